@@ -0,0 +1,125 @@
+// Command categorymap links expenses recorded with free-text categories to
+// the managed category tree.
+//
+// Without flags it prints every unlinked free-text category as CSV, with the
+// closest existing category filled in as a suggestion:
+//
+//	categorymap > mapping.csv
+//
+// After reviewing the category column, apply the mapping. Rows with an empty
+// category are skipped, -create adds categories that do not exist yet, and
+// nothing is written without -apply:
+//
+//	categorymap -mapping mapping.csv -create -apply
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"ledgerly/db"
+	"ledgerly/services"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	mappingFile := flag.String("mapping", "", "CSV file with value and category columns")
+	create := flag.Bool("create", false, "create categories that do not exist")
+	apply := flag.Bool("apply", false, "write the changes (default is a dry run)")
+	flag.Parse()
+
+	_ = godotenv.Load()
+	db.InitDB()
+	categoryService := &services.CategoryService{}
+
+	if *mappingFile == "" {
+		if err := printLegacyCategories(categoryService); err != nil {
+			fmt.Fprintln(os.Stderr, "Error listing categories:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	mapping, err := readMapping(*mappingFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading mapping:", err)
+		os.Exit(1)
+	}
+
+	result, err := categoryService.MapLegacyCategories(mapping, *create, *apply)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error mapping categories:", err)
+		os.Exit(1)
+	}
+
+	if !*apply {
+		fmt.Println("Dry run, nothing was written. Re-run with -apply to save.")
+	}
+	fmt.Println("Expenses linked:", result.Expenses)
+	fmt.Println("Budgets renamed:", result.Budgets)
+	if len(result.Created) > 0 {
+		fmt.Println("Categories created:", strings.Join(result.Created, ", "))
+	}
+}
+
+func printLegacyCategories(categoryService *services.CategoryService) error {
+	legacy, err := categoryService.ListLegacyCategories()
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	_ = w.Write([]string{"value", "expenses", "category"})
+	for _, l := range legacy {
+		_ = w.Write([]string{l.Value, strconv.FormatInt(l.Expenses, 10), l.Suggested})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// readMapping reads a CSV with a header row naming the value and category
+// columns, as printed without flags.
+func readMapping(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("mapping file is empty")
+	}
+
+	valueCol, categoryCol := -1, -1
+	for i, name := range rows[0] {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "value":
+			valueCol = i
+		case "category":
+			categoryCol = i
+		}
+	}
+	if valueCol < 0 || categoryCol < 0 {
+		return nil, errors.New("mapping file needs value and category columns")
+	}
+
+	mapping := make(map[string]string)
+	for _, row := range rows[1:] {
+		if valueCol >= len(row) || categoryCol >= len(row) {
+			continue
+		}
+		mapping[row[valueCol]] = row[categoryCol]
+	}
+	return mapping, nil
+}
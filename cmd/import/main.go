@@ -0,0 +1,117 @@
+// Command import records expenses or petty cash transactions from a CSV or
+// XLSX file, as the /imports endpoints do.
+//
+// Columns are read by field name unless mapped with -map. Nothing is written
+// without -apply, so a first run validates the file and reports each row:
+//
+//	import -kind expenses -user admin -map title=Description,expense_date=Date ledger.xlsx
+//	import -kind expenses -user admin -map title=Description,expense_date=Date -apply ledger.xlsx
+//
+// Rows belong to -user unless the file has a user column of usernames.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"ledgerly/db"
+	"ledgerly/models"
+	"ledgerly/services"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	kind := flag.String("kind", services.ImportKindExpenses, "what to import: expenses or transactions")
+	username := flag.String("user", "", "username rows are recorded for and the import is audited as")
+	mappingFlag := flag.String("map", "", "comma-separated field=column pairs mapping fields to column headers")
+	mode := flag.String("mode", services.ImportModeAllOrNothing, "all_or_nothing or skip_invalid")
+	apply := flag.Bool("apply", false, "write the rows (default is a dry run)")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: import [flags] file.csv|file.xlsx")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || *username == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	mapping, err := parseMapping(*mappingFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading -map:", err)
+		os.Exit(2)
+	}
+
+	_ = godotenv.Load()
+	db.InitDB()
+
+	var user models.User
+	if err := db.DB.Where("username = ?", *username).First(&user).Error; err != nil {
+		fmt.Fprintf(os.Stderr, "Error finding user %q: %v\n", *username, err)
+		os.Exit(1)
+	}
+
+	path := flag.Arg(0)
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error opening file:", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	result, err := (&services.ImportService{}).Import(f, services.ImportOptions{
+		Kind:     *kind,
+		Filename: filepath.Base(path),
+		Mapping:  mapping,
+		Mode:     *mode,
+		DryRun:   !*apply,
+		UserID:   strconv.FormatUint(uint64(user.ID), 10),
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error importing:", err)
+		os.Exit(1)
+	}
+
+	for _, line := range result.Lines {
+		switch line.Status {
+		case services.ImportRowInvalid:
+			fmt.Printf("row %d: invalid: %s\n", line.Row, line.Error)
+		case services.ImportRowDuplicate:
+			fmt.Printf("row %d: duplicate of #%d\n", line.Row, line.DuplicateOf)
+		}
+	}
+	if !*apply {
+		fmt.Println("Dry run, nothing was written. Re-run with -apply to save.")
+	} else if !result.Committed {
+		fmt.Println("Nothing was written because some rows are invalid. Fix them or use -mode skip_invalid.")
+	}
+	fmt.Println("Rows:", result.Rows)
+	fmt.Println("Imported:", result.Imported)
+	fmt.Println("Valid, not imported:", result.Valid)
+	fmt.Println("Invalid:", result.Invalid)
+	fmt.Println("Duplicates:", result.Duplicates)
+	if result.Invalid > 0 && result.Mode == services.ImportModeAllOrNothing {
+		os.Exit(1)
+	}
+}
+
+// parseMapping parses field=column pairs separated by commas.
+func parseMapping(value string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	if value == "" {
+		return mapping, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		field, column, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(field) == "" || strings.TrimSpace(column) == "" {
+			return nil, errors.New("mapping pairs must look like field=column")
+		}
+		mapping[strings.TrimSpace(field)] = strings.TrimSpace(column)
+	}
+	return mapping, nil
+}
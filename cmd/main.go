@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"log/slog"
 	"ledgerly/db"
 	"ledgerly/routes"
+	"ledgerly/services"
 	"os"
+	_ "time/tzdata" // Report timezones work without system zoneinfo
 
 	_ "ledgerly/docs" // Swagger docs
 
@@ -31,6 +34,7 @@ func main() {
 	}
 
 	db.InitDB()
+	services.StartRecurringScheduler(context.Background())
 
 	r := routes.SetupRouter()
 
@@ -34,4 +34,12 @@ func main() {
 	} else {
 		fmt.Println("Employee created")
 	}
+
+	categoryService := &services.CategoryService{}
+	for _, name := range []string{"Travel", "Meals", "Office Supplies", "Postage", "Miscellaneous"} {
+		if err := categoryService.CreateCategory(&models.Category{Name: name}); err != nil {
+			fmt.Println("Error creating category:", err)
+		}
+	}
+	fmt.Println("Categories created")
 }
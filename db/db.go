@@ -4,6 +4,7 @@ import (
 	"log/slog"
 	"ledgerly/models"
 	"os"
+	"time"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -20,17 +21,64 @@ func InitDB() {
 	
 	slog.Info("Initializing database", "path", dbPath)
 	
-	DB, err = gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	// Timestamps are stored in UTC so date range comparisons stay consistent
+	DB, err = gorm.Open(sqlite.Open(dbPath), &gorm.Config{
+		NowFunc: func() time.Time { return time.Now().UTC() },
+	})
 	if err != nil {
 		slog.Error("Failed to connect database", "error", err)
 		os.Exit(1)
 	}
 
 	slog.Info("Running auto-migrations")
-	err = DB.AutoMigrate(&models.PettyCashTransaction{}, &models.Expense{}, &models.User{})
+	err = DB.AutoMigrate(
+		&models.PettyCashTransaction{},
+		&models.Expense{},
+		&models.ExpenseSplit{},
+		&models.User{},
+		&models.AccountingPeriod{},
+		&models.AuditLog{},
+		&models.BalanceCheckpoint{},
+		&models.Fund{},
+		&models.Reconciliation{},
+		&models.CashCountLine{},
+		&models.Budget{},
+		&models.BudgetAlert{},
+		&models.Notification{},
+		&models.Category{},
+		&models.SpendingLimit{},
+		&models.PolicyRule{},
+		&models.PolicyViolation{},
+		&models.DuplicateFlag{},
+		&models.Reimbursement{},
+		&models.ReimbursementBatch{},
+		&models.BankAccount{},
+		&models.CashAdvance{},
+		&models.ExpenseReport{},
+		&models.ExchangeRate{},
+		&models.TaxCode{},
+		&models.Vendor{},
+		&models.Dimension{},
+		&models.DimensionValue{},
+		&models.RecurringTemplate{},
+		&models.RecurringRun{},
+		&models.MileageRate{},
+		&models.PerDiemRate{},
+		&models.Refund{},
+		&models.AccountingExportProfile{},
+		&models.AccountMapping{},
+		&models.AccountingExport{},
+		&models.AccountingExportRecord{},
+		&models.BankStatement{},
+		&models.BankStatementLine{},
+	)
 	if err != nil {
 		slog.Error("Failed to migrate database", "error", err)
 		os.Exit(1)
 	}
+	if err := runMigrations(); err != nil {
+		slog.Error("Failed to run data migrations", "error", err)
+		os.Exit(1)
+	}
 	slog.Info("Database initialized successfully")
 }
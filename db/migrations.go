@@ -0,0 +1,108 @@
+package db
+
+import (
+	"ledgerly/models"
+	"log/slog"
+)
+
+// runMigrations applies data migrations that AutoMigrate cannot express.
+// Each step must be safe to run on every start.
+func runMigrations() error {
+	if err := ensureDefaultFund(); err != nil {
+		return err
+	}
+	if err := ensureDefaultDimensions(); err != nil {
+		return err
+	}
+	if err := dropLegacyIndexes(); err != nil {
+		return err
+	}
+
+	base := models.BaseCurrency()
+	steps := []struct {
+		name string
+		sql  string
+		args []interface{}
+	}{
+		{"backfill petty cash transaction dates", "UPDATE petty_cash_transactions SET transaction_date = created_at WHERE transaction_date IS NULL", nil},
+		{"backfill expense dates", "UPDATE expenses SET expense_date = created_at WHERE expense_date IS NULL", nil},
+		{"assign transactions to the default fund", "UPDATE petty_cash_transactions SET fund_id = (SELECT min(id) FROM funds WHERE deleted_at IS NULL) WHERE fund_id IS NULL OR fund_id = 0", nil},
+		{"drop checkpoints without a fund", "DELETE FROM balance_checkpoints WHERE fund_id IS NULL", nil},
+		{"approve expenses recorded before approvals", "UPDATE expenses SET status = 'approved' WHERE status IS NULL OR status = ''", nil},
+		{"count expenses recorded before attendees as one person", "UPDATE expenses SET attendees = 1 WHERE attendees IS NULL OR attendees = 0", nil},
+		{"put funds recorded before currencies in the base currency", "UPDATE funds SET currency = ? WHERE currency IS NULL OR currency = ''", []interface{}{base}},
+		{"put transactions in their fund's currency", "UPDATE petty_cash_transactions SET currency = (SELECT currency FROM funds WHERE funds.id = petty_cash_transactions.fund_id), exchange_rate = 1, base_amount = amount WHERE currency IS NULL OR currency = ''", nil},
+		{"put advances in their fund's currency", "UPDATE cash_advances SET currency = (SELECT currency FROM funds WHERE funds.id = cash_advances.fund_id) WHERE currency IS NULL OR currency = ''", nil},
+		{"put expenses recorded before currencies in the base currency", "UPDATE expenses SET currency = ?, exchange_rate = 1, base_amount = amount WHERE currency IS NULL OR currency = ''", []interface{}{base}},
+		{"treat expenses recorded before tax capture as exempt", "UPDATE expenses SET tax_rate = 0, tax_amount = 0, net_amount = amount WHERE net_amount IS NULL", nil},
+		{"apply budgets recorded before departments to every department", "UPDATE budgets SET department = '' WHERE department IS NULL", nil},
+		{"treat expenses recorded before expense types as receipts", "UPDATE expenses SET type = 'receipt' WHERE type IS NULL OR type = ''", nil},
+	}
+
+	for _, step := range steps {
+		result := DB.Exec(step.sql, step.args...)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			slog.Info("Data migration applied", "step", step.name, "rows", result.RowsAffected)
+		}
+	}
+	return nil
+}
+
+// ensureDefaultFund creates the fund that existing and unassigned
+// transactions belong to.
+func ensureDefaultFund() error {
+	var count int64
+	if err := DB.Model(&models.Fund{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	slog.Info("Creating default petty cash fund")
+	return DB.Create(&models.Fund{Name: "Main", Currency: models.BaseCurrency(), Active: true}).Error
+}
+
+// ensureDefaultDimensions creates the department, cost center and project
+// dimensions on first start. They are optional until an admin adds values and
+// marks them required.
+func ensureDefaultDimensions() error {
+	var count int64
+	if err := DB.Model(&models.Dimension{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	slog.Info("Creating default dimensions")
+	return DB.Create(&[]models.Dimension{
+		{Code: models.DimensionDepartment, Name: "Department", Active: true},
+		{Code: "cost_center", Name: "Cost center", Active: true},
+		{Code: "project", Name: "Project", Active: true},
+	}).Error
+}
+
+// dropLegacyIndexes removes indexes that were replaced by wider ones.
+func dropLegacyIndexes() error {
+	legacy := []struct {
+		model interface{}
+		name  string
+	}{
+		// Checkpoints became per fund
+		{&models.BalanceCheckpoint{}, "idx_balance_checkpoints_date"},
+		// Refunds can add a second line per expense
+		{&models.Reimbursement{}, "idx_reimbursements_expense_id"},
+	}
+
+	for _, idx := range legacy {
+		if DB.Migrator().HasIndex(idx.model, idx.name) {
+			slog.Info("Dropping legacy index", "index", idx.name)
+			if err := DB.Migrator().DropIndex(idx.model, idx.name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
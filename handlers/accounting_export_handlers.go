@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"ledgerly/models"
+	"ledgerly/services"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateAccountingExportRequest selects what an accounting export holds.
+type CreateAccountingExportRequest struct {
+	ProfileID uint   `json:"profile_id" binding:"required"`
+	From      string `json:"from" binding:"required" example:"2026-09-01"`
+	To        string `json:"to" binding:"required" example:"2026-09-30"`
+	DryRun    bool   `json:"dry_run"`
+}
+
+// CreateAccountingProfile godoc
+// @Summary Create accounting export profile
+// @Description Create a profile mapping categories to the accounts of an external accounting system, with the journal format it imports (quickbooks_iif, xero_csv or tally_xml). Categories without a mapping use the mapping or GL account of their closest ancestor, then default_account. Expenses are credited to petty_cash_account when paid from petty cash and to payable_account otherwise.
+// @Tags Accounting Exports
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param profile body models.AccountingExportProfile true "Profile"
+// @Success 201 {object} models.AccountingExportProfile
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /accounting-export-profiles [post]
+func (h *Handler) CreateAccountingProfile(c *gin.Context) {
+	var profile models.AccountingExportProfile
+	if err := c.ShouldBindJSON(&profile); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.AccountingExportService.CreateProfile(&profile, currentUserID(c)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, profile)
+}
+
+// ListAccountingProfiles godoc
+// @Summary List accounting export profiles
+// @Description Get all accounting export profiles with their account mappings
+// @Tags Accounting Exports
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.AccountingExportProfile
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounting-export-profiles [get]
+func (h *Handler) ListAccountingProfiles(c *gin.Context) {
+	profiles, err := h.AccountingExportService.ListProfiles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, profiles)
+}
+
+// GetAccountingProfile godoc
+// @Summary Get accounting export profile
+// @Description Get an accounting export profile with its account mappings
+// @Tags Accounting Exports
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Profile ID"
+// @Success 200 {object} models.AccountingExportProfile
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /accounting-export-profiles/{id} [get]
+func (h *Handler) GetAccountingProfile(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	profile, err := h.AccountingExportService.GetProfile(id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+// UpdateAccountingProfile godoc
+// @Summary Update accounting export profile
+// @Description Update an accounting export profile's settings and account mappings; fields left out keep their current values, and accounts, when given, replaces all mappings. What was already exported stays exported.
+// @Tags Accounting Exports
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Profile ID"
+// @Param profile body models.AccountingExportProfile true "Profile"
+// @Success 200 {object} models.AccountingExportProfile
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /accounting-export-profiles/{id} [put]
+func (h *Handler) UpdateAccountingProfile(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	// Fields left out of the request keep their stored values
+	changes, err := h.AccountingExportService.GetProfile(id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.ShouldBindJSON(changes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	profile, err := h.AccountingExportService.UpdateProfile(id, changes, currentUserID(c))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+// DeleteAccountingProfile godoc
+// @Summary Delete accounting export profile
+// @Description Delete an accounting export profile that has no exports. Profiles with exports can be deactivated instead.
+// @Tags Accounting Exports
+// @Security BearerAuth
+// @Param id path int true "Profile ID"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /accounting-export-profiles/{id} [delete]
+func (h *Handler) DeleteAccountingProfile(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.AccountingExportService.DeleteProfile(id, currentUserID(c)); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// CreateAccountingExport godoc
+// @Summary Create accounting export
+// @Description Export the journal of the approved expenses, and refunds of approved expenses, dated from and to (inclusive) that the profile has not exported yet. Each expense debits its category accounts, and tax to the profile's tax account if it has one, and credits petty cash or the employee payable in the base currency; refunds reverse their share. What is exported is recorded so later exports of the profile leave it out. With dry_run the export is previewed without recording anything.
+// @Tags Accounting Exports
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param export body CreateAccountingExportRequest true "Profile and date range"
+// @Success 201 {object} models.AccountingExport
+// @Success 200 {object} models.AccountingExport "Dry run"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /accounting-exports [post]
+func (h *Handler) CreateAccountingExport(c *gin.Context) {
+	var req CreateAccountingExportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, _, err := parseDate(req.From, time.UTC)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from date"})
+		return
+	}
+	to, _, err := parseDate(req.To, time.UTC)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to date"})
+		return
+	}
+
+	export, err := h.AccountingExportService.CreateExport(services.AccountingExportRequest{
+		ProfileID: req.ProfileID,
+		From:      from,
+		To:        to,
+		DryRun:    req.DryRun,
+	}, currentUserID(c))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if req.DryRun {
+		c.JSON(http.StatusOK, export)
+		return
+	}
+	c.JSON(http.StatusCreated, export)
+}
+
+// ListAccountingExports godoc
+// @Summary List accounting exports
+// @Description Get accounting exports, newest first
+// @Tags Accounting Exports
+// @Produce json
+// @Security BearerAuth
+// @Param profile_id query int false "Filter by profile"
+// @Success 200 {array} models.AccountingExport
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /accounting-exports [get]
+func (h *Handler) ListAccountingExports(c *gin.Context) {
+	profileID, ok := parseUintQuery(c, "profile_id")
+	if !ok {
+		return
+	}
+
+	exports, err := h.AccountingExportService.ListExports(profileID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, exports)
+}
+
+// GetAccountingExport godoc
+// @Summary Get accounting export
+// @Description Get an accounting export with its profile
+// @Tags Accounting Exports
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Export ID"
+// @Success 200 {object} models.AccountingExport
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /accounting-exports/{id} [get]
+func (h *Handler) GetAccountingExport(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	export, err := h.AccountingExportService.GetExport(id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, export)
+}
+
+// DownloadAccountingExport godoc
+// @Summary Download accounting export
+// @Description Download the journal file of an export that was not voided: a QuickBooks IIF file, a Xero manual journal CSV or Tally XML vouchers
+// @Tags Accounting Exports
+// @Produce plain
+// @Produce text/csv
+// @Produce xml
+// @Security BearerAuth
+// @Param id path int true "Export ID"
+// @Success 200 {file} file
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /accounting-exports/{id}/download [get]
+func (h *Handler) DownloadAccountingExport(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	file, err := h.AccountingExportService.DownloadExport(id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="`+file.Filename+`"`)
+	c.Data(http.StatusOK, file.ContentType, file.Content)
+}
+
+// VoidAccountingExport godoc
+// @Summary Void accounting export
+// @Description Mark an export as not imported, for example because the accounting system rejected it, so its expenses and refunds go into the next export of the profile
+// @Tags Accounting Exports
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Export ID"
+// @Success 200 {object} models.AccountingExport
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /accounting-exports/{id}/void [post]
+func (h *Handler) VoidAccountingExport(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	export, err := h.AccountingExportService.VoidExport(id, currentUserID(c))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, export)
+}
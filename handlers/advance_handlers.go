@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"ledgerly/models"
+	"ledgerly/services"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IssueAdvance godoc
+// @Summary Issue cash advance
+// @Description Pay cash out of a fund to an employee ahead of their spending. The advance is due ADVANCE_DUE_DAYS after issue unless due_date is given. Employees with overdue advances are refused with the advance_overdue error code.
+// @Tags Advances
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param advance body models.CashAdvance true "Advance details"
+// @Success 201 {object} models.CashAdvance
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /advances [post]
+func (h *Handler) IssueAdvance(c *gin.Context) {
+	var advance models.CashAdvance
+	if err := c.ShouldBindJSON(&advance); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.AdvanceService.IssueAdvance(&advance, currentUserID(c)); err != nil {
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	c.JSON(http.StatusCreated, advance)
+}
+
+// ListAdvances godoc
+// @Summary List cash advances
+// @Description Get cash advances in issue order
+// @Tags Advances
+// @Produce json
+// @Security BearerAuth
+// @Param user_id query string false "Filter by employee"
+// @Param fund_id query int false "Filter by fund"
+// @Param status query string false "Filter by status (outstanding, settled)"
+// @Success 200 {array} models.CashAdvance
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /advances [get]
+func (h *Handler) ListAdvances(c *gin.Context) {
+	fundID, ok := parseUintQuery(c, "fund_id")
+	if !ok {
+		return
+	}
+
+	advances, err := h.AdvanceService.ListAdvances(services.AdvanceFilter{
+		UserID: c.Query("user_id"),
+		FundID: fundID,
+		Status: models.CashAdvanceStatus(c.Query("status")),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, advances)
+}
+
+// ListMyAdvances godoc
+// @Summary List my cash advances
+// @Description Get the current user's cash advances
+// @Tags Advances
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "Filter by status (outstanding, settled)"
+// @Success 200 {array} models.CashAdvance
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /me/advances [get]
+func (h *Handler) ListMyAdvances(c *gin.Context) {
+	advances, err := h.AdvanceService.ListAdvances(services.AdvanceFilter{
+		UserID: currentUserID(c),
+		Status: models.CashAdvanceStatus(c.Query("status")),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, advances)
+}
+
+// GetAdvance godoc
+// @Summary Get cash advance
+// @Description Get a cash advance with its issuing transaction and the expenses liquidating it
+// @Tags Advances
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Advance ID"
+// @Success 200 {object} models.CashAdvance
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /advances/{id} [get]
+func (h *Handler) GetAdvance(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	advance, err := h.AdvanceService.GetAdvance(id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, advance)
+}
+
+// LiquidateAdvance godoc
+// @Summary Liquidate cash advance
+// @Description Link the employee's expenses paid with an advance and credit the change they returned to the fund. Linked expenses are no longer reimbursed. The advance is settled once nothing is outstanding.
+// @Tags Advances
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Advance ID"
+// @Param liquidation body services.Liquidation true "Expenses and change"
+// @Success 200 {object} models.CashAdvance
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /advances/{id}/liquidate [post]
+func (h *Handler) LiquidateAdvance(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	var liquidation services.Liquidation
+	if err := c.ShouldBindJSON(&liquidation); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	advance, err := h.AdvanceService.LiquidateAdvance(id, liquidation, currentUserID(c))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, advance)
+}
+
+// GetAdvanceAgeingReport godoc
+// @Summary Get outstanding advances report
+// @Description Get the advances not yet fully liquidated, aged by days past their due date (current, 1-30, 31-60, 61-90, 90+)
+// @Tags Reports
+// @Produce json
+// @Security BearerAuth
+// @Param date query string false "Report date (YYYY-MM-DD), defaults to today"
+// @Success 200 {object} services.AdvanceAgeingReport
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /reports/outstanding-advances [get]
+func (h *Handler) GetAdvanceAgeingReport(c *gin.Context) {
+	date := time.Now().UTC()
+	if v := c.Query("date"); v != "" {
+		var err error
+		if date, _, err = parseDate(v, time.UTC); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid date"})
+			return
+		}
+	}
+
+	report, err := h.ReportingService.GetAdvanceAgeingReport(date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"encoding/json"
+	"ledgerly/models"
+	"ledgerly/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MatchBankLineRequest names the top-up a withdrawal funded.
+type MatchBankLineRequest struct {
+	TransactionID uint `json:"transaction_id" binding:"required"`
+}
+
+// BankMatchingResult reports a matching run.
+type BankMatchingResult struct {
+	Matched int `json:"matched"`
+}
+
+// ImportBankStatement godoc
+// @Summary Import bank statement
+// @Description Import a statement of the bank account petty cash is topped up from, as OFX, camt.053 XML, or CSV or XLSX (max 20 MB), detected from the file unless format is given. CSV and XLSX statements are read from the columns date, amount (negative for withdrawals), currency, reference, description, counterparty and id unless mapping names others, with dates as YYYY-MM-DD, DD.MM.YYYY or DD/MM/YYYY. Lines already imported are skipped and deposits are ignored. Withdrawals are matched to unmatched top-ups of the same amount and currency dated within BANK_MATCH_WINDOW_DAYS, preferring a top-up whose reference appears on the line; ambiguous lines are left for manual matching. With dry_run nothing is recorded.
+// @Tags Bank Statements
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file true "OFX, camt.053, CSV or XLSX file"
+// @Param format formData string false "ofx, camt053 or csv"
+// @Param account formData string false "Account the CSV or XLSX statement is of"
+// @Param currency formData string false "Currency of CSV or XLSX lines without one, defaults to the base currency"
+// @Param mapping formData string false "JSON object mapping fields to column headers, e.g. {\"date\":\"Booking date\"}"
+// @Param dry_run formData bool false "Report without importing"
+// @Success 201 {object} services.BankStatementImportResult
+// @Success 200 {object} services.BankStatementImportResult "Dry run"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /bank-statements [post]
+func (h *Handler) ImportBankStatement(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportFileSize)
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "statement file is required"})
+		return
+	}
+
+	opts := services.BankStatementImportOptions{
+		Filename: header.Filename,
+		Format:   models.BankStatementFormat(c.PostForm("format")),
+		Account:  c.PostForm("account"),
+		Currency: c.PostForm("currency"),
+		DryRun:   c.PostForm("dry_run") == "true",
+		UserID:   currentUserID(c),
+	}
+	if mapping := c.PostForm("mapping"); mapping != "" {
+		if err := json.Unmarshal([]byte(mapping), &opts.Mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "mapping must be a JSON object of field names to column headers"})
+			return
+		}
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	result, err := h.BankStatementService.ImportStatement(file, opts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if opts.DryRun {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+	c.JSON(http.StatusCreated, result)
+}
+
+// ListBankStatements godoc
+// @Summary List bank statements
+// @Description Get imported bank statements, newest first, without their lines
+// @Tags Bank Statements
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.BankStatement
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /bank-statements [get]
+func (h *Handler) ListBankStatements(c *gin.Context) {
+	statements, err := h.BankStatementService.ListStatements()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, statements)
+}
+
+// GetBankStatement godoc
+// @Summary Get bank statement
+// @Description Get an imported bank statement with its lines and the top-ups they are matched to
+// @Tags Bank Statements
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Statement ID"
+// @Success 200 {object} models.BankStatement
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /bank-statements/{id} [get]
+func (h *Handler) GetBankStatement(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	statement, err := h.BankStatementService.GetStatement(id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, statement)
+}
+
+// RunBankMatching godoc
+// @Summary Match bank statement lines
+// @Description Match every unmatched withdrawal that can be matched automatically to a top-up, such as after top-ups were entered late
+// @Tags Bank Statements
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} BankMatchingResult
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /bank-statements/match [post]
+func (h *Handler) RunBankMatching(c *gin.Context) {
+	matched, err := h.BankStatementService.RunMatching(currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, BankMatchingResult{Matched: matched})
+}
+
+// ListBankStatementLines godoc
+// @Summary List bank statement lines
+// @Description Get bank statement lines by booking date, with the top-ups they are matched to
+// @Tags Bank Statements
+// @Produce json
+// @Security BearerAuth
+// @Param statement_id query int false "Filter by statement"
+// @Param status query string false "Filter by status (unmatched, matched, ignored)"
+// @Param from query string false "Booked from (YYYY-MM-DD)"
+// @Param to query string false "Booked to, inclusive (YYYY-MM-DD)"
+// @Success 200 {array} models.BankStatementLine
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /bank-statement-lines [get]
+func (h *Handler) ListBankStatementLines(c *gin.Context) {
+	dates, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+	statementID, ok := parseUintQuery(c, "statement_id")
+	if !ok {
+		return
+	}
+
+	lines, err := h.BankStatementService.ListLines(services.BankLineFilter{
+		StatementID: statementID,
+		Status:      models.BankLineStatus(c.Query("status")),
+		Dates:       dates,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, lines)
+}
+
+// ListBankMatchCandidates godoc
+// @Summary List match candidates
+// @Description Get the unmatched top-ups of a withdrawal's amount and currency, closest in date first, to match it to by hand
+// @Tags Bank Statements
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Line ID"
+// @Success 200 {array} models.PettyCashTransaction
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /bank-statement-lines/{id}/candidates [get]
+func (h *Handler) ListBankMatchCandidates(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	candidates, err := h.BankStatementService.MatchCandidates(id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, candidates)
+}
+
+// MatchBankStatementLine godoc
+// @Summary Match bank statement line
+// @Description Match an unmatched withdrawal to the top-up it funded, which must be of the same amount and currency and not matched to another line
+// @Tags Bank Statements
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Line ID"
+// @Param match body MatchBankLineRequest true "Top-up transaction"
+// @Success 200 {object} models.BankStatementLine
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /bank-statement-lines/{id}/match [post]
+func (h *Handler) MatchBankStatementLine(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	var req MatchBankLineRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	line, err := h.BankStatementService.MatchLine(id, req.TransactionID, currentUserID(c))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, line)
+}
+
+// UnmatchBankStatementLine godoc
+// @Summary Unmatch bank statement line
+// @Description Return a matched or ignored withdrawal to the unmatched lines, releasing its top-up. The next matching run may match it automatically again.
+// @Tags Bank Statements
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Line ID"
+// @Success 200 {object} models.BankStatementLine
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /bank-statement-lines/{id}/unmatch [post]
+func (h *Handler) UnmatchBankStatementLine(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	line, err := h.BankStatementService.UnmatchLine(id, currentUserID(c))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, line)
+}
+
+// IgnoreBankStatementLine godoc
+// @Summary Ignore bank statement line
+// @Description Mark an unmatched withdrawal as not funding petty cash, such as another payment from the same account, so it leaves the unreconciled report
+// @Tags Bank Statements
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Line ID"
+// @Success 200 {object} models.BankStatementLine
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /bank-statement-lines/{id}/ignore [post]
+func (h *Handler) IgnoreBankStatementLine(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	line, err := h.BankStatementService.IgnoreLine(id, currentUserID(c))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, line)
+}
+
+// GetBankReconciliationReport godoc
+// @Summary Get unreconciled bank items
+// @Description Get the withdrawals on imported statements no top-up was matched to and the top-ups no withdrawal was matched to, with totals per currency
+// @Tags Reports
+// @Produce json
+// @Security BearerAuth
+// @Param fund_id query int false "Filter top-ups by fund"
+// @Param from query string false "Dated from (YYYY-MM-DD)"
+// @Param to query string false "Dated to, inclusive (YYYY-MM-DD)"
+// @Success 200 {object} services.BankReconciliationReport
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /reports/bank-reconciliation [get]
+func (h *Handler) GetBankReconciliationReport(c *gin.Context) {
+	dates, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+	fundID, ok := parseUintQuery(c, "fund_id")
+	if !ok {
+		return
+	}
+
+	report, err := h.ReportingService.GetBankReconciliationReport(dates, fundID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"ledgerly/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateBudget godoc
+// @Summary Create budget
+// @Description Create a spending budget for a category, optionally limited to one fund or user. The start date is moved to the beginning of its period.
+// @Tags Budgets
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param budget body models.Budget true "Budget details"
+// @Success 201 {object} models.Budget
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /budgets [post]
+func (h *Handler) CreateBudget(c *gin.Context) {
+	var budget models.Budget
+	if err := c.ShouldBindJSON(&budget); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.BudgetService.CreateBudget(&budget); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, budget)
+}
+
+// ListBudgets godoc
+// @Summary List budgets
+// @Description Get all budgets
+// @Tags Budgets
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Budget
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /budgets [get]
+func (h *Handler) ListBudgets(c *gin.Context) {
+	budgets, err := h.BudgetService.ListBudgets()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, budgets)
+}
+
+// UpdateBudget godoc
+// @Summary Update budget
+// @Description Update a budget's settings; fields left out keep their current values. Set active to false to suspend it.
+// @Tags Budgets
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Budget ID"
+// @Param budget body models.Budget true "Budget details"
+// @Success 200 {object} models.Budget
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /budgets/{id} [put]
+func (h *Handler) UpdateBudget(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	// Fields left out of the request keep their stored values
+	changes, err := h.BudgetService.GetBudget(id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.ShouldBindJSON(changes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	budget, err := h.BudgetService.UpdateBudget(id, changes)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, budget)
+}
+
+// DeleteBudget godoc
+// @Summary Delete budget
+// @Description Delete a budget
+// @Tags Budgets
+// @Security BearerAuth
+// @Param id path int true "Budget ID"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /budgets/{id} [delete]
+func (h *Handler) DeleteBudget(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.BudgetService.DeleteBudget(id); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetBudgetVsActual godoc
+// @Summary Get budget vs actual
+// @Description Compare each budget in force on the date with the spend in its current period
+// @Tags Reports
+// @Produce json
+// @Security BearerAuth
+// @Param date query string false "Report date (YYYY-MM-DD), defaults to today"
+// @Success 200 {object} services.BudgetReport
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /reports/budget-vs-actual [get]
+func (h *Handler) GetBudgetVsActual(c *gin.Context) {
+	date := time.Now().UTC()
+	if v := c.Query("date"); v != "" {
+		var err error
+		if date, _, err = parseDate(v, time.UTC); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid date"})
+			return
+		}
+	}
+
+	report, err := h.ReportingService.GetBudgetVsActual(date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
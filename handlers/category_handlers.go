@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"ledgerly/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateCategory godoc
+// @Summary Create category
+// @Description Create an expense category, optionally below a parent category, with its GL account and expense rules
+// @Tags Categories
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param category body models.Category true "Category details"
+// @Success 201 {object} models.Category
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /categories [post]
+func (h *Handler) CreateCategory(c *gin.Context) {
+	var category models.Category
+	if err := c.ShouldBindJSON(&category); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.CategoryService.CreateCategory(&category); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, category)
+}
+
+// ListCategories godoc
+// @Summary List categories
+// @Description Get expense categories by name, or as a tree of top-level categories with their subcategories
+// @Tags Categories
+// @Produce json
+// @Security BearerAuth
+// @Param active query bool false "Only active categories"
+// @Param tree query bool false "Return the category tree"
+// @Success 200 {array} models.Category
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /categories [get]
+func (h *Handler) ListCategories(c *gin.Context) {
+	activeOnly := c.Query("active") == "true"
+	if c.Query("tree") == "true" {
+		tree, err := h.CategoryService.GetCategoryTree(activeOnly)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, tree)
+		return
+	}
+
+	categories, err := h.CategoryService.ListCategories(activeOnly)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, categories)
+}
+
+// GetCategory godoc
+// @Summary Get category
+// @Description Get an expense category
+// @Tags Categories
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Category ID"
+// @Success 200 {object} models.Category
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /categories/{id} [get]
+func (h *Handler) GetCategory(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	category, err := h.CategoryService.GetCategory(id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, category)
+}
+
+// UpdateCategory godoc
+// @Summary Update category
+// @Description Update a category's settings; fields left out keep their current values. Renaming also renames it on existing expenses and budgets.
+// @Tags Categories
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Category ID"
+// @Param category body models.Category true "Category details"
+// @Success 200 {object} models.Category
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /categories/{id} [put]
+func (h *Handler) UpdateCategory(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	// Fields left out of the request keep their stored values
+	changes, err := h.CategoryService.GetCategory(id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.ShouldBindJSON(changes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	category, err := h.CategoryService.UpdateCategory(id, changes)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, category)
+}
+
+// DeleteCategory godoc
+// @Summary Delete category
+// @Description Delete an unused category without subcategories; used categories must be deactivated instead
+// @Tags Categories
+// @Security BearerAuth
+// @Param id path int true "Category ID"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /categories/{id} [delete]
+func (h *Handler) DeleteCategory(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.CategoryService.DeleteCategory(id); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"ledgerly/models"
+	"ledgerly/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetExchangeRate godoc
+// @Summary Set exchange rate
+// @Description Set the value of one unit of a currency in the base currency from a date on, replacing any rate already set for that date
+// @Tags Currencies
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param rate body models.ExchangeRate true "Currency, date and rate"
+// @Success 200 {object} models.ExchangeRate
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /exchange-rates [post]
+func (h *Handler) SetExchangeRate(c *gin.Context) {
+	var rate models.ExchangeRate
+	if err := c.ShouldBindJSON(&rate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.CurrencyService.SetRate(&rate, currentUserID(c)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rate)
+}
+
+// ListExchangeRates godoc
+// @Summary List exchange rates
+// @Description Get exchange rates to the base currency, newest first per currency
+// @Tags Currencies
+// @Produce json
+// @Security BearerAuth
+// @Param currency query string false "Filter by currency"
+// @Param from query string false "Rate date from (YYYY-MM-DD)"
+// @Param to query string false "Rate date to, inclusive (YYYY-MM-DD)"
+// @Success 200 {array} models.ExchangeRate
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /exchange-rates [get]
+func (h *Handler) ListExchangeRates(c *gin.Context) {
+	dates, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+
+	rates, err := h.CurrencyService.ListRates(services.RateFilter{Currency: c.Query("currency"), Dates: dates})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rates)
+}
+
+// DeleteExchangeRate godoc
+// @Summary Delete exchange rate
+// @Description Delete an exchange rate. Amounts already converted with it keep their base-currency value.
+// @Tags Currencies
+// @Security BearerAuth
+// @Param id path int true "Exchange rate ID"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /exchange-rates/{id} [delete]
+func (h *Handler) DeleteExchangeRate(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.CurrencyService.DeleteRate(id, currentUserID(c)); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// maxRateFileSize caps exchange rate imports.
+const maxRateFileSize = 5 << 20
+
+// ImportExchangeRates godoc
+// @Summary Import exchange rates
+// @Description Load exchange rates from a CSV (max 5 MB) with currency, date (YYYY-MM-DD) and rate columns. Nothing is imported if any line is invalid.
+// @Tags Currencies
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file true "Rate CSV"
+// @Success 200 {object} services.RateImport
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /exchange-rates/import [post]
+func (h *Handler) ImportExchangeRates(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxRateFileSize)
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "rate file is required"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	result, err := h.CurrencyService.ImportRates(file, currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"ledgerly/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateDimension godoc
+// @Summary Create dimension
+// @Description Create a dimension, such as a department or project, that expenses and petty cash transactions can be tagged with. Required dimensions must be tagged on every submitted expense.
+// @Tags Dimensions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param dimension body models.Dimension true "Dimension details"
+// @Success 201 {object} models.Dimension
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /dimensions [post]
+func (h *Handler) CreateDimension(c *gin.Context) {
+	var dimension models.Dimension
+	if err := c.ShouldBindJSON(&dimension); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DimensionService.CreateDimension(&dimension); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, dimension)
+}
+
+// ListDimensions godoc
+// @Summary List dimensions
+// @Description Get dimensions with their values
+// @Tags Dimensions
+// @Produce json
+// @Security BearerAuth
+// @Param active query bool false "Only active dimensions and values"
+// @Success 200 {array} models.Dimension
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /dimensions [get]
+func (h *Handler) ListDimensions(c *gin.Context) {
+	dimensions, err := h.DimensionService.ListDimensions(c.Query("active") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, dimensions)
+}
+
+// GetDimension godoc
+// @Summary Get dimension
+// @Description Get a dimension with its values
+// @Tags Dimensions
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Dimension ID"
+// @Success 200 {object} models.Dimension
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /dimensions/{id} [get]
+func (h *Handler) GetDimension(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	dimension, err := h.DimensionService.GetDimension(id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, dimension)
+}
+
+// UpdateDimension godoc
+// @Summary Update dimension
+// @Description Update a dimension's name and flags; fields left out keep their current values and the code cannot change. Set active to false to stop tagging with it.
+// @Tags Dimensions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Dimension ID"
+// @Param dimension body models.Dimension true "Dimension details"
+// @Success 200 {object} models.Dimension
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /dimensions/{id} [put]
+func (h *Handler) UpdateDimension(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	// Fields left out of the request keep their stored values
+	changes, err := h.DimensionService.GetDimension(id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.ShouldBindJSON(changes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	dimension, err := h.DimensionService.UpdateDimension(id, changes)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, dimension)
+}
+
+// CreateDimensionValue godoc
+// @Summary Create dimension value
+// @Description Add a value, such as a department or project code, to a dimension
+// @Tags Dimensions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Dimension ID"
+// @Param value body models.DimensionValue true "Value details"
+// @Success 201 {object} models.DimensionValue
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /dimensions/{id}/values [post]
+func (h *Handler) CreateDimensionValue(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	var value models.DimensionValue
+	if err := c.ShouldBindJSON(&value); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DimensionService.CreateValue(id, &value); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, value)
+}
+
+// UpdateDimensionValue godoc
+// @Summary Update dimension value
+// @Description Update a value's name and active flag; fields left out keep their current values and the code cannot change. Inactive values stay on tagged expenses but cannot be used for new ones.
+// @Tags Dimensions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Dimension ID"
+// @Param value_id path int true "Value ID"
+// @Param value body models.DimensionValue true "Value details"
+// @Success 200 {object} models.DimensionValue
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /dimensions/{id}/values/{value_id} [put]
+func (h *Handler) UpdateDimensionValue(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	valueID, err := strconv.ParseUint(c.Param("value_id"), 10, 64)
+	if err != nil || valueID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid value_id"})
+		return
+	}
+
+	// Fields left out of the request keep their stored values
+	changes, err := h.DimensionService.GetValue(id, uint(valueID))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.ShouldBindJSON(changes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	value, err := h.DimensionService.UpdateValue(id, uint(valueID), changes)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, value)
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"ledgerly/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListDuplicateFlags godoc
+// @Summary List duplicate flags
+// @Description Get expenses flagged as likely duplicates, highest score first
+// @Tags Duplicates
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "Filter by status (open, dismissed, confirmed)"
+// @Success 200 {array} models.DuplicateFlag
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /duplicates [get]
+func (h *Handler) ListDuplicateFlags(c *gin.Context) {
+	flags, err := h.DuplicateService.ListFlags(models.DuplicateStatus(c.Query("status")))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, flags)
+}
+
+// DismissDuplicateFlag godoc
+// @Summary Dismiss duplicate flag
+// @Description Record that a flagged expense is not a duplicate
+// @Tags Duplicates
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Flag ID"
+// @Param review body ReviewRequest false "Review note"
+// @Success 200 {object} models.DuplicateFlag
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /duplicates/{id}/dismiss [post]
+func (h *Handler) DismissDuplicateFlag(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req ReviewRequest
+	_ = c.ShouldBindJSON(&req)
+
+	flag, err := h.DuplicateService.DismissFlag(id, currentUserID(c), req.Note)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, flag)
+}
+
+// ConfirmDuplicateFlag godoc
+// @Summary Confirm duplicate flag
+// @Description Confirm that a flagged expense is a duplicate; the expense is rejected
+// @Tags Duplicates
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Flag ID"
+// @Param review body ReviewRequest false "Review note"
+// @Success 200 {object} models.DuplicateFlag
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /duplicates/{id}/confirm [post]
+func (h *Handler) ConfirmDuplicateFlag(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req ReviewRequest
+	_ = c.ShouldBindJSON(&req)
+
+	flag, err := h.DuplicateService.ConfirmFlag(id, currentUserID(c), req.Note)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, flag)
+}
@@ -0,0 +1,367 @@
+package handlers
+
+import (
+	"ledgerly/models"
+	"ledgerly/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ExpenseReportLinesRequest lists expenses to put on a report.
+type ExpenseReportLinesRequest struct {
+	ExpenseIDs []uint `json:"expense_ids"`
+}
+
+// ApproveExpenseReportRequest approves a report except for the rejected
+// lines.
+type ApproveExpenseReportRequest struct {
+	Note          string                   `json:"note"`
+	RejectedLines []services.LineRejection `json:"rejected_lines"`
+}
+
+// CreateExpenseReport godoc
+// @Summary Create expense report
+// @Description Start an empty draft claim to group your draft expenses for one submission
+// @Tags Expense Reports
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param report body models.ExpenseReport true "Report title and description"
+// @Success 201 {object} models.ExpenseReport
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /expense-reports [post]
+func (h *Handler) CreateExpenseReport(c *gin.Context) {
+	var report models.ExpenseReport
+	if err := c.ShouldBindJSON(&report); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.ExpenseReportService.CreateReport(&report, currentUserID(c)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, report)
+}
+
+// ListExpenseReports godoc
+// @Summary List expense reports
+// @Description Get expense reports, newest first. Approvers see everyone's reports; others see their own.
+// @Tags Expense Reports
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "Filter by status (draft, submitted, approved, partially_approved, rejected)"
+// @Param user_id query string false "Filter by claimant (approvers only)"
+// @Success 200 {array} models.ExpenseReport
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /expense-reports [get]
+func (h *Handler) ListExpenseReports(c *gin.Context) {
+	filter := services.ExpenseReportFilter{
+		UserID: c.Query("user_id"),
+		Status: models.ExpenseReportStatus(c.Query("status")),
+	}
+	if !hasPermission(c, models.PermissionExpensesApprove) {
+		filter.UserID = currentUserID(c)
+	}
+
+	reports, err := h.ExpenseReportService.ListReports(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, reports)
+}
+
+// GetExpenseReport godoc
+// @Summary Get expense report
+// @Description Get an expense report with its lines and their policy violations
+// @Tags Expense Reports
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Report ID"
+// @Success 200 {object} models.ExpenseReport
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /expense-reports/{id} [get]
+func (h *Handler) GetExpenseReport(c *gin.Context) {
+	report, ok := h.visibleExpenseReport(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// UpdateExpenseReport godoc
+// @Summary Update expense report
+// @Description Change the title and description of one of your draft reports
+// @Tags Expense Reports
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Report ID"
+// @Param report body models.ExpenseReport true "Report title and description"
+// @Success 200 {object} models.ExpenseReport
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /expense-reports/{id} [put]
+func (h *Handler) UpdateExpenseReport(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	var changes models.ExpenseReport
+	if err := c.ShouldBindJSON(&changes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := h.ExpenseReportService.UpdateReport(id, currentUserID(c), &changes)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// DeleteExpenseReport godoc
+// @Summary Delete expense report
+// @Description Delete one of your draft reports; its expenses stay as drafts
+// @Tags Expense Reports
+// @Security BearerAuth
+// @Param id path int true "Report ID"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /expense-reports/{id} [delete]
+func (h *Handler) DeleteExpenseReport(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.ExpenseReportService.DeleteReport(id, currentUserID(c)); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// AddExpenseReportLines godoc
+// @Summary Add expenses to report
+// @Description Put some of your draft expenses on one of your draft reports
+// @Tags Expense Reports
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Report ID"
+// @Param lines body ExpenseReportLinesRequest true "Draft expenses"
+// @Success 200 {object} models.ExpenseReport
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /expense-reports/{id}/expenses [post]
+func (h *Handler) AddExpenseReportLines(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req ExpenseReportLinesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := h.ExpenseReportService.AddExpenses(id, currentUserID(c), req.ExpenseIDs)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// RemoveExpenseReportLine godoc
+// @Summary Remove expense from report
+// @Description Take a draft expense off one of your draft reports
+// @Tags Expense Reports
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Report ID"
+// @Param expense_id path int true "Expense ID"
+// @Success 200 {object} models.ExpenseReport
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /expense-reports/{id}/expenses/{expense_id} [delete]
+func (h *Handler) RemoveExpenseReportLine(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	expenseID, err := strconv.ParseUint(c.Param("expense_id"), 10, 64)
+	if err != nil || expenseID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid expense_id"})
+		return
+	}
+
+	report, err := h.ExpenseReportService.RemoveExpense(id, currentUserID(c), uint(expenseID))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// SubmitExpenseReport godoc
+// @Summary Submit expense report
+// @Description Submit every line of one of your draft reports together. Each line is checked like a single expense and any failure keeps the whole report in draft; justify soft policy violations on the drafts first. Submitted lines wait for the report's review.
+// @Tags Expense Reports
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Report ID"
+// @Success 200 {object} models.ExpenseReport
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /expense-reports/{id}/submit [post]
+func (h *Handler) SubmitExpenseReport(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	report, err := h.ExpenseReportService.SubmitReport(id, currentUserID(c))
+	if err != nil {
+		c.JSON(errorStatus(err), errorBody(err))
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// ApproveExpenseReport godoc
+// @Summary Approve expense report
+// @Description Approve a submitted report, rejecting any lines listed in rejected_lines with their reasons. The report becomes approved, partially_approved or rejected.
+// @Tags Expense Reports
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Report ID"
+// @Param review body ApproveExpenseReportRequest false "Review note and rejected lines"
+// @Success 200 {object} models.ExpenseReport
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /expense-reports/{id}/approve [post]
+func (h *Handler) ApproveExpenseReport(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req ApproveExpenseReportRequest
+	_ = c.ShouldBindJSON(&req)
+
+	report, err := h.ExpenseReportService.ApproveReport(id, currentUserID(c), req.Note, req.RejectedLines)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// RejectExpenseReport godoc
+// @Summary Reject expense report
+// @Description Reject every line of a submitted report awaiting approval
+// @Tags Expense Reports
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Report ID"
+// @Param review body ReviewRequest false "Review note"
+// @Success 200 {object} models.ExpenseReport
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /expense-reports/{id}/reject [post]
+func (h *Handler) RejectExpenseReport(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req ReviewRequest
+	_ = c.ShouldBindJSON(&req)
+
+	report, err := h.ExpenseReportService.RejectReport(id, currentUserID(c), req.Note)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// ExportExpenseReport godoc
+// @Summary Export expense report
+// @Description Download an expense report as CSV, one row per line followed by the totals
+// @Tags Expense Reports
+// @Produce text/csv
+// @Security BearerAuth
+// @Param id path int true "Report ID"
+// @Success 200 {file} file
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /expense-reports/{id}/export [get]
+func (h *Handler) ExportExpenseReport(c *gin.Context) {
+	report, ok := h.visibleExpenseReport(c)
+	if !ok {
+		return
+	}
+
+	file, err := h.ExpenseReportService.ExportReport(report.ID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="`+file.Filename+`"`)
+	c.Data(http.StatusOK, file.ContentType, file.Content)
+}
+
+// visibleExpenseReport loads the :id report if the user may see it:
+// approvers see every report, others only their own. Anything else is a 404.
+func (h *Handler) visibleExpenseReport(c *gin.Context) (*models.ExpenseReport, bool) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return nil, false
+	}
+
+	report, err := h.ExpenseReportService.GetReport(id)
+	if err == nil && report.UserID != currentUserID(c) && !hasPermission(c, models.PermissionExpensesApprove) {
+		err = gorm.ErrRecordNotFound
+	}
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return report, true
+}
@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"ledgerly/models"
+	"ledgerly/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReviewRequest represents an optional note left by a reviewer
+type ReviewRequest struct {
+	Note string `json:"note" example:"Checked with custodian"`
+}
+
+// CreateFund godoc
+// @Summary Create fund
+// @Description Create a petty cash fund (cash box). Its currency defaults to the base currency and all its transactions are in it.
+// @Tags Funds
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param fund body models.Fund true "Fund details"
+// @Success 201 {object} models.Fund
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /funds [post]
+func (h *Handler) CreateFund(c *gin.Context) {
+	var fund models.Fund
+	if err := c.ShouldBindJSON(&fund); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.FundService.CreateFund(&fund); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, fund)
+}
+
+// UpdateFund godoc
+// @Summary Update fund
+// @Description Rename a fund, change its custodian or deactivate it; fields left out keep their current values. The currency can only change while the fund has no transactions.
+// @Tags Funds
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Fund ID"
+// @Param fund body models.Fund true "Fund details"
+// @Success 200 {object} models.Fund
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /funds/{id} [put]
+func (h *Handler) UpdateFund(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	// Fields left out of the request keep their stored values
+	changes, err := h.FundService.GetFund(id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.ShouldBindJSON(changes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fund, err := h.FundService.UpdateFund(id, changes)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, fund)
+}
+
+// ListFunds godoc
+// @Summary List funds
+// @Description Get all petty cash funds with their current balances
+// @Tags Funds
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} services.FundBalance
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /funds [get]
+func (h *Handler) ListFunds(c *gin.Context) {
+	funds, err := h.FundService.ListFunds()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, funds)
+}
+
+// CreateReconciliation godoc
+// @Summary Record cash count
+// @Description Record a physical cash count by denomination. The system balance and variance are captured at the moment of counting.
+// @Tags Reconciliations
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param reconciliation body models.Reconciliation true "Fund, denomination lines and notes"
+// @Success 201 {object} models.Reconciliation
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /reconciliations [post]
+func (h *Handler) CreateReconciliation(c *gin.Context) {
+	var rec models.Reconciliation
+	if err := c.ShouldBindJSON(&rec); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rec.CountedBy = currentUserID(c)
+	if err := h.ReconciliationService.CreateReconciliation(&rec); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, rec)
+}
+
+// ListReconciliations godoc
+// @Summary List reconciliations
+// @Description Get cash counts, newest first
+// @Tags Reconciliations
+// @Produce json
+// @Security BearerAuth
+// @Param fund_id query int false "Filter by fund"
+// @Param status query string false "Filter by status (pending, approved, rejected)"
+// @Param from query string false "Counted from (YYYY-MM-DD)"
+// @Param to query string false "Counted to, inclusive (YYYY-MM-DD)"
+// @Success 200 {array} models.Reconciliation
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /reconciliations [get]
+func (h *Handler) ListReconciliations(c *gin.Context) {
+	filter, ok := parseReconciliationFilter(c)
+	if !ok {
+		return
+	}
+
+	recs, err := h.ReconciliationService.ListReconciliations(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, recs)
+}
+
+// GetReconciliation godoc
+// @Summary Get reconciliation
+// @Description Get a cash count with its denomination lines and adjustment
+// @Tags Reconciliations
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Reconciliation ID"
+// @Success 200 {object} models.Reconciliation
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /reconciliations/{id} [get]
+func (h *Handler) GetReconciliation(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	rec, err := h.ReconciliationService.GetReconciliation(id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rec)
+}
+
+// ApproveReconciliation godoc
+// @Summary Approve reconciliation
+// @Description Approve a cash count and post any variance as a cash over or cash short adjustment
+// @Tags Reconciliations
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Reconciliation ID"
+// @Param review body ReviewRequest false "Review note"
+// @Success 200 {object} models.Reconciliation
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /reconciliations/{id}/approve [post]
+func (h *Handler) ApproveReconciliation(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req ReviewRequest
+	_ = c.ShouldBindJSON(&req)
+
+	rec, err := h.ReconciliationService.ApproveReconciliation(id, currentUserID(c), req.Note)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rec)
+}
+
+// RejectReconciliation godoc
+// @Summary Reject reconciliation
+// @Description Reject a cash count without posting an adjustment
+// @Tags Reconciliations
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Reconciliation ID"
+// @Param review body ReviewRequest false "Review note"
+// @Success 200 {object} models.Reconciliation
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /reconciliations/{id}/reject [post]
+func (h *Handler) RejectReconciliation(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req ReviewRequest
+	_ = c.ShouldBindJSON(&req)
+
+	rec, err := h.ReconciliationService.RejectReconciliation(id, currentUserID(c), req.Note)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rec)
+}
+
+// GetReconciliationReport godoc
+// @Summary Get reconciliation report
+// @Description Get cash count history with over/short totals per fund
+// @Tags Reports
+// @Produce json
+// @Security BearerAuth
+// @Param fund_id query int false "Filter by fund"
+// @Param status query string false "Filter by status (pending, approved, rejected)"
+// @Param from query string false "Counted from (YYYY-MM-DD)"
+// @Param to query string false "Counted to, inclusive (YYYY-MM-DD)"
+// @Success 200 {object} services.ReconciliationReport
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /reports/reconciliations [get]
+func (h *Handler) GetReconciliationReport(c *gin.Context) {
+	filter, ok := parseReconciliationFilter(c)
+	if !ok {
+		return
+	}
+
+	report, err := h.ReportingService.GetReconciliationReport(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func parseReconciliationFilter(c *gin.Context) (services.ReconciliationFilter, bool) {
+	filter := services.ReconciliationFilter{Status: models.ReconciliationStatus(c.Query("status"))}
+	dates, ok := parseDateRange(c)
+	if !ok {
+		return filter, false
+	}
+	fundID, ok := parseUintQuery(c, "fund_id")
+	if !ok {
+		return filter, false
+	}
+	filter.Dates = dates
+	filter.FundID = fundID
+	return filter, true
+}
@@ -1,27 +1,249 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
-	"net/http"
 	"ledgerly/models"
 	"ledgerly/services"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type Handler struct {
-	PettyCashService *services.PettyCashService
-	ExpenseService   *services.ExpenseService
-	ReportingService *services.ReportingService
-	AuthService      *services.AuthService
+	PettyCashService        *services.PettyCashService
+	ExpenseService          *services.ExpenseService
+	ReportingService        *services.ReportingService
+	AuthService             *services.AuthService
+	PeriodService           *services.PeriodService
+	AuditService            *services.AuditService
+	FundService             *services.FundService
+	ReconciliationService   *services.ReconciliationService
+	BudgetService           *services.BudgetService
+	NotificationService     *services.NotificationService
+	CategoryService         *services.CategoryService
+	LimitService            *services.LimitService
+	PolicyService           *services.PolicyService
+	DuplicateService        *services.DuplicateService
+	ReimbursementService    *services.ReimbursementService
+	AdvanceService          *services.AdvanceService
+	ExpenseReportService    *services.ExpenseReportService
+	CurrencyService         *services.CurrencyService
+	TaxService              *services.TaxService
+	VendorService           *services.VendorService
+	DimensionService        *services.DimensionService
+	RecurringService        *services.RecurringService
+	TravelRateService       *services.TravelRateService
+	RefundService           *services.RefundService
+	ImportService           *services.ImportService
+	AccountingExportService *services.AccountingExportService
+	BankStatementService    *services.BankStatementService
 }
 
 func NewHandler() *Handler {
 	return &Handler{
-		PettyCashService: &services.PettyCashService{},
-		ExpenseService:   &services.ExpenseService{},
-		ReportingService: &services.ReportingService{},
-		AuthService:      &services.AuthService{},
+		PettyCashService:        &services.PettyCashService{},
+		ExpenseService:          &services.ExpenseService{},
+		ReportingService:        &services.ReportingService{},
+		AuthService:             &services.AuthService{},
+		PeriodService:           &services.PeriodService{},
+		AuditService:            &services.AuditService{},
+		FundService:             &services.FundService{},
+		ReconciliationService:   &services.ReconciliationService{},
+		BudgetService:           &services.BudgetService{},
+		NotificationService:     &services.NotificationService{},
+		CategoryService:         &services.CategoryService{},
+		LimitService:            &services.LimitService{},
+		PolicyService:           &services.PolicyService{},
+		DuplicateService:        &services.DuplicateService{},
+		ReimbursementService:    &services.ReimbursementService{},
+		AdvanceService:          &services.AdvanceService{},
+		ExpenseReportService:    &services.ExpenseReportService{},
+		CurrencyService:         &services.CurrencyService{},
+		TaxService:              &services.TaxService{},
+		VendorService:           &services.VendorService{},
+		DimensionService:        &services.DimensionService{},
+		RecurringService:        &services.RecurringService{},
+		TravelRateService:       &services.TravelRateService{},
+		RefundService:           &services.RefundService{},
+		ImportService:           &services.ImportService{},
+		AccountingExportService: &services.AccountingExportService{},
+		BankStatementService:    &services.BankStatementService{},
+	}
+}
+
+// currentUserID returns the authenticated user's ID in the string form used
+// by the models, or "" if the request is unauthenticated.
+func currentUserID(c *gin.Context) string {
+	if userID, exists := c.Get("user_id"); exists {
+		return fmt.Sprintf("%d", userID.(uint))
+	}
+	return ""
+}
+
+// currentRole returns the authenticated user's role, or "" if the request is
+// unauthenticated.
+func currentRole(c *gin.Context) models.UserRole {
+	if role, exists := c.Get("role"); exists {
+		return role.(models.UserRole)
+	}
+	return ""
+}
+
+// hasPermission reports whether the authenticated user's role grants
+// permission.
+func hasPermission(c *gin.Context, permission models.Permission) bool {
+	for _, p := range models.RolePermissions[currentRole(c)] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIDParam parses the :id path parameter, writing a 400 response if it
+// is not a valid ID.
+func parseIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// parseUintQuery reads an optional numeric query parameter, writing a 400
+// response if it is malformed. A missing parameter is 0.
+func parseUintQuery(c *gin.Context, name string) (uint, bool) {
+	v := c.Query(name)
+	if v == "" {
+		return 0, true
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name})
+		return 0, false
+	}
+	return uint(n), true
+}
+
+// parseDate accepts YYYY-MM-DD (midnight in loc) or RFC 3339.
+func parseDate(value string, loc *time.Location) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, loc); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
+}
+
+// parseDateRange reads the optional from/to query parameters as UTC dates.
+func parseDateRange(c *gin.Context) (services.DateRange, bool) {
+	return parseDateRangeIn(c, time.UTC)
+}
+
+// parseDateRangeIn reads the optional from/to query parameters, writing a 400
+// response if either is malformed. Plain dates are midnight in loc, and a
+// plain "to" date includes that whole day.
+func parseDateRangeIn(c *gin.Context, loc *time.Location) (services.DateRange, bool) {
+	var dates services.DateRange
+	if v := c.Query("from"); v != "" {
+		from, _, err := parseDate(v, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from date"})
+			return dates, false
+		}
+		dates.From = from
+	}
+	if v := c.Query("to"); v != "" {
+		to, dateOnly, err := parseDate(v, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to date"})
+			return dates, false
+		}
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		dates.To = to
+	}
+	return dates, true
+}
+
+// errorStatus maps a service error to an HTTP status: missing records are
+// 404, everything else is treated as a rejected request.
+func errorStatus(err error) int {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
+
+// errorBody builds the JSON error response for err, adding the error code
+// of errors that carry one and the entries behind policy and duplicate
+// errors.
+func errorBody(err error) gin.H {
+	body := gin.H{"error": err.Error()}
+	var coded interface{ ErrorCode() string }
+	if errors.As(err, &coded) {
+		body["code"] = coded.ErrorCode()
+	}
+	var policyErr *services.PolicyError
+	if errors.As(err, &policyErr) {
+		body["violations"] = policyErr.Violations
+	}
+	var duplicateErr *services.DuplicateError
+	if errors.As(err, &duplicateErr) {
+		body["duplicates"] = duplicateErr.Matches
+	}
+	return body
+}
+
+// exportFormat picks the download format of a list or report from the
+// format query parameter, or else the Accept header, writing a 400 response
+// for an unknown format. "" means JSON.
+func exportFormat(c *gin.Context) (string, bool) {
+	format := strings.ToLower(c.Query("format"))
+	if format == "" {
+		accepted := c.NegotiateFormat(gin.MIMEJSON,
+			services.ExportContentTypes[services.ExportFormatCSV],
+			services.ExportContentTypes[services.ExportFormatXLSX],
+			services.ExportContentTypes[services.ExportFormatPDF])
+		for f, contentType := range services.ExportContentTypes {
+			if contentType == accepted {
+				return f, true
+			}
+		}
+		return "", true
+	}
+	if format == "json" {
+		return "", true
+	}
+	if _, ok := services.ExportContentTypes[format]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json, csv, xlsx or pdf"})
+		return "", false
+	}
+	return format, true
+}
+
+// sendExport streams an export as a download. Once the first byte is sent
+// the status can no longer change, so a failure after that is logged and
+// the response cut short.
+func sendExport(c *gin.Context, file *services.ExportStream) {
+	c.Header("Content-Type", file.ContentType)
+	c.Header("Content-Disposition", `attachment; filename="`+file.Filename+`"`)
+	c.Status(http.StatusOK)
+	if err := file.WriteTo(c.Writer); err != nil {
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Disposition")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		slog.Error("Export failed", "file", file.Filename, "error", err)
+		c.Abort()
 	}
 }
 
@@ -38,12 +260,16 @@ type LoginResponse struct {
 
 // ErrorResponse represents an error response
 type ErrorResponse struct {
-	Error string `json:"error" example:"invalid credentials"`
+	Error      string                   `json:"error" example:"invalid credentials"`
+	Code       string                   `json:"code,omitempty" example:"limit_daily_exceeded"`
+	Violations []models.PolicyViolation `json:"violations,omitempty"`
+	Duplicates []models.DuplicateFlag   `json:"duplicates,omitempty"`
 }
 
 // BalanceResponse represents petty cash balance
 type BalanceResponse struct {
-	Balance float64 `json:"balance" example:"5000.00"`
+	Balance float64    `json:"balance" example:"5000.00"`
+	AsOf    *time.Time `json:"as_of,omitempty"`
 }
 
 // Login godoc
@@ -84,7 +310,7 @@ func (h *Handler) Login(c *gin.Context) {
 
 // CreatePettyCashTransaction godoc
 // @Summary Create petty cash transaction
-// @Description Create a credit or debit petty cash transaction
+// @Description Create a credit or debit petty cash transaction. Debits count against the user's spending limits; a rejected debit returns a limit_* error code.
 // @Tags Petty Cash
 // @Accept json
 // @Produce json
@@ -134,8 +360,11 @@ func (h *Handler) CreatePettyCashTransaction(c *gin.Context) {
 		return
 	}
 
+	// Populate UserID from JWT claims
+	tx.UserID = currentUserID(c)
+
 	if err := h.PettyCashService.CreateTransaction(&tx); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, errorBody(err))
 		return
 	}
 
@@ -144,17 +373,52 @@ func (h *Handler) CreatePettyCashTransaction(c *gin.Context) {
 
 // ListPettyCashTransactions godoc
 // @Summary List petty cash transactions
-// @Description Get all petty cash transactions
+// @Description Get petty cash transactions ordered by transaction date. With format, or an Accept header asking for CSV, XLSX or PDF, they are downloaded as a table with credit, debit and net totals instead.
 // @Tags Petty Cash
-// @Produce json
+// @Produce json,text/csv,application/vnd.openxmlformats-officedocument.spreadsheetml.sheet,application/pdf
 // @Security BearerAuth
+// @Param fund_id query int false "Filter by fund"
+// @Param from query string false "Transaction date from (YYYY-MM-DD)"
+// @Param to query string false "Transaction date to, inclusive (YYYY-MM-DD)"
+// @Param format query string false "Response format (json, csv, xlsx, pdf); overrides the Accept header"
 // @Success 200 {array} models.PettyCashTransaction
+// @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
 // @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /petty-cash [get]
 func (h *Handler) ListPettyCashTransactions(c *gin.Context) {
-	transactions, err := h.PettyCashService.ListTransactions()
+	dates, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+
+	fundID, ok := parseUintQuery(c, "fund_id")
+	if !ok {
+		return
+	}
+
+	format, ok := exportFormat(c)
+	if !ok {
+		return
+	}
+	filter := services.TransactionFilter{Dates: dates, FundID: fundID}
+	if format != "" {
+		file, err := h.PettyCashService.ExportTransactions(filter, format)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "fund not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		sendExport(c, file)
+		return
+	}
+
+	transactions, err := h.PettyCashService.ListTransactions(filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -164,27 +428,91 @@ func (h *Handler) ListPettyCashTransactions(c *gin.Context) {
 
 // GetPettyCashBalance godoc
 // @Summary Get petty cash balance
-// @Description Get current petty cash balance
+// @Description Get current petty cash balance, or the historical balance at the end of the as_of date
 // @Tags Petty Cash
 // @Produce json
 // @Security BearerAuth
+// @Param fund_id query int false "Fund (all funds if omitted)"
+// @Param as_of query string false "Balance at the end of this date (YYYY-MM-DD) or at this instant (RFC 3339)"
 // @Success 200 {object} BalanceResponse
+// @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
 // @Failure 403 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /petty-cash/balance [get]
 func (h *Handler) GetPettyCashBalance(c *gin.Context) {
-	balance, err := h.PettyCashService.GetBalance()
+	fundID, ok := parseUintQuery(c, "fund_id")
+	if !ok {
+		return
+	}
+
+	asOfParam := c.Query("as_of")
+	if asOfParam == "" {
+		balance, err := h.PettyCashService.GetBalance(fundID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, BalanceResponse{Balance: balance})
+		return
+	}
+
+	asOf, dateOnly, err := parseDate(asOfParam, time.UTC)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid as_of date"})
+		return
+	}
+	// A plain date means the balance at the close of that day
+	cutoff := asOf
+	if dateOnly {
+		cutoff = asOf.AddDate(0, 0, 1)
+	}
+
+	balance, err := h.PettyCashService.GetBalanceAsOf(fundID, cutoff)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, BalanceResponse{Balance: balance, AsOf: &asOf})
+}
+
+// GetPettyCashLedger godoc
+// @Summary Get petty cash ledger
+// @Description Get transactions in date order with a running balance, starting from the balance on the from date
+// @Tags Petty Cash
+// @Produce json
+// @Security BearerAuth
+// @Param fund_id query int false "Fund (all funds if omitted)"
+// @Param from query string false "Transaction date from (YYYY-MM-DD)"
+// @Param to query string false "Transaction date to, inclusive (YYYY-MM-DD)"
+// @Success 200 {object} services.Ledger
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /petty-cash/ledger [get]
+func (h *Handler) GetPettyCashLedger(c *gin.Context) {
+	dates, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+
+	fundID, ok := parseUintQuery(c, "fund_id")
+	if !ok {
+		return
+	}
+
+	ledger, err := h.PettyCashService.GetLedger(services.TransactionFilter{Dates: dates, FundID: fundID})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"balance": balance})
+	c.JSON(http.StatusOK, ledger)
 }
 
 // CreateExpense godoc
 // @Summary Create expense
-// @Description Create a new expense record
+// @Description Create a new expense record, booked to an active leaf category given by category_id or category name. Mileage expenses (type "mileage") give calculation.vehicle_type and calculation.distance in km, per diem expenses (type "per_diem") calculation.destination and calculation.days; their amount and currency come from the rate in force on the expense date and no receipt is needed. With status "draft" the expense is only saved; otherwise it is submitted. Submission fails with a limit_* code over the user's spending limits, policy_violation for hard policy violations, justification_required when soft violations lack a justification (keyed by rule ID) and duplicate_expense for likely duplicates when duplicate blocking is enabled.
 // @Tags Expenses
 // @Accept json
 // @Produce json
@@ -203,12 +531,10 @@ func (h *Handler) CreateExpense(c *gin.Context) {
 	}
 
 	// Populate UserID from JWT claims
-	if userID, exists := c.Get("user_id"); exists {
-		expense.UserID = fmt.Sprintf("%d", userID.(uint))
-	}
+	expense.UserID = currentUserID(c)
 
 	if err := h.ExpenseService.CreateExpense(&expense); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, errorBody(err))
 		return
 	}
 
@@ -217,17 +543,48 @@ func (h *Handler) CreateExpense(c *gin.Context) {
 
 // ListExpenses godoc
 // @Summary List expenses
-// @Description Get all expenses
+// @Description Get expenses ordered by expense date. With format, or an Accept header asking for CSV, XLSX or PDF, they are downloaded as a table with the total in the base currency instead.
 // @Tags Expenses
-// @Produce json
+// @Produce json,text/csv,application/vnd.openxmlformats-officedocument.spreadsheetml.sheet,application/pdf
 // @Security BearerAuth
+// @Param from query string false "Expense date from (YYYY-MM-DD)"
+// @Param to query string false "Expense date to, inclusive (YYYY-MM-DD)"
+// @Param status query string false "Filter by status (draft, pending_approval, approved, rejected)"
+// @Param violations query bool false "Only expenses with policy violations"
+// @Param format query string false "Response format (json, csv, xlsx, pdf); overrides the Accept header"
 // @Success 200 {array} models.Expense
+// @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
 // @Failure 403 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /expenses [get]
 func (h *Handler) ListExpenses(c *gin.Context) {
-	expenses, err := h.ExpenseService.ListExpenses()
+	dates, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+
+	filter := services.ExpenseFilter{
+		Dates:          dates,
+		Status:         models.ExpenseStatus(c.Query("status")),
+		WithViolations: c.Query("violations") == "true",
+	}
+
+	format, ok := exportFormat(c)
+	if !ok {
+		return
+	}
+	if format != "" {
+		file, err := h.ExpenseService.ExportExpenses(filter, format)
+		if err != nil {
+			c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		sendExport(c, file)
+		return
+	}
+
+	expenses, err := h.ExpenseService.ListExpenses(filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -235,21 +592,283 @@ func (h *Handler) ListExpenses(c *gin.Context) {
 	c.JSON(http.StatusOK, expenses)
 }
 
+// UpdateDraftExpense godoc
+// @Summary Update draft expense
+// @Description Replace the details of one of your draft expenses. Policy violations are re-evaluated but not enforced.
+// @Tags Expenses
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Expense ID"
+// @Param expense body models.Expense true "Expense details"
+// @Success 200 {object} models.Expense
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /expenses/{id} [put]
+func (h *Handler) UpdateDraftExpense(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	var changes models.Expense
+	if err := c.ShouldBindJSON(&changes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	expense, err := h.ExpenseService.UpdateDraft(id, currentUserID(c), &changes)
+	if err != nil {
+		c.JSON(errorStatus(err), errorBody(err))
+		return
+	}
+	c.JSON(http.StatusOK, expense)
+}
+
+// SubmitExpenseRequest represents justifications for soft policy
+// violations, keyed by policy rule ID
+type SubmitExpenseRequest struct {
+	Justifications map[string]string `json:"justifications"`
+}
+
+// SubmitExpense godoc
+// @Summary Submit draft expense
+// @Description Submit one of your draft expenses. Hard policy violations block it; soft violations need a justification and send it for approval.
+// @Tags Expenses
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Expense ID"
+// @Param justifications body SubmitExpenseRequest false "Justifications"
+// @Success 200 {object} models.Expense
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /expenses/{id}/submit [post]
+func (h *Handler) SubmitExpense(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req SubmitExpenseRequest
+	_ = c.ShouldBindJSON(&req)
+
+	expense, err := h.ExpenseService.SubmitExpense(id, currentUserID(c), req.Justifications)
+	if err != nil {
+		c.JSON(errorStatus(err), errorBody(err))
+		return
+	}
+	c.JSON(http.StatusOK, expense)
+}
+
+// maxReceiptSize caps receipt uploads.
+const maxReceiptSize = 10 << 20
+
+// UploadReceipt godoc
+// @Summary Upload receipt
+// @Description Attach a receipt file (max 10 MB) to one of your draft expenses. Its hash is used to detect resubmitted receipts.
+// @Tags Expenses
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Expense ID"
+// @Param file formData file true "Receipt file"
+// @Success 200 {object} models.Expense
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /expenses/{id}/receipt [post]
+func (h *Handler) UploadReceipt(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxReceiptSize)
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "receipt file is required"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	expense, err := h.ExpenseService.AttachReceipt(id, currentUserID(c), header.Filename, file)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, expense)
+}
+
+// GetReceipt godoc
+// @Summary Download receipt
+// @Description Download the uploaded receipt file of an expense
+// @Tags Expenses
+// @Produce octet-stream
+// @Security BearerAuth
+// @Param id path int true "Expense ID"
+// @Success 200 {file} file
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /expenses/{id}/receipt [get]
+func (h *Handler) GetReceipt(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	path, err := h.ExpenseService.ReceiptPath(id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.File(path)
+}
+
+// ApproveExpense godoc
+// @Summary Approve expense
+// @Description Approve an expense held for approval by a budget or a justified policy violation
+// @Tags Expenses
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Expense ID"
+// @Param review body ReviewRequest false "Review note"
+// @Success 200 {object} models.Expense
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /expenses/{id}/approve [post]
+func (h *Handler) ApproveExpense(c *gin.Context) {
+	h.reviewExpense(c, h.ExpenseService.ApproveExpense)
+}
+
+// RejectExpense godoc
+// @Summary Reject expense
+// @Description Reject an expense held for approval. Rejected expenses are left out of reports and budgets.
+// @Tags Expenses
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Expense ID"
+// @Param review body ReviewRequest false "Review note"
+// @Success 200 {object} models.Expense
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /expenses/{id}/reject [post]
+func (h *Handler) RejectExpense(c *gin.Context) {
+	h.reviewExpense(c, h.ExpenseService.RejectExpense)
+}
+
+func (h *Handler) reviewExpense(c *gin.Context, review func(id uint, userID, note string) (*models.Expense, error)) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req ReviewRequest
+	_ = c.ShouldBindJSON(&req)
+
+	expense, err := review(id, currentUserID(c), req.Note)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, expense)
+}
+
 // GetExpenseSummary godoc
 // @Summary Get expense summary
-// @Description Get expense summary with totals by category
+// @Description Get expense totals by category, user, fund and optionally a dimension, filtered by dimension tags, optionally as a time series and compared with the previous period or the same period last year. With format, or an Accept header asking for CSV, XLSX or PDF, the summary is downloaded as a table instead.
 // @Tags Reports
-// @Produce json
+// @Produce json,text/csv,application/vnd.openxmlformats-officedocument.spreadsheetml.sheet,application/pdf
 // @Security BearerAuth
+// @Param from query string false "Expense date from (YYYY-MM-DD)"
+// @Param to query string false "Expense date to, inclusive (YYYY-MM-DD)"
+// @Param interval query string false "Time series bucket (day, week, month, quarter)"
+// @Param group_by query string false "Breakdown inside each bucket (category, user, fund or a dimension code, which also totals per dimension value)"
+// @Param timezone query string false "IANA timezone for dates and buckets, e.g. Europe/Berlin (default UTC)"
+// @Param compare query string false "Comparison basis (previous_period, previous_year); requires from and to"
+// @Param currency query string false "Only total expenses in this currency, in original amounts (default: all expenses in the base currency)"
+// @Param tag query []string false "Only expenses tagged dimension:value, e.g. department:SALES; repeat to combine" collectionFormat(multi)
+// @Param format query string false "Response format (json, csv, xlsx, pdf); overrides the Accept header"
 // @Success 200 {object} services.ExpenseSummary
+// @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
 // @Failure 403 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /reports/expenses-summary [get]
 func (h *Handler) GetExpenseSummary(c *gin.Context) {
-	summary, err := h.ReportingService.GetExpenseSummary()
+	loc := time.UTC
+	if tz := c.Query("timezone"); tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid timezone"})
+			return
+		}
+	}
+
+	dates, ok := parseDateRangeIn(c, loc)
+	if !ok {
+		return
+	}
+
+	query := services.ExpenseSummaryQuery{
+		Dates:    dates,
+		Interval: c.Query("interval"),
+		GroupBy:  c.Query("group_by"),
+		Location: loc,
+		Compare:  c.Query("compare"),
+		Currency: strings.ToUpper(c.Query("currency")),
+	}
+	for _, tag := range c.QueryArray("tag") {
+		code, value, found := strings.Cut(tag, ":")
+		if !found || strings.TrimSpace(code) == "" || strings.TrimSpace(value) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "tag must be dimension:value"})
+			return
+		}
+		if query.Tags == nil {
+			query.Tags = make(models.Tags)
+		}
+		query.Tags[strings.ToLower(strings.TrimSpace(code))] = strings.ToUpper(strings.TrimSpace(value))
+	}
+	if err := query.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	format, ok := exportFormat(c)
+	if !ok {
+		return
+	}
+	if format != "" {
+		file, err := h.ReportingService.ExportExpenseSummary(query, format)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		sendExport(c, file)
+		return
+	}
+
+	summary, err := h.ReportingService.GetExpenseSummary(query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, summary)
@@ -257,17 +876,48 @@ func (h *Handler) GetExpenseSummary(c *gin.Context) {
 
 // GetPettyCashSummary godoc
 // @Summary Get petty cash summary
-// @Description Get petty cash summary with credits, debits, and balance
+// @Description Get petty cash summary with credits, debits, and balance, in the fund's currency or in the base currency for all funds. With format, or an Accept header asking for CSV, XLSX or PDF, the summary is downloaded as a table instead.
 // @Tags Reports
-// @Produce json
+// @Produce json,text/csv,application/vnd.openxmlformats-officedocument.spreadsheetml.sheet,application/pdf
 // @Security BearerAuth
+// @Param fund_id query int false "Fund (all funds if omitted)"
+// @Param format query string false "Response format (json, csv, xlsx, pdf); overrides the Accept header"
 // @Success 200 {object} services.PettyCashSummary
+// @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
 // @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /reports/petty-cash-summary [get]
 func (h *Handler) GetPettyCashSummary(c *gin.Context) {
-	summary, err := h.ReportingService.GetPettyCashSummary()
+	fundID, ok := parseUintQuery(c, "fund_id")
+	if !ok {
+		return
+	}
+
+	format, ok := exportFormat(c)
+	if !ok {
+		return
+	}
+	if format != "" {
+		file, err := h.ReportingService.ExportPettyCashSummary(fundID, format)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "fund not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		sendExport(c, file)
+		return
+	}
+
+	summary, err := h.ReportingService.GetPettyCashSummary(fundID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "fund not found"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"ledgerly/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxImportFileSize caps expense and transaction imports.
+const maxImportFileSize = 20 << 20
+
+// ImportExpenses godoc
+// @Summary Import expenses
+// @Description Record expenses from a CSV or XLSX file (max 20 MB) with a header row, validated as if each was entered through the API. Columns are read by field name (title, amount, currency, category, expense_date, vendor, vendor_tax_id, tax_code, notes, attendees, status, user and tag:<dimension>) unless mapping names others. Rows are submitted unless their status is draft, and belong to the importing user unless a user column gives a username. Rows matching an existing expense of the user on date, amount, currency and title are skipped as duplicates. In all_or_nothing mode nothing is imported if any row is invalid; skip_invalid imports the valid rows. With dry_run nothing is written. The result reports each row.
+// @Tags Imports
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file true "CSV or XLSX file"
+// @Param mapping formData string false "JSON object mapping fields to column headers, e.g. {\"title\":\"Description\"}"
+// @Param mode formData string false "all_or_nothing (default) or skip_invalid"
+// @Param dry_run formData bool false "Validate without importing"
+// @Success 200 {object} services.ImportResult
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /imports/expenses [post]
+func (h *Handler) ImportExpenses(c *gin.Context) {
+	h.importFile(c, services.ImportKindExpenses)
+}
+
+// ImportPettyCashTransactions godoc
+// @Summary Import petty cash transactions
+// @Description Post petty cash transactions from a CSV or XLSX file (max 20 MB) with a header row, validated as if each was entered through the API. Columns are read by field name (type, amount, currency, description, reference, fund, transaction_date, user and tag:<dimension>) unless mapping names others; fund is a fund name or ID and defaults to the default fund. Rows belong to the importing user unless a user column gives a username. Rows matching an existing transaction of the fund on type, date, amount and description are skipped as duplicates. In all_or_nothing mode nothing is imported if any row is invalid; skip_invalid imports the valid rows. With dry_run nothing is written. The result reports each row.
+// @Tags Imports
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file true "CSV or XLSX file"
+// @Param mapping formData string false "JSON object mapping fields to column headers, e.g. {\"description\":\"Memo\"}"
+// @Param mode formData string false "all_or_nothing (default) or skip_invalid"
+// @Param dry_run formData bool false "Validate without importing"
+// @Success 200 {object} services.ImportResult
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /imports/transactions [post]
+func (h *Handler) ImportPettyCashTransactions(c *gin.Context) {
+	h.importFile(c, services.ImportKindTransactions)
+}
+
+func (h *Handler) importFile(c *gin.Context, kind string) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportFileSize)
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "import file is required"})
+		return
+	}
+
+	opts := services.ImportOptions{
+		Kind:     kind,
+		Filename: header.Filename,
+		Mode:     c.PostForm("mode"),
+		DryRun:   c.PostForm("dry_run") == "true",
+		UserID:   currentUserID(c),
+	}
+	if mapping := c.PostForm("mapping"); mapping != "" {
+		if err := json.Unmarshal([]byte(mapping), &opts.Mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "mapping must be a JSON object of field names to column headers"})
+			return
+		}
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	result, err := h.ImportService.Import(file, opts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"ledgerly/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetRoleLimit godoc
+// @Summary Set role spending limits
+// @Description Create or replace the per-transaction, daily and monthly spending limits of a role. Omitted limits are unlimited.
+// @Tags Limits
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param role path string true "Role (admin, employee)"
+// @Param limit body models.SpendingLimit true "Limits"
+// @Success 200 {object} models.SpendingLimit
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /limits/roles/{role} [put]
+func (h *Handler) SetRoleLimit(c *gin.Context) {
+	var limit models.SpendingLimit
+	if err := c.ShouldBindJSON(&limit); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.LimitService.SetRoleLimit(models.UserRole(c.Param("role")), &limit, currentUserID(c)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, limit)
+}
+
+// SetUserLimit godoc
+// @Summary Set user spending limits
+// @Description Create or replace one user's overrides of their role's limits. Omitted limits fall back to the role.
+// @Tags Limits
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Param limit body models.SpendingLimit true "Limits"
+// @Success 200 {object} models.SpendingLimit
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /limits/users/{id} [put]
+func (h *Handler) SetUserLimit(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	var limit models.SpendingLimit
+	if err := c.ShouldBindJSON(&limit); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.LimitService.SetUserLimit(id, &limit, currentUserID(c)); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, limit)
+}
+
+// ListLimits godoc
+// @Summary List spending limits
+// @Description Get all role limits and user overrides
+// @Tags Limits
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.SpendingLimit
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /limits [get]
+func (h *Handler) ListLimits(c *gin.Context) {
+	limits, err := h.LimitService.ListLimits()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, limits)
+}
+
+// DeleteLimit godoc
+// @Summary Delete spending limit
+// @Description Remove a role's limits or a user's overrides
+// @Tags Limits
+// @Security BearerAuth
+// @Param id path int true "Limit ID"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /limits/{id} [delete]
+func (h *Handler) DeleteLimit(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.LimitService.DeleteLimit(id, currentUserID(c)); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetMyLimits godoc
+// @Summary Get my spending limits
+// @Description Get the current user's effective spending limits and what remains of them today and this month (UTC)
+// @Tags Limits
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} services.SpendingAllowance
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /me/limits [get]
+func (h *Handler) GetMyLimits(c *gin.Context) {
+	allowance, err := h.LimitService.GetAllowance(currentUserID(c), time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, allowance)
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateFiscalYearRequest represents a fiscal year to define
+type CreateFiscalYearRequest struct {
+	FiscalYear int `json:"fiscal_year" example:"2026"`
+}
+
+// ReopenPeriodRequest represents the justification for reopening a period
+type ReopenPeriodRequest struct {
+	Reason string `json:"reason" example:"Late supplier invoice"`
+}
+
+// LockDateResponse represents the current lock date
+type LockDateResponse struct {
+	LockDate *time.Time `json:"lock_date"`
+}
+
+// CreateFiscalYear godoc
+// @Summary Define fiscal year
+// @Description Create the twelve monthly accounting periods of a fiscal year, starting at the configured fiscal year start month
+// @Tags Periods
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param fiscal_year body CreateFiscalYearRequest true "Fiscal year"
+// @Success 201 {array} models.AccountingPeriod
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /periods [post]
+func (h *Handler) CreateFiscalYear(c *gin.Context) {
+	var req CreateFiscalYearRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	periods, err := h.PeriodService.CreateFiscalYear(req.FiscalYear)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, periods)
+}
+
+// ListPeriods godoc
+// @Summary List accounting periods
+// @Description Get accounting periods with their status and closing snapshots
+// @Tags Periods
+// @Produce json
+// @Security BearerAuth
+// @Param fiscal_year query int false "Filter by fiscal year"
+// @Success 200 {array} models.AccountingPeriod
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /periods [get]
+func (h *Handler) ListPeriods(c *gin.Context) {
+	fiscalYear := 0
+	if v := c.Query("fiscal_year"); v != "" {
+		year, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid fiscal_year"})
+			return
+		}
+		fiscalYear = year
+	}
+
+	periods, err := h.PeriodService.ListPeriods(fiscalYear)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, periods)
+}
+
+// GetLockDate godoc
+// @Summary Get lock date
+// @Description Get the end of the latest closed period; nothing dated before it can be created or changed
+// @Tags Periods
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} LockDateResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /periods/lock-date [get]
+func (h *Handler) GetLockDate(c *gin.Context) {
+	lockDate, err := h.PeriodService.GetLockDate()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := LockDateResponse{}
+	if !lockDate.IsZero() {
+		resp.LockDate = &lockDate
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// ClosePeriod godoc
+// @Summary Close accounting period
+// @Description Close a period, snapshot its balances and lock it against changes
+// @Tags Periods
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Period ID"
+// @Success 200 {object} models.AccountingPeriod
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /periods/{id}/close [post]
+func (h *Handler) ClosePeriod(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	period, err := h.PeriodService.ClosePeriod(id, currentUserID(c))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, period)
+}
+
+// ReopenPeriod godoc
+// @Summary Reopen accounting period
+// @Description Reopen the most recently closed period. The reason is recorded in the audit log.
+// @Tags Periods
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Period ID"
+// @Param reason body ReopenPeriodRequest true "Reason for reopening"
+// @Success 200 {object} models.AccountingPeriod
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /periods/{id}/reopen [post]
+func (h *Handler) ReopenPeriod(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req ReopenPeriodRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	period, err := h.PeriodService.ReopenPeriod(id, currentUserID(c), req.Reason)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, period)
+}
+
+// ListAuditLogs godoc
+// @Summary List audit logs
+// @Description Get audited operations, newest first
+// @Tags Audit
+// @Produce json
+// @Security BearerAuth
+// @Param entity_type query string false "Filter by entity type"
+// @Success 200 {array} models.AuditLog
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /audit-logs [get]
+func (h *Handler) ListAuditLogs(c *gin.Context) {
+	logs, err := h.AuditService.ListLogs(c.Query("entity_type"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, logs)
+}
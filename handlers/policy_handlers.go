@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"ledgerly/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreatePolicyRule godoc
+// @Summary Create policy rule
+// @Description Create an expense policy rule. An expense violates the rule when it meets every condition that is set.
+// @Tags Policies
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param rule body models.PolicyRule true "Rule details"
+// @Success 201 {object} models.PolicyRule
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /policy-rules [post]
+func (h *Handler) CreatePolicyRule(c *gin.Context) {
+	var rule models.PolicyRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.PolicyService.CreateRule(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, rule)
+}
+
+// ListPolicyRules godoc
+// @Summary List policy rules
+// @Description Get all expense policy rules
+// @Tags Policies
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.PolicyRule
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /policy-rules [get]
+func (h *Handler) ListPolicyRules(c *gin.Context) {
+	rules, err := h.PolicyService.ListRules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+// UpdatePolicyRule godoc
+// @Summary Update policy rule
+// @Description Update a policy rule; fields left out keep their current values. Set active to false to suspend it.
+// @Tags Policies
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Rule ID"
+// @Param rule body models.PolicyRule true "Rule details"
+// @Success 200 {object} models.PolicyRule
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /policy-rules/{id} [put]
+func (h *Handler) UpdatePolicyRule(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	// Fields left out of the request keep their stored values
+	changes, err := h.PolicyService.GetRule(id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.ShouldBindJSON(changes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule, err := h.PolicyService.UpdateRule(id, changes)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeletePolicyRule godoc
+// @Summary Delete policy rule
+// @Description Delete a policy rule. Violations already recorded on expenses are kept.
+// @Tags Policies
+// @Security BearerAuth
+// @Param id path int true "Rule ID"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /policy-rules/{id} [delete]
+func (h *Handler) DeletePolicyRule(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.PolicyService.DeleteRule(id); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetPolicyViolationReport godoc
+// @Summary Get policy violation report
+// @Description Get policy violations of submitted expenses by rule and by user
+// @Tags Reports
+// @Produce json
+// @Security BearerAuth
+// @Param from query string false "Expense date from (YYYY-MM-DD)"
+// @Param to query string false "Expense date to, inclusive (YYYY-MM-DD)"
+// @Success 200 {object} services.PolicyViolationReport
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /reports/policy-violations [get]
+func (h *Handler) GetPolicyViolationReport(c *gin.Context) {
+	dates, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+
+	report, err := h.ReportingService.GetPolicyViolationReport(dates)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
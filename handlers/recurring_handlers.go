@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"ledgerly/models"
+	"ledgerly/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CreateRecurringTemplate godoc
+// @Summary Create recurring template
+// @Description Schedule an expense or petty cash transaction to be created weekly, monthly or on a cron expression (UTC), from start_date until end_date. In draft mode expenses are saved as drafts and transactions wait to be confirmed; in submit mode they are submitted or posted directly. A start date in the past catches up on the runs since. Credit templates need petty cash permission; only recurring managers can create templates for other users.
+// @Tags Recurring
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param template body models.RecurringTemplate true "Template details"
+// @Success 201 {object} models.RecurringTemplate
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /recurring-templates [post]
+func (h *Handler) CreateRecurringTemplate(c *gin.Context) {
+	var template models.RecurringTemplate
+	if err := c.ShouldBindJSON(&template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.canScheduleTemplate(c, &template) {
+		return
+	}
+
+	if err := h.RecurringService.CreateTemplate(&template, currentUserID(c)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, template)
+}
+
+// ListRecurringTemplates godoc
+// @Summary List recurring templates
+// @Description Get your recurring templates; recurring managers see everyone's
+// @Tags Recurring
+// @Produce json
+// @Security BearerAuth
+// @Param kind query string false "expense or transaction"
+// @Param user_id query string false "Filter by user (recurring managers only)"
+// @Success 200 {array} models.RecurringTemplate
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /recurring-templates [get]
+func (h *Handler) ListRecurringTemplates(c *gin.Context) {
+	filter := services.RecurringFilter{
+		UserID: c.Query("user_id"),
+		Kind:   models.RecurringKind(c.Query("kind")),
+	}
+	if !hasPermission(c, models.PermissionRecurringManage) {
+		filter.UserID = currentUserID(c)
+	}
+
+	templates, err := h.RecurringService.ListTemplates(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, templates)
+}
+
+// GetRecurringTemplate godoc
+// @Summary Get recurring template
+// @Description Get a recurring template with its next run
+// @Tags Recurring
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Template ID"
+// @Success 200 {object} models.RecurringTemplate
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /recurring-templates/{id} [get]
+func (h *Handler) GetRecurringTemplate(c *gin.Context) {
+	template, ok := h.visibleRecurringTemplate(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, template)
+}
+
+// UpdateRecurringTemplate godoc
+// @Summary Update recurring template
+// @Description Update a recurring template's schedule and what it creates; fields left out keep their current values. Runs already made are kept and the next run is rescheduled after the last one. Set active to false to pause it; runs missed while paused are caught up when it is reactivated.
+// @Tags Recurring
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Template ID"
+// @Param template body models.RecurringTemplate true "Template details"
+// @Success 200 {object} models.RecurringTemplate
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /recurring-templates/{id} [put]
+func (h *Handler) UpdateRecurringTemplate(c *gin.Context) {
+	template, ok := h.visibleRecurringTemplate(c)
+	if !ok {
+		return
+	}
+
+	// Fields left out of the request keep their stored values. Tags are
+	// replaced as a whole rather than merged into the stored ones.
+	changes := *template
+	changes.Tags = nil
+	if err := c.ShouldBindJSON(&changes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if changes.Tags == nil {
+		changes.Tags = template.Tags
+	}
+	changes.UserID = template.UserID
+	if !h.canScheduleTemplate(c, &changes) {
+		return
+	}
+
+	updated, err := h.RecurringService.UpdateTemplate(template.ID, &changes)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteRecurringTemplate godoc
+// @Summary Delete recurring template
+// @Description Stop a recurring template. Its runs and the expenses and transactions they created are kept.
+// @Tags Recurring
+// @Security BearerAuth
+// @Param id path int true "Template ID"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /recurring-templates/{id} [delete]
+func (h *Handler) DeleteRecurringTemplate(c *gin.Context) {
+	template, ok := h.visibleRecurringTemplate(c)
+	if !ok {
+		return
+	}
+
+	if err := h.RecurringService.DeleteTemplate(template.ID); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListRecurringRuns godoc
+// @Summary List recurring runs
+// @Description Get the runs of a recurring template, latest first, with what each created or why it failed
+// @Tags Recurring
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Template ID"
+// @Success 200 {array} models.RecurringRun
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /recurring-templates/{id}/runs [get]
+func (h *Handler) ListRecurringRuns(c *gin.Context) {
+	template, ok := h.visibleRecurringTemplate(c)
+	if !ok {
+		return
+	}
+
+	runs, err := h.RecurringService.ListRuns(template.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, runs)
+}
+
+// ConfirmRecurringRun godoc
+// @Summary Confirm recurring run
+// @Description Post the petty cash transaction of a pending draft-mode run, dated when the run was scheduled
+// @Tags Recurring
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Run ID"
+// @Success 200 {object} models.RecurringRun
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /recurring-runs/{id}/confirm [post]
+func (h *Handler) ConfirmRecurringRun(c *gin.Context) {
+	id, ok := h.visibleRecurringRun(c)
+	if !ok {
+		return
+	}
+
+	run, err := h.RecurringService.ConfirmRun(id, currentUserID(c))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, run)
+}
+
+// SkipRecurringRun godoc
+// @Summary Skip recurring run
+// @Description Discard a pending draft-mode run without posting its transaction
+// @Tags Recurring
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Run ID"
+// @Success 200 {object} models.RecurringRun
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /recurring-runs/{id}/skip [post]
+func (h *Handler) SkipRecurringRun(c *gin.Context) {
+	id, ok := h.visibleRecurringRun(c)
+	if !ok {
+		return
+	}
+
+	run, err := h.RecurringService.SkipRun(id, currentUserID(c))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, run)
+}
+
+// canScheduleTemplate checks the user may schedule template: credits need
+// petty cash permission, and only recurring managers schedule for other
+// users. Templates without a user are the current user's.
+func (h *Handler) canScheduleTemplate(c *gin.Context, template *models.RecurringTemplate) bool {
+	if template.UserID == "" || !hasPermission(c, models.PermissionRecurringManage) {
+		template.UserID = currentUserID(c)
+	}
+	// As with petty cash entry, claimants may only schedule debits
+	if template.Kind == models.RecurringKindTransaction && template.Type != models.TransactionTypeDebit &&
+		!hasPermission(c, models.PermissionPettyCashCreate) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+		return false
+	}
+	return true
+}
+
+// visibleRecurringTemplate loads the :id template if the user may see it:
+// recurring managers see every template, others only their own. Anything
+// else is a 404.
+func (h *Handler) visibleRecurringTemplate(c *gin.Context) (*models.RecurringTemplate, bool) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return nil, false
+	}
+
+	template, err := h.RecurringService.GetTemplate(id)
+	if err == nil && template.UserID != currentUserID(c) && !hasPermission(c, models.PermissionRecurringManage) {
+		err = gorm.ErrRecordNotFound
+	}
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return template, true
+}
+
+// visibleRecurringRun checks the user may see the :id run's template and
+// returns the run's ID.
+func (h *Handler) visibleRecurringRun(c *gin.Context) (uint, bool) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return 0, false
+	}
+
+	_, template, err := h.RecurringService.GetRun(id)
+	if err == nil && template.UserID != currentUserID(c) && !hasPermission(c, models.PermissionRecurringManage) {
+		err = gorm.ErrRecordNotFound
+	}
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"ledgerly/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RecordRefund godoc
+// @Summary Record refund
+// @Description Record money a vendor returned against a submitted expense, for a return or a partial refund, up to what is left unrefunded. refund_date defaults to today and must be in an open period. Refunds of expenses paid from petty cash are credited back to the same fund; other refunds come off the employee's reimbursement, or are owed back by the employee and netted against their next batch once it is batched or paid. Reports net refunds off the period they were received in.
+// @Tags Expenses
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Expense ID"
+// @Param refund body models.Refund true "Amount in the expense's currency, reason and refund date"
+// @Success 201 {object} models.Refund
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /expenses/{id}/refunds [post]
+func (h *Handler) RecordRefund(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	var refund models.Refund
+	if err := c.ShouldBindJSON(&refund); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.RefundService.RecordRefund(id, &refund, currentUserID(c)); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, refund)
+}
+
+// ListRefunds godoc
+// @Summary List refunds
+// @Description Get the refunds of one of your expenses, oldest first, with their petty cash credits; approvers see the refunds of any expense
+// @Tags Expenses
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Expense ID"
+// @Success 200 {array} models.Refund
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /expenses/{id}/refunds [get]
+func (h *Handler) ListRefunds(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	userID := ""
+	if !hasPermission(c, models.PermissionExpensesApprove) {
+		userID = currentUserID(c)
+	}
+	refunds, err := h.RefundService.ListRefunds(id, userID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, refunds)
+}
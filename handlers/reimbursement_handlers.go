@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"ledgerly/models"
+	"ledgerly/services"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateReimbursementBatchRequest selects what a payout batch pays.
+type CreateReimbursementBatchRequest struct {
+	UserIDs       []uint `json:"user_ids"`
+	ExecutionDate string `json:"execution_date" example:"2026-10-30"`
+}
+
+// ListReimbursements godoc
+// @Summary List reimbursements
+// @Description Get the reimbursements accrued for approved out-of-pocket expenses
+// @Tags Reimbursements
+// @Produce json
+// @Security BearerAuth
+// @Param user_id query string false "Filter by employee"
+// @Param status query string false "Filter by status (owed, batched, paid)"
+// @Success 200 {array} models.Reimbursement
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /reimbursements [get]
+func (h *Handler) ListReimbursements(c *gin.Context) {
+	reimbursements, err := h.ReimbursementService.ListReimbursements(services.ReimbursementFilter{
+		UserID: c.Query("user_id"),
+		Status: models.ReimbursementStatus(c.Query("status")),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, reimbursements)
+}
+
+// ListPayables godoc
+// @Summary List reimbursement payables
+// @Description Get the unpaid reimbursement total per employee, split into owed and already batched
+// @Tags Reimbursements
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} services.Payable
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /reimbursements/payables [get]
+func (h *Handler) ListPayables(c *gin.Context) {
+	payables, err := h.ReimbursementService.ListPayables()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, payables)
+}
+
+// ListMyReimbursements godoc
+// @Summary List my reimbursements
+// @Description Get the current user's reimbursements
+// @Tags Reimbursements
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "Filter by status (owed, batched, paid)"
+// @Success 200 {array} models.Reimbursement
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /me/reimbursements [get]
+func (h *Handler) ListMyReimbursements(c *gin.Context) {
+	reimbursements, err := h.ReimbursementService.ListReimbursements(services.ReimbursementFilter{
+		UserID: currentUserID(c),
+		Status: models.ReimbursementStatus(c.Query("status")),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, reimbursements)
+}
+
+// GetMyBankAccount godoc
+// @Summary Get my bank account
+// @Description Get the account the current user's reimbursements are paid to
+// @Tags Reimbursements
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.BankAccount
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /me/bank-account [get]
+func (h *Handler) GetMyBankAccount(c *gin.Context) {
+	account, err := h.ReimbursementService.GetBankAccount(currentUserID(c))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, account)
+}
+
+// SetMyBankAccount godoc
+// @Summary Set my bank account
+// @Description Create or replace the account the current user's reimbursements are paid to. The IBAN check digits are verified.
+// @Tags Reimbursements
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param account body models.BankAccount true "Bank account"
+// @Success 200 {object} models.BankAccount
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /me/bank-account [put]
+func (h *Handler) SetMyBankAccount(c *gin.Context) {
+	h.setBankAccount(c, currentUserID(c))
+}
+
+// SetUserBankAccount godoc
+// @Summary Set user bank account
+// @Description Create or replace the account an employee's reimbursements are paid to
+// @Tags Reimbursements
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Param account body models.BankAccount true "Bank account"
+// @Success 200 {object} models.BankAccount
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /users/{id}/bank-account [put]
+func (h *Handler) SetUserBankAccount(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+	h.setBankAccount(c, strconv.FormatUint(uint64(id), 10))
+}
+
+func (h *Handler) setBankAccount(c *gin.Context, userID string) {
+	var account models.BankAccount
+	if err := c.ShouldBindJSON(&account); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.ReimbursementService.SetBankAccount(userID, &account); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, account)
+}
+
+// CreateReimbursementBatch godoc
+// @Summary Create reimbursement batch
+// @Description Group all owed reimbursements, or those of the given employees, into a payout batch. Employees who owe back more than they are owed are left out. The execution date defaults to today.
+// @Tags Reimbursements
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param batch body CreateReimbursementBatchRequest true "Batch selection"
+// @Success 201 {object} models.ReimbursementBatch
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /reimbursement-batches [post]
+func (h *Handler) CreateReimbursementBatch(c *gin.Context) {
+	var req CreateReimbursementBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var executionDate time.Time
+	if req.ExecutionDate != "" {
+		date, _, err := parseDate(req.ExecutionDate, time.UTC)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid execution_date"})
+			return
+		}
+		executionDate = date
+	}
+	userIDs := make([]string, 0, len(req.UserIDs))
+	for _, id := range req.UserIDs {
+		userIDs = append(userIDs, strconv.FormatUint(uint64(id), 10))
+	}
+
+	batch, err := h.ReimbursementService.CreateBatch(userIDs, executionDate, currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, batch)
+}
+
+// ListReimbursementBatches godoc
+// @Summary List reimbursement batches
+// @Description Get all payout batches, newest first
+// @Tags Reimbursements
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.ReimbursementBatch
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /reimbursement-batches [get]
+func (h *Handler) ListReimbursementBatches(c *gin.Context) {
+	batches, err := h.ReimbursementService.ListBatches()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, batches)
+}
+
+// GetReimbursementBatch godoc
+// @Summary Get reimbursement batch
+// @Description Get a payout batch with its reimbursements
+// @Tags Reimbursements
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Batch ID"
+// @Success 200 {object} models.ReimbursementBatch
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /reimbursement-batches/{id} [get]
+func (h *Handler) GetReimbursementBatch(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	batch, err := h.ReimbursementService.GetBatch(id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, batch)
+}
+
+// ExportReimbursementBatch godoc
+// @Summary Export reimbursement batch
+// @Description Download a batch as a SEPA pain.001.001.03 credit transfer file or a generic bank CSV, with one payment per employee. Every payee needs a bank account on file.
+// @Tags Reimbursements
+// @Produce xml
+// @Produce text/csv
+// @Security BearerAuth
+// @Param id path int true "Batch ID"
+// @Param format query string false "File format (sepa, csv)" default(sepa)
+// @Success 200 {file} file
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /reimbursement-batches/{id}/export [get]
+func (h *Handler) ExportReimbursementBatch(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	file, err := h.ReimbursementService.ExportBatch(id, c.Query("format"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="`+file.Filename+`"`)
+	c.Data(http.StatusOK, file.ContentType, file.Content)
+}
+
+// MarkReimbursementBatchPaid godoc
+// @Summary Mark reimbursement batch paid
+// @Description Record that the bank executed an open batch; its reimbursements are paid and each employee is notified
+// @Tags Reimbursements
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Batch ID"
+// @Success 200 {object} models.ReimbursementBatch
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /reimbursement-batches/{id}/paid [post]
+func (h *Handler) MarkReimbursementBatchPaid(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	batch, err := h.ReimbursementService.MarkBatchPaid(id, currentUserID(c))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, batch)
+}
+
+// CancelReimbursementBatch godoc
+// @Summary Cancel reimbursement batch
+// @Description Cancel an open batch; its reimbursements are owed again and can be batched anew
+// @Tags Reimbursements
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Batch ID"
+// @Success 200 {object} models.ReimbursementBatch
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /reimbursement-batches/{id}/cancel [post]
+func (h *Handler) CancelReimbursementBatch(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	batch, err := h.ReimbursementService.CancelBatch(id, currentUserID(c))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, batch)
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"ledgerly/models"
+	"ledgerly/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateTaxCode godoc
+// @Summary Create tax code
+// @Description Create a VAT/GST code with its rate as a percentage of the net amount
+// @Tags Taxes
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param code body models.TaxCode true "Tax code details"
+// @Success 201 {object} models.TaxCode
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /tax-codes [post]
+func (h *Handler) CreateTaxCode(c *gin.Context) {
+	var code models.TaxCode
+	if err := c.ShouldBindJSON(&code); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.TaxService.CreateTaxCode(&code); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, code)
+}
+
+// ListTaxCodes godoc
+// @Summary List tax codes
+// @Description Get the tax codes expenses can be booked with
+// @Tags Taxes
+// @Produce json
+// @Security BearerAuth
+// @Param active query bool false "Only active tax codes"
+// @Success 200 {array} models.TaxCode
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /tax-codes [get]
+func (h *Handler) ListTaxCodes(c *gin.Context) {
+	codes, err := h.TaxService.ListTaxCodes(c.Query("active") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, codes)
+}
+
+// GetTaxCode godoc
+// @Summary Get tax code
+// @Description Get a tax code
+// @Tags Taxes
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Tax code ID"
+// @Success 200 {object} models.TaxCode
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /tax-codes/{id} [get]
+func (h *Handler) GetTaxCode(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	code, err := h.TaxService.GetTaxCode(id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, code)
+}
+
+// UpdateTaxCode godoc
+// @Summary Update tax code
+// @Description Update a tax code; fields left out keep their current values. Set active to false to retire it. Expenses already booked keep their code and rate.
+// @Tags Taxes
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Tax code ID"
+// @Param code body models.TaxCode true "Tax code details"
+// @Success 200 {object} models.TaxCode
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /tax-codes/{id} [put]
+func (h *Handler) UpdateTaxCode(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	// Fields left out of the request keep their stored values
+	changes, err := h.TaxService.GetTaxCode(id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.ShouldBindJSON(changes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	code, err := h.TaxService.UpdateTaxCode(id, changes)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, code)
+}
+
+// DeleteTaxCode godoc
+// @Summary Delete tax code
+// @Description Delete a tax code no expense has been booked with
+// @Tags Taxes
+// @Security BearerAuth
+// @Param id path int true "Tax code ID"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /tax-codes/{id} [delete]
+func (h *Handler) DeleteTaxCode(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.TaxService.DeleteTaxCode(id); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetTaxReport godoc
+// @Summary Get tax summary
+// @Description Get net, tax and gross totals of approved expenses per period and tax rate, in the base currency, net of refunds received in each period
+// @Tags Reports
+// @Produce json
+// @Security BearerAuth
+// @Param from query string false "Expense date from (YYYY-MM-DD)"
+// @Param to query string false "Expense date to, inclusive (YYYY-MM-DD)"
+// @Param interval query string false "Filing period (month, quarter); default month"
+// @Success 200 {object} services.TaxReport
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /reports/tax-summary [get]
+func (h *Handler) GetTaxReport(c *gin.Context) {
+	dates, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+
+	report, err := h.ReportingService.GetTaxReport(services.TaxReportQuery{Dates: dates, Interval: c.Query("interval")})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// ExportTaxReport godoc
+// @Summary Export tax summary
+// @Description Download the tax summary as CSV for filing, one row per period and rate followed by the totals per rate
+// @Tags Reports
+// @Produce text/csv
+// @Security BearerAuth
+// @Param from query string false "Expense date from (YYYY-MM-DD)"
+// @Param to query string false "Expense date to, inclusive (YYYY-MM-DD)"
+// @Param interval query string false "Filing period (month, quarter); default month"
+// @Success 200 {file} file
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /reports/tax-summary/export [get]
+func (h *Handler) ExportTaxReport(c *gin.Context) {
+	dates, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+
+	file, err := h.ReportingService.ExportTaxReport(services.TaxReportQuery{Dates: dates, Interval: c.Query("interval")})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="`+file.Filename+`"`)
+	c.Data(http.StatusOK, file.ContentType, file.Content)
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"ledgerly/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetMileageRate godoc
+// @Summary Set mileage rate
+// @Description Set the amount paid per kilometre for a vehicle type from a date on, replacing any rate already set for that date. Mileage expenses use the latest rate on or before their expense date.
+// @Tags Travel Rates
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param rate body models.MileageRate true "Vehicle type, effective date, rate and currency"
+// @Success 200 {object} models.MileageRate
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /mileage-rates [post]
+func (h *Handler) SetMileageRate(c *gin.Context) {
+	var rate models.MileageRate
+	if err := c.ShouldBindJSON(&rate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.TravelRateService.SetMileageRate(&rate, currentUserID(c)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rate)
+}
+
+// ListMileageRates godoc
+// @Summary List mileage rates
+// @Description Get mileage rates, newest first per vehicle type
+// @Tags Travel Rates
+// @Produce json
+// @Security BearerAuth
+// @Param vehicle_type query string false "Filter by vehicle type"
+// @Success 200 {array} models.MileageRate
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /mileage-rates [get]
+func (h *Handler) ListMileageRates(c *gin.Context) {
+	rates, err := h.TravelRateService.ListMileageRates(c.Query("vehicle_type"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rates)
+}
+
+// DeleteMileageRate godoc
+// @Summary Delete mileage rate
+// @Description Delete a mileage rate. Expenses already calculated with it keep their amount.
+// @Tags Travel Rates
+// @Security BearerAuth
+// @Param id path int true "Mileage rate ID"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /mileage-rates/{id} [delete]
+func (h *Handler) DeleteMileageRate(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.TravelRateService.DeleteMileageRate(id, currentUserID(c)); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// SetPerDiemRate godoc
+// @Summary Set per diem rate
+// @Description Set the daily allowance for a destination from a date on, replacing any rate already set for that date. Per diem expenses use the latest rate on or before their expense date.
+// @Tags Travel Rates
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param rate body models.PerDiemRate true "Destination, effective date, daily rate and currency"
+// @Success 200 {object} models.PerDiemRate
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /per-diem-rates [post]
+func (h *Handler) SetPerDiemRate(c *gin.Context) {
+	var rate models.PerDiemRate
+	if err := c.ShouldBindJSON(&rate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.TravelRateService.SetPerDiemRate(&rate, currentUserID(c)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rate)
+}
+
+// ListPerDiemRates godoc
+// @Summary List per diem rates
+// @Description Get per diem rates, newest first per destination
+// @Tags Travel Rates
+// @Produce json
+// @Security BearerAuth
+// @Param destination query string false "Filter by destination"
+// @Success 200 {array} models.PerDiemRate
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /per-diem-rates [get]
+func (h *Handler) ListPerDiemRates(c *gin.Context) {
+	rates, err := h.TravelRateService.ListPerDiemRates(c.Query("destination"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rates)
+}
+
+// DeletePerDiemRate godoc
+// @Summary Delete per diem rate
+// @Description Delete a per diem rate. Expenses already calculated with it keep their amount.
+// @Tags Travel Rates
+// @Security BearerAuth
+// @Param id path int true "Per diem rate ID"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /per-diem-rates/{id} [delete]
+func (h *Handler) DeletePerDiemRate(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.TravelRateService.DeletePerDiemRate(id, currentUserID(c)); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"ledgerly/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MergeVendorsRequest lists the duplicate vendors to fold into another.
+type MergeVendorsRequest struct {
+	SourceIDs []uint `json:"source_ids"`
+}
+
+// CreateVendor godoc
+// @Summary Create vendor
+// @Description Create a vendor with the aliases it appears under on receipts and an optional default category for its expenses
+// @Tags Vendors
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param vendor body models.Vendor true "Vendor details"
+// @Success 201 {object} models.Vendor
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /vendors [post]
+func (h *Handler) CreateVendor(c *gin.Context) {
+	var vendor models.Vendor
+	if err := c.ShouldBindJSON(&vendor); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.VendorService.CreateVendor(&vendor); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, vendor)
+}
+
+// ListVendors godoc
+// @Summary List vendors
+// @Description Get vendors by name
+// @Tags Vendors
+// @Produce json
+// @Security BearerAuth
+// @Param search query string false "Name or alias contains"
+// @Param active query bool false "Only active vendors"
+// @Success 200 {array} models.Vendor
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /vendors [get]
+func (h *Handler) ListVendors(c *gin.Context) {
+	vendors, err := h.VendorService.ListVendors(c.Query("search"), c.Query("active") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, vendors)
+}
+
+// MatchVendor godoc
+// @Summary Match vendor
+// @Description Get the vendor an expense title or vendor name would be linked to
+// @Tags Vendors
+// @Produce json
+// @Security BearerAuth
+// @Param text query string true "Expense title or vendor name"
+// @Success 200 {object} models.Vendor
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /vendors/match [get]
+func (h *Handler) MatchVendor(c *gin.Context) {
+	text := c.Query("text")
+	if text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "text is required"})
+		return
+	}
+
+	vendor, err := h.VendorService.MatchVendor(text)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if vendor == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no matching vendor"})
+		return
+	}
+	c.JSON(http.StatusOK, vendor)
+}
+
+// GetVendor godoc
+// @Summary Get vendor
+// @Description Get a vendor
+// @Tags Vendors
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Vendor ID"
+// @Success 200 {object} models.Vendor
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /vendors/{id} [get]
+func (h *Handler) GetVendor(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	vendor, err := h.VendorService.GetVendor(id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, vendor)
+}
+
+// UpdateVendor godoc
+// @Summary Update vendor
+// @Description Update a vendor's details; fields left out keep their current values. Set active to false to stop matching it. Renaming it renames it on its expenses.
+// @Tags Vendors
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Vendor ID"
+// @Param vendor body models.Vendor true "Vendor details"
+// @Success 200 {object} models.Vendor
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /vendors/{id} [put]
+func (h *Handler) UpdateVendor(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	// Fields left out of the request keep their stored values
+	changes, err := h.VendorService.GetVendor(id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.ShouldBindJSON(changes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	vendor, err := h.VendorService.UpdateVendor(id, changes)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, vendor)
+}
+
+// DeleteVendor godoc
+// @Summary Delete vendor
+// @Description Delete a vendor no expense or transaction is linked to
+// @Tags Vendors
+// @Security BearerAuth
+// @Param id path int true "Vendor ID"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /vendors/{id} [delete]
+func (h *Handler) DeleteVendor(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.VendorService.DeleteVendor(id); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// MergeVendors godoc
+// @Summary Merge vendors
+// @Description Fold duplicate vendors into this one. Their expenses and transactions move to it and their names become its aliases.
+// @Tags Vendors
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Vendor ID to keep"
+// @Param request body MergeVendorsRequest true "Vendors to merge"
+// @Success 200 {object} models.Vendor
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /vendors/{id}/merge [post]
+func (h *Handler) MergeVendors(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req MergeVendorsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	vendor, err := h.VendorService.MergeVendors(id, req.SourceIDs, currentUserID(c))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, vendor)
+}
+
+// GetVendorSpendReport godoc
+// @Summary Get spend by vendor
+// @Description Get spend per vendor in the base currency, highest first: submitted expenses net of refunds received in the range, plus petty cash debits booked to a vendor without an expense
+// @Tags Reports
+// @Produce json
+// @Security BearerAuth
+// @Param from query string false "Date from (YYYY-MM-DD)"
+// @Param to query string false "Date to, inclusive (YYYY-MM-DD)"
+// @Success 200 {object} services.VendorSpendReport
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /reports/spend-by-vendor [get]
+func (h *Handler) GetVendorSpendReport(c *gin.Context) {
+	dates, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+
+	report, err := h.ReportingService.GetVendorSpendReport(dates)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,80 @@
+package models
+
+import "time"
+
+// AccountingFormat is the journal file format of an accounting system.
+type AccountingFormat string
+
+const (
+	AccountingFormatQuickBooksIIF AccountingFormat = "quickbooks_iif"
+	AccountingFormatXeroCSV       AccountingFormat = "xero_csv"
+	AccountingFormatTallyXML      AccountingFormat = "tally_xml"
+)
+
+// AccountingExportProfile maps categories to the accounts of an external
+// accounting system and picks the journal format it imports. Expenses are
+// debited to the account mapped to their category, or failing that to the
+// category's GLAccount, then to those of its ancestors and finally to
+// DefaultAccount. They are credited to PettyCashAccount when paid from petty
+// cash and to PayableAccount when an employee is owed for them. With a
+// TaxAccount, tax is debited to it separately from the net amount. TaxRate is
+// the tax rate name Xero journal lines are marked with.
+type AccountingExportProfile struct {
+	ID               uint             `gorm:"primaryKey" json:"id"`
+	Name             string           `gorm:"uniqueIndex" json:"name" example:"Xero"`
+	Format           AccountingFormat `json:"format" example:"xero_csv"`
+	DefaultAccount   string           `json:"default_account" example:"429"`
+	PettyCashAccount string           `json:"petty_cash_account" example:"091"`
+	PayableAccount   string           `json:"payable_account" example:"814"`
+	TaxAccount       string           `json:"tax_account" example:"820"`
+	TaxRate          string           `json:"tax_rate" example:"Tax Exempt"`
+	Active           bool             `json:"active"`
+	Accounts         []AccountMapping `gorm:"foreignKey:ProfileID" json:"accounts"`
+	CreatedAt        time.Time        `json:"created_at"`
+	UpdatedAt        time.Time        `json:"updated_at"`
+}
+
+// AccountMapping books a category, and the categories below it without a
+// mapping of their own, to an external account.
+type AccountMapping struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	ProfileID  uint   `gorm:"uniqueIndex:idx_account_mappings_profile_category" json:"profile_id"`
+	CategoryID uint   `gorm:"uniqueIndex:idx_account_mappings_profile_category" json:"category_id"`
+	Account    string `json:"account" example:"6100"`
+}
+
+// AccountingExport is a journal file exported for a profile, holding the
+// approved expenses dated From to To and the refunds of approved expenses
+// dated in that range that no earlier export of the profile included. The
+// file is kept so it can be downloaded again. Voiding an export releases its
+// records for the next one. Total is the sum of the journal debits in the
+// base currency.
+type AccountingExport struct {
+	ID         uint                     `gorm:"primaryKey" json:"id"`
+	Reference  string                   `gorm:"uniqueIndex" json:"reference"`
+	ProfileID  uint                     `gorm:"index" json:"profile_id"`
+	Profile    *AccountingExportProfile `gorm:"foreignKey:ProfileID" json:"profile,omitempty"`
+	Format     AccountingFormat         `json:"format"`
+	From       time.Time                `json:"from"`
+	To         time.Time                `json:"to"`
+	Filename   string                   `json:"filename"`
+	Content    []byte                   `json:"-"`
+	Entries    int                      `json:"entries"`
+	Total      float64                  `json:"total"`
+	Currency   string                   `gorm:"size:3" json:"currency"`
+	ExportedBy string                   `json:"exported_by"`
+	VoidedAt   *time.Time               `json:"voided_at"`
+	VoidedBy   string                   `json:"voided_by"`
+	CreatedAt  time.Time                `json:"created_at"`
+}
+
+// AccountingExportRecord marks an expense or refund as exported by a
+// profile, so later exports of the profile leave it out.
+type AccountingExportRecord struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	ExportID   uint      `gorm:"index" json:"export_id"`
+	ProfileID  uint      `gorm:"uniqueIndex:idx_accounting_export_records_entity" json:"profile_id"`
+	EntityType string    `gorm:"uniqueIndex:idx_accounting_export_records_entity" json:"entity_type"`
+	EntityID   uint      `gorm:"uniqueIndex:idx_accounting_export_records_entity" json:"entity_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
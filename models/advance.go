@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+type CashAdvanceStatus string
+
+const (
+	CashAdvanceStatusOutstanding CashAdvanceStatus = "outstanding"
+	CashAdvanceStatusSettled     CashAdvanceStatus = "settled"
+)
+
+// CashAdvance is cash taken from a fund by an employee before they spend it.
+// It is liquidated by linking the expenses paid with it and returning the
+// change; Outstanding is what is still unaccounted for. Amounts are in the
+// fund's currency.
+type CashAdvance struct {
+	ID                 uint                  `gorm:"primaryKey" json:"id"`
+	FundID             uint                  `gorm:"index" json:"fund_id"`
+	UserID             string                `gorm:"index" json:"user_id"`
+	Amount             float64               `json:"amount"`
+	Currency           string                `gorm:"size:3" json:"currency" example:"EUR"`
+	Purpose            string                `json:"purpose"`
+	IssuedAt           time.Time             `gorm:"index" json:"issued_at"`
+	DueDate            time.Time             `gorm:"index" json:"due_date"`
+	IssuedBy           string                `json:"issued_by"`
+	IssueTransactionID uint                  `json:"issue_transaction_id"`
+	IssueTransaction   *PettyCashTransaction `gorm:"foreignKey:IssueTransactionID" json:"issue_transaction,omitempty"`
+	SpentAmount        float64               `json:"spent_amount"`
+	ReturnedAmount     float64               `json:"returned_amount"`
+	Outstanding        float64               `json:"outstanding"`
+	Status             CashAdvanceStatus     `gorm:"index" json:"status"`
+	SettledAt          *time.Time            `json:"settled_at"`
+	Expenses           []Expense             `gorm:"foreignKey:CashAdvanceID" json:"expenses,omitempty"`
+	CreatedAt          time.Time             `json:"created_at"`
+	UpdatedAt          time.Time             `json:"updated_at"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// AuditLog records a sensitive operation and who performed it.
+type AuditLog struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Action     string    `gorm:"index" json:"action"`
+	EntityType string    `gorm:"index" json:"entity_type"`
+	EntityID   uint      `json:"entity_id"`
+	UserID     string    `json:"user_id"`
+	Details    string    `json:"details"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// BalanceCheckpoint caches the balance of a fund over every transaction dated
+// before Date, so historical balances only need to sum what came after it.
+// FundID 0 holds the total across all funds. Checkpoints are created lazily
+// and dropped whenever a transaction dated before them is written.
+type BalanceCheckpoint struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	FundID    uint      `gorm:"uniqueIndex:idx_balance_checkpoints_fund_date" json:"fund_id"`
+	Date      time.Time `gorm:"uniqueIndex:idx_balance_checkpoints_fund_date" json:"date"`
+	Balance   float64   `json:"balance"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// invalidateCheckpoints drops checkpoints of every fund that include a
+// transaction dated at date. A zero date drops them all.
+func invalidateCheckpoints(tx *gorm.DB, date time.Time) error {
+	query := tx.Session(&gorm.Session{NewDB: true}).Where("1 = 1")
+	if !date.IsZero() {
+		query = query.Where("date > ?", date)
+	}
+	return query.Delete(&BalanceCheckpoint{}).Error
+}
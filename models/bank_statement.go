@@ -0,0 +1,73 @@
+package models
+
+import "time"
+
+// BankStatementFormat is the file format a bank statement was imported from.
+type BankStatementFormat string
+
+const (
+	BankStatementFormatOFX     BankStatementFormat = "ofx"
+	BankStatementFormatCAMT053 BankStatementFormat = "camt053"
+	BankStatementFormatCSV     BankStatementFormat = "csv"
+)
+
+type BankLineStatus string
+
+const (
+	BankLineStatusUnmatched BankLineStatus = "unmatched"
+	BankLineStatusMatched   BankLineStatus = "matched"
+	BankLineStatusIgnored   BankLineStatus = "ignored"
+)
+
+// BankMatchMethod tells whether a line was matched automatically on import or
+// by a user.
+type BankMatchMethod string
+
+const (
+	BankMatchMethodAuto   BankMatchMethod = "auto"
+	BankMatchMethodManual BankMatchMethod = "manual"
+)
+
+// BankStatement is a statement of the bank account petty cash funds are
+// topped up from. From and To span its lines' booking dates. Lines already
+// imported with an earlier statement are left out and counted in Duplicates.
+type BankStatement struct {
+	ID         uint                `gorm:"primaryKey" json:"id"`
+	Format     BankStatementFormat `json:"format"`
+	Filename   string              `json:"filename"`
+	Account    string              `gorm:"index" json:"account" example:"DE89370400440532013000"`
+	Currency   string              `gorm:"size:3" json:"currency"`
+	From       time.Time           `json:"from"`
+	To         time.Time           `json:"to"`
+	LineCount  int                 `json:"line_count"`
+	Duplicates int                 `json:"duplicates"`
+	ImportedBy string              `json:"imported_by"`
+	Lines      []BankStatementLine `gorm:"foreignKey:StatementID" json:"lines,omitempty"`
+	CreatedAt  time.Time           `json:"created_at"`
+}
+
+// BankStatementLine is one booking on a bank statement. Amount is negative
+// for withdrawals, which are matched to the petty cash credits they funded;
+// a credit is matched to at most one line. Deposits are imported as ignored.
+// EntryID is the bank's identifier of the booking, or a hash of its details
+// when the file has none, and is unique per account so re-imports skip it.
+type BankStatementLine struct {
+	ID            uint                  `gorm:"primaryKey" json:"id"`
+	StatementID   uint                  `gorm:"index" json:"statement_id"`
+	Account       string                `gorm:"uniqueIndex:idx_bank_statement_lines_entry" json:"account"`
+	EntryID       string                `gorm:"uniqueIndex:idx_bank_statement_lines_entry" json:"entry_id"`
+	BookingDate   time.Time             `gorm:"index" json:"booking_date"`
+	Amount        float64               `json:"amount"`
+	Currency      string                `gorm:"size:3" json:"currency"`
+	Reference     string                `json:"reference"`
+	Description   string                `json:"description"`
+	Counterparty  string                `json:"counterparty"`
+	Status        BankLineStatus        `gorm:"index" json:"status"`
+	TransactionID *uint                 `gorm:"uniqueIndex" json:"transaction_id"`
+	Transaction   *PettyCashTransaction `gorm:"foreignKey:TransactionID" json:"transaction,omitempty"`
+	MatchMethod   BankMatchMethod       `json:"match_method,omitempty"`
+	MatchedBy     string                `json:"matched_by"`
+	MatchedAt     *time.Time            `json:"matched_at"`
+	CreatedAt     time.Time             `json:"created_at"`
+	UpdatedAt     time.Time             `json:"updated_at"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type BudgetPeriod string
+
+const (
+	BudgetPeriodMonth   BudgetPeriod = "month"
+	BudgetPeriodQuarter BudgetPeriod = "quarter"
+	BudgetPeriodYear    BudgetPeriod = "year"
+)
+
+// OverspendAction is what happens to an expense that would push a budget
+// over its amount.
+type OverspendAction string
+
+const (
+	OverspendWarn            OverspendAction = "warn"
+	OverspendRequireApproval OverspendAction = "require_approval"
+	OverspendBlock           OverspendAction = "block"
+)
+
+// Budget caps spending on a category for every period from StartDate until
+// the optional EndDate. FundID, UserID and Department narrow it to expenses
+// paid from one fund, claimed by one user or tagged with one department.
+// Amounts are in the base currency.
+type Budget struct {
+	ID              uint            `gorm:"primaryKey" json:"id"`
+	Category        string          `gorm:"index" json:"category"`
+	FundID          *uint           `json:"fund_id"`
+	UserID          string          `json:"user_id"`
+	Department      string          `json:"department"`
+	Period          BudgetPeriod    `json:"period"`
+	Amount          float64         `json:"amount"`
+	OverspendAction OverspendAction `json:"overspend_action"`
+	StartDate       time.Time       `json:"start_date"`
+	EndDate         *time.Time      `json:"end_date"`
+	Active          bool            `json:"active"`
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt  `gorm:"index" json:"-"`
+}
+
+// BudgetAlert records that a budget crossed a utilization threshold in one
+// period, so each threshold is only notified once.
+type BudgetAlert struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	BudgetID    uint      `gorm:"uniqueIndex:idx_budget_alerts_budget_period_threshold" json:"budget_id"`
+	PeriodStart time.Time `gorm:"uniqueIndex:idx_budget_alerts_budget_period_threshold" json:"period_start"`
+	Threshold   int       `gorm:"uniqueIndex:idx_budget_alerts_budget_period_threshold" json:"threshold"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Category is a node in the expense category tree. Expenses are booked to
+// leaf categories; the rules of a category also apply to its descendants.
+// RequiredDimensions are the codes of dimensions its expenses must be tagged
+// with.
+type Category struct {
+	ID                 uint           `gorm:"primaryKey" json:"id"`
+	Name               string         `gorm:"uniqueIndex" json:"name"`
+	ParentID           *uint          `gorm:"index" json:"parent_id"`
+	GLAccount          string         `json:"gl_account"`
+	ReceiptRequired    bool           `json:"receipt_required"`
+	MaxAmount          *float64       `json:"max_amount"`
+	RequiredDimensions []string       `gorm:"serializer:json" json:"required_dimensions"`
+	Active             bool           `json:"active"`
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+	DeletedAt          gorm.DeletedAt `gorm:"index" json:"-"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// BaseCurrency returns BASE_CURRENCY, the currency amounts are reported and
+// limited in, defaulting to EUR.
+func BaseCurrency() string {
+	if currency := strings.ToUpper(strings.TrimSpace(os.Getenv("BASE_CURRENCY"))); currency != "" {
+		return currency
+	}
+	return "EUR"
+}
+
+// ExchangeRate is the value of one unit of Currency in the base currency,
+// in force from Date until the next rate for the currency.
+type ExchangeRate struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Currency  string    `gorm:"size:3;uniqueIndex:idx_exchange_rates_currency_date" json:"currency" example:"GBP"`
+	Date      time.Time `gorm:"uniqueIndex:idx_exchange_rates_currency_date" json:"date"`
+	Rate      float64   `json:"rate" example:"1.17"`
+	Source    string    `json:"source"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// DimensionDepartment is the code of the dimension budgets can be scoped to.
+const DimensionDepartment = "department"
+
+// Dimension is an axis spend is charged along, such as department, cost
+// center or project. Expenses and petty cash transactions are tagged with one
+// of its values. Every submitted expense must be tagged with a Required
+// dimension; categories can require further dimensions.
+type Dimension struct {
+	ID        uint             `gorm:"primaryKey" json:"id"`
+	Code      string           `gorm:"uniqueIndex" json:"code" example:"project"`
+	Name      string           `json:"name" example:"Project"`
+	Required  bool             `json:"required"`
+	Active    bool             `json:"active"`
+	Values    []DimensionValue `gorm:"foreignKey:DimensionID" json:"values,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// DimensionValue is one value of a dimension. Inactive values stay on the
+// expenses tagged with them but cannot be used for new ones.
+type DimensionValue struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	DimensionID uint      `gorm:"uniqueIndex:idx_dimension_values_dimension_code" json:"dimension_id"`
+	Code        string    `gorm:"uniqueIndex:idx_dimension_values_dimension_code" json:"code" example:"SALES"`
+	Name        string    `json:"name" example:"Sales"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
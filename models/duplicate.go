@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+type DuplicateStatus string
+
+const (
+	DuplicateStatusOpen      DuplicateStatus = "open"
+	DuplicateStatusDismissed DuplicateStatus = "dismissed"
+	DuplicateStatusConfirmed DuplicateStatus = "confirmed"
+)
+
+// Kinds of entries an expense can duplicate.
+const (
+	DuplicateMatchExpense     = "expense"
+	DuplicateMatchTransaction = "petty_cash_transaction"
+)
+
+// DuplicateFlag pairs a submitted expense with an earlier expense or petty
+// cash debit it likely duplicates. Score is 0-100; Reasons lists what
+// matched.
+type DuplicateFlag struct {
+	ID         uint            `gorm:"primaryKey" json:"id"`
+	ExpenseID  uint            `gorm:"index" json:"expense_id"`
+	Expense    *Expense        `gorm:"foreignKey:ExpenseID" json:"expense,omitempty"`
+	MatchType  string          `json:"match_type"`
+	MatchID    uint            `json:"match_id"`
+	Score      int             `json:"score"`
+	Reasons    []string        `gorm:"serializer:json" json:"reasons"`
+	Status     DuplicateStatus `gorm:"index" json:"status"`
+	ReviewedBy string          `json:"reviewed_by"`
+	ReviewedAt *time.Time      `json:"reviewed_at"`
+	ReviewNote string          `json:"review_note"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+type ExpenseReportStatus string
+
+const (
+	ExpenseReportStatusDraft             ExpenseReportStatus = "draft"
+	ExpenseReportStatusSubmitted         ExpenseReportStatus = "submitted"
+	ExpenseReportStatusApproved          ExpenseReportStatus = "approved"
+	ExpenseReportStatusPartiallyApproved ExpenseReportStatus = "partially_approved"
+	ExpenseReportStatusRejected          ExpenseReportStatus = "rejected"
+)
+
+// ExpenseReport is a claim grouping an employee's expenses, such as a trip
+// or a month, so they are submitted and reviewed together. Lines can be
+// rejected individually; the totals, in the base currency, follow the line
+// statuses.
+type ExpenseReport struct {
+	ID            uint                `gorm:"primaryKey" json:"id"`
+	UserID        string              `gorm:"index" json:"user_id"`
+	Title         string              `json:"title" example:"Berlin trip, October"`
+	Description   string              `json:"description"`
+	Status        ExpenseReportStatus `gorm:"index" json:"status"`
+	Total         float64             `json:"total"`
+	ApprovedTotal float64             `json:"approved_total"`
+	RejectedTotal float64             `json:"rejected_total"`
+	LineCount     int                 `json:"line_count"`
+	SubmittedAt   *time.Time          `json:"submitted_at"`
+	ReviewedBy    string              `json:"reviewed_by"`
+	ReviewedAt    *time.Time          `json:"reviewed_at"`
+	ReviewNote    string              `json:"review_note"`
+	Expenses      []Expense           `gorm:"foreignKey:ExpenseReportID" json:"expenses,omitempty"`
+	CreatedAt     time.Time           `json:"created_at"`
+	UpdatedAt     time.Time           `json:"updated_at"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Fund is a physical petty cash box. Every transaction belongs to one fund
+// and is in the fund's currency.
+type Fund struct {
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	Name        string         `gorm:"uniqueIndex" json:"name"`
+	Currency    string         `gorm:"size:3" json:"currency" example:"EUR"`
+	CustodianID string         `json:"custodian_id"`
+	Active      bool           `json:"active"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// SpendingLimit caps what a user may spend per entry, per day and per month.
+// A row with Role set applies to everyone with that role; a row with UserID
+// set overrides individual caps for one user. Nil caps are unlimited, or
+// inherited from the role for user rows. Caps are in the base currency.
+type SpendingLimit struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	Role           UserRole  `gorm:"uniqueIndex:idx_spending_limits_scope" json:"role"`
+	UserID         string    `gorm:"uniqueIndex:idx_spending_limits_scope" json:"user_id"`
+	PerTransaction *float64  `json:"per_transaction"`
+	Daily          *float64  `json:"daily"`
+	Monthly        *float64  `json:"monthly"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
@@ -13,26 +13,193 @@ const (
 	TransactionTypeDebit  TransactionType = "debit"
 )
 
+// PettyCashTransaction moves cash in or out of a petty cash fund, in the
+// fund's currency.
 type PettyCashTransaction struct {
-	ID          uint            `gorm:"primaryKey" json:"id"`
-	Type        TransactionType `json:"type"`
-	Amount      float64         `json:"amount"`
-	Description string          `json:"description"`
-	UserID      string          `json:"user_id"`
-	CreatedAt   time.Time       `json:"created_at"`
-	UpdatedAt   time.Time       `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt  `gorm:"index" json:"-"`
+	ID       uint            `gorm:"primaryKey" json:"id"`
+	FundID   uint            `gorm:"index" json:"fund_id"`
+	Type     TransactionType `json:"type"`
+	Amount   float64         `json:"amount"`
+	Currency string          `gorm:"size:3" json:"currency" example:"EUR"`
+	// ExchangeRate converts Amount to BaseAmount, in the base currency, at the
+	// rate of TransactionDate.
+	ExchangeRate float64 `json:"exchange_rate"`
+	BaseAmount   float64 `json:"base_amount"`
+
+	VendorID *uint `gorm:"index" json:"vendor_id"`
+	// Tags charge the transaction to dimension values.
+	Tags        Tags   `gorm:"serializer:json" json:"tags,omitempty"`
+	Description string `json:"description"`
+	// Reference is the bank transfer reference of a top-up, which bank
+	// statement lines are matched on.
+	Reference     string `gorm:"index" json:"reference" example:"TOPUP-2026-09"`
+	UserID        string `json:"user_id"`
+	CashAdvanceID *uint  `gorm:"index" json:"cash_advance_id"`
+
+	// TransactionDate is when the cash actually moved; CreatedAt is when the
+	// transaction was entered.
+	TransactionDate time.Time      `gorm:"index" json:"transaction_date"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
+// Tags map dimension codes to the codes of the values spend is charged to.
+type Tags map[string]string
+
+type ExpenseStatus string
+
+const (
+	ExpenseStatusDraft           ExpenseStatus = "draft"
+	ExpenseStatusPendingApproval ExpenseStatus = "pending_approval"
+	ExpenseStatusApproved        ExpenseStatus = "approved"
+	ExpenseStatusRejected        ExpenseStatus = "rejected"
+)
+
+// UncountedExpenseStatuses are the statuses of expenses that do not count as
+// spend in reports, budgets or limits.
+var UncountedExpenseStatuses = []ExpenseStatus{ExpenseStatusDraft, ExpenseStatusRejected}
+
+// Expense is a spend claim, in the currency it was paid in and converted to
+// the base currency.
 type Expense struct {
-	ID                      uint           `gorm:"primaryKey" json:"id"`
-	Title                   string         `json:"title"`
-	Amount                  float64        `json:"amount"`
-	Category                string         `json:"category"`
-	UserID                  string         `json:"user_id"`
-	PettyCashTransactionID  *uint          `json:"petty_cash_transaction_id"`
-	PettyCashTransaction    *PettyCashTransaction `gorm:"foreignKey:PettyCashTransactionID" json:"petty_cash_transaction,omitempty"`
-	CreatedAt               time.Time      `json:"created_at"`
-	UpdatedAt               time.Time      `json:"updated_at"`
-	DeletedAt               gorm.DeletedAt `gorm:"index" json:"-"`
+	ID    uint        `gorm:"primaryKey" json:"id"`
+	Title string      `json:"title"`
+	Type  ExpenseType `gorm:"index" json:"type" example:"receipt"`
+	// Calculation records how the Amount of a mileage or per diem expense,
+	// which has no receipt, was calculated from a rate table.
+	Calculation *ExpenseCalculation `gorm:"serializer:json" json:"calculation,omitempty"`
+
+	// Amount is the gross amount in Currency and BaseAmount its base-currency
+	// equivalent at the rate of ExpenseDate.
+	Amount       float64 `json:"amount"`
+	Currency     string  `gorm:"size:3;index" json:"currency" example:"EUR"`
+	ExchangeRate float64 `json:"exchange_rate"`
+	BaseAmount   float64 `json:"base_amount"`
+	// RefundedAmount is the part of Amount vendors have refunded. Only
+	// recording a refund changes it.
+	RefundedAmount float64 `json:"refunded_amount"`
+
+	// NetAmount and TaxAmount split Amount by the tax code and rate as booked.
+	TaxCodeID *uint   `gorm:"index" json:"tax_code_id"`
+	TaxCode   string  `json:"tax_code"`
+	TaxRate   float64 `json:"tax_rate"`
+	NetAmount float64 `json:"net_amount"`
+	TaxAmount float64 `json:"tax_amount"`
+
+	VendorID    *uint  `gorm:"index" json:"vendor_id"`
+	Vendor      string `json:"vendor"`
+	VendorTaxID string `json:"vendor_tax_id"`
+
+	// Category holds the name of the category as booked, so reports keep
+	// working for expenses recorded before the category tree existed.
+	Category   string `json:"category"`
+	CategoryID *uint  `gorm:"index" json:"category_id"`
+	// Tags charge the expense to dimension values.
+	Tags Tags `gorm:"serializer:json" json:"tags,omitempty"`
+
+	Receipt                string                `json:"receipt"`
+	ReceiptHash            string                `gorm:"index" json:"receipt_hash"`
+	Notes                  string                `json:"notes"`
+	Attendees              int                   `json:"attendees"`
+	UserID                 string                `json:"user_id"`
+	PettyCashTransactionID *uint                 `json:"petty_cash_transaction_id"`
+	PettyCashTransaction   *PettyCashTransaction `gorm:"foreignKey:PettyCashTransactionID" json:"petty_cash_transaction,omitempty"`
+	CashAdvanceID          *uint                 `gorm:"index" json:"cash_advance_id"`
+	ExpenseReportID        *uint                 `gorm:"index" json:"expense_report_id"`
+	// ExpenseDate is the date on the receipt; CreatedAt is when the expense
+	// was entered.
+	ExpenseDate time.Time     `gorm:"index" json:"expense_date"`
+	Status      ExpenseStatus `gorm:"index" json:"status"`
+	ReviewedBy  string        `json:"reviewed_by"`
+	ReviewedAt  *time.Time    `json:"reviewed_at"`
+	ReviewNote  string        `json:"review_note"`
+
+	// An expense with Splits is booked to the category of its largest split
+	// and its tax is the sum of theirs.
+	Splits           []ExpenseSplit    `gorm:"foreignKey:ExpenseID" json:"splits,omitempty"`
+	PolicyViolations []PolicyViolation `gorm:"foreignKey:ExpenseID" json:"policy_violations,omitempty"`
+	Justifications   map[string]string `gorm:"-" json:"justifications,omitempty"`
+	Warnings         []string          `gorm:"-" json:"warnings,omitempty"`
+	CreatedAt        time.Time         `json:"created_at"`
+	UpdatedAt        time.Time         `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt    `gorm:"index" json:"-"`
+}
+
+// ExpenseSplit is one line of an expense split across categories, tax codes
+// or dimension values; the splits of an expense add up to its amount. Amount
+// is gross, in the expense's currency, and BaseAmount is the split's share of
+// the expense's base amount. Tags are the expense's tags overridden by the
+// split's own.
+type ExpenseSplit struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	ExpenseID   uint      `gorm:"index" json:"expense_id"`
+	Description string    `json:"description"`
+	Amount      float64   `json:"amount"`
+	BaseAmount  float64   `json:"base_amount"`
+	Category    string    `json:"category"`
+	CategoryID  *uint     `gorm:"index" json:"category_id"`
+	TaxCodeID   *uint     `json:"tax_code_id"`
+	TaxCode     string    `json:"tax_code"`
+	TaxRate     float64   `json:"tax_rate"`
+	NetAmount   float64   `json:"net_amount"`
+	TaxAmount   float64   `json:"tax_amount"`
+	Tags        Tags      `gorm:"serializer:json" json:"tags,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// AfterCreate drops balance checkpoints the new transaction falls before.
+func (t *PettyCashTransaction) AfterCreate(tx *gorm.DB) error {
+	return invalidateCheckpoints(tx, t.TransactionDate)
+}
+
+// BeforeUpdate rejects edits to transactions dated inside a closed period and
+// drops balance checkpoints affected by the edit.
+func (t *PettyCashTransaction) BeforeUpdate(tx *gorm.DB) error {
+	if err := checkEditable(tx, &PettyCashTransaction{}, t.ID, "transaction_date", t.TransactionDate); err != nil {
+		return err
+	}
+	return t.invalidateStoredCheckpoints(tx)
+}
+
+// BeforeDelete rejects deleting transactions dated inside a closed period and
+// drops balance checkpoints that include them.
+func (t *PettyCashTransaction) BeforeDelete(tx *gorm.DB) error {
+	if err := checkEditable(tx, &PettyCashTransaction{}, t.ID, "transaction_date", time.Time{}); err != nil {
+		return err
+	}
+	return t.invalidateStoredCheckpoints(tx)
+}
+
+// invalidateStoredCheckpoints drops checkpoints from the earlier of the
+// stored and new transaction dates. Bulk writes without an ID drop them all.
+func (t *PettyCashTransaction) invalidateStoredCheckpoints(tx *gorm.DB) error {
+	if t.ID == 0 {
+		return invalidateCheckpoints(tx, time.Time{})
+	}
+	var stored []time.Time
+	if err := tx.Session(&gorm.Session{NewDB: true}).Unscoped().
+		Model(&PettyCashTransaction{}).
+		Where("id = ?", t.ID).
+		Pluck("transaction_date", &stored).Error; err != nil {
+		return err
+	}
+	date := t.TransactionDate
+	for _, d := range stored {
+		if date.IsZero() || d.Before(date) {
+			date = d
+		}
+	}
+	return invalidateCheckpoints(tx, date)
+}
+
+// BeforeUpdate rejects edits to expenses dated inside a closed period.
+func (e *Expense) BeforeUpdate(tx *gorm.DB) error {
+	return checkEditable(tx, &Expense{}, e.ID, "expense_date", e.ExpenseDate)
+}
+
+// BeforeDelete rejects deleting expenses dated inside a closed period.
+func (e *Expense) BeforeDelete(tx *gorm.DB) error {
+	return checkEditable(tx, &Expense{}, e.ID, "expense_date", time.Time{})
 }
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Notification is a message for one user, or for every user with Role when
+// UserID is empty.
+type Notification struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     string     `gorm:"index" json:"user_id"`
+	Role       UserRole   `gorm:"index" json:"role"`
+	Type       string     `json:"type"`
+	Message    string     `json:"message"`
+	EntityType string     `json:"entity_type"`
+	EntityID   uint       `json:"entity_id"`
+	ReadAt     *time.Time `json:"read_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type PeriodStatus string
+
+const (
+	PeriodStatusOpen   PeriodStatus = "open"
+	PeriodStatusClosed PeriodStatus = "closed"
+)
+
+var ErrPeriodLocked = errors.New("date falls within a closed accounting period")
+
+// AccountingPeriod is one month of a fiscal year. EndDate is exclusive: it is
+// the first instant of the following period. The balance fields are the
+// snapshot taken when the period was closed, in the base currency.
+type AccountingPeriod struct {
+	ID             uint         `gorm:"primaryKey" json:"id"`
+	Name           string       `gorm:"uniqueIndex" json:"name"`
+	FiscalYear     int          `gorm:"index" json:"fiscal_year"`
+	Number         int          `json:"number"`
+	StartDate      time.Time    `gorm:"index" json:"start_date"`
+	EndDate        time.Time    `gorm:"index" json:"end_date"`
+	Status         PeriodStatus `gorm:"index" json:"status"`
+	OpeningBalance float64      `json:"opening_balance"`
+	TotalCredits   float64      `json:"total_credits"`
+	TotalDebits    float64      `json:"total_debits"`
+	ClosingBalance float64      `json:"closing_balance"`
+	TotalExpenses  float64      `json:"total_expenses"`
+	ClosedAt       *time.Time   `json:"closed_at"`
+	ClosedBy       string       `json:"closed_by"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+}
+
+// LockDate returns the end of the latest closed period. Nothing dated before
+// it may be created or changed. A zero time means no period has been closed.
+func LockDate(tx *gorm.DB) (time.Time, error) {
+	var period AccountingPeriod
+	err := tx.Session(&gorm.Session{NewDB: true}).
+		Where("status = ?", PeriodStatusClosed).
+		Order("end_date desc").
+		Limit(1).
+		Find(&period).Error
+	if err != nil {
+		return time.Time{}, err
+	}
+	return period.EndDate, nil
+}
+
+// CheckPeriodOpen returns ErrPeriodLocked if date is before the lock date.
+func CheckPeriodOpen(tx *gorm.DB, date time.Time) error {
+	lockDate, err := LockDate(tx)
+	if err != nil {
+		return err
+	}
+	if !lockDate.IsZero() && date.Before(lockDate) {
+		return ErrPeriodLocked
+	}
+	return nil
+}
+
+// checkEditable guards updates and deletes of dated ledger entries: both the
+// stored date of the row and its new date must be outside closed periods.
+func checkEditable(tx *gorm.DB, model interface{}, id uint, dateColumn string, newDate time.Time) error {
+	if id != 0 {
+		var stored []time.Time
+		err := tx.Session(&gorm.Session{NewDB: true}).Unscoped().
+			Model(model).
+			Where("id = ?", id).
+			Pluck(dateColumn, &stored).Error
+		if err != nil {
+			return err
+		}
+		for _, date := range stored {
+			if err := CheckPeriodOpen(tx, date); err != nil {
+				return err
+			}
+		}
+	}
+	if !newDate.IsZero() {
+		return CheckPeriodOpen(tx, newDate)
+	}
+	return nil
+}
@@ -14,9 +14,83 @@ const (
 	// Expenses
 	PermissionExpensesCreate  Permission = "expenses.create"
 	PermissionExpensesViewOwn Permission = "expenses.view_own"
+	PermissionExpensesApprove Permission = "expenses.approve"
 
 	// Reports
 	PermissionReportsView Permission = "reports.view"
+
+	// Accounting Periods
+	PermissionPeriodsView   Permission = "periods.view"
+	PermissionPeriodsManage Permission = "periods.manage"
+	PermissionPeriodsReopen Permission = "periods.reopen"
+
+	// Audit
+	PermissionAuditView Permission = "audit.view"
+
+	// Funds
+	PermissionFundsManage Permission = "funds.manage"
+
+	// Reconciliations
+	PermissionReconciliationsCreate  Permission = "reconciliations.create"
+	PermissionReconciliationsView    Permission = "reconciliations.view"
+	PermissionReconciliationsApprove Permission = "reconciliations.approve"
+
+	// Budgets
+	PermissionBudgetsManage Permission = "budgets.manage"
+
+	// Notifications
+	PermissionNotificationsView Permission = "notifications.view"
+
+	// Categories
+	PermissionCategoriesView   Permission = "categories.view"
+	PermissionCategoriesManage Permission = "categories.manage"
+
+	// Spending limits
+	PermissionLimitsManage Permission = "limits.manage"
+
+	// Expense policies
+	PermissionPoliciesManage Permission = "policies.manage"
+
+	// Reimbursements
+	PermissionReimbursementsManage Permission = "reimbursements.manage"
+
+	// Cash advances
+	PermissionAdvancesManage Permission = "advances.manage"
+
+	// Exchange rates
+	PermissionExchangeRatesView   Permission = "exchange_rates.view"
+	PermissionExchangeRatesManage Permission = "exchange_rates.manage"
+
+	// Tax codes
+	PermissionTaxCodesView   Permission = "tax_codes.view"
+	PermissionTaxCodesManage Permission = "tax_codes.manage"
+
+	// Vendors
+	PermissionVendorsView   Permission = "vendors.view"
+	PermissionVendorsManage Permission = "vendors.manage"
+
+	// Dimensions
+	PermissionDimensionsView   Permission = "dimensions.view"
+	PermissionDimensionsManage Permission = "dimensions.manage"
+
+	// Recurring templates
+	PermissionRecurringManage Permission = "recurring.manage"
+
+	// Mileage and per diem rates
+	PermissionTravelRatesView   Permission = "travel_rates.view"
+	PermissionTravelRatesManage Permission = "travel_rates.manage"
+
+	// Refunds
+	PermissionRefundsManage Permission = "refunds.manage"
+
+	// Bulk imports
+	PermissionImportsManage Permission = "imports.manage"
+
+	// Accounting exports
+	PermissionAccountingExport Permission = "accounting.export"
+
+	// Bank statements
+	PermissionBankStatementsManage Permission = "bank_statements.manage"
 )
 
 var RolePermissions = map[UserRole][]Permission{
@@ -28,11 +102,51 @@ var RolePermissions = map[UserRole][]Permission{
 		PermissionExpensesCreate,
 		PermissionExpensesViewOwn,
 		PermissionReportsView,
+		PermissionPeriodsView,
+		PermissionPeriodsManage,
+		PermissionPeriodsReopen,
+		PermissionAuditView,
+		PermissionFundsManage,
+		PermissionReconciliationsCreate,
+		PermissionReconciliationsView,
+		PermissionReconciliationsApprove,
+		PermissionExpensesApprove,
+		PermissionBudgetsManage,
+		PermissionNotificationsView,
+		PermissionCategoriesView,
+		PermissionCategoriesManage,
+		PermissionLimitsManage,
+		PermissionPoliciesManage,
+		PermissionReimbursementsManage,
+		PermissionAdvancesManage,
+		PermissionExchangeRatesView,
+		PermissionExchangeRatesManage,
+		PermissionTaxCodesView,
+		PermissionTaxCodesManage,
+		PermissionVendorsView,
+		PermissionVendorsManage,
+		PermissionDimensionsView,
+		PermissionDimensionsManage,
+		PermissionRecurringManage,
+		PermissionTravelRatesView,
+		PermissionTravelRatesManage,
+		PermissionRefundsManage,
+		PermissionImportsManage,
+		PermissionAccountingExport,
+		PermissionBankStatementsManage,
 	},
 	RoleEmployee: {
 		PermissionAuthLogin,
 		PermissionPettyCashViewBalance,
 		PermissionExpensesCreate,
 		PermissionExpensesViewOwn,
+		PermissionReconciliationsCreate,
+		PermissionNotificationsView,
+		PermissionCategoriesView,
+		PermissionExchangeRatesView,
+		PermissionTaxCodesView,
+		PermissionVendorsView,
+		PermissionDimensionsView,
+		PermissionTravelRatesView,
 	},
 }
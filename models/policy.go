@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// PolicySeverity decides what a violation does to an expense. Hard
+// violations block submission; soft ones need a justification and send the
+// expense for approval.
+type PolicySeverity string
+
+const (
+	PolicySeverityHard PolicySeverity = "hard"
+	PolicySeveritySoft PolicySeverity = "soft"
+)
+
+// PolicyRule describes expenses that break an expense policy. An expense
+// violates the rule when it meets every condition that is set; a rule
+// without conditions never matches.
+type PolicyRule struct {
+	ID       uint           `gorm:"primaryKey" json:"id"`
+	Name     string         `json:"name" example:"Meals capped at 40 per person"`
+	Message  string         `json:"message" example:"Meals may not exceed 40 per attendee"`
+	Severity PolicySeverity `json:"severity"`
+	Active   bool           `json:"active"`
+
+	// Categories matches expenses booked to one of these categories or
+	// their subcategories.
+	Categories []string `gorm:"serializer:json" json:"categories"`
+	// Keywords matches expenses whose title or notes contain one of these
+	// words, ignoring case.
+	Keywords []string `gorm:"serializer:json" json:"keywords"`
+	// AmountAbove matches expenses of more than this amount in the base
+	// currency.
+	AmountAbove *float64 `json:"amount_above"`
+	// PerPersonAbove matches expenses of more than this amount per attendee.
+	PerPersonAbove *float64 `json:"per_person_above"`
+	// WeekendOnly matches expenses dated on a Saturday or Sunday.
+	WeekendOnly bool `json:"weekend_only"`
+	// ReceiptMissing matches expenses without a receipt.
+	ReceiptMissing bool `json:"receipt_missing"`
+	// NotesMissing matches expenses without notes.
+	NotesMissing bool `json:"notes_missing"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PolicyViolation is a rule an expense broke when it was last evaluated.
+// Rule details are copied so the record survives later rule changes.
+type PolicyViolation struct {
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	ExpenseID     uint           `gorm:"index" json:"expense_id"`
+	RuleID        uint           `gorm:"index" json:"rule_id"`
+	RuleName      string         `json:"rule_name"`
+	Severity      PolicySeverity `json:"severity"`
+	Message       string         `json:"message"`
+	Justification string         `json:"justification"`
+	CreatedAt     time.Time      `json:"created_at"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+type ReconciliationStatus string
+
+const (
+	ReconciliationStatusPending  ReconciliationStatus = "pending"
+	ReconciliationStatusApproved ReconciliationStatus = "approved"
+	ReconciliationStatusRejected ReconciliationStatus = "rejected"
+)
+
+// CashCountLine is the number of notes or coins of one denomination found
+// during a count.
+type CashCountLine struct {
+	ID               uint    `gorm:"primaryKey" json:"id"`
+	ReconciliationID uint    `gorm:"index" json:"-"`
+	Denomination     float64 `json:"denomination"`
+	Quantity         int     `json:"quantity"`
+	Total            float64 `json:"total"`
+}
+
+// Reconciliation is a physical cash count of a fund compared with the system
+// balance at the moment of counting. Variance is counted minus system: a
+// positive variance is cash over, a negative one cash short. Approving a
+// non-zero variance posts an adjustment transaction.
+type Reconciliation struct {
+	ID                      uint                  `gorm:"primaryKey" json:"id"`
+	FundID                  uint                  `gorm:"index" json:"fund_id"`
+	CountedBy               string                `json:"counted_by"`
+	CountedAt               time.Time             `gorm:"index" json:"counted_at"`
+	Lines                   []CashCountLine       `gorm:"foreignKey:ReconciliationID" json:"lines"`
+	CountedTotal            float64               `json:"counted_total"`
+	SystemBalance           float64               `json:"system_balance"`
+	Variance                float64               `json:"variance"`
+	Notes                   string                `json:"notes"`
+	Status                  ReconciliationStatus  `gorm:"index" json:"status"`
+	ReviewedBy              string                `json:"reviewed_by"`
+	ReviewedAt              *time.Time            `json:"reviewed_at"`
+	ReviewNote              string                `json:"review_note"`
+	AdjustmentTransactionID *uint                 `json:"adjustment_transaction_id"`
+	AdjustmentTransaction   *PettyCashTransaction `gorm:"foreignKey:AdjustmentTransactionID" json:"adjustment_transaction,omitempty"`
+	CreatedAt               time.Time             `json:"created_at"`
+	UpdatedAt               time.Time             `json:"updated_at"`
+}
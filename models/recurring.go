@@ -0,0 +1,98 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RecurringKind is what a recurring template creates on each run.
+type RecurringKind string
+
+const (
+	RecurringKindExpense     RecurringKind = "expense"
+	RecurringKindTransaction RecurringKind = "transaction"
+)
+
+// RecurringMode is whether runs are created for review or posted directly.
+// Draft expenses wait for their claimant to submit them; draft transactions
+// wait for someone to confirm the run.
+type RecurringMode string
+
+const (
+	RecurringModeDraft  RecurringMode = "draft"
+	RecurringModeSubmit RecurringMode = "submit"
+)
+
+type RecurringFrequency string
+
+const (
+	RecurringFrequencyWeekly  RecurringFrequency = "weekly"
+	RecurringFrequencyMonthly RecurringFrequency = "monthly"
+	RecurringFrequencyCron    RecurringFrequency = "cron"
+)
+
+// RecurringTemplate creates an expense or petty cash transaction on a
+// schedule. Weekly and monthly templates run every Interval weeks or months
+// on the weekday or day of month of StartDate, at its time of day; days past
+// the end of a month run on its last day. Cron templates run on a five-field
+// cron expression in UTC. Runs stop after EndDate. NextRunAt is the next run
+// due, or nil once the schedule has ended.
+type RecurringTemplate struct {
+	ID        uint               `gorm:"primaryKey" json:"id"`
+	Name      string             `json:"name" example:"Water delivery"`
+	Kind      RecurringKind      `json:"kind" example:"expense"`
+	Mode      RecurringMode      `json:"mode" example:"draft"`
+	Frequency RecurringFrequency `json:"frequency" example:"monthly"`
+	Interval  int                `json:"interval" example:"1"`
+	Cron      string             `json:"cron,omitempty" example:"0 9 1 * *"`
+	StartDate time.Time          `json:"start_date"`
+	EndDate   *time.Time         `json:"end_date"`
+	NextRunAt *time.Time         `gorm:"index" json:"next_run_at"`
+	LastRunAt *time.Time         `json:"last_run_at"`
+	UserID    string             `gorm:"index" json:"user_id"`
+
+	// What each run creates. Title is the expense title or the transaction
+	// description; Category, TaxCode and Notes only apply to expenses and
+	// FundID and Type only to transactions.
+	Title      string          `json:"title" example:"Water delivery"`
+	Amount     float64         `json:"amount" example:"42.50"`
+	Currency   string          `gorm:"size:3" json:"currency" example:"EUR"`
+	Category   string          `json:"category"`
+	CategoryID *uint           `json:"category_id"`
+	TaxCode    string          `json:"tax_code"`
+	VendorID   *uint           `json:"vendor_id"`
+	Notes      string          `json:"notes"`
+	Tags       Tags            `gorm:"serializer:json" json:"tags,omitempty"`
+	FundID     uint            `json:"fund_id"`
+	Type       TransactionType `json:"type"`
+
+	Active    bool           `json:"active"`
+	CreatedBy string         `json:"created_by"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+type RecurringRunStatus string
+
+const (
+	RecurringRunCreated RecurringRunStatus = "created"
+	RecurringRunPending RecurringRunStatus = "pending"
+	RecurringRunSkipped RecurringRunStatus = "skipped"
+	RecurringRunFailed  RecurringRunStatus = "failed"
+)
+
+// RecurringRun records one scheduled run of a template. There is at most one
+// run per template and scheduled time, which keeps a run from posting twice.
+type RecurringRun struct {
+	ID            uint               `gorm:"primaryKey" json:"id"`
+	TemplateID    uint               `gorm:"uniqueIndex:idx_recurring_runs_template_scheduled" json:"template_id"`
+	ScheduledFor  time.Time          `gorm:"uniqueIndex:idx_recurring_runs_template_scheduled" json:"scheduled_for"`
+	Status        RecurringRunStatus `gorm:"index" json:"status"`
+	ExpenseID     *uint              `json:"expense_id"`
+	TransactionID *uint              `json:"transaction_id"`
+	Error         string             `json:"error,omitempty"`
+	CreatedAt     time.Time          `json:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Refund is money returned by a vendor against an expense, for a return or a
+// partial refund. Amount is in the expense's currency and BaseAmount is
+// converted at the expense's own exchange rate, so refunding an expense in
+// full nets it to zero in the base currency. Refunds of expenses paid from
+// petty cash are credited back to the fund by PettyCashTransactionID.
+type Refund struct {
+	ID                     uint                  `gorm:"primaryKey" json:"id"`
+	ExpenseID              uint                  `gorm:"index" json:"expense_id"`
+	Amount                 float64               `json:"amount" example:"19.99"`
+	BaseAmount             float64               `json:"base_amount"`
+	Reason                 string                `json:"reason" example:"Returned damaged chair"`
+	RefundDate             time.Time             `gorm:"index" json:"refund_date"`
+	PettyCashTransactionID *uint                 `json:"petty_cash_transaction_id"`
+	PettyCashTransaction   *PettyCashTransaction `gorm:"foreignKey:PettyCashTransactionID" json:"petty_cash_transaction,omitempty"`
+	RecordedBy             string                `json:"recorded_by"`
+	CreatedAt              time.Time             `json:"created_at"`
+	UpdatedAt              time.Time             `json:"updated_at"`
+}
@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+type ReimbursementStatus string
+
+const (
+	ReimbursementStatusOwed    ReimbursementStatus = "owed"
+	ReimbursementStatusBatched ReimbursementStatus = "batched"
+	ReimbursementStatusPaid    ReimbursementStatus = "paid"
+)
+
+type ReimbursementBatchStatus string
+
+const (
+	BatchStatusOpen      ReimbursementBatchStatus = "open"
+	BatchStatusPaid      ReimbursementBatchStatus = "paid"
+	BatchStatusCancelled ReimbursementBatchStatus = "cancelled"
+)
+
+// Reimbursement is the amount owed to an employee for one approved
+// out-of-pocket expense, in the base currency. A refund of an expense whose
+// reimbursement was already batched or paid adds a negative line, linked to
+// the refund, for what the employee owes back.
+type Reimbursement struct {
+	ID        uint                `gorm:"primaryKey" json:"id"`
+	ExpenseID uint                `gorm:"index:idx_reimbursements_expense" json:"expense_id"`
+	Expense   *Expense            `gorm:"foreignKey:ExpenseID" json:"expense,omitempty"`
+	RefundID  *uint               `gorm:"uniqueIndex" json:"refund_id"`
+	UserID    string              `gorm:"index" json:"user_id"`
+	Amount    float64             `json:"amount"`
+	Status    ReimbursementStatus `gorm:"index" json:"status"`
+	BatchID   *uint               `gorm:"index" json:"batch_id"`
+	PaidAt    *time.Time          `json:"paid_at"`
+	CreatedAt time.Time           `json:"created_at"`
+	UpdatedAt time.Time           `json:"updated_at"`
+}
+
+// ReimbursementBatch groups reimbursements into one payout run.
+type ReimbursementBatch struct {
+	ID             uint                     `gorm:"primaryKey" json:"id"`
+	Reference      string                   `gorm:"uniqueIndex" json:"reference"`
+	Status         ReimbursementBatchStatus `gorm:"index" json:"status"`
+	ExecutionDate  time.Time                `json:"execution_date"`
+	Total          float64                  `json:"total"`
+	Count          int                      `json:"count"`
+	CreatedBy      string                   `json:"created_by"`
+	ExportedAt     *time.Time               `json:"exported_at"`
+	PaidAt         *time.Time               `json:"paid_at"`
+	PaidBy         string                   `json:"paid_by"`
+	Reimbursements []Reimbursement          `gorm:"foreignKey:BatchID" json:"reimbursements,omitempty"`
+	CreatedAt      time.Time                `json:"created_at"`
+	UpdatedAt      time.Time                `json:"updated_at"`
+}
+
+// BankAccount is where an employee's reimbursements are paid.
+type BankAccount struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	UserID        string    `gorm:"uniqueIndex" json:"user_id"`
+	AccountHolder string    `json:"account_holder" example:"Jane Doe"`
+	IBAN          string    `json:"iban" example:"DE89370400440532013000"`
+	BIC           string    `json:"bic" example:"COBADEFFXXX"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
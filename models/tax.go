@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TaxCode is a VAT/GST rate expenses can be booked with. Rate is a
+// percentage of the net amount. Expenses without a tax code are exempt.
+type TaxCode struct {
+	ID                  uint           `gorm:"primaryKey" json:"id"`
+	Code                string         `gorm:"uniqueIndex" json:"code" example:"VAT20"`
+	Name                string         `json:"name" example:"Standard rate"`
+	Rate                float64        `json:"rate" example:"20"`
+	VendorTaxIDRequired bool           `json:"vendor_tax_id_required"`
+	Active              bool           `json:"active"`
+	CreatedAt           time.Time      `json:"created_at"`
+	UpdatedAt           time.Time      `json:"updated_at"`
+	DeletedAt           gorm.DeletedAt `gorm:"index" json:"-"`
+}
@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// ExpenseType is what an expense claims: a receipt, or an amount calculated
+// from a rate table.
+type ExpenseType string
+
+const (
+	ExpenseTypeReceipt ExpenseType = "receipt"
+	ExpenseTypeMileage ExpenseType = "mileage"
+	ExpenseTypePerDiem ExpenseType = "per_diem"
+)
+
+// Calculated reports whether the amount of expenses of this type comes from
+// a rate table rather than a receipt.
+func (t ExpenseType) Calculated() bool {
+	return t == ExpenseTypeMileage || t == ExpenseTypePerDiem
+}
+
+// ExpenseCalculation is what a mileage or per diem amount was calculated
+// from. Claimants give the vehicle type and distance, or the destination and
+// days; the rate in force on the expense date is filled in.
+type ExpenseCalculation struct {
+	VehicleType   string    `json:"vehicle_type,omitempty" example:"car"`
+	Distance      float64   `json:"distance,omitempty" example:"120"`
+	Destination   string    `json:"destination,omitempty" example:"DE-BER"`
+	Days          float64   `json:"days,omitempty" example:"2.5"`
+	RateID        uint      `json:"rate_id"`
+	Rate          float64   `json:"rate"`
+	Currency      string    `json:"currency"`
+	EffectiveFrom time.Time `json:"effective_from"`
+	Formula       string    `json:"formula" example:"120 km x 0.30 EUR"`
+}
+
+// MileageRate is the amount paid per kilometre driven in a type of vehicle,
+// in force from EffectiveFrom until the next rate for the vehicle type.
+type MileageRate struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	VehicleType   string    `gorm:"uniqueIndex:idx_mileage_rates_vehicle_effective" json:"vehicle_type" example:"car"`
+	EffectiveFrom time.Time `gorm:"uniqueIndex:idx_mileage_rates_vehicle_effective" json:"effective_from"`
+	Rate          float64   `json:"rate" example:"0.30"`
+	Currency      string    `gorm:"size:3" json:"currency" example:"EUR"`
+	CreatedBy     string    `json:"created_by"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// PerDiemRate is the daily allowance for travel to a destination, in force
+// from EffectiveFrom until the next rate for the destination.
+type PerDiemRate struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	Destination   string    `gorm:"uniqueIndex:idx_per_diem_rates_destination_effective" json:"destination" example:"DE-BER"`
+	EffectiveFrom time.Time `gorm:"uniqueIndex:idx_per_diem_rates_destination_effective" json:"effective_from"`
+	DailyRate     float64   `json:"daily_rate" example:"28"`
+	Currency      string    `gorm:"size:3" json:"currency" example:"EUR"`
+	CreatedBy     string    `json:"created_by"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Vendor is a shop or payee expenses and petty cash debits are paid to.
+// Aliases are other names it appears under on receipts. A vendor merged into
+// another is deleted and MergedIntoID points at the vendor that replaced it.
+type Vendor struct {
+	ID                uint           `gorm:"primaryKey" json:"id"`
+	Name              string         `gorm:"uniqueIndex" json:"name" example:"Paper & Co"`
+	TaxID             string         `json:"tax_id" example:"DE123456789"`
+	Aliases           []string       `gorm:"serializer:json" json:"aliases"`
+	DefaultCategoryID *uint          `json:"default_category_id"`
+	Active            bool           `json:"active"`
+	MergedIntoID      *uint          `gorm:"index" json:"merged_into_id,omitempty"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt `gorm:"index" json:"-"`
+}
@@ -37,6 +37,7 @@ func SetupRouter() *gin.Engine {
 		pc.POST("", h.CreatePettyCashTransaction) 
 		pc.GET("", middleware.PermissionMiddleware(models.PermissionPettyCashViewList), h.ListPettyCashTransactions)
 		pc.GET("/balance", middleware.PermissionMiddleware(models.PermissionPettyCashViewBalance), h.GetPettyCashBalance)
+		pc.GET("/ledger", middleware.PermissionMiddleware(models.PermissionPettyCashViewList), h.GetPettyCashLedger)
 	}
 
 	// Expense Routes
@@ -44,6 +45,30 @@ func SetupRouter() *gin.Engine {
 	{
 		ex.POST("", middleware.PermissionMiddleware(models.PermissionExpensesCreate), h.CreateExpense)
 		ex.GET("", middleware.PermissionMiddleware(models.PermissionExpensesViewOwn), h.ListExpenses)
+		ex.PUT("/:id", middleware.PermissionMiddleware(models.PermissionExpensesCreate), h.UpdateDraftExpense)
+		ex.POST("/:id/submit", middleware.PermissionMiddleware(models.PermissionExpensesCreate), h.SubmitExpense)
+		ex.POST("/:id/receipt", middleware.PermissionMiddleware(models.PermissionExpensesCreate), h.UploadReceipt)
+		ex.GET("/:id/receipt", middleware.PermissionMiddleware(models.PermissionExpensesViewOwn), h.GetReceipt)
+		ex.POST("/:id/refunds", middleware.PermissionMiddleware(models.PermissionRefundsManage), h.RecordRefund)
+		ex.GET("/:id/refunds", middleware.PermissionMiddleware(models.PermissionExpensesViewOwn), h.ListRefunds)
+		ex.POST("/:id/approve", middleware.PermissionMiddleware(models.PermissionExpensesApprove), h.ApproveExpense)
+		ex.POST("/:id/reject", middleware.PermissionMiddleware(models.PermissionExpensesApprove), h.RejectExpense)
+	}
+
+	// Expense Report Routes
+	er := protected.Group("/expense-reports")
+	{
+		er.POST("", middleware.PermissionMiddleware(models.PermissionExpensesCreate), h.CreateExpenseReport)
+		er.GET("", middleware.PermissionMiddleware(models.PermissionExpensesViewOwn), h.ListExpenseReports)
+		er.GET("/:id", middleware.PermissionMiddleware(models.PermissionExpensesViewOwn), h.GetExpenseReport)
+		er.PUT("/:id", middleware.PermissionMiddleware(models.PermissionExpensesCreate), h.UpdateExpenseReport)
+		er.DELETE("/:id", middleware.PermissionMiddleware(models.PermissionExpensesCreate), h.DeleteExpenseReport)
+		er.POST("/:id/expenses", middleware.PermissionMiddleware(models.PermissionExpensesCreate), h.AddExpenseReportLines)
+		er.DELETE("/:id/expenses/:expense_id", middleware.PermissionMiddleware(models.PermissionExpensesCreate), h.RemoveExpenseReportLine)
+		er.POST("/:id/submit", middleware.PermissionMiddleware(models.PermissionExpensesCreate), h.SubmitExpenseReport)
+		er.POST("/:id/approve", middleware.PermissionMiddleware(models.PermissionExpensesApprove), h.ApproveExpenseReport)
+		er.POST("/:id/reject", middleware.PermissionMiddleware(models.PermissionExpensesApprove), h.RejectExpenseReport)
+		er.GET("/:id/export", middleware.PermissionMiddleware(models.PermissionExpensesViewOwn), h.ExportExpenseReport)
 	}
 
 	// Reporting Routes
@@ -52,7 +77,255 @@ func SetupRouter() *gin.Engine {
 	{
 		rp.GET("/expenses-summary", h.GetExpenseSummary)
 		rp.GET("/petty-cash-summary", h.GetPettyCashSummary)
+		rp.GET("/reconciliations", h.GetReconciliationReport)
+		rp.GET("/budget-vs-actual", h.GetBudgetVsActual)
+		rp.GET("/policy-violations", h.GetPolicyViolationReport)
+		rp.GET("/outstanding-advances", h.GetAdvanceAgeingReport)
+		rp.GET("/tax-summary", h.GetTaxReport)
+		rp.GET("/tax-summary/export", h.ExportTaxReport)
+		rp.GET("/spend-by-vendor", h.GetVendorSpendReport)
+		rp.GET("/bank-reconciliation", h.GetBankReconciliationReport)
+	}
+
+	// Fund Routes
+	fd := protected.Group("/funds")
+	{
+		fd.POST("", middleware.PermissionMiddleware(models.PermissionFundsManage), h.CreateFund)
+		fd.GET("", middleware.PermissionMiddleware(models.PermissionPettyCashViewBalance), h.ListFunds)
+		fd.PUT("/:id", middleware.PermissionMiddleware(models.PermissionFundsManage), h.UpdateFund)
+	}
+
+	// Reconciliation Routes
+	rc := protected.Group("/reconciliations")
+	{
+		rc.POST("", middleware.PermissionMiddleware(models.PermissionReconciliationsCreate), h.CreateReconciliation)
+		rc.GET("", middleware.PermissionMiddleware(models.PermissionReconciliationsView), h.ListReconciliations)
+		rc.GET("/:id", middleware.PermissionMiddleware(models.PermissionReconciliationsView), h.GetReconciliation)
+		rc.POST("/:id/approve", middleware.PermissionMiddleware(models.PermissionReconciliationsApprove), h.ApproveReconciliation)
+		rc.POST("/:id/reject", middleware.PermissionMiddleware(models.PermissionReconciliationsApprove), h.RejectReconciliation)
+	}
+
+	// Category Routes
+	ct := protected.Group("/categories")
+	{
+		ct.POST("", middleware.PermissionMiddleware(models.PermissionCategoriesManage), h.CreateCategory)
+		ct.GET("", middleware.PermissionMiddleware(models.PermissionCategoriesView), h.ListCategories)
+		ct.GET("/:id", middleware.PermissionMiddleware(models.PermissionCategoriesView), h.GetCategory)
+		ct.PUT("/:id", middleware.PermissionMiddleware(models.PermissionCategoriesManage), h.UpdateCategory)
+		ct.DELETE("/:id", middleware.PermissionMiddleware(models.PermissionCategoriesManage), h.DeleteCategory)
+	}
+
+	// Duplicate Review Routes
+	dp := protected.Group("/duplicates")
+	dp.Use(middleware.PermissionMiddleware(models.PermissionExpensesApprove))
+	{
+		dp.GET("", h.ListDuplicateFlags)
+		dp.POST("/:id/dismiss", h.DismissDuplicateFlag)
+		dp.POST("/:id/confirm", h.ConfirmDuplicateFlag)
+	}
+
+	// Policy Rule Routes
+	pl := protected.Group("/policy-rules")
+	pl.Use(middleware.PermissionMiddleware(models.PermissionPoliciesManage))
+	{
+		pl.POST("", h.CreatePolicyRule)
+		pl.GET("", h.ListPolicyRules)
+		pl.PUT("/:id", h.UpdatePolicyRule)
+		pl.DELETE("/:id", h.DeletePolicyRule)
+	}
+
+	// Cash Advance Routes
+	ad := protected.Group("/advances")
+	ad.Use(middleware.PermissionMiddleware(models.PermissionAdvancesManage))
+	{
+		ad.POST("", h.IssueAdvance)
+		ad.GET("", h.ListAdvances)
+		ad.GET("/:id", h.GetAdvance)
+		ad.POST("/:id/liquidate", h.LiquidateAdvance)
+	}
+	protected.GET("/me/advances", h.ListMyAdvances)
+
+	// Tax Code Routes
+	tc := protected.Group("/tax-codes")
+	{
+		tc.POST("", middleware.PermissionMiddleware(models.PermissionTaxCodesManage), h.CreateTaxCode)
+		tc.GET("", middleware.PermissionMiddleware(models.PermissionTaxCodesView), h.ListTaxCodes)
+		tc.GET("/:id", middleware.PermissionMiddleware(models.PermissionTaxCodesView), h.GetTaxCode)
+		tc.PUT("/:id", middleware.PermissionMiddleware(models.PermissionTaxCodesManage), h.UpdateTaxCode)
+		tc.DELETE("/:id", middleware.PermissionMiddleware(models.PermissionTaxCodesManage), h.DeleteTaxCode)
+	}
+
+	// Vendor Routes
+	vd := protected.Group("/vendors")
+	{
+		vd.POST("", middleware.PermissionMiddleware(models.PermissionVendorsManage), h.CreateVendor)
+		vd.GET("", middleware.PermissionMiddleware(models.PermissionVendorsView), h.ListVendors)
+		vd.GET("/match", middleware.PermissionMiddleware(models.PermissionVendorsView), h.MatchVendor)
+		vd.GET("/:id", middleware.PermissionMiddleware(models.PermissionVendorsView), h.GetVendor)
+		vd.PUT("/:id", middleware.PermissionMiddleware(models.PermissionVendorsManage), h.UpdateVendor)
+		vd.DELETE("/:id", middleware.PermissionMiddleware(models.PermissionVendorsManage), h.DeleteVendor)
+		vd.POST("/:id/merge", middleware.PermissionMiddleware(models.PermissionVendorsManage), h.MergeVendors)
+	}
+
+	// Dimension Routes
+	dm := protected.Group("/dimensions")
+	{
+		dm.POST("", middleware.PermissionMiddleware(models.PermissionDimensionsManage), h.CreateDimension)
+		dm.GET("", middleware.PermissionMiddleware(models.PermissionDimensionsView), h.ListDimensions)
+		dm.GET("/:id", middleware.PermissionMiddleware(models.PermissionDimensionsView), h.GetDimension)
+		dm.PUT("/:id", middleware.PermissionMiddleware(models.PermissionDimensionsManage), h.UpdateDimension)
+		dm.POST("/:id/values", middleware.PermissionMiddleware(models.PermissionDimensionsManage), h.CreateDimensionValue)
+		dm.PUT("/:id/values/:value_id", middleware.PermissionMiddleware(models.PermissionDimensionsManage), h.UpdateDimensionValue)
+	}
+
+	// Recurring Routes
+	rt := protected.Group("/recurring-templates")
+	{
+		rt.POST("", middleware.PermissionMiddleware(models.PermissionExpensesCreate), h.CreateRecurringTemplate)
+		rt.GET("", middleware.PermissionMiddleware(models.PermissionExpensesCreate), h.ListRecurringTemplates)
+		rt.GET("/:id", middleware.PermissionMiddleware(models.PermissionExpensesCreate), h.GetRecurringTemplate)
+		rt.PUT("/:id", middleware.PermissionMiddleware(models.PermissionExpensesCreate), h.UpdateRecurringTemplate)
+		rt.DELETE("/:id", middleware.PermissionMiddleware(models.PermissionExpensesCreate), h.DeleteRecurringTemplate)
+		rt.GET("/:id/runs", middleware.PermissionMiddleware(models.PermissionExpensesCreate), h.ListRecurringRuns)
+	}
+	rr := protected.Group("/recurring-runs")
+	{
+		rr.POST("/:id/confirm", middleware.PermissionMiddleware(models.PermissionExpensesCreate), h.ConfirmRecurringRun)
+		rr.POST("/:id/skip", middleware.PermissionMiddleware(models.PermissionExpensesCreate), h.SkipRecurringRun)
+	}
+
+	// Import Routes
+	im := protected.Group("/imports")
+	{
+		im.POST("/expenses", middleware.PermissionMiddleware(models.PermissionImportsManage), h.ImportExpenses)
+		im.POST("/transactions", middleware.PermissionMiddleware(models.PermissionImportsManage), h.ImportPettyCashTransactions)
+	}
+
+	// Accounting Export Routes
+	ap := protected.Group("/accounting-export-profiles")
+	ap.Use(middleware.PermissionMiddleware(models.PermissionAccountingExport))
+	{
+		ap.POST("", h.CreateAccountingProfile)
+		ap.GET("", h.ListAccountingProfiles)
+		ap.GET("/:id", h.GetAccountingProfile)
+		ap.PUT("/:id", h.UpdateAccountingProfile)
+		ap.DELETE("/:id", h.DeleteAccountingProfile)
+	}
+	ae := protected.Group("/accounting-exports")
+	ae.Use(middleware.PermissionMiddleware(models.PermissionAccountingExport))
+	{
+		ae.POST("", h.CreateAccountingExport)
+		ae.GET("", h.ListAccountingExports)
+		ae.GET("/:id", h.GetAccountingExport)
+		ae.GET("/:id/download", h.DownloadAccountingExport)
+		ae.POST("/:id/void", h.VoidAccountingExport)
+	}
+
+	// Bank Statement Routes
+	bs := protected.Group("/bank-statements")
+	bs.Use(middleware.PermissionMiddleware(models.PermissionBankStatementsManage))
+	{
+		bs.POST("", h.ImportBankStatement)
+		bs.GET("", h.ListBankStatements)
+		bs.POST("/match", h.RunBankMatching)
+		bs.GET("/:id", h.GetBankStatement)
+	}
+	bl := protected.Group("/bank-statement-lines")
+	bl.Use(middleware.PermissionMiddleware(models.PermissionBankStatementsManage))
+	{
+		bl.GET("", h.ListBankStatementLines)
+		bl.GET("/:id/candidates", h.ListBankMatchCandidates)
+		bl.POST("/:id/match", h.MatchBankStatementLine)
+		bl.POST("/:id/unmatch", h.UnmatchBankStatementLine)
+		bl.POST("/:id/ignore", h.IgnoreBankStatementLine)
+	}
+
+	// Mileage and Per Diem Rate Routes
+	mr := protected.Group("/mileage-rates")
+	{
+		mr.GET("", middleware.PermissionMiddleware(models.PermissionTravelRatesView), h.ListMileageRates)
+		mr.POST("", middleware.PermissionMiddleware(models.PermissionTravelRatesManage), h.SetMileageRate)
+		mr.DELETE("/:id", middleware.PermissionMiddleware(models.PermissionTravelRatesManage), h.DeleteMileageRate)
+	}
+	pd := protected.Group("/per-diem-rates")
+	{
+		pd.GET("", middleware.PermissionMiddleware(models.PermissionTravelRatesView), h.ListPerDiemRates)
+		pd.POST("", middleware.PermissionMiddleware(models.PermissionTravelRatesManage), h.SetPerDiemRate)
+		pd.DELETE("/:id", middleware.PermissionMiddleware(models.PermissionTravelRatesManage), h.DeletePerDiemRate)
+	}
+
+	// Exchange Rate Routes
+	xr := protected.Group("/exchange-rates")
+	{
+		xr.GET("", middleware.PermissionMiddleware(models.PermissionExchangeRatesView), h.ListExchangeRates)
+		xr.POST("", middleware.PermissionMiddleware(models.PermissionExchangeRatesManage), h.SetExchangeRate)
+		xr.POST("/import", middleware.PermissionMiddleware(models.PermissionExchangeRatesManage), h.ImportExchangeRates)
+		xr.DELETE("/:id", middleware.PermissionMiddleware(models.PermissionExchangeRatesManage), h.DeleteExchangeRate)
 	}
 
+	// Reimbursement Routes
+	rb := protected.Group("/reimbursements")
+	rb.Use(middleware.PermissionMiddleware(models.PermissionReimbursementsManage))
+	{
+		rb.GET("", h.ListReimbursements)
+		rb.GET("/payables", h.ListPayables)
+	}
+	bt := protected.Group("/reimbursement-batches")
+	bt.Use(middleware.PermissionMiddleware(models.PermissionReimbursementsManage))
+	{
+		bt.POST("", h.CreateReimbursementBatch)
+		bt.GET("", h.ListReimbursementBatches)
+		bt.GET("/:id", h.GetReimbursementBatch)
+		bt.GET("/:id/export", h.ExportReimbursementBatch)
+		bt.POST("/:id/paid", h.MarkReimbursementBatchPaid)
+		bt.POST("/:id/cancel", h.CancelReimbursementBatch)
+	}
+	protected.PUT("/users/:id/bank-account", middleware.PermissionMiddleware(models.PermissionReimbursementsManage), h.SetUserBankAccount)
+	protected.GET("/me/reimbursements", h.ListMyReimbursements)
+	protected.GET("/me/bank-account", h.GetMyBankAccount)
+	protected.PUT("/me/bank-account", h.SetMyBankAccount)
+
+	// Spending Limit Routes
+	lm := protected.Group("/limits")
+	lm.Use(middleware.PermissionMiddleware(models.PermissionLimitsManage))
+	{
+		lm.GET("", h.ListLimits)
+		lm.PUT("/roles/:role", h.SetRoleLimit)
+		lm.PUT("/users/:id", h.SetUserLimit)
+		lm.DELETE("/:id", h.DeleteLimit)
+	}
+	protected.GET("/me/limits", h.GetMyLimits)
+
+	// Budget Routes
+	bg := protected.Group("/budgets")
+	bg.Use(middleware.PermissionMiddleware(models.PermissionBudgetsManage))
+	{
+		bg.POST("", h.CreateBudget)
+		bg.GET("", h.ListBudgets)
+		bg.PUT("/:id", h.UpdateBudget)
+		bg.DELETE("/:id", h.DeleteBudget)
+	}
+
+	// Notification Routes
+	nt := protected.Group("/notifications")
+	nt.Use(middleware.PermissionMiddleware(models.PermissionNotificationsView))
+	{
+		nt.GET("", h.ListNotifications)
+		nt.POST("/:id/read", h.MarkNotificationRead)
+	}
+
+	// Accounting Period Routes
+	pr := protected.Group("/periods")
+	{
+		pr.POST("", middleware.PermissionMiddleware(models.PermissionPeriodsManage), h.CreateFiscalYear)
+		pr.GET("", middleware.PermissionMiddleware(models.PermissionPeriodsView), h.ListPeriods)
+		pr.GET("/lock-date", middleware.PermissionMiddleware(models.PermissionPeriodsView), h.GetLockDate)
+		pr.POST("/:id/close", middleware.PermissionMiddleware(models.PermissionPeriodsManage), h.ClosePeriod)
+		pr.POST("/:id/reopen", middleware.PermissionMiddleware(models.PermissionPeriodsReopen), h.ReopenPeriod)
+	}
+
+	// Audit Routes
+	protected.GET("/audit-logs", middleware.PermissionMiddleware(models.PermissionAuditView), h.ListAuditLogs)
+
 	return r
 }
\ No newline at end of file
@@ -0,0 +1,394 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"ledgerly/models"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// journalContentTypes and journalExtensions describe the file of each
+// accounting format.
+var (
+	journalContentTypes = map[models.AccountingFormat]string{
+		models.AccountingFormatQuickBooksIIF: "text/plain",
+		models.AccountingFormatXeroCSV:       "text/csv",
+		models.AccountingFormatTallyXML:      "application/xml",
+	}
+	journalExtensions = map[models.AccountingFormat]string{
+		models.AccountingFormatQuickBooksIIF: ".iif",
+		models.AccountingFormatXeroCSV:       ".csv",
+		models.AccountingFormatTallyXML:      ".xml",
+	}
+)
+
+// journalEntry is one balanced journal in the base currency: an approved
+// expense, or a refund reversing part of one. The first line is the petty
+// cash or payable side and the rest are the expense accounts.
+type journalEntry struct {
+	Number     string
+	Date       time.Time
+	Memo       string
+	EntityType string
+	EntityID   uint
+	Lines      []journalLine
+}
+
+// journalLine posts Amount to Account: debits are positive and credits
+// negative. Tags are the dimension values of expense lines.
+type journalLine struct {
+	Account string
+	Amount  float64
+	Tags    models.Tags
+}
+
+// accountResolver finds the external account of a category for a profile.
+type accountResolver struct {
+	profile    *models.AccountingExportProfile
+	mapped     map[uint]string
+	categories map[uint]models.Category
+}
+
+func newAccountResolver(tx *gorm.DB, profile *models.AccountingExportProfile) (*accountResolver, error) {
+	var categories []models.Category
+	if err := tx.Unscoped().Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	r := &accountResolver{
+		profile:    profile,
+		mapped:     make(map[uint]string, len(profile.Accounts)),
+		categories: make(map[uint]models.Category, len(categories)),
+	}
+	for _, mapping := range profile.Accounts {
+		r.mapped[mapping.CategoryID] = mapping.Account
+	}
+	for _, c := range categories {
+		r.categories[c.ID] = c
+	}
+	return r, nil
+}
+
+// account returns the account spend booked to a category is debited to: the
+// profile's mapping of the category or its closest mapped ancestor, else the
+// closest GL account on the category tree, else the profile's default.
+func (r *accountResolver) account(categoryID *uint, category string) (string, error) {
+	for id, seen := categoryID, make(map[uint]bool); id != nil && !seen[*id]; {
+		seen[*id] = true
+		if account := r.mapped[*id]; account != "" {
+			return account, nil
+		}
+		c, ok := r.categories[*id]
+		if !ok {
+			break
+		}
+		if c.GLAccount != "" {
+			return c.GLAccount, nil
+		}
+		id = c.ParentID
+	}
+	if r.profile.DefaultAccount != "" {
+		return r.profile.DefaultAccount, nil
+	}
+	return "", fmt.Errorf("category %s has no account in profile %s", category, r.profile.Name)
+}
+
+// accountingJournal builds the journal entries of the approved expenses and
+// the refunds of approved expenses dated within dates that the profile has
+// not exported yet, in date order.
+func accountingJournal(tx *gorm.DB, profile *models.AccountingExportProfile, dates DateRange) ([]journalEntry, error) {
+	accounts, err := newAccountResolver(tx, profile)
+	if err != nil {
+		return nil, err
+	}
+	unexported := func(entityType, table string) *gorm.DB {
+		return tx.Where("NOT EXISTS (SELECT 1 FROM accounting_export_records r WHERE r.profile_id = ? AND r.entity_type = ? AND r.entity_id = "+table+".id)",
+			profile.ID, entityType)
+	}
+
+	var expenses []models.Expense
+	err = dates.apply(unexported(accountingEntityExpense, "expenses"), "expense_date").
+		Preload("Splits").Where("status = ?", models.ExpenseStatusApproved).
+		Order("expense_date, id").Find(&expenses).Error
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]journalEntry, 0, len(expenses))
+	for i := range expenses {
+		entry, err := expenseJournal(&expenses[i], accounts)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	var refunds []models.Refund
+	err = dates.apply(unexported(accountingEntityRefund, "refunds"), "refund_date").
+		Joins("JOIN expenses ON expenses.id = refunds.expense_id AND expenses.deleted_at IS NULL").
+		Where("expenses.status = ?", models.ExpenseStatusApproved).
+		Order("refund_date, refunds.id").Find(&refunds).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, refund := range refunds {
+		var expense models.Expense
+		if err := tx.Preload("Splits").First(&expense, refund.ExpenseID).Error; err != nil {
+			return nil, err
+		}
+		entry, err := refundJournal(refund, &expense, accounts)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Date.Before(entries[j].Date)
+	})
+	return entries, nil
+}
+
+// expenseJournal debits an expense, split by split, to the accounts of its
+// categories and credits petty cash or the employee payable.
+func expenseJournal(expense *models.Expense, accounts *accountResolver) (journalEntry, error) {
+	counterpart := accounts.profile.PayableAccount
+	if expense.PettyCashTransactionID != nil {
+		counterpart = accounts.profile.PettyCashAccount
+	}
+	entry := journalEntry{
+		Number:     fmt.Sprintf("EXP-%d", expense.ID),
+		Date:       expense.ExpenseDate,
+		Memo:       expense.Title,
+		EntityType: accountingEntityExpense,
+		EntityID:   expense.ID,
+		Lines:      []journalLine{{Account: counterpart}},
+	}
+	if expense.Vendor != "" {
+		entry.Memo += " (" + expense.Vendor + ")"
+	}
+
+	splits := expense.Splits
+	if len(splits) == 0 {
+		splits = []models.ExpenseSplit{{
+			BaseAmount: expense.BaseAmount,
+			Category:   expense.Category,
+			CategoryID: expense.CategoryID,
+			TaxAmount:  expense.TaxAmount,
+			Tags:       expense.Tags,
+		}}
+	}
+	total := 0.0
+	for _, split := range splits {
+		account, err := accounts.account(split.CategoryID, split.Category)
+		if err != nil {
+			return entry, err
+		}
+		net := split.BaseAmount
+		if accounts.profile.TaxAccount != "" && split.TaxAmount != 0 {
+			tax := roundAmount(split.TaxAmount * expense.ExchangeRate)
+			entry.Lines = addJournalLine(entry.Lines, accounts.profile.TaxAccount, tax, nil)
+			net -= tax
+			total += tax
+		}
+		entry.Lines = addJournalLine(entry.Lines, account, roundAmount(net), split.Tags)
+		total += roundAmount(net)
+	}
+	// The credit balances the debits as rounded, to the cent
+	entry.Lines[0].Amount = -roundAmount(total)
+	return entry, nil
+}
+
+// refundJournal reverses the share of an expense's journal a refund
+// returned, debiting petty cash or the employee payable with the refund.
+func refundJournal(refund models.Refund, expense *models.Expense, accounts *accountResolver) (journalEntry, error) {
+	entry, err := expenseJournal(expense, accounts)
+	if err != nil {
+		return entry, err
+	}
+	entry.Number = fmt.Sprintf("REF-%d", refund.ID)
+	entry.Date = refund.RefundDate
+	entry.Memo = "Refund: " + expense.Title
+	if refund.Reason != "" {
+		entry.Memo += " - " + refund.Reason
+	}
+	entry.EntityType = accountingEntityRefund
+	entry.EntityID = refund.ID
+
+	share := 0.0
+	if expense.BaseAmount != 0 {
+		share = refund.BaseAmount / expense.BaseAmount
+	}
+	largest, total := 1, 0.0
+	for i := 1; i < len(entry.Lines); i++ {
+		entry.Lines[i].Amount = -roundAmount(entry.Lines[i].Amount * share)
+		total += entry.Lines[i].Amount
+		if math.Abs(entry.Lines[i].Amount) > math.Abs(entry.Lines[largest].Amount) {
+			largest = i
+		}
+	}
+	// Rounding differences go on the largest line so the credits add up to
+	// the refund exactly
+	if len(entry.Lines) > 1 {
+		entry.Lines[largest].Amount = roundAmount(entry.Lines[largest].Amount - refund.BaseAmount - total)
+	}
+	entry.Lines[0].Amount = roundAmount(refund.BaseAmount)
+	return entry, nil
+}
+
+// addJournalLine adds amount to the line of the same account and tags, or
+// appends a new line.
+func addJournalLine(lines []journalLine, account string, amount float64, tags models.Tags) []journalLine {
+	for i := 1; i < len(lines); i++ {
+		if lines[i].Account == account && maps.Equal(lines[i].Tags, tags) {
+			lines[i].Amount = roundAmount(lines[i].Amount + amount)
+			return lines
+		}
+	}
+	return append(lines, journalLine{Account: account, Amount: amount, Tags: tags})
+}
+
+// renderJournal renders journal entries in the profile's format.
+func renderJournal(profile *models.AccountingExportProfile, entries []journalEntry) ([]byte, error) {
+	switch profile.Format {
+	case models.AccountingFormatQuickBooksIIF:
+		return quickBooksIIF(entries), nil
+	case models.AccountingFormatXeroCSV:
+		return xeroJournalCSV(entries, profile.TaxRate)
+	case models.AccountingFormatTallyXML:
+		return tallyVouchers(entries)
+	}
+	return nil, fmt.Errorf("unsupported format %s", profile.Format)
+}
+
+// quickBooksIIF renders entries as QuickBooks Desktop general journal
+// transactions: a TRNS line for the petty cash or payable side, an SPL line
+// per expense account and ENDTRNS.
+func quickBooksIIF(entries []journalEntry) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("!TRNS\tTRNSTYPE\tDATE\tACCNT\tAMOUNT\tDOCNUM\tMEMO\r\n")
+	buf.WriteString("!SPL\tTRNSTYPE\tDATE\tACCNT\tAMOUNT\tDOCNUM\tMEMO\r\n")
+	buf.WriteString("!ENDTRNS\r\n")
+	for _, entry := range entries {
+		for i, line := range entry.Lines {
+			kind := "SPL"
+			if i == 0 {
+				kind = "TRNS"
+			}
+			fmt.Fprintf(&buf, "%s\tGENERAL JOURNAL\t%s\t%s\t%.2f\t%s\t%s\r\n", kind, entry.Date.Format("01/02/2006"),
+				iifField(line.Account), line.Amount, entry.Number, iifField(entry.Memo))
+		}
+		buf.WriteString("ENDTRNS\r\n")
+	}
+	return buf.Bytes()
+}
+
+// iifField strips the tabs, line breaks and quotes IIF fields cannot hold.
+func iifField(s string) string {
+	return strings.NewReplacer("\t", " ", "\r", " ", "\n", " ", `"`, "'").Replace(s)
+}
+
+// xeroJournalCSV renders entries in Xero's manual journal import template.
+// Lines of one journal share its narration and date; the first two
+// dimensions an expense line is tagged with become tracking categories.
+func xeroJournalCSV(entries []journalEntry, taxRate string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	header := []string{"*Narration", "*Date", "Description", "*AccountCode", "*TaxRate", "*Amount",
+		"TrackingName1", "TrackingOption1", "TrackingName2", "TrackingOption2"}
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		narration := entry.Number + " " + entry.Memo
+		for _, line := range entry.Lines {
+			record := []string{narration, entry.Date.Format("02/01/2006"), entry.Memo, line.Account, taxRate,
+				fmt.Sprintf("%.2f", line.Amount), "", "", "", ""}
+			for i, code := range slices.Sorted(maps.Keys(line.Tags)) {
+				if i == 2 {
+					break
+				}
+				record[6+2*i] = code
+				record[7+2*i] = line.Tags[code]
+			}
+			if err := w.Write(record); err != nil {
+				return nil, err
+			}
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+type tallyEnvelope struct {
+	XMLName      xml.Name `xml:"ENVELOPE"`
+	TallyRequest string   `xml:"HEADER>TALLYREQUEST"`
+	ReportName   string   `xml:"BODY>IMPORTDATA>REQUESTDESC>REPORTNAME"`
+	Company      string   `xml:"BODY>IMPORTDATA>REQUESTDESC>STATICVARIABLES>SVCURRENTCOMPANY"`
+	Messages     []struct {
+		Voucher tallyVoucher `xml:"VOUCHER"`
+	} `xml:"BODY>IMPORTDATA>REQUESTDATA>TALLYMESSAGE"`
+}
+
+type tallyVoucher struct {
+	VoucherType string             `xml:"VCHTYPE,attr"`
+	Action      string             `xml:"ACTION,attr"`
+	Date        string             `xml:"DATE"`
+	TypeName    string             `xml:"VOUCHERTYPENAME"`
+	Number      string             `xml:"VOUCHERNUMBER"`
+	Narration   string             `xml:"NARRATION"`
+	Entries     []tallyLedgerEntry `xml:"ALLLEDGERENTRIES.LIST"`
+}
+
+// tallyLedgerEntry follows Tally's sign convention: debits are deemed
+// positive and carry negative amounts.
+type tallyLedgerEntry struct {
+	LedgerName       string `xml:"LEDGERNAME"`
+	IsDeemedPositive string `xml:"ISDEEMEDPOSITIVE"`
+	Amount           string `xml:"AMOUNT"`
+}
+
+// tallyVouchers renders entries as Tally journal vouchers for the company
+// named ORG_NAME. Accounts are Tally ledger names.
+func tallyVouchers(entries []journalEntry) ([]byte, error) {
+	doc := tallyEnvelope{TallyRequest: "Import Data", ReportName: "Vouchers", Company: orgName()}
+	doc.Messages = make([]struct {
+		Voucher tallyVoucher `xml:"VOUCHER"`
+	}, len(entries))
+	for i, entry := range entries {
+		voucher := &doc.Messages[i].Voucher
+		voucher.VoucherType = "Journal"
+		voucher.Action = "Create"
+		voucher.Date = entry.Date.Format("20060102")
+		voucher.TypeName = "Journal"
+		voucher.Number = entry.Number
+		voucher.Narration = entry.Memo
+		// Tally lists the debits first
+		lines := slices.Clone(entry.Lines)
+		sort.SliceStable(lines, func(a, b int) bool { return lines[a].Amount > 0 && lines[b].Amount < 0 })
+		for _, line := range lines {
+			deemedPositive := "No"
+			if line.Amount > 0 {
+				deemedPositive = "Yes"
+			}
+			voucher.Entries = append(voucher.Entries, tallyLedgerEntry{
+				LedgerName:       line.Account,
+				IsDeemedPositive: deemedPositive,
+				Amount:           fmt.Sprintf("%.2f", -line.Amount),
+			})
+		}
+	}
+
+	content, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(content, '\n')...), nil
+}
@@ -0,0 +1,342 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"ledgerly/db"
+	"ledgerly/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type AccountingExportService struct{}
+
+// AccountingExportRequest selects what an accounting export holds: what is
+// dated From to To, both inclusive. A dry run reports what would be
+// exported without recording anything.
+type AccountingExportRequest struct {
+	ProfileID uint
+	From      time.Time
+	To        time.Time
+	DryRun    bool
+}
+
+// Record types of accounting exports.
+const (
+	accountingEntityExpense = "expense"
+	accountingEntityRefund  = "refund"
+)
+
+func (s *AccountingExportService) CreateProfile(profile *models.AccountingExportProfile, userID string) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		profile.ID = 0
+		profile.Active = true
+		if err := validateAccountingProfile(tx, profile); err != nil {
+			return err
+		}
+		if err := tx.Omit(clause.Associations).Create(profile).Error; err != nil {
+			return err
+		}
+		if err := saveAccountMappings(tx, profile); err != nil {
+			return err
+		}
+		return recordAudit(tx, "accounting_profile.create", "accounting_profile", profile.ID, userID, profile.Name)
+	})
+}
+
+// UpdateProfile replaces a profile's settings and account mappings with those
+// of changes. Records already exported stay exported.
+func (s *AccountingExportService) UpdateProfile(id uint, changes *models.AccountingExportProfile, userID string) (*models.AccountingExportProfile, error) {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var profile models.AccountingExportProfile
+		if err := tx.First(&profile, id).Error; err != nil {
+			return err
+		}
+
+		profile.Name = changes.Name
+		profile.Format = changes.Format
+		profile.DefaultAccount = changes.DefaultAccount
+		profile.PettyCashAccount = changes.PettyCashAccount
+		profile.PayableAccount = changes.PayableAccount
+		profile.TaxAccount = changes.TaxAccount
+		profile.TaxRate = changes.TaxRate
+		profile.Active = changes.Active
+		profile.Accounts = changes.Accounts
+		if err := validateAccountingProfile(tx, &profile); err != nil {
+			return err
+		}
+		if err := tx.Omit(clause.Associations).Save(&profile).Error; err != nil {
+			return err
+		}
+		if err := saveAccountMappings(tx, &profile); err != nil {
+			return err
+		}
+		return recordAudit(tx, "accounting_profile.update", "accounting_profile", id, userID, profile.Name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetProfile(id)
+}
+
+// DeleteProfile deletes a profile that was never used; profiles with
+// exports are deactivated instead so their history is kept.
+func (s *AccountingExportService) DeleteProfile(id uint, userID string) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var profile models.AccountingExportProfile
+		if err := tx.First(&profile, id).Error; err != nil {
+			return err
+		}
+		var exports int64
+		if err := tx.Model(&models.AccountingExport{}).Where("profile_id = ?", id).Count(&exports).Error; err != nil {
+			return err
+		}
+		if exports > 0 {
+			return errors.New("profile has exports; deactivate it instead")
+		}
+		if err := tx.Where("profile_id = ?", id).Delete(&models.AccountMapping{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&profile).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, "accounting_profile.delete", "accounting_profile", id, userID, profile.Name)
+	})
+}
+
+func (s *AccountingExportService) GetProfile(id uint) (*models.AccountingExportProfile, error) {
+	var profile models.AccountingExportProfile
+	err := db.DB.Preload("Accounts", func(tx *gorm.DB) *gorm.DB { return tx.Order("category_id") }).First(&profile, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func (s *AccountingExportService) ListProfiles() ([]models.AccountingExportProfile, error) {
+	var profiles []models.AccountingExportProfile
+	err := db.DB.Preload("Accounts", func(tx *gorm.DB) *gorm.DB { return tx.Order("category_id") }).Order("name").Find(&profiles).Error
+	return profiles, err
+}
+
+// CreateExport renders the journal of everything in the requested range the
+// profile has not exported yet, and records it as exported. Only approved
+// expenses are exported, and refunds of them.
+func (s *AccountingExportService) CreateExport(req AccountingExportRequest, userID string) (*models.AccountingExport, error) {
+	if req.From.IsZero() || req.To.IsZero() {
+		return nil, errors.New("from and to are mandatory")
+	}
+	from := startOfDay(req.From)
+	to := startOfDay(req.To).AddDate(0, 0, 1)
+	if !from.Before(to) {
+		return nil, errors.New("to cannot be before from")
+	}
+
+	var export models.AccountingExport
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var profile models.AccountingExportProfile
+		if err := tx.Preload("Accounts").First(&profile, req.ProfileID).Error; err != nil {
+			return err
+		}
+		if !profile.Active {
+			return errors.New("profile is inactive")
+		}
+
+		entries, err := accountingJournal(tx, &profile, DateRange{From: from, To: to})
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return errors.New("nothing left to export in this range")
+		}
+		content, err := renderJournal(&profile, entries)
+		if err != nil {
+			return err
+		}
+
+		export = models.AccountingExport{
+			ProfileID:  profile.ID,
+			Format:     profile.Format,
+			From:       from,
+			To:         to.AddDate(0, 0, -1),
+			Content:    content,
+			Entries:    len(entries),
+			Currency:   models.BaseCurrency(),
+			ExportedBy: userID,
+		}
+		for _, entry := range entries {
+			for _, line := range entry.Lines {
+				if line.Amount > 0 {
+					export.Total += line.Amount
+				}
+			}
+		}
+		export.Total = roundAmount(export.Total)
+		if req.DryRun {
+			return errDryRun
+		}
+
+		if err := tx.Create(&export).Error; err != nil {
+			return err
+		}
+		export.Reference = fmt.Sprintf("AE%06d", export.ID)
+		export.Filename = export.Reference + journalExtensions[profile.Format]
+		err = tx.Model(&export).UpdateColumns(map[string]interface{}{"reference": export.Reference, "filename": export.Filename}).Error
+		if err != nil {
+			return err
+		}
+
+		records := make([]models.AccountingExportRecord, 0, len(entries))
+		for _, entry := range entries {
+			records = append(records, models.AccountingExportRecord{
+				ExportID:   export.ID,
+				ProfileID:  profile.ID,
+				EntityType: entry.EntityType,
+				EntityID:   entry.EntityID,
+			})
+		}
+		// The unique index stops a concurrent export of the same records
+		if err := tx.Create(&records).Error; err != nil {
+			return err
+		}
+		detail := fmt.Sprintf("%s, %d entries, %.2f %s", profile.Name, export.Entries, export.Total, export.Currency)
+		return recordAudit(tx, "accounting_export.create", "accounting_export", export.ID, userID, detail)
+	})
+	if errors.Is(err, errDryRun) {
+		return &export, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.GetExport(export.ID)
+}
+
+func (s *AccountingExportService) GetExport(id uint) (*models.AccountingExport, error) {
+	var export models.AccountingExport
+	if err := db.DB.Preload("Profile").First(&export, id).Error; err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// ListExports returns exports newest first, optionally of one profile.
+func (s *AccountingExportService) ListExports(profileID uint) ([]models.AccountingExport, error) {
+	var exports []models.AccountingExport
+	query := db.DB.Order("id desc")
+	if profileID != 0 {
+		query = query.Where("profile_id = ?", profileID)
+	}
+	err := query.Find(&exports).Error
+	return exports, err
+}
+
+// DownloadExport returns the journal file of an export that was not voided.
+func (s *AccountingExportService) DownloadExport(id uint) (*ExportFile, error) {
+	export, err := s.GetExport(id)
+	if err != nil {
+		return nil, err
+	}
+	if export.VoidedAt != nil {
+		return nil, errors.New("export was voided")
+	}
+	return &ExportFile{Filename: export.Filename, ContentType: journalContentTypes[export.Format], Content: export.Content}, nil
+}
+
+// VoidExport marks an export as not imported, for example because the file
+// was rejected, so its expenses and refunds go into the next export.
+func (s *AccountingExportService) VoidExport(id uint, userID string) (*models.AccountingExport, error) {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var export models.AccountingExport
+		if err := tx.First(&export, id).Error; err != nil {
+			return err
+		}
+		if export.VoidedAt != nil {
+			return errors.New("export is already voided")
+		}
+		now := time.Now().UTC()
+		err := tx.Model(&export).UpdateColumns(map[string]interface{}{"voided_at": now, "voided_by": userID}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("export_id = ?", export.ID).Delete(&models.AccountingExportRecord{}).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, "accounting_export.void", "accounting_export", export.ID, userID, export.Reference)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetExport(id)
+}
+
+func validateAccountingProfile(tx *gorm.DB, profile *models.AccountingExportProfile) error {
+	profile.Name = strings.TrimSpace(profile.Name)
+	if profile.Name == "" {
+		return errors.New("name is mandatory")
+	}
+	var duplicates int64
+	err := tx.Model(&models.AccountingExportProfile{}).
+		Where("lower(name) = lower(?) AND id <> ?", profile.Name, profile.ID).Count(&duplicates).Error
+	if err != nil {
+		return err
+	}
+	if duplicates > 0 {
+		return errors.New("a profile with this name already exists")
+	}
+
+	switch profile.Format {
+	case models.AccountingFormatQuickBooksIIF, models.AccountingFormatXeroCSV, models.AccountingFormatTallyXML:
+	default:
+		return errors.New("format must be quickbooks_iif, xero_csv or tally_xml")
+	}
+	profile.DefaultAccount = strings.TrimSpace(profile.DefaultAccount)
+	profile.PettyCashAccount = strings.TrimSpace(profile.PettyCashAccount)
+	profile.PayableAccount = strings.TrimSpace(profile.PayableAccount)
+	profile.TaxAccount = strings.TrimSpace(profile.TaxAccount)
+	profile.TaxRate = strings.TrimSpace(profile.TaxRate)
+	if profile.PettyCashAccount == "" || profile.PayableAccount == "" {
+		return errors.New("petty_cash_account and payable_account are mandatory")
+	}
+	if profile.Format == models.AccountingFormatXeroCSV && profile.TaxRate == "" {
+		profile.TaxRate = "Tax Exempt"
+	}
+
+	mapped := make(map[uint]bool, len(profile.Accounts))
+	for i := range profile.Accounts {
+		mapping := &profile.Accounts[i]
+		mapping.Account = strings.TrimSpace(mapping.Account)
+		if mapping.Account == "" {
+			return errors.New("every account mapping needs an account")
+		}
+		if mapped[mapping.CategoryID] {
+			return fmt.Errorf("category %d is mapped more than once", mapping.CategoryID)
+		}
+		mapped[mapping.CategoryID] = true
+		if err := tx.First(&models.Category{}, mapping.CategoryID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("unknown category %d", mapping.CategoryID)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// saveAccountMappings replaces the account mappings of a profile with
+// profile.Accounts.
+func saveAccountMappings(tx *gorm.DB, profile *models.AccountingExportProfile) error {
+	if err := tx.Where("profile_id = ?", profile.ID).Delete(&models.AccountMapping{}).Error; err != nil {
+		return err
+	}
+	for i := range profile.Accounts {
+		profile.Accounts[i].ID = 0
+		profile.Accounts[i].ProfileID = profile.ID
+	}
+	if len(profile.Accounts) == 0 {
+		return nil
+	}
+	return tx.Create(&profile.Accounts).Error
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"ledgerly/db"
+	"ledgerly/models"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type AdvanceService struct{}
+
+// AdvanceCodeOverdue is the error code of advances refused because the
+// employee has an overdue one.
+const AdvanceCodeOverdue = "advance_overdue"
+
+// AdvanceOverdueError refuses a new advance while the employee has older
+// advances past their due date.
+type AdvanceOverdueError struct {
+	AdvanceIDs []uint
+}
+
+func (e *AdvanceOverdueError) ErrorCode() string {
+	return AdvanceCodeOverdue
+}
+
+func (e *AdvanceOverdueError) Error() string {
+	ids := make([]string, 0, len(e.AdvanceIDs))
+	for _, id := range e.AdvanceIDs {
+		ids = append(ids, "#"+strconv.FormatUint(uint64(id), 10))
+	}
+	return "employee has overdue cash advances: " + strings.Join(ids, ", ")
+}
+
+// AdvanceFilter narrows an advance listing. Zero values match everything.
+type AdvanceFilter struct {
+	UserID string
+	FundID uint
+	Status models.CashAdvanceStatus
+}
+
+// Liquidation accounts for part or all of an advance: the expenses paid with
+// it and the change handed back.
+type Liquidation struct {
+	ExpenseIDs     []uint  `json:"expense_ids"`
+	ChangeReturned float64 `json:"change_returned" example:"12.50"`
+	Note           string  `json:"note"`
+}
+
+// GetAdvanceDueDays returns ADVANCE_DUE_DAYS, the days an employee has to
+// liquidate an advance, defaulting to 14.
+func GetAdvanceDueDays() int {
+	days, err := strconv.Atoi(os.Getenv("ADVANCE_DUE_DAYS"))
+	if err != nil || days < 1 {
+		return 14
+	}
+	return days
+}
+
+// IssueAdvance pays cash out of a fund to an employee. The advance is due
+// ADVANCE_DUE_DAYS after issue unless a due date is given, and is refused
+// while the employee has overdue advances.
+func (s *AdvanceService) IssueAdvance(advance *models.CashAdvance, issuedBy string) error {
+	if advance.Amount <= 0 {
+		return errors.New("amount must be greater than zero")
+	}
+	advance.Purpose = strings.TrimSpace(advance.Purpose)
+	if advance.Purpose == "" {
+		return errors.New("purpose is mandatory")
+	}
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Where("id = ?", advance.UserID).First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("user not found")
+			}
+			return err
+		}
+		overdue, err := overdueAdvances(tx, advance.UserID, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		if len(overdue) > 0 {
+			return &AdvanceOverdueError{AdvanceIDs: overdue}
+		}
+
+		issue := models.PettyCashTransaction{
+			FundID:          advance.FundID,
+			Type:            models.TransactionTypeDebit,
+			Amount:          advance.Amount,
+			Description:     "Cash advance: " + advance.Purpose,
+			UserID:          advance.UserID,
+			TransactionDate: advance.IssuedAt,
+		}
+		if err := createTransaction(tx, &issue); err != nil {
+			return err
+		}
+
+		advance.ID = 0
+		advance.FundID = issue.FundID
+		advance.Currency = issue.Currency
+		advance.Amount = roundAmount(advance.Amount)
+		advance.IssuedAt = issue.TransactionDate
+		if advance.DueDate.IsZero() {
+			advance.DueDate = issue.TransactionDate.AddDate(0, 0, GetAdvanceDueDays())
+		}
+		advance.DueDate = startOfDay(advance.DueDate)
+		if advance.DueDate.Before(startOfDay(advance.IssuedAt)) {
+			return errors.New("due_date cannot be before the issue date")
+		}
+		advance.IssuedBy = issuedBy
+		advance.IssueTransactionID = issue.ID
+		advance.SpentAmount = 0
+		advance.ReturnedAmount = 0
+		advance.Outstanding = advance.Amount
+		advance.Status = models.CashAdvanceStatusOutstanding
+		advance.SettledAt = nil
+		advance.Expenses = nil
+		if err := tx.Create(advance).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&issue).UpdateColumn("cash_advance_id", advance.ID).Error; err != nil {
+			return err
+		}
+		advance.IssueTransaction = &issue
+		return recordAudit(tx, "advance.issue", "cash_advance", advance.ID, issuedBy, fmt.Sprintf("%.2f to user %s", advance.Amount, advance.UserID))
+	})
+}
+
+func (s *AdvanceService) GetAdvance(id uint) (*models.CashAdvance, error) {
+	var advance models.CashAdvance
+	if err := db.DB.Preload("IssueTransaction").Preload("Expenses").First(&advance, id).Error; err != nil {
+		return nil, err
+	}
+	return &advance, nil
+}
+
+func (s *AdvanceService) ListAdvances(filter AdvanceFilter) ([]models.CashAdvance, error) {
+	var advances []models.CashAdvance
+	query := db.DB.Order("issued_at, id")
+	if filter.UserID != "" {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.FundID != 0 {
+		query = query.Where("fund_id = ?", filter.FundID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	err := query.Find(&advances).Error
+	return advances, err
+}
+
+// LiquidateAdvance links expenses paid with an advance and credits any change
+// back to its fund. The expenses must be the employee's own submitted
+// out-of-pocket expenses; linking them withdraws their reimbursement. The
+// advance is settled once nothing is outstanding.
+func (s *AdvanceService) LiquidateAdvance(id uint, liquidation Liquidation, userID string) (*models.CashAdvance, error) {
+	if len(liquidation.ExpenseIDs) == 0 && liquidation.ChangeReturned <= 0 {
+		return nil, errors.New("expense_ids or change_returned is required")
+	}
+	if liquidation.ChangeReturned < 0 {
+		return nil, errors.New("change_returned cannot be negative")
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var advance models.CashAdvance
+		if err := tx.First(&advance, id).Error; err != nil {
+			return err
+		}
+		if advance.Status != models.CashAdvanceStatusOutstanding {
+			return errors.New("advance is already settled")
+		}
+
+		var expenses []models.Expense
+		if len(liquidation.ExpenseIDs) > 0 {
+			if err := tx.Where("id IN ?", liquidation.ExpenseIDs).Find(&expenses).Error; err != nil {
+				return err
+			}
+			if len(expenses) != len(liquidation.ExpenseIDs) {
+				return errors.New("expense not found")
+			}
+		}
+
+		spent := 0.0
+		for _, expense := range expenses {
+			switch {
+			case expense.UserID != advance.UserID:
+				return fmt.Errorf("expense #%d was not claimed by the advance holder", expense.ID)
+			case expense.PettyCashTransactionID != nil:
+				return fmt.Errorf("expense #%d is already paid from petty cash", expense.ID)
+			case expense.Status != models.ExpenseStatusApproved && expense.Status != models.ExpenseStatusPendingApproval:
+				return fmt.Errorf("expense #%d is %s", expense.ID, expense.Status)
+			case expense.Currency != advance.Currency:
+				return fmt.Errorf("expense #%d is in %s, not the advance's %s", expense.ID, expense.Currency, advance.Currency)
+			}
+			spent += expense.Amount
+		}
+		change := roundAmount(liquidation.ChangeReturned)
+		if accounted := roundAmount(spent + change); accounted > advance.Outstanding {
+			return fmt.Errorf("liquidation of %.2f exceeds the outstanding %.2f; claim the excess as a separate expense", accounted, advance.Outstanding)
+		}
+
+		for i := range expenses {
+			expense := &expenses[i]
+			if err := cancelReimbursement(tx, expense.ID); err != nil {
+				return err
+			}
+			// Pointing the expense at the issuing debit books it to the
+			// advance's fund, like any expense paid from petty cash
+			err := tx.Model(expense).Updates(map[string]interface{}{
+				"petty_cash_transaction_id": advance.IssueTransactionID,
+				"cash_advance_id":           advance.ID,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		if change > 0 {
+			credit := models.PettyCashTransaction{
+				FundID:          advance.FundID,
+				Type:            models.TransactionTypeCredit,
+				Amount:          change,
+				Description:     fmt.Sprintf("Change returned from cash advance #%d", advance.ID),
+				UserID:          advance.UserID,
+				CashAdvanceID:   &advance.ID,
+				TransactionDate: time.Now().UTC(),
+			}
+			if err := createTransaction(tx, &credit); err != nil {
+				return err
+			}
+		}
+
+		if err := refreshAdvance(tx, advance.ID); err != nil {
+			return err
+		}
+		details := fmt.Sprintf("%d expenses, %.2f change", len(expenses), change)
+		if liquidation.Note != "" {
+			details += ": " + liquidation.Note
+		}
+		return recordAudit(tx, "advance.liquidate", "cash_advance", advance.ID, userID, details)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetAdvance(id)
+}
+
+// refreshAdvance recomputes what an advance has accounted for from its
+// linked expenses and change credits. Rejected expenses no longer count, so
+// rejecting one reopens a settled advance.
+func refreshAdvance(tx *gorm.DB, id uint) error {
+	var advance models.CashAdvance
+	if err := tx.First(&advance, id).Error; err != nil {
+		return err
+	}
+
+	var spent, returned float64
+	err := tx.Model(&models.Expense{}).
+		Where("cash_advance_id = ? AND status NOT IN ?", id, models.UncountedExpenseStatuses).
+		Select("coalesce(sum(amount), 0)").Scan(&spent).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Model(&models.PettyCashTransaction{}).
+		Where("cash_advance_id = ? AND type = ?", id, models.TransactionTypeCredit).
+		Select("coalesce(sum(amount), 0)").Scan(&returned).Error
+	if err != nil {
+		return err
+	}
+
+	advance.SpentAmount = roundAmount(spent)
+	advance.ReturnedAmount = roundAmount(returned)
+	advance.Outstanding = roundAmount(advance.Amount - advance.SpentAmount - advance.ReturnedAmount)
+	if advance.Outstanding <= 0 {
+		if advance.SettledAt == nil {
+			now := time.Now().UTC()
+			advance.SettledAt = &now
+		}
+		advance.Status = models.CashAdvanceStatusSettled
+	} else {
+		advance.Status = models.CashAdvanceStatusOutstanding
+		advance.SettledAt = nil
+	}
+	return tx.Save(&advance).Error
+}
+
+// refreshExpenseAdvance refreshes the advance an expense liquidates, if any.
+func refreshExpenseAdvance(tx *gorm.DB, expense *models.Expense) error {
+	if expense.CashAdvanceID == nil {
+		return nil
+	}
+	return refreshAdvance(tx, *expense.CashAdvanceID)
+}
+
+// overdueAdvances returns the IDs of the user's outstanding advances due
+// before the day of now. Advances may be liquidated all through their due
+// date.
+func overdueAdvances(tx *gorm.DB, userID string, now time.Time) ([]uint, error) {
+	var ids []uint
+	err := tx.Model(&models.CashAdvance{}).
+		Where("user_id = ? AND status = ? AND due_date < ?", userID, models.CashAdvanceStatusOutstanding, startOfDay(now)).
+		Order("id").
+		Pluck("id", &ids).Error
+	return ids, err
+}
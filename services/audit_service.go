@@ -0,0 +1,32 @@
+package services
+
+import (
+	"ledgerly/db"
+	"ledgerly/models"
+
+	"gorm.io/gorm"
+)
+
+type AuditService struct{}
+
+// recordAudit writes an audit entry using tx so it commits or rolls back
+// together with the change it describes.
+func recordAudit(tx *gorm.DB, action, entityType string, entityID uint, userID, details string) error {
+	return tx.Create(&models.AuditLog{
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		UserID:     userID,
+		Details:    details,
+	}).Error
+}
+
+func (s *AuditService) ListLogs(entityType string) ([]models.AuditLog, error) {
+	var logs []models.AuditLog
+	query := db.DB.Order("created_at desc")
+	if entityType != "" {
+		query = query.Where("entity_type = ?", entityType)
+	}
+	err := query.Find(&logs).Error
+	return logs, err
+}
@@ -0,0 +1,299 @@
+package services
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"ledgerly/models"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bankStatementFields are the columns a CSV or XLSX statement is read from,
+// each named after its field unless the mapping names another. Amounts are
+// negative for withdrawals.
+var bankStatementFields = []string{"date", "amount", "currency", "reference", "description", "counterparty", "id"}
+
+// detectStatementFormat tells statement formats apart by file name, or else
+// by content.
+func detectStatementFormat(data []byte, filename string) models.BankStatementFormat {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".ofx", ".qfx":
+		return models.BankStatementFormatOFX
+	case ".csv", ".xlsx":
+		return models.BankStatementFormatCSV
+	}
+	head := data[:min(len(data), 4096)]
+	switch {
+	case bytes.Contains(head, []byte("OFXHEADER")), bytes.Contains(bytes.ToUpper(head), []byte("<OFX>")):
+		return models.BankStatementFormatOFX
+	case bytes.Contains(head, []byte("camt.053")), bytes.Contains(head, []byte("BkToCstmrStmt")):
+		return models.BankStatementFormatCAMT053
+	}
+	return models.BankStatementFormatCSV
+}
+
+// ofxElement matches the tags of OFX files, both the SGML of OFX 1.x, where
+// leaf elements are not closed, and the XML of OFX 2.x.
+var ofxElement = regexp.MustCompile(`<(/?)([A-Za-z0-9.]+)>([^<]*)`)
+
+// parseOFX reads the transactions of an OFX bank statement. NAME is the
+// counterparty, MEMO the description and REFNUM or CHECKNUM the reference.
+func parseOFX(data []byte) (*models.BankStatement, error) {
+	statement := &models.BankStatement{Format: models.BankStatementFormatOFX}
+	var line *models.BankStatementLine
+	for _, m := range ofxElement.FindAllSubmatch(data, -1) {
+		closing := len(m[1]) > 0
+		tag := strings.ToUpper(string(m[2]))
+		value := strings.TrimSpace(html.UnescapeString(string(m[3])))
+
+		switch {
+		case tag == "STMTTRN" && !closing:
+			line = &models.BankStatementLine{}
+		case tag == "STMTTRN":
+			if line == nil {
+				continue
+			}
+			if line.BookingDate.IsZero() {
+				return nil, fmt.Errorf("transaction %d has no DTPOSTED", len(statement.Lines)+1)
+			}
+			statement.Lines = append(statement.Lines, *line)
+			line = nil
+		case closing || value == "":
+		case line != nil:
+			switch tag {
+			case "DTPOSTED":
+				date, err := ofxDate(value)
+				if err != nil {
+					return nil, fmt.Errorf("transaction %d: invalid DTPOSTED %q", len(statement.Lines)+1, value)
+				}
+				line.BookingDate = date
+			case "TRNAMT":
+				amount, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", "."), 64)
+				if err != nil {
+					return nil, fmt.Errorf("transaction %d: invalid TRNAMT %q", len(statement.Lines)+1, value)
+				}
+				line.Amount = amount
+			case "FITID":
+				line.EntryID = value
+			case "NAME", "PAYEE":
+				line.Counterparty = value
+			case "MEMO":
+				line.Description = value
+			case "REFNUM", "CHECKNUM":
+				if line.Reference == "" {
+					line.Reference = value
+				}
+			}
+		case tag == "CURDEF":
+			statement.Currency = value
+		case tag == "ACCTID":
+			statement.Account = value
+		}
+	}
+	if len(statement.Lines) == 0 && !bytes.Contains(bytes.ToUpper(data), []byte("<OFX>")) {
+		return nil, errors.New("not an OFX file")
+	}
+	return statement, nil
+}
+
+// ofxDate parses the date of an OFX date and time such as
+// 20260910120000.000[-5:EST].
+func ofxDate(value string) (time.Time, error) {
+	if len(value) < 8 {
+		return time.Time{}, errors.New("date too short")
+	}
+	return time.Parse("20060102", value[:8])
+}
+
+type camtDocument struct {
+	Statements []camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtStatement struct {
+	IBAN     string      `xml:"Acct>Id>IBAN"`
+	OtherID  string      `xml:"Acct>Id>Othr>Id"`
+	Currency string      `xml:"Acct>Ccy"`
+	Entries  []camtEntry `xml:"Ntry"`
+}
+
+type camtEntry struct {
+	Amount struct {
+		Currency string `xml:"Ccy,attr"`
+		Value    string `xml:",chardata"`
+	} `xml:"Amt"`
+	Indicator string `xml:"CdtDbtInd"`
+	// Sts holds the status code directly up to version 6 and in Cd after
+	Status struct {
+		Value string `xml:",chardata"`
+		Code  string `xml:"Cd"`
+	} `xml:"Sts"`
+	BookingDate     string        `xml:"BookgDt>Dt"`
+	BookingDateTime string        `xml:"BookgDt>DtTm"`
+	ServicerRef     string        `xml:"AcctSvcrRef"`
+	EntryRef        string        `xml:"NtryRef"`
+	Info            string        `xml:"AddtlNtryInf"`
+	Details         []camtDetails `xml:"NtryDtls>TxDtls"`
+}
+
+type camtDetails struct {
+	EndToEndID   string   `xml:"Refs>EndToEndId"`
+	CreditorRef  string   `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+	Unstructured []string `xml:"RmtInf>Ustrd"`
+	Creditor     string   `xml:"RltdPties>Cdtr>Nm"`
+	CreditorPty  string   `xml:"RltdPties>Cdtr>Pty>Nm"`
+	Debtor       string   `xml:"RltdPties>Dbtr>Nm"`
+	DebtorPty    string   `xml:"RltdPties>Dbtr>Pty>Nm"`
+}
+
+// parseCAMT053 reads the booked entries of an ISO 20022 camt.053 account
+// statement. Entries booking several transactions at once become one line,
+// described by their first transaction.
+func parseCAMT053(data []byte) (*models.BankStatement, error) {
+	var doc camtDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("reading camt.053: %w", err)
+	}
+	if len(doc.Statements) == 0 {
+		return nil, errors.New("not a camt.053 statement")
+	}
+
+	statement := &models.BankStatement{Format: models.BankStatementFormatCAMT053}
+	for _, stmt := range doc.Statements {
+		account := cmp.Or(stmt.IBAN, stmt.OtherID)
+		if statement.Account == "" {
+			statement.Account, statement.Currency = account, stmt.Currency
+		}
+		for i, entry := range stmt.Entries {
+			// Pending and information-only entries are not booked yet
+			if status := cmp.Or(strings.TrimSpace(entry.Status.Code), strings.TrimSpace(entry.Status.Value)); status != "" && status != "BOOK" {
+				continue
+			}
+			amount, err := strconv.ParseFloat(strings.TrimSpace(entry.Amount.Value), 64)
+			if err != nil {
+				return nil, fmt.Errorf("entry %d: invalid amount %q", i+1, entry.Amount.Value)
+			}
+			date := cmp.Or(entry.BookingDate, entry.BookingDateTime)
+			if len(date) < 10 {
+				return nil, fmt.Errorf("entry %d has no booking date", i+1)
+			}
+			booked, err := time.Parse("2006-01-02", date[:10])
+			if err != nil {
+				return nil, fmt.Errorf("entry %d: invalid booking date %q", i+1, date)
+			}
+
+			line := models.BankStatementLine{
+				Account:     account,
+				EntryID:     cmp.Or(entry.ServicerRef, entry.EntryRef),
+				BookingDate: booked,
+				Amount:      amount,
+				Currency:    cmp.Or(entry.Amount.Currency, stmt.Currency),
+				Reference:   entry.EntryRef,
+				Description: strings.TrimSpace(entry.Info),
+			}
+			if entry.Indicator == "DBIT" {
+				line.Amount = -amount
+			}
+			if len(entry.Details) > 0 {
+				details := entry.Details[0]
+				if ref := cmp.Or(details.CreditorRef, details.EndToEndID); ref != "" && ref != "NOTPROVIDED" {
+					line.Reference = ref
+				}
+				if len(details.Unstructured) > 0 {
+					line.Description = strings.TrimSpace(strings.Join(details.Unstructured, " "))
+				}
+				line.Counterparty = cmp.Or(details.Creditor, details.CreditorPty)
+				if entry.Indicator != "DBIT" {
+					line.Counterparty = cmp.Or(details.Debtor, details.DebtorPty)
+				}
+			}
+			statement.Lines = append(statement.Lines, line)
+		}
+	}
+	return statement, nil
+}
+
+// parseStatementCSV reads a CSV or XLSX statement with a header row. Dates
+// are YYYY-MM-DD, DD.MM.YYYY or DD/MM/YYYY.
+func parseStatementCSV(data []byte, filename string, mapping map[string]string) (*models.BankStatement, error) {
+	rows, err := readSpreadsheet(bytes.NewReader(data), filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("statement file is empty")
+	}
+	columns, err := importColumns(bankStatementFields, rows[0], mapping)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := columns["date"]; !ok {
+		return nil, errors.New("statement file needs a date column")
+	}
+
+	statement := &models.BankStatement{Format: models.BankStatementFormatCSV}
+	for i, row := range rows[1:] {
+		if blankRow(row) {
+			continue
+		}
+		field := func(name string) string {
+			if c, ok := columns[name]; ok && c < len(row) {
+				return strings.TrimSpace(row[c])
+			}
+			return ""
+		}
+		date, err := statementDate(field("date"))
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+2, err)
+		}
+		amount, err := importAmount(field("amount"))
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+2, err)
+		}
+		statement.Lines = append(statement.Lines, models.BankStatementLine{
+			EntryID:      field("id"),
+			BookingDate:  date,
+			Amount:       amount,
+			Currency:     field("currency"),
+			Reference:    field("reference"),
+			Description:  field("description"),
+			Counterparty: field("counterparty"),
+		})
+	}
+	return statement, nil
+}
+
+func statementDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, errors.New("date is mandatory")
+	}
+	for _, layout := range []string{"02.01.2006", "02/01/2006"} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+	date, err := importDate(value, "date")
+	if err != nil {
+		return time.Time{}, errors.New("date must be YYYY-MM-DD, DD.MM.YYYY or DD/MM/YYYY")
+	}
+	return date, nil
+}
+
+// statementEntryID identifies a line the bank gave no identifier by its
+// details and how many identical lines came before it in the file, so the
+// same file imports the same IDs again.
+func statementEntryID(line *models.BankStatementLine, seen map[string]int) string {
+	key := fmt.Sprintf("%s|%s|%.2f|%s|%s|%s|%s", line.Account, line.BookingDate.Format("2006-01-02"), line.Amount,
+		line.Currency, line.Reference, line.Description, line.Counterparty)
+	seen[key]++
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d", key, seen[key])))
+	return "h:" + hex.EncodeToString(sum[:12])
+}
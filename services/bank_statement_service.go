@@ -0,0 +1,500 @@
+package services
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"ledgerly/db"
+	"ledgerly/models"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+type BankStatementService struct{}
+
+// BankStatementImportOptions control a statement import. Format is detected
+// when empty. Account and Currency apply to CSV and XLSX statements, which
+// carry neither; Mapping maps their fields to column headers.
+type BankStatementImportOptions struct {
+	Filename string
+	Format   models.BankStatementFormat
+	Account  string
+	Currency string
+	Mapping  map[string]string
+	DryRun   bool
+	UserID   string
+}
+
+// BankStatementImportResult reports an import: the statement with the lines
+// it added, how many lines earlier imports already had, and how many
+// withdrawals were matched to top-ups.
+type BankStatementImportResult struct {
+	Statement  *models.BankStatement `json:"statement"`
+	DryRun     bool                  `json:"dry_run"`
+	Imported   int                   `json:"imported"`
+	Duplicates int                   `json:"duplicates"`
+	Matched    int                   `json:"matched"`
+}
+
+// BankLineFilter narrows statement line listings.
+type BankLineFilter struct {
+	StatementID uint
+	Status      models.BankLineStatus
+	Dates       DateRange
+}
+
+// GetBankMatchWindow returns BANK_MATCH_WINDOW_DAYS, how many days apart a
+// withdrawal and the top-up it funded may be dated to match automatically,
+// defaulting to 5.
+func GetBankMatchWindow() int {
+	days, err := strconv.Atoi(os.Getenv("BANK_MATCH_WINDOW_DAYS"))
+	if err != nil || days < 0 {
+		return 5
+	}
+	return days
+}
+
+// ImportStatement records the lines of an OFX, camt.053, CSV or XLSX bank
+// statement that no earlier import had, and matches its withdrawals to petty
+// cash top-ups. A dry run reports the same without recording anything.
+func (s *BankStatementService) ImportStatement(r io.Reader, opts BankStatementImportOptions) (*BankStatementImportResult, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Format == "" {
+		opts.Format = detectStatementFormat(data, opts.Filename)
+	}
+
+	var statement *models.BankStatement
+	switch opts.Format {
+	case models.BankStatementFormatOFX:
+		statement, err = parseOFX(data)
+	case models.BankStatementFormatCAMT053:
+		statement, err = parseCAMT053(data)
+	case models.BankStatementFormatCSV:
+		if statement, err = parseStatementCSV(data, opts.Filename, opts.Mapping); err == nil {
+			statement.Account, statement.Currency = strings.TrimSpace(opts.Account), opts.Currency
+		}
+	default:
+		return nil, errors.New("format must be ofx, camt053 or csv")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(statement.Lines) == 0 {
+		return nil, errors.New("statement has no lines")
+	}
+	statement.Filename = opts.Filename
+	statement.ImportedBy = opts.UserID
+	if statement.Currency, err = normalizeCurrency(statement.Currency); err != nil {
+		return nil, err
+	}
+
+	result := &BankStatementImportResult{Statement: statement, DryRun: opts.DryRun}
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		lines := statement.Lines
+		statement.Lines = make([]models.BankStatementLine, 0, len(lines))
+		seen := make(map[string]int)
+		imported := make(map[string]bool)
+		for _, line := range lines {
+			line.Account = cmp.Or(line.Account, statement.Account)
+			line.Amount = roundAmount(line.Amount)
+			if line.Currency == "" {
+				line.Currency = statement.Currency
+			}
+			if line.Currency, err = normalizeCurrency(line.Currency); err != nil {
+				return fmt.Errorf("line of %s: %w", line.BookingDate.Format("2006-01-02"), err)
+			}
+			if line.EntryID == "" {
+				line.EntryID = statementEntryID(&line, seen)
+			}
+			line.Status = models.BankLineStatusUnmatched
+			if line.Amount >= 0 {
+				line.Status = models.BankLineStatusIgnored
+			}
+
+			key := line.Account + "|" + line.EntryID
+			var existing int64
+			err := tx.Model(&models.BankStatementLine{}).Where("account = ? AND entry_id = ?", line.Account, line.EntryID).Count(&existing).Error
+			if err != nil {
+				return err
+			}
+			if existing > 0 || imported[key] {
+				result.Duplicates++
+				continue
+			}
+			imported[key] = true
+			statement.Lines = append(statement.Lines, line)
+		}
+		if len(statement.Lines) == 0 {
+			return errors.New("every line of the statement was already imported")
+		}
+
+		for i, line := range statement.Lines {
+			if i == 0 || line.BookingDate.Before(statement.From) {
+				statement.From = line.BookingDate
+			}
+			if line.BookingDate.After(statement.To) {
+				statement.To = line.BookingDate
+			}
+		}
+		statement.LineCount = len(statement.Lines)
+		statement.Duplicates = result.Duplicates
+		result.Imported = statement.LineCount
+		if err := tx.Create(statement).Error; err != nil {
+			return err
+		}
+
+		matched, err := matchBankLines(tx, statement.Lines)
+		if err != nil {
+			return err
+		}
+		result.Matched = matched
+		if opts.DryRun {
+			return errDryRun
+		}
+		detail := fmt.Sprintf("%s %s, %d lines, %d matched", statement.Format, statement.Account, result.Imported, result.Matched)
+		return recordAudit(tx, "bank_statement.import", "bank_statement", statement.ID, opts.UserID, detail)
+	})
+	if errors.Is(err, errDryRun) {
+		statement.ID = 0
+		for i := range statement.Lines {
+			statement.Lines[i].ID = 0
+			statement.Lines[i].StatementID = 0
+		}
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if result.Statement, err = s.GetStatement(statement.ID); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ListStatements returns imported statements newest first, without lines.
+func (s *BankStatementService) ListStatements() ([]models.BankStatement, error) {
+	var statements []models.BankStatement
+	err := db.DB.Order("id desc").Find(&statements).Error
+	return statements, err
+}
+
+func (s *BankStatementService) GetStatement(id uint) (*models.BankStatement, error) {
+	var statement models.BankStatement
+	err := db.DB.Preload("Lines", func(tx *gorm.DB) *gorm.DB { return tx.Order("booking_date, id") }).
+		Preload("Lines.Transaction").First(&statement, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &statement, nil
+}
+
+// ListLines returns statement lines by booking date with the top-ups they
+// are matched to.
+func (s *BankStatementService) ListLines(filter BankLineFilter) ([]models.BankStatementLine, error) {
+	query := db.DB.Preload("Transaction").Order("booking_date, id")
+	if filter.StatementID != 0 {
+		query = query.Where("statement_id = ?", filter.StatementID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	var lines []models.BankStatementLine
+	err := filter.Dates.apply(query, "booking_date").Find(&lines).Error
+	return lines, err
+}
+
+// MatchCandidates returns the unmatched top-ups a withdrawal could be
+// matched to, those of its amount and currency, closest in date first.
+func (s *BankStatementService) MatchCandidates(lineID uint) ([]models.PettyCashTransaction, error) {
+	var line models.BankStatementLine
+	if err := db.DB.First(&line, lineID).Error; err != nil {
+		return nil, err
+	}
+	if line.Amount >= 0 {
+		return nil, errors.New("only withdrawals are matched to top-ups")
+	}
+
+	var candidates []models.PettyCashTransaction
+	err := unmatchedTopUps(db.DB).Where("currency = ? AND abs(amount - ?) < 0.005", line.Currency, -line.Amount).
+		Order("transaction_date, id").Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return daysApart(candidates[i].TransactionDate, line.BookingDate) < daysApart(candidates[j].TransactionDate, line.BookingDate)
+	})
+	return candidates, nil
+}
+
+// MatchLine matches an unmatched withdrawal to the top-up it funded, which
+// must be of the same amount and currency.
+func (s *BankStatementService) MatchLine(lineID, transactionID uint, userID string) (*models.BankStatementLine, error) {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var line models.BankStatementLine
+		if err := tx.First(&line, lineID).Error; err != nil {
+			return err
+		}
+		if line.Amount >= 0 {
+			return errors.New("only withdrawals are matched to top-ups")
+		}
+		if line.Status != models.BankLineStatusUnmatched {
+			return fmt.Errorf("line is %s; unmatch it first", line.Status)
+		}
+
+		var topUp models.PettyCashTransaction
+		if err := tx.First(&topUp, transactionID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("transaction not found")
+			}
+			return err
+		}
+		var isTopUp int64
+		if err := topUps(tx).Where("petty_cash_transactions.id = ?", topUp.ID).Count(&isTopUp).Error; err != nil {
+			return err
+		}
+		if isTopUp == 0 {
+			return errors.New("transaction is not a petty cash top-up")
+		}
+		if topUp.Currency != line.Currency || math.Abs(topUp.Amount+line.Amount) >= 0.005 {
+			return fmt.Errorf("top-up of %.2f %s does not match the withdrawal of %.2f %s",
+				topUp.Amount, topUp.Currency, -line.Amount, line.Currency)
+		}
+		var other models.BankStatementLine
+		err := tx.Where("transaction_id = ?", topUp.ID).First(&other).Error
+		if err == nil {
+			return fmt.Errorf("transaction is already matched to bank line %d", other.ID)
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if err := setBankMatch(tx, &line, &topUp.ID, models.BankMatchMethodManual, userID); err != nil {
+			return err
+		}
+		detail := fmt.Sprintf("transaction %d, %.2f %s", topUp.ID, topUp.Amount, topUp.Currency)
+		return recordAudit(tx, "bank_line.match", "bank_statement_line", line.ID, userID, detail)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.getLine(lineID)
+}
+
+// UnmatchLine returns a matched or ignored withdrawal to the unmatched
+// lines.
+func (s *BankStatementService) UnmatchLine(lineID uint, userID string) (*models.BankStatementLine, error) {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var line models.BankStatementLine
+		if err := tx.First(&line, lineID).Error; err != nil {
+			return err
+		}
+		if line.Amount >= 0 {
+			return errors.New("deposits are always ignored")
+		}
+		if line.Status == models.BankLineStatusUnmatched {
+			return errors.New("line is not matched")
+		}
+		detail := string(line.Status)
+		if line.TransactionID != nil {
+			detail = fmt.Sprintf("transaction %d", *line.TransactionID)
+		}
+		if err := setBankMatch(tx, &line, nil, "", ""); err != nil {
+			return err
+		}
+		return recordAudit(tx, "bank_line.unmatch", "bank_statement_line", line.ID, userID, detail)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.getLine(lineID)
+}
+
+// IgnoreLine marks an unmatched withdrawal as not funding petty cash, such as
+// other payments from the same account, so it leaves the unreconciled
+// report.
+func (s *BankStatementService) IgnoreLine(lineID uint, userID string) (*models.BankStatementLine, error) {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var line models.BankStatementLine
+		if err := tx.First(&line, lineID).Error; err != nil {
+			return err
+		}
+		if line.Status != models.BankLineStatusUnmatched {
+			return fmt.Errorf("line is already %s", line.Status)
+		}
+		line.Status = models.BankLineStatusIgnored
+		if err := tx.Model(&line).Update("status", line.Status).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, "bank_line.ignore", "bank_statement_line", line.ID, userID, line.Description)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.getLine(lineID)
+}
+
+// RunMatching matches every unmatched withdrawal it can to a top-up, such as
+// after top-ups were entered late, and returns how many it matched.
+func (s *BankStatementService) RunMatching(userID string) (int, error) {
+	matched := 0
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var lines []models.BankStatementLine
+		err := tx.Where("status = ? AND amount < 0", models.BankLineStatusUnmatched).Find(&lines).Error
+		if err != nil {
+			return err
+		}
+		if matched, err = matchBankLines(tx, lines); err != nil || matched == 0 {
+			return err
+		}
+		return recordAudit(tx, "bank_statement.match", "bank_statement", 0, userID, fmt.Sprintf("%d lines matched", matched))
+	})
+	return matched, err
+}
+
+func (s *BankStatementService) getLine(id uint) (*models.BankStatementLine, error) {
+	var line models.BankStatementLine
+	if err := db.DB.Preload("Transaction").First(&line, id).Error; err != nil {
+		return nil, err
+	}
+	return &line, nil
+}
+
+// matchBankLines matches the unmatched withdrawals among lines, oldest first,
+// to unmatched top-ups of the same amount and currency dated within the
+// match window. A top-up whose reference, or else description, appears in
+// the line's reference or description is preferred, the closest in date if
+// several do; without one a line is only matched to a lone candidate, so
+// ambiguous lines are left for manual matching.
+func matchBankLines(tx *gorm.DB, lines []models.BankStatementLine) (int, error) {
+	window := GetBankMatchWindow()
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].BookingDate.Before(lines[j].BookingDate) })
+
+	matched := 0
+	for i := range lines {
+		line := &lines[i]
+		if line.Status != models.BankLineStatusUnmatched || line.Amount >= 0 {
+			continue
+		}
+		day := startOfDay(line.BookingDate)
+		var candidates []models.PettyCashTransaction
+		err := unmatchedTopUps(tx).
+			Where("currency = ? AND abs(amount - ?) < 0.005", line.Currency, -line.Amount).
+			Where("transaction_date >= ? AND transaction_date < ?", day.AddDate(0, 0, -window), day.AddDate(0, 0, window+1)).
+			Order("transaction_date, id").Find(&candidates).Error
+		if err != nil {
+			return 0, err
+		}
+
+		var referenced []models.PettyCashTransaction
+		for _, c := range candidates {
+			if referenceMatches(line, &c) {
+				referenced = append(referenced, c)
+			}
+		}
+		var match *models.PettyCashTransaction
+		switch {
+		case len(referenced) > 0:
+			match = closestTopUp(line.BookingDate, referenced)
+		case len(candidates) == 1:
+			match = &candidates[0]
+		}
+		if match == nil {
+			continue
+		}
+		if err := setBankMatch(tx, line, &match.ID, models.BankMatchMethodAuto, ""); err != nil {
+			return 0, err
+		}
+		matched++
+	}
+	return matched, nil
+}
+
+// closestTopUp returns the top-up dated closest to date, or nil when two are
+// equally close.
+func closestTopUp(date time.Time, candidates []models.PettyCashTransaction) *models.PettyCashTransaction {
+	var best *models.PettyCashTransaction
+	tie := false
+	for i := range candidates {
+		switch {
+		case best == nil || daysApart(candidates[i].TransactionDate, date) < daysApart(best.TransactionDate, date):
+			best, tie = &candidates[i], false
+		case daysApart(candidates[i].TransactionDate, date) == daysApart(best.TransactionDate, date):
+			tie = true
+		}
+	}
+	if tie {
+		return nil
+	}
+	return best
+}
+
+func daysApart(a, b time.Time) int {
+	days := int(startOfDay(a).Sub(startOfDay(b)).Hours() / 24)
+	if days < 0 {
+		return -days
+	}
+	return days
+}
+
+// referenceMatches reports whether a line names a top-up: its reference if
+// it has one, or else its description, in letters and digits only.
+func referenceMatches(line *models.BankStatementLine, topUp *models.PettyCashTransaction) bool {
+	text := referenceKey(line.Reference + " " + line.Description)
+	if ref := referenceKey(topUp.Reference); ref != "" {
+		return strings.Contains(text, ref)
+	}
+	desc := referenceKey(topUp.Description)
+	return len(desc) >= 6 && strings.Contains(text, desc)
+}
+
+func referenceKey(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
+
+// setBankMatch matches a line to a top-up, or with a nil transactionID
+// returns it to unmatched.
+func setBankMatch(tx *gorm.DB, line *models.BankStatementLine, transactionID *uint, method models.BankMatchMethod, userID string) error {
+	line.TransactionID = transactionID
+	line.Status = models.BankLineStatusUnmatched
+	line.MatchMethod = method
+	line.MatchedBy = userID
+	line.MatchedAt = nil
+	if transactionID != nil {
+		now := time.Now().UTC()
+		line.Status = models.BankLineStatusMatched
+		line.MatchedAt = &now
+	}
+	return tx.Model(line).Select("transaction_id", "status", "match_method", "matched_by", "matched_at").Updates(line).Error
+}
+
+// topUps selects the petty cash credits that bring cash in from the bank,
+// which are all credits except returned advance change, refunds paid back
+// into a fund and reconciliation adjustments.
+func topUps(tx *gorm.DB) *gorm.DB {
+	return tx.Model(&models.PettyCashTransaction{}).
+		Where("petty_cash_transactions.type = ? AND petty_cash_transactions.cash_advance_id IS NULL", models.TransactionTypeCredit).
+		Where("petty_cash_transactions.id NOT IN (SELECT petty_cash_transaction_id FROM refunds WHERE petty_cash_transaction_id IS NOT NULL)").
+		Where("petty_cash_transactions.id NOT IN (SELECT adjustment_transaction_id FROM reconciliations WHERE adjustment_transaction_id IS NOT NULL)")
+}
+
+// unmatchedTopUps selects the top-ups no statement line is matched to.
+func unmatchedTopUps(tx *gorm.DB) *gorm.DB {
+	return topUps(tx).
+		Where("petty_cash_transactions.id NOT IN (SELECT transaction_id FROM bank_statement_lines WHERE transaction_id IS NOT NULL)")
+}
@@ -0,0 +1,354 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"ledgerly/db"
+	"ledgerly/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type BudgetService struct{}
+
+// budgetAlertThresholds are the utilization percentages admins are notified
+// about, once per budget period.
+var budgetAlertThresholds = []int{80, 100}
+
+// budgetUsage is a budget's spend in the period of an expense, before and
+// after adding it.
+type budgetUsage struct {
+	Budget      models.Budget
+	PeriodStart time.Time
+	Before      float64
+	After       float64
+}
+
+func (s *BudgetService) CreateBudget(budget *models.Budget) error {
+	if err := validateBudget(budget); err != nil {
+		return err
+	}
+	budget.Active = true
+	return db.DB.Create(budget).Error
+}
+
+func (s *BudgetService) GetBudget(id uint) (*models.Budget, error) {
+	var budget models.Budget
+	if err := db.DB.First(&budget, id).Error; err != nil {
+		return nil, err
+	}
+	return &budget, nil
+}
+
+// UpdateBudget replaces a budget's settings with those of changes.
+func (s *BudgetService) UpdateBudget(id uint, changes *models.Budget) (*models.Budget, error) {
+	var budget models.Budget
+	if err := db.DB.First(&budget, id).Error; err != nil {
+		return nil, err
+	}
+
+	budget.Category = changes.Category
+	budget.FundID = changes.FundID
+	budget.UserID = changes.UserID
+	budget.Department = changes.Department
+	budget.Period = changes.Period
+	budget.Amount = changes.Amount
+	budget.OverspendAction = changes.OverspendAction
+	budget.StartDate = changes.StartDate
+	budget.EndDate = changes.EndDate
+	budget.Active = changes.Active
+	if err := validateBudget(&budget); err != nil {
+		return nil, err
+	}
+	if err := db.DB.Save(&budget).Error; err != nil {
+		return nil, err
+	}
+	return &budget, nil
+}
+
+func (s *BudgetService) DeleteBudget(id uint) error {
+	result := db.DB.Delete(&models.Budget{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (s *BudgetService) ListBudgets() ([]models.Budget, error) {
+	var budgets []models.Budget
+	err := db.DB.Order("category, start_date").Find(&budgets).Error
+	return budgets, err
+}
+
+func validateBudget(budget *models.Budget) error {
+	budget.Category = strings.TrimSpace(budget.Category)
+	if budget.Category == "" {
+		return errors.New("category is mandatory")
+	}
+	var category models.Category
+	if err := db.DB.Where("lower(name) = lower(?)", budget.Category).First(&category).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("unknown category")
+		}
+		return err
+	}
+	budget.Category = category.Name
+	if err := validateBudgetDepartment(budget); err != nil {
+		return err
+	}
+	if budget.Amount <= 0 {
+		return errors.New("amount must be greater than zero")
+	}
+
+	switch budget.Period {
+	case "":
+		budget.Period = models.BudgetPeriodMonth
+	case models.BudgetPeriodMonth, models.BudgetPeriodQuarter, models.BudgetPeriodYear:
+	default:
+		return errors.New("period must be month, quarter or year")
+	}
+
+	switch budget.OverspendAction {
+	case "":
+		budget.OverspendAction = models.OverspendWarn
+	case models.OverspendWarn, models.OverspendRequireApproval, models.OverspendBlock:
+	default:
+		return errors.New("overspend_action must be warn, require_approval or block")
+	}
+
+	// Budgets always start on a period boundary
+	startDate := budget.StartDate
+	if startDate.IsZero() {
+		startDate = time.Now()
+	}
+	budget.StartDate, _ = budgetPeriodRange(budget.Period, startDate)
+	if budget.EndDate != nil && !budget.EndDate.After(budget.StartDate) {
+		return errors.New("end_date must be after start_date")
+	}
+	return nil
+}
+
+// validateBudgetDepartment checks that a budget's department is a value of
+// the department dimension.
+func validateBudgetDepartment(budget *models.Budget) error {
+	budget.Department = strings.ToUpper(strings.TrimSpace(budget.Department))
+	if budget.Department == "" {
+		return nil
+	}
+	var values int64
+	err := db.DB.Model(&models.DimensionValue{}).
+		Joins("JOIN dimensions ON dimensions.id = dimension_values.dimension_id").
+		Where("dimensions.code = ? AND dimension_values.code = ?", models.DimensionDepartment, budget.Department).
+		Count(&values).Error
+	if err != nil {
+		return err
+	}
+	if values == 0 {
+		return errors.New("unknown department")
+	}
+	return nil
+}
+
+// budgetPeriodRange returns the [start, end) budget period of the given kind
+// containing date. Quarters and years follow the fiscal year.
+func budgetPeriodRange(period models.BudgetPeriod, date time.Time) (time.Time, time.Time) {
+	date = date.UTC()
+	monthStart := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	span := 1
+	switch period {
+	case models.BudgetPeriodQuarter:
+		span = 3
+	case models.BudgetPeriodYear:
+		span = 12
+	}
+	monthsIntoFiscalYear := (int(date.Month()) - int(GetFiscalYearStartMonth()) + 12) % 12
+	start := monthStart.AddDate(0, -(monthsIntoFiscalYear % span), 0)
+	return start, start.AddDate(0, span, 0)
+}
+
+// applyBudgets checks an unsaved expense against the budgets it counts
+// towards: those of its category and of the category's ancestors, or of each
+// split's for a split expense. Exceeding a budget warns, holds the expense
+// for approval or blocks it, depending on the budget's overspend action.
+func applyBudgets(tx *gorm.DB, expense *models.Expense) ([]budgetUsage, error) {
+	fundID, err := expenseFundID(tx, expense)
+	if err != nil {
+		return nil, err
+	}
+
+	var budgets []models.Budget
+	added := make(map[uint]float64)
+	for _, line := range chargedLines(expense) {
+		categories, err := expenseCategoryNames(tx, &models.Expense{Category: line.Category, CategoryID: line.CategoryID})
+		if err != nil {
+			return nil, err
+		}
+
+		query := tx.Where("active = ? AND category IN ? AND start_date <= ?", true, categories, expense.ExpenseDate).
+			Where("end_date IS NULL OR end_date > ?", expense.ExpenseDate).
+			Where("user_id = '' OR user_id = ?", expense.UserID).
+			Where("department = '' OR department = ?", line.Tags[models.DimensionDepartment])
+		if fundID != nil {
+			query = query.Where("fund_id IS NULL OR fund_id = ?", *fundID)
+		} else {
+			query = query.Where("fund_id IS NULL")
+		}
+		var matched []models.Budget
+		if err := query.Order("id").Find(&matched).Error; err != nil {
+			return nil, err
+		}
+		for _, budget := range matched {
+			if _, ok := added[budget.ID]; !ok {
+				budgets = append(budgets, budget)
+			}
+			added[budget.ID] += line.BaseAmount
+		}
+	}
+
+	usages := make([]budgetUsage, 0, len(budgets))
+	for _, budget := range budgets {
+		start, end := budgetPeriodRange(budget.Period, expense.ExpenseDate)
+		before, err := budgetActual(tx, budget, start, end)
+		if err != nil {
+			return nil, err
+		}
+		usage := budgetUsage{Budget: budget, PeriodStart: start, Before: before, After: roundAmount(before + added[budget.ID])}
+		usages = append(usages, usage)
+
+		if usage.After <= budget.Amount {
+			continue
+		}
+		message := fmt.Sprintf("%s budget of %.2f for the %s starting %s would be exceeded (%.2f already spent)",
+			budget.Category, budget.Amount, budget.Period, start.Format("2006-01-02"), before)
+		switch budget.OverspendAction {
+		case models.OverspendBlock:
+			return nil, errors.New(message)
+		case models.OverspendRequireApproval:
+			expense.Status = models.ExpenseStatusPendingApproval
+			expense.Warnings = append(expense.Warnings, message+"; approval required")
+		default:
+			expense.Warnings = append(expense.Warnings, message)
+		}
+	}
+	return usages, nil
+}
+
+// recordBudgetAlerts notifies admins the first time a budget crosses each
+// alert threshold within a period.
+func recordBudgetAlerts(tx *gorm.DB, usages []budgetUsage) error {
+	for _, usage := range usages {
+		for _, threshold := range budgetAlertThresholds {
+			limit := usage.Budget.Amount * float64(threshold) / 100
+			if usage.Before >= limit || usage.After < limit {
+				continue
+			}
+
+			alert := models.BudgetAlert{BudgetID: usage.Budget.ID, PeriodStart: usage.PeriodStart, Threshold: threshold}
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&alert)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+
+			err := notify(tx, &models.Notification{
+				Role:       models.RoleAdmin,
+				Type:       "budget_threshold",
+				Message:    fmt.Sprintf("%s budget reached %d%% (%.2f of %.2f) for the %s starting %s", usage.Budget.Category, threshold, usage.After, usage.Budget.Amount, usage.Budget.Period, usage.PeriodStart.Format("2006-01-02")),
+				EntityType: "budget",
+				EntityID:   usage.Budget.ID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// budgetActual sums the expenses and splits counted against budget in
+// [start, end), including those booked to subcategories. Drafts and rejected
+// expenses do not count; those awaiting approval do. Refunds received in the
+// period are taken off.
+func budgetActual(tx *gorm.DB, budget models.Budget, start, end time.Time) (float64, error) {
+	categories, err := categorySubtreeNames(tx, budget.Category)
+	if err != nil {
+		return 0, err
+	}
+
+	scope := func(query *gorm.DB) *gorm.DB {
+		query = query.
+			Joins("LEFT JOIN expense_splits ON expense_splits.expense_id = expenses.id").
+			Joins("LEFT JOIN petty_cash_transactions ON petty_cash_transactions.id = expenses.petty_cash_transaction_id").
+			Where("expenses.deleted_at IS NULL AND expenses.status NOT IN ?", models.UncountedExpenseStatuses).
+			Where("coalesce(expense_splits.category, expenses.category) IN ?", categories)
+		if budget.UserID != "" {
+			query = query.Where("expenses.user_id = ?", budget.UserID)
+		}
+		if budget.FundID != nil {
+			query = query.Where("petty_cash_transactions.fund_id = ?", *budget.FundID)
+		}
+		if budget.Department != "" {
+			query = query.Where("json_extract(coalesce(expense_splits.tags, expenses.tags), '$."+models.DimensionDepartment+"') = ?", budget.Department)
+		}
+		return query
+	}
+
+	var spent, refunded float64
+	err = scope(tx.Table("expenses")).
+		Where("expenses.expense_date >= ? AND expenses.expense_date < ?", start, end).
+		Select("coalesce(sum(coalesce(expense_splits.base_amount, expenses.base_amount)), 0)").Scan(&spent).Error
+	if err != nil {
+		return 0, err
+	}
+	// Refunds come off the period they were received in
+	err = scope(tx.Table("refunds").Joins("JOIN expenses ON expenses.id = refunds.expense_id")).
+		Where("refunds.refund_date >= ? AND refunds.refund_date < ?", start, end).
+		Select("coalesce(sum(refunds.base_amount * coalesce(expense_splits.base_amount / nullif(expenses.base_amount, 0), 1)), 0)").Scan(&refunded).Error
+	return spent - refunded, err
+}
+
+// expenseFundID returns the fund an expense was paid from, or nil if it was
+// paid out of pocket.
+func expenseFundID(tx *gorm.DB, expense *models.Expense) (*uint, error) {
+	if expense.PettyCashTransactionID == nil {
+		return nil, nil
+	}
+	var t models.PettyCashTransaction
+	if err := tx.First(&t, *expense.PettyCashTransactionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("petty cash transaction not found")
+		}
+		return nil, err
+	}
+	return &t.FundID, nil
+}
+
+// expenseCategoryNames returns the names of the expense's category and its
+// ancestors.
+func expenseCategoryNames(tx *gorm.DB, expense *models.Expense) ([]string, error) {
+	if expense.CategoryID == nil {
+		return []string{expense.Category}, nil
+	}
+	var category models.Category
+	if err := tx.First(&category, *expense.CategoryID).Error; err != nil {
+		return nil, err
+	}
+	lineage, err := categoryLineage(tx, category)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(lineage))
+	for _, c := range lineage {
+		names = append(names, c.Name)
+	}
+	return names, nil
+}
@@ -0,0 +1,448 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"ledgerly/db"
+	"ledgerly/models"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+type CategoryService struct{}
+
+// maxCategoryDepth bounds walks up the category tree.
+const maxCategoryDepth = 16
+
+// errDryRun rolls back a transaction whose changes were only previewed.
+var errDryRun = errors.New("dry run")
+
+// CategoryNode is a category with its subcategories.
+type CategoryNode struct {
+	models.Category
+	Children []*CategoryNode `json:"children"`
+}
+
+// LegacyCategory is a free-text category used by expenses that are not
+// linked to the category tree yet.
+type LegacyCategory struct {
+	Value     string `json:"value"`
+	Expenses  int64  `json:"expenses"`
+	Suggested string `json:"suggested"`
+}
+
+// CategoryMappingResult reports what MapLegacyCategories changed, or would
+// change in a dry run.
+type CategoryMappingResult struct {
+	Expenses int64    `json:"expenses"`
+	Budgets  int64    `json:"budgets"`
+	Created  []string `json:"created"`
+}
+
+func (s *CategoryService) CreateCategory(category *models.Category) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := validateCategory(tx, category); err != nil {
+			return err
+		}
+		category.Active = true
+		return tx.Create(category).Error
+	})
+}
+
+// UpdateCategory replaces a category's settings. Renaming a category renames
+// it on its expenses and budgets too, so reports stay grouped.
+func (s *CategoryService) UpdateCategory(id uint, changes *models.Category) (*models.Category, error) {
+	var category models.Category
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&category, id).Error; err != nil {
+			return err
+		}
+		oldName := category.Name
+
+		if name := strings.TrimSpace(changes.Name); name != "" {
+			category.Name = name
+		}
+		category.ParentID = changes.ParentID
+		category.GLAccount = changes.GLAccount
+		category.ReceiptRequired = changes.ReceiptRequired
+		category.MaxAmount = changes.MaxAmount
+		category.RequiredDimensions = changes.RequiredDimensions
+		category.Active = changes.Active
+		if err := validateCategory(tx, &category); err != nil {
+			return err
+		}
+		if err := tx.Save(&category).Error; err != nil {
+			return err
+		}
+
+		if category.Name == oldName {
+			return nil
+		}
+		if err := tx.Model(&models.Expense{}).Where("category_id = ?", category.ID).UpdateColumn("category", category.Name).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.ExpenseSplit{}).Where("category_id = ?", category.ID).UpdateColumn("category", category.Name).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Budget{}).Where("category = ?", oldName).UpdateColumn("category", category.Name).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// DeleteCategory removes an unused leaf category. Categories that have been
+// used must be deactivated instead.
+func (s *CategoryService) DeleteCategory(id uint) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var category models.Category
+		if err := tx.First(&category, id).Error; err != nil {
+			return err
+		}
+
+		var children int64
+		if err := tx.Model(&models.Category{}).Where("parent_id = ?", id).Count(&children).Error; err != nil {
+			return err
+		}
+		if children > 0 {
+			return errors.New("category has subcategories")
+		}
+
+		var used, splits int64
+		if err := tx.Model(&models.Expense{}).Where("category_id = ?", id).Count(&used).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.ExpenseSplit{}).Where("category_id = ?", id).Count(&splits).Error; err != nil {
+			return err
+		}
+		if used+splits > 0 {
+			return errors.New("category is in use; deactivate it instead")
+		}
+		return tx.Delete(&category).Error
+	})
+}
+
+func (s *CategoryService) GetCategory(id uint) (*models.Category, error) {
+	var category models.Category
+	if err := db.DB.First(&category, id).Error; err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+func (s *CategoryService) ListCategories(activeOnly bool) ([]models.Category, error) {
+	var categories []models.Category
+	query := db.DB.Order("name")
+	if activeOnly {
+		query = query.Where("active = ?", true)
+	}
+	err := query.Find(&categories).Error
+	return categories, err
+}
+
+// GetCategoryTree returns the top-level categories with their descendants.
+// With activeOnly, inactive categories and everything below them are left
+// out.
+func (s *CategoryService) GetCategoryTree(activeOnly bool) ([]*CategoryNode, error) {
+	categories, err := s.ListCategories(activeOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[uint]*CategoryNode, len(categories))
+	for _, category := range categories {
+		nodes[category.ID] = &CategoryNode{Category: category, Children: []*CategoryNode{}}
+	}
+	roots := []*CategoryNode{}
+	for _, category := range categories {
+		node := nodes[category.ID]
+		if category.ParentID == nil {
+			roots = append(roots, node)
+		} else if parent, ok := nodes[*category.ParentID]; ok {
+			parent.Children = append(parent.Children, node)
+		}
+	}
+	return roots, nil
+}
+
+// ListLegacyCategories returns the free-text categories of unlinked
+// expenses, each with the closest existing category as a suggestion.
+func (s *CategoryService) ListLegacyCategories() ([]LegacyCategory, error) {
+	var legacy []LegacyCategory
+	err := db.DB.Model(&models.Expense{}).
+		Select("category AS value, count(*) AS expenses").
+		Where("category_id IS NULL").
+		Group("category").
+		Order("category").
+		Scan(&legacy).Error
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := s.ListCategories(true)
+	if err != nil {
+		return nil, err
+	}
+	for i := range legacy {
+		legacy[i].Suggested = suggestCategory(legacy[i].Value, categories)
+	}
+	return legacy, nil
+}
+
+// MapLegacyCategories links expenses and budgets that use free-text
+// categories to the category tree. mapping maps each free-text value to a
+// category name; with create, missing categories are created at the top
+// level. Nothing is written unless apply is set.
+func (s *CategoryService) MapLegacyCategories(mapping map[string]string, create, apply bool) (*CategoryMappingResult, error) {
+	values := make([]string, 0, len(mapping))
+	for value := range mapping {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	result := &CategoryMappingResult{Created: []string{}}
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		for _, value := range values {
+			name := strings.TrimSpace(mapping[value])
+			if name == "" {
+				continue
+			}
+
+			var category models.Category
+			err := tx.Where("lower(name) = lower(?)", name).First(&category).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				if !create {
+					return fmt.Errorf("category %q does not exist", name)
+				}
+				category = models.Category{Name: name, Active: true}
+				if err := tx.Create(&category).Error; err != nil {
+					return err
+				}
+				result.Created = append(result.Created, category.Name)
+			} else if err != nil {
+				return err
+			}
+
+			// Mapping is bookkeeping only, so it also applies to expenses in
+			// closed periods
+			expenses := tx.Model(&models.Expense{}).
+				Where("category_id IS NULL AND category = ?", value).
+				UpdateColumns(map[string]interface{}{"category_id": category.ID, "category": category.Name})
+			if expenses.Error != nil {
+				return expenses.Error
+			}
+			result.Expenses += expenses.RowsAffected
+
+			budgets := tx.Model(&models.Budget{}).Where("category = ?", value).UpdateColumn("category", category.Name)
+			if budgets.Error != nil {
+				return budgets.Error
+			}
+			result.Budgets += budgets.RowsAffected
+		}
+		if !apply {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+	return result, nil
+}
+
+func validateCategory(tx *gorm.DB, category *models.Category) error {
+	category.Name = strings.TrimSpace(category.Name)
+	if category.Name == "" {
+		return errors.New("name is mandatory")
+	}
+	if category.MaxAmount != nil && *category.MaxAmount <= 0 {
+		return errors.New("max_amount must be greater than zero")
+	}
+	required, err := normalizeDimensionCodes(tx, category.RequiredDimensions)
+	if err != nil {
+		return err
+	}
+	category.RequiredDimensions = required
+
+	var duplicates int64
+	if err := tx.Model(&models.Category{}).Where("lower(name) = lower(?) AND id <> ?", category.Name, category.ID).Count(&duplicates).Error; err != nil {
+		return err
+	}
+	if duplicates > 0 {
+		return errors.New("a category with this name already exists")
+	}
+
+	if category.ParentID == nil {
+		return nil
+	}
+	var parent models.Category
+	if err := tx.First(&parent, *category.ParentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("parent category not found")
+		}
+		return err
+	}
+	ancestors, err := categoryLineage(tx, parent)
+	if err != nil {
+		return err
+	}
+	for _, ancestor := range ancestors {
+		if category.ID != 0 && ancestor.ID == category.ID {
+			return errors.New("a category cannot be moved below itself")
+		}
+	}
+	return nil
+}
+
+// applyCategory books an expense to its category and enforces the rules of
+// the category and its ancestors, including the dimensions they require. The
+// rules of a split expense apply to each split and its own category.
+func applyCategory(tx *gorm.DB, expense *models.Expense) error {
+	if _, err := resolveCategory(tx, expense); err != nil {
+		return err
+	}
+	for _, line := range chargedLines(expense) {
+		lineage, err := resolveCategory(tx, &models.Expense{Category: line.Category, CategoryID: line.CategoryID})
+		if err != nil {
+			return err
+		}
+		for _, c := range lineage {
+			if c.ReceiptRequired && !expense.Type.Calculated() && strings.TrimSpace(expense.Receipt) == "" {
+				return fmt.Errorf("a receipt is required for %s expenses", line.Category)
+			}
+			if c.MaxAmount != nil && line.BaseAmount > *c.MaxAmount {
+				return fmt.Errorf("%s expenses are limited to %.2f %s", c.Name, *c.MaxAmount, models.BaseCurrency())
+			}
+		}
+		if err := checkRequiredDimensions(tx, line.Tags, lineage); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveCategory books an expense to its category, given by ID or by name,
+// and returns the category's lineage. The category must be an active leaf.
+func resolveCategory(tx *gorm.DB, expense *models.Expense) ([]models.Category, error) {
+	var category models.Category
+	var err error
+	if expense.CategoryID != nil {
+		err = tx.First(&category, *expense.CategoryID).Error
+	} else {
+		name := strings.TrimSpace(expense.Category)
+		if name == "" {
+			return nil, errors.New("category is mandatory")
+		}
+		err = tx.Where("lower(name) = lower(?)", name).First(&category).Error
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("unknown category")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var children int64
+	if err := tx.Model(&models.Category{}).Where("parent_id = ? AND active = ?", category.ID, true).Count(&children).Error; err != nil {
+		return nil, err
+	}
+	if children > 0 {
+		return nil, fmt.Errorf("category %s has subcategories; choose one of them", category.Name)
+	}
+
+	lineage, err := categoryLineage(tx, category)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range lineage {
+		if !c.Active {
+			return nil, fmt.Errorf("category %s is inactive", c.Name)
+		}
+	}
+
+	expense.CategoryID = &category.ID
+	expense.Category = category.Name
+	return lineage, nil
+}
+
+// categoryLineage returns category followed by its ancestors, nearest first.
+func categoryLineage(tx *gorm.DB, category models.Category) ([]models.Category, error) {
+	lineage := []models.Category{category}
+	for parentID := category.ParentID; parentID != nil; {
+		if len(lineage) > maxCategoryDepth {
+			return nil, errors.New("category tree is too deep")
+		}
+		var parent models.Category
+		if err := tx.First(&parent, *parentID).Error; err != nil {
+			return nil, err
+		}
+		lineage = append(lineage, parent)
+		parentID = parent.ParentID
+	}
+	return lineage, nil
+}
+
+// categorySubtreeNames returns the name of the category called name and of
+// all its descendants. Unknown names are returned as is, so free-text
+// categories still match themselves.
+func categorySubtreeNames(tx *gorm.DB, name string) ([]string, error) {
+	var categories []models.Category
+	if err := tx.Find(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	children := make(map[uint][]models.Category)
+	var root *models.Category
+	for i, category := range categories {
+		if category.ParentID != nil {
+			children[*category.ParentID] = append(children[*category.ParentID], category)
+		}
+		if category.Name == name {
+			root = &categories[i]
+		}
+	}
+	if root == nil {
+		return []string{name}, nil
+	}
+
+	names := []string{}
+	queue := []models.Category{*root}
+	for len(queue) > 0 {
+		category := queue[0]
+		queue = queue[1:]
+		names = append(names, category.Name)
+		queue = append(queue, children[category.ID]...)
+	}
+	return names, nil
+}
+
+// suggestCategory picks the existing category a free-text value most likely
+// means: one with the same name ignoring case and punctuation, or else the
+// longest one whose name starts the value, so "Travelling" maps to "Travel".
+func suggestCategory(value string, categories []models.Category) string {
+	key := categoryKey(value)
+	best := ""
+	for _, category := range categories {
+		candidate := categoryKey(category.Name)
+		if candidate == key {
+			return category.Name
+		}
+		if len(candidate) >= 4 && strings.HasPrefix(key, candidate) && len(category.Name) > len(best) {
+			best = category.Name
+		}
+	}
+	return best
+}
+
+func categoryKey(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"ledgerly/db"
+	"ledgerly/models"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CurrencyService struct{}
+
+// Exchange rate sources.
+const (
+	RateSourceAPI = "api"
+	RateSourceCSV = "csv"
+)
+
+// RateFilter narrows exchange rate listings. An empty Currency means all
+// currencies.
+type RateFilter struct {
+	Currency string
+	Dates    DateRange
+}
+
+// RateImport is the outcome of a CSV rate import.
+type RateImport struct {
+	Imported int `json:"imported"`
+}
+
+// MissingRateError reports a conversion with no rate on or before the date.
+type MissingRateError struct {
+	Currency string
+	Date     time.Time
+}
+
+func (e *MissingRateError) Error() string {
+	return fmt.Sprintf("no %s exchange rate on or before %s", e.Currency, e.Date.Format("2006-01-02"))
+}
+
+func (e *MissingRateError) ErrorCode() string {
+	return "exchange_rate_missing"
+}
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// SetRate creates or replaces the rate of a currency on a date.
+func (s *CurrencyService) SetRate(rate *models.ExchangeRate, userID string) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		return saveRate(tx, rate, RateSourceAPI, userID)
+	})
+}
+
+func (s *CurrencyService) ListRates(filter RateFilter) ([]models.ExchangeRate, error) {
+	var rates []models.ExchangeRate
+	query := filter.Dates.apply(db.DB, "date")
+	if filter.Currency != "" {
+		query = query.Where("currency = ?", strings.ToUpper(filter.Currency))
+	}
+	err := query.Order("currency, date desc").Find(&rates).Error
+	return rates, err
+}
+
+func (s *CurrencyService) DeleteRate(id uint, userID string) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var rate models.ExchangeRate
+		if err := tx.First(&rate, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&rate).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, "exchange_rate.delete", "exchange_rate", rate.ID, userID, fmt.Sprintf("%s %s", rate.Currency, rate.Date.Format("2006-01-02")))
+	})
+}
+
+// ImportRates loads a CSV with a header row naming the currency, date
+// (YYYY-MM-DD) and rate columns. The import is all or nothing.
+func (s *CurrencyService) ImportRates(r io.Reader, userID string) (*RateImport, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("rate file is empty")
+	}
+
+	columns := map[string]int{"currency": -1, "date": -1, "rate": -1}
+	for i, name := range rows[0] {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := columns[name]; ok {
+			columns[name] = i
+		}
+	}
+	for name, col := range columns {
+		if col < 0 {
+			return nil, fmt.Errorf("rate file needs a %s column", name)
+		}
+	}
+
+	result := &RateImport{}
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		for n, row := range rows[1:] {
+			line := n + 2
+			field := func(name string) string {
+				if col := columns[name]; col < len(row) {
+					return strings.TrimSpace(row[col])
+				}
+				return ""
+			}
+			date, err := time.Parse("2006-01-02", field("date"))
+			if err != nil {
+				return fmt.Errorf("line %d: date must be YYYY-MM-DD", line)
+			}
+			value, err := strconv.ParseFloat(field("rate"), 64)
+			if err != nil {
+				return fmt.Errorf("line %d: rate must be a number", line)
+			}
+			rate := models.ExchangeRate{Currency: field("currency"), Date: date, Rate: value}
+			if err := saveRate(tx, &rate, RateSourceCSV, userID); err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+			result.Imported++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// saveRate validates rate and upserts it on its currency and date.
+func saveRate(tx *gorm.DB, rate *models.ExchangeRate, source, userID string) error {
+	currency, err := normalizeCurrency(rate.Currency)
+	if err != nil {
+		return err
+	}
+	if currency == models.BaseCurrency() {
+		return errors.New("the base currency has no exchange rate")
+	}
+	if rate.Rate <= 0 {
+		return errors.New("rate must be greater than zero")
+	}
+	if rate.Date.IsZero() {
+		return errors.New("date is mandatory")
+	}
+
+	rate.ID = 0
+	rate.Currency = currency
+	rate.Date = startOfDay(rate.Date)
+	rate.Source = source
+	rate.CreatedBy = userID
+	err = tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "currency"}, {Name: "date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "source", "created_by", "updated_at"}),
+	}).Create(rate).Error
+	if err != nil {
+		return err
+	}
+	if err := tx.Where("currency = ? AND date = ?", rate.Currency, rate.Date).First(rate).Error; err != nil {
+		return err
+	}
+	return recordAudit(tx, "exchange_rate.set", "exchange_rate", rate.ID, userID, fmt.Sprintf("%s %s = %g %s", rate.Currency, rate.Date.Format("2006-01-02"), rate.Rate, models.BaseCurrency()))
+}
+
+// normalizeCurrency upper-cases a currency code and checks it looks like an
+// ISO 4217 code. An empty code is the base currency.
+func normalizeCurrency(currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return models.BaseCurrency(), nil
+	}
+	if !currencyPattern.MatchString(currency) {
+		return "", errors.New("currency must be a three-letter ISO 4217 code")
+	}
+	return currency, nil
+}
+
+// rateOn returns the latest rate of currency on or before date. The base
+// currency is always 1.
+func rateOn(tx *gorm.DB, currency string, date time.Time) (float64, error) {
+	if currency == models.BaseCurrency() {
+		return 1, nil
+	}
+	var rate models.ExchangeRate
+	err := tx.Where("currency = ? AND date <= ?", currency, date.UTC()).Order("date desc").First(&rate).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, &MissingRateError{Currency: currency, Date: date}
+	}
+	if err != nil {
+		return 0, err
+	}
+	return rate.Rate, nil
+}
+
+// convertToBase returns the rate of currency on date and amount converted
+// with it, rounded to cents.
+func convertToBase(tx *gorm.DB, currency string, amount float64, date time.Time) (float64, float64, error) {
+	rate, err := rateOn(tx, currency, date)
+	if err != nil {
+		return 0, 0, err
+	}
+	return rate, roundAmount(amount * rate), nil
+}
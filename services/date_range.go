@@ -0,0 +1,112 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"ledgerly/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DateRange limits a query to business dates in [From, To). A zero bound is
+// open. Bounds are compared in UTC, the zone dates are stored in.
+type DateRange struct {
+	From time.Time
+	To   time.Time
+}
+
+func (r DateRange) apply(query *gorm.DB, column string) *gorm.DB {
+	if !r.From.IsZero() {
+		query = query.Where(column+" >= ?", r.From.UTC())
+	}
+	if !r.To.IsZero() {
+		query = query.Where(column+" < ?", r.To.UTC())
+	}
+	return query
+}
+
+// normalizeBusinessDate defaults a missing business date to now, stores it in
+// UTC and rejects dates in the future or before the lock date.
+func normalizeBusinessDate(tx *gorm.DB, date time.Time) (time.Time, error) {
+	now := time.Now().UTC()
+	if date.IsZero() {
+		date = now
+	}
+	date = date.UTC()
+	if date.After(now) {
+		return time.Time{}, errors.New("date cannot be in the future")
+	}
+	if err := models.CheckPeriodOpen(tx, date); err != nil {
+		return time.Time{}, err
+	}
+	return date, nil
+}
+
+// startOfDay returns midnight UTC of t's day.
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Report intervals for time-series bucketing.
+const (
+	IntervalDay     = "day"
+	IntervalWeek    = "week"
+	IntervalMonth   = "month"
+	IntervalQuarter = "quarter"
+)
+
+// ValidInterval reports whether interval is a supported bucket size.
+func ValidInterval(interval string) bool {
+	switch interval {
+	case IntervalDay, IntervalWeek, IntervalMonth, IntervalQuarter:
+		return true
+	}
+	return false
+}
+
+// bucketStart returns the start of the bucket containing t, in loc. Business
+// dates are stored as UTC timestamps, so the day they fall on depends on loc.
+// Weeks start on Monday and quarters follow the calendar year.
+func bucketStart(t time.Time, interval string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	switch interval {
+	case IntervalWeek:
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case IntervalMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+	case IntervalQuarter:
+		month := time.Month((int(t.Month())-1)/3*3 + 1)
+		return time.Date(t.Year(), month, 1, 0, 0, 0, 0, loc)
+	}
+	return day
+}
+
+// nextBucket returns the start of the bucket after the one starting at start.
+func nextBucket(start time.Time, interval string) time.Time {
+	switch interval {
+	case IntervalWeek:
+		return start.AddDate(0, 0, 7)
+	case IntervalMonth:
+		return start.AddDate(0, 1, 0)
+	case IntervalQuarter:
+		return start.AddDate(0, 3, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+func bucketLabel(start time.Time, interval string) string {
+	switch interval {
+	case IntervalWeek:
+		year, week := start.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case IntervalMonth:
+		return start.Format("2006-01")
+	case IntervalQuarter:
+		return fmt.Sprintf("%d-Q%d", start.Year(), (int(start.Month())-1)/3+1)
+	}
+	return start.Format("2006-01-02")
+}
@@ -0,0 +1,293 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"ledgerly/db"
+	"ledgerly/models"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DimensionService struct{}
+
+// UntaggedDimension is the dimension value key of spend not tagged with the
+// dimension.
+const UntaggedDimension = "untagged"
+
+var (
+	dimensionCodePattern  = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+	dimensionValuePattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9_.-]{0,31}$`)
+)
+
+func (s *DimensionService) CreateDimension(dimension *models.Dimension) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		dimension.Code = strings.ToLower(strings.TrimSpace(dimension.Code))
+		if !dimensionCodePattern.MatchString(dimension.Code) {
+			return errors.New("code must be lower-case letters, digits and underscores, starting with a letter")
+		}
+		if err := validateDimension(tx, dimension); err != nil {
+			return err
+		}
+		dimension.Active = true
+		dimension.Values = nil
+		return tx.Create(dimension).Error
+	})
+}
+
+// UpdateDimension replaces a dimension's name and flags. The code cannot
+// change because expenses are tagged with it.
+func (s *DimensionService) UpdateDimension(id uint, changes *models.Dimension) (*models.Dimension, error) {
+	var dimension models.Dimension
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&dimension, id).Error; err != nil {
+			return err
+		}
+		if name := strings.TrimSpace(changes.Name); name != "" {
+			dimension.Name = name
+		}
+		dimension.Required = changes.Required
+		dimension.Active = changes.Active
+		if err := validateDimension(tx, &dimension); err != nil {
+			return err
+		}
+		return tx.Omit(clause.Associations).Save(&dimension).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetDimension(id)
+}
+
+func (s *DimensionService) GetDimension(id uint) (*models.Dimension, error) {
+	var dimension models.Dimension
+	err := db.DB.Preload("Values", func(tx *gorm.DB) *gorm.DB { return tx.Order("code") }).First(&dimension, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &dimension, nil
+}
+
+// ListDimensions returns dimensions with their values. With activeOnly,
+// inactive dimensions and values are left out.
+func (s *DimensionService) ListDimensions(activeOnly bool) ([]models.Dimension, error) {
+	var dimensions []models.Dimension
+	query := db.DB.Order("code").Preload("Values", func(tx *gorm.DB) *gorm.DB {
+		if activeOnly {
+			tx = tx.Where("active = ?", true)
+		}
+		return tx.Order("code")
+	})
+	if activeOnly {
+		query = query.Where("active = ?", true)
+	}
+	err := query.Find(&dimensions).Error
+	return dimensions, err
+}
+
+func (s *DimensionService) CreateValue(dimensionID uint, value *models.DimensionValue) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&models.Dimension{}, dimensionID).Error; err != nil {
+			return err
+		}
+		value.ID = 0
+		value.DimensionID = dimensionID
+		value.Code = strings.ToUpper(strings.TrimSpace(value.Code))
+		if !dimensionValuePattern.MatchString(value.Code) {
+			return errors.New("code must be up to 32 letters, digits, dots, dashes and underscores")
+		}
+		if err := validateDimensionValue(tx, value); err != nil {
+			return err
+		}
+		value.Active = true
+		return tx.Create(value).Error
+	})
+}
+
+func (s *DimensionService) GetValue(dimensionID, id uint) (*models.DimensionValue, error) {
+	var value models.DimensionValue
+	if err := db.DB.Where("dimension_id = ?", dimensionID).First(&value, id).Error; err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+// UpdateValue replaces a dimension value's name and active flag. The code
+// cannot change because expenses are tagged with it; deactivate the value
+// and create a new one instead.
+func (s *DimensionService) UpdateValue(dimensionID, id uint, changes *models.DimensionValue) (*models.DimensionValue, error) {
+	var value models.DimensionValue
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("dimension_id = ?", dimensionID).First(&value, id).Error; err != nil {
+			return err
+		}
+		if name := strings.TrimSpace(changes.Name); name != "" {
+			value.Name = name
+		}
+		value.Active = changes.Active
+		if err := validateDimensionValue(tx, &value); err != nil {
+			return err
+		}
+		return tx.Save(&value).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+func validateDimension(tx *gorm.DB, dimension *models.Dimension) error {
+	dimension.Name = strings.TrimSpace(dimension.Name)
+	if dimension.Name == "" {
+		return errors.New("name is mandatory")
+	}
+	var duplicates int64
+	if err := tx.Model(&models.Dimension{}).Where("code = ? AND id <> ?", dimension.Code, dimension.ID).Count(&duplicates).Error; err != nil {
+		return err
+	}
+	if duplicates > 0 {
+		return errors.New("a dimension with this code already exists")
+	}
+	return nil
+}
+
+func validateDimensionValue(tx *gorm.DB, value *models.DimensionValue) error {
+	value.Name = strings.TrimSpace(value.Name)
+	if value.Name == "" {
+		value.Name = value.Code
+	}
+	var duplicates int64
+	err := tx.Model(&models.DimensionValue{}).
+		Where("dimension_id = ? AND code = ? AND id <> ?", value.DimensionID, value.Code, value.ID).
+		Count(&duplicates).Error
+	if err != nil {
+		return err
+	}
+	if duplicates > 0 {
+		return errors.New("a value with this code already exists")
+	}
+	return nil
+}
+
+// normalizeTags checks that every tag names an active dimension and one of
+// its active values, and returns the tags with canonical codes. Tags with an
+// empty value are dropped.
+func normalizeTags(tx *gorm.DB, tags models.Tags) (models.Tags, error) {
+	normalized := make(models.Tags, len(tags))
+	for code, value := range tags {
+		code = strings.ToLower(strings.TrimSpace(code))
+		if value = strings.ToUpper(strings.TrimSpace(value)); value != "" {
+			normalized[code] = value
+		}
+	}
+	if len(normalized) == 0 {
+		return nil, nil
+	}
+
+	codes := make([]string, 0, len(normalized))
+	for code := range normalized {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		var dimension models.Dimension
+		if err := tx.Where("code = ?", code).Limit(1).Find(&dimension).Error; err != nil {
+			return nil, err
+		}
+		if dimension.ID == 0 {
+			return nil, fmt.Errorf("unknown dimension %s", code)
+		}
+		if !dimension.Active {
+			return nil, fmt.Errorf("dimension %s is inactive", code)
+		}
+
+		var value models.DimensionValue
+		if err := tx.Where("dimension_id = ? AND code = ?", dimension.ID, normalized[code]).Limit(1).Find(&value).Error; err != nil {
+			return nil, err
+		}
+		if value.ID == 0 {
+			return nil, fmt.Errorf("unknown %s %s", code, normalized[code])
+		}
+		if !value.Active {
+			return nil, fmt.Errorf("%s %s is inactive", code, value.Code)
+		}
+	}
+	return normalized, nil
+}
+
+// applyTags validates an expense's tags. An expense paid from petty cash
+// without tags of its own takes those of its transaction.
+func applyTags(tx *gorm.DB, expense *models.Expense) error {
+	if len(expense.Tags) == 0 && expense.PettyCashTransactionID != nil {
+		var t models.PettyCashTransaction
+		if err := tx.First(&t, *expense.PettyCashTransactionID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("petty cash transaction not found")
+			}
+			return err
+		}
+		expense.Tags = t.Tags
+	}
+	tags, err := normalizeTags(tx, expense.Tags)
+	if err != nil {
+		return err
+	}
+	expense.Tags = tags
+	return nil
+}
+
+// checkRequiredDimensions makes sure tags include every active required
+// dimension and every active dimension the category lineage requires.
+func checkRequiredDimensions(tx *gorm.DB, tags models.Tags, lineage []models.Category) error {
+	var required []models.Dimension
+	query := tx.Where("active = ?", true)
+	codes := make([]string, 0)
+	for _, c := range lineage {
+		codes = append(codes, c.RequiredDimensions...)
+	}
+	if len(codes) > 0 {
+		query = query.Where("required = ? OR code IN ?", true, codes)
+	} else {
+		query = query.Where("required = ?", true)
+	}
+	if err := query.Order("code").Find(&required).Error; err != nil {
+		return err
+	}
+	for _, dimension := range required {
+		if tags[dimension.Code] == "" {
+			return fmt.Errorf("%s is required", strings.ToLower(dimension.Name))
+		}
+	}
+	return nil
+}
+
+// normalizeDimensionCodes lower-cases and de-duplicates dimension codes and
+// checks that each names an existing dimension.
+func normalizeDimensionCodes(tx *gorm.DB, codes []string) ([]string, error) {
+	seen := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		if code = strings.ToLower(strings.TrimSpace(code)); code != "" {
+			seen[code] = true
+		}
+	}
+	normalized := sortedKeys(seen)
+	if len(normalized) == 0 {
+		return nil, nil
+	}
+
+	var known []string
+	if err := tx.Model(&models.Dimension{}).Where("code IN ?", normalized).Pluck("code", &known).Error; err != nil {
+		return nil, err
+	}
+	if len(known) != len(normalized) {
+		for _, code := range known {
+			delete(seen, code)
+		}
+		return nil, fmt.Errorf("unknown dimension %s", strings.Join(sortedKeys(seen), ", "))
+	}
+	return normalized, nil
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"ledgerly/db"
+	"ledgerly/models"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type DuplicateService struct{}
+
+// Duplicate detection modes.
+const (
+	DuplicateModeOff   = "off"
+	DuplicateModeFlag  = "flag"
+	DuplicateModeBlock = "block"
+)
+
+// DuplicateCodeBlocked is the error code of an expense blocked as a likely
+// duplicate.
+const DuplicateCodeBlocked = "duplicate_expense"
+
+// duplicateWindowDays is how far apart two entries may be dated and still be
+// compared.
+const duplicateWindowDays = 14
+
+// DuplicateError reports the entries a blocked expense likely duplicates.
+type DuplicateError struct {
+	Matches []models.DuplicateFlag
+}
+
+func (e *DuplicateError) Error() string {
+	descriptions := make([]string, 0, len(e.Matches))
+	for _, m := range e.Matches {
+		descriptions = append(descriptions, fmt.Sprintf("%s #%d (score %d)", m.MatchType, m.MatchID, m.Score))
+	}
+	return "expense looks like a duplicate of " + strings.Join(descriptions, ", ")
+}
+
+func (e *DuplicateError) ErrorCode() string {
+	return DuplicateCodeBlocked
+}
+
+// GetDuplicateMode returns DUPLICATE_DETECTION_MODE (off, flag or block),
+// defaulting to flag.
+func GetDuplicateMode() string {
+	switch mode := os.Getenv("DUPLICATE_DETECTION_MODE"); mode {
+	case DuplicateModeOff, DuplicateModeBlock:
+		return mode
+	default:
+		return DuplicateModeFlag
+	}
+}
+
+// GetDuplicateThreshold returns the score from DUPLICATE_SCORE_THRESHOLD
+// (1-100) at which entries count as duplicates, defaulting to 70.
+func GetDuplicateThreshold() int {
+	threshold, err := strconv.Atoi(os.Getenv("DUPLICATE_SCORE_THRESHOLD"))
+	if err != nil || threshold < 1 || threshold > 100 {
+		return 70
+	}
+	return threshold
+}
+
+func (s *DuplicateService) ListFlags(status models.DuplicateStatus) ([]models.DuplicateFlag, error) {
+	var flags []models.DuplicateFlag
+	query := db.DB.Preload("Expense").Order("score desc, id")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Find(&flags).Error
+	return flags, err
+}
+
+// DismissFlag records that a flagged pair is not a duplicate.
+func (s *DuplicateService) DismissFlag(id uint, userID, note string) (*models.DuplicateFlag, error) {
+	return reviewFlag(id, userID, note, models.DuplicateStatusDismissed)
+}
+
+// ConfirmFlag records that a flagged expense is a duplicate and rejects it.
+func (s *DuplicateService) ConfirmFlag(id uint, userID, note string) (*models.DuplicateFlag, error) {
+	return reviewFlag(id, userID, note, models.DuplicateStatusConfirmed)
+}
+
+func reviewFlag(id uint, userID, note string, status models.DuplicateStatus) (*models.DuplicateFlag, error) {
+	var flag models.DuplicateFlag
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Preload("Expense").First(&flag, id).Error; err != nil {
+			return err
+		}
+		if flag.Status != models.DuplicateStatusOpen {
+			return errors.New("duplicate flag is already reviewed")
+		}
+
+		now := time.Now().UTC()
+		flag.Status = status
+		flag.ReviewedBy = userID
+		flag.ReviewedAt = &now
+		flag.ReviewNote = note
+		if err := tx.Omit("Expense").Save(&flag).Error; err != nil {
+			return err
+		}
+
+		if status == models.DuplicateStatusConfirmed && flag.Expense != nil && flag.Expense.Status != models.ExpenseStatusRejected {
+			// Rejecting is a status change, so it is allowed in closed periods
+			err := tx.Model(flag.Expense).UpdateColumns(map[string]interface{}{
+				"status":      models.ExpenseStatusRejected,
+				"reviewed_by": userID,
+				"reviewed_at": now,
+				"review_note": "Duplicate of " + flag.MatchType + " #" + strconv.FormatUint(uint64(flag.MatchID), 10),
+				"updated_at":  now,
+			}).Error
+			if err != nil {
+				return err
+			}
+			if err := cancelReimbursement(tx, flag.ExpenseID); err != nil {
+				return err
+			}
+			if err := refreshExpenseAdvance(tx, flag.Expense); err != nil {
+				return err
+			}
+			if err := refreshExpenseReport(tx, flag.Expense); err != nil {
+				return err
+			}
+		}
+		return recordAudit(tx, "duplicate."+string(status), "expense", flag.ExpenseID, userID, note)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &flag, nil
+}
+
+// checkDuplicates scores an expense being submitted against the claimant's
+// other expenses and petty cash debits. In block mode likely duplicates
+// stop the submission; otherwise they are returned to be flagged.
+func checkDuplicates(tx *gorm.DB, expense *models.Expense) ([]models.DuplicateFlag, error) {
+	mode := GetDuplicateMode()
+	if mode == DuplicateModeOff {
+		return nil, nil
+	}
+
+	matches, err := findDuplicates(tx, expense, GetDuplicateThreshold())
+	if err != nil || len(matches) == 0 {
+		return nil, err
+	}
+	if mode == DuplicateModeBlock {
+		return nil, &DuplicateError{Matches: matches}
+	}
+	for _, m := range matches {
+		expense.Warnings = append(expense.Warnings, fmt.Sprintf("possible duplicate of %s #%d (score %d)", m.MatchType, m.MatchID, m.Score))
+	}
+	return matches, nil
+}
+
+// recordDuplicateFlags queues the matches of a saved expense for review.
+func recordDuplicateFlags(tx *gorm.DB, expenseID uint, matches []models.DuplicateFlag) error {
+	if len(matches) == 0 {
+		return nil
+	}
+	for i := range matches {
+		matches[i].ExpenseID = expenseID
+		matches[i].Status = models.DuplicateStatusOpen
+	}
+	return tx.Create(&matches).Error
+}
+
+// findDuplicates returns the entries scoring at least threshold against
+// expense: the claimant's submitted expenses and unlinked petty cash debits
+// dated nearby, and any expense with the same receipt file.
+func findDuplicates(tx *gorm.DB, expense *models.Expense, threshold int) ([]models.DuplicateFlag, error) {
+	from := expense.ExpenseDate.AddDate(0, 0, -duplicateWindowDays)
+	to := expense.ExpenseDate.AddDate(0, 0, duplicateWindowDays)
+
+	nearby := tx.Where("user_id = ? AND expense_date BETWEEN ? AND ?", expense.UserID, from, to)
+	if expense.ReceiptHash != "" {
+		nearby = nearby.Or("receipt_hash = ?", expense.ReceiptHash)
+	}
+	var expenses []models.Expense
+	err := tx.Where("id <> ? AND status NOT IN ?", expense.ID, models.UncountedExpenseStatuses).
+		Where(nearby).
+		Find(&expenses).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []models.DuplicateFlag
+	for _, other := range expenses {
+		score, reasons := duplicateScore(expense, other.Currency, other.Amount, other.ExpenseDate, other.Category, other.Title)
+		if expense.ReceiptHash != "" && other.ReceiptHash == expense.ReceiptHash {
+			score, reasons = 100, append(reasons, "same receipt file")
+		}
+		if score >= threshold {
+			matches = append(matches, models.DuplicateFlag{MatchType: models.DuplicateMatchExpense, MatchID: other.ID, Score: score, Reasons: reasons})
+		}
+	}
+
+	// Debits already backing an expense are covered by that expense, and cash
+	// advances are accounted for by liquidating them
+	debits := tx.Where("user_id = ? AND type = ? AND transaction_date BETWEEN ? AND ?", expense.UserID, models.TransactionTypeDebit, from, to).
+		Where("cash_advance_id IS NULL").
+		Where("id NOT IN (SELECT petty_cash_transaction_id FROM expenses WHERE petty_cash_transaction_id IS NOT NULL AND deleted_at IS NULL)")
+	if expense.PettyCashTransactionID != nil {
+		debits = debits.Where("id <> ?", *expense.PettyCashTransactionID)
+	}
+	var transactions []models.PettyCashTransaction
+	if err := debits.Find(&transactions).Error; err != nil {
+		return nil, err
+	}
+	for _, t := range transactions {
+		score, reasons := duplicateScore(expense, t.Currency, t.Amount, t.TransactionDate, "", t.Description)
+		if score >= threshold {
+			matches = append(matches, models.DuplicateFlag{MatchType: models.DuplicateMatchTransaction, MatchID: t.ID, Score: score, Reasons: reasons})
+		}
+	}
+	return matches, nil
+}
+
+// duplicateScore rates how likely an entry is the same spend as expense: 40
+// points for the same amount in the same currency, up to 25 for date
+// proximity, 10 for the same category and up to 25 for title similarity.
+func duplicateScore(expense *models.Expense, currency string, amount float64, date time.Time, category, title string) (int, []string) {
+	score := 0
+	reasons := []string{}
+
+	if expense.Currency == currency && math.Abs(expense.Amount-amount) < 0.005 {
+		score += 40
+		reasons = append(reasons, "same amount")
+	}
+
+	days := math.Abs(expense.ExpenseDate.Sub(date).Hours()) / 24
+	switch {
+	case days < 1:
+		score += 25
+		reasons = append(reasons, "same day")
+	case days <= 3:
+		score += 15
+		reasons = append(reasons, fmt.Sprintf("%.0f days apart", math.Round(days)))
+	case days <= 7:
+		score += 10
+		reasons = append(reasons, fmt.Sprintf("%.0f days apart", math.Round(days)))
+	}
+
+	if category != "" && strings.EqualFold(expense.Category, category) {
+		score += 10
+		reasons = append(reasons, "same category")
+	}
+
+	if similarity := titleSimilarity(expense.Title, title); similarity > 0 {
+		score += int(math.Round(similarity * 25))
+		reasons = append(reasons, fmt.Sprintf("similar title (%.0f%%)", similarity*100))
+	}
+	return score, reasons
+}
+
+// titleSimilarity is the Jaccard similarity of the words in two titles.
+func titleSimilarity(a, b string) float64 {
+	setA := make(map[string]bool)
+	for _, w := range words(strings.ToLower(a)) {
+		setA[w] = true
+	}
+	setB := make(map[string]bool)
+	for _, w := range words(strings.ToLower(b)) {
+		setB[w] = true
+	}
+	if len(setA) == 0 || len(setB) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for w := range setA {
+		if setB[w] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(setA)+len(setB)-shared)
+}
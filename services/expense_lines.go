@@ -0,0 +1,85 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"ledgerly/db"
+	"ledgerly/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// expenseLine is the unit that expense reports aggregate over: a split of a
+// split expense, or else the whole expense. Amount is in the base currency
+// and OriginalAmount in the expense's Currency. Tags maps dimension codes to
+// value codes. Refund lines take a refund off the expense's lines as of the
+// refund date, with negative amounts.
+type expenseLine struct {
+	ExpenseID      uint
+	Refund         bool
+	Date           time.Time
+	Amount         float64
+	Currency       string
+	OriginalAmount float64
+	Category       string
+	UserID         string
+	FundID         *uint
+	Tags           models.Tags
+}
+
+// eachExpenseLine streams the expense lines dated within dates to fn without
+// loading them all into memory, followed by the refund lines of refunds dated
+// within dates. Split expenses yield one line per split, and their refunds are
+// shared between the splits in proportion. Drafts and rejected expenses are
+// left out. FundID is the fund of the linked petty cash transaction, or nil
+// for expenses paid out of pocket.
+func eachExpenseLine(dates DateRange, fn func(line expenseLine) error) error {
+	expenses := db.DB.Table("expenses").
+		Select("expenses.id, expenses.expense_date, "+
+			"coalesce(expense_splits.base_amount, expenses.base_amount), expenses.currency, "+
+			"coalesce(expense_splits.amount, expenses.amount), coalesce(expense_splits.category, expenses.category), "+
+			"expenses.user_id, petty_cash_transactions.fund_id, coalesce(expense_splits.tags, expenses.tags)").
+		Joins("LEFT JOIN expense_splits ON expense_splits.expense_id = expenses.id").
+		Joins("LEFT JOIN petty_cash_transactions ON petty_cash_transactions.id = expenses.petty_cash_transaction_id").
+		Where("expenses.deleted_at IS NULL AND expenses.status NOT IN ?", models.UncountedExpenseStatuses)
+	if err := scanExpenseLines(dates.apply(expenses, "expenses.expense_date"), false, fn); err != nil {
+		return err
+	}
+
+	refunds := db.DB.Table("refunds").
+		Select("expenses.id, refunds.refund_date, "+
+			"-refunds.base_amount * coalesce(expense_splits.base_amount / nullif(expenses.base_amount, 0), 1), expenses.currency, "+
+			"-refunds.amount * coalesce(expense_splits.amount / nullif(expenses.amount, 0), 1), coalesce(expense_splits.category, expenses.category), "+
+			"expenses.user_id, petty_cash_transactions.fund_id, coalesce(expense_splits.tags, expenses.tags)").
+		Joins("JOIN expenses ON expenses.id = refunds.expense_id").
+		Joins("LEFT JOIN expense_splits ON expense_splits.expense_id = expenses.id").
+		Joins("LEFT JOIN petty_cash_transactions ON petty_cash_transactions.id = expenses.petty_cash_transaction_id").
+		Where("expenses.deleted_at IS NULL AND expenses.status NOT IN ?", models.UncountedExpenseStatuses)
+	return scanExpenseLines(dates.apply(refunds, "refunds.refund_date"), true, fn)
+}
+
+func scanExpenseLines(query *gorm.DB, refund bool, fn func(line expenseLine) error) error {
+	rows, err := query.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		line := expenseLine{Refund: refund}
+		var tags sql.NullString
+		if err := rows.Scan(&line.ExpenseID, &line.Date, &line.Amount, &line.Currency, &line.OriginalAmount, &line.Category, &line.UserID, &line.FundID, &tags); err != nil {
+			return err
+		}
+		if tags.Valid && tags.String != "" {
+			if err := json.Unmarshal([]byte(tags.String), &line.Tags); err != nil {
+				return err
+			}
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,429 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"ledgerly/db"
+	"ledgerly/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ExpenseReportService struct{}
+
+// ExpenseReportFilter narrows an expense report listing. Zero values match
+// everything.
+type ExpenseReportFilter struct {
+	UserID string
+	Status models.ExpenseReportStatus
+}
+
+// LineRejection rejects one line of an expense report under review.
+type LineRejection struct {
+	ExpenseID uint   `json:"expense_id"`
+	Reason    string `json:"reason" example:"Personal expense"`
+}
+
+// CreateReport starts an empty draft report for userID.
+func (s *ExpenseReportService) CreateReport(report *models.ExpenseReport, userID string) error {
+	report.Title = strings.TrimSpace(report.Title)
+	if report.Title == "" {
+		return errors.New("title is mandatory")
+	}
+	*report = models.ExpenseReport{
+		UserID:      userID,
+		Title:       report.Title,
+		Description: report.Description,
+		Status:      models.ExpenseReportStatusDraft,
+	}
+	return db.DB.Create(report).Error
+}
+
+// UpdateReport changes the title and description of one of the user's
+// draft reports.
+func (s *ExpenseReportService) UpdateReport(id uint, userID string, changes *models.ExpenseReport) (*models.ExpenseReport, error) {
+	title := strings.TrimSpace(changes.Title)
+	if title == "" {
+		return nil, errors.New("title is mandatory")
+	}
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		report, err := loadDraftReport(tx, id, userID)
+		if err != nil {
+			return err
+		}
+		return tx.Model(report).Updates(map[string]interface{}{"title": title, "description": changes.Description}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetReport(id)
+}
+
+// DeleteReport deletes one of the user's draft reports. Its expenses stay
+// as drafts.
+func (s *ExpenseReportService) DeleteReport(id uint, userID string) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		report, err := loadDraftReport(tx, id, userID)
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&models.Expense{}).Where("expense_report_id = ?", report.ID).
+			UpdateColumn("expense_report_id", nil).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(report).Error
+	})
+}
+
+func (s *ExpenseReportService) GetReport(id uint) (*models.ExpenseReport, error) {
+	var report models.ExpenseReport
+	err := db.DB.Preload("Expenses", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("expense_date, id")
+	}).Preload("Expenses.Splits").Preload("Expenses.PolicyViolations").First(&report, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (s *ExpenseReportService) ListReports(filter ExpenseReportFilter) ([]models.ExpenseReport, error) {
+	var reports []models.ExpenseReport
+	query := db.DB.Order("created_at desc, id desc")
+	if filter.UserID != "" {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	err := query.Find(&reports).Error
+	return reports, err
+}
+
+// AddExpenses puts some of the user's draft expenses on one of their draft
+// reports.
+func (s *ExpenseReportService) AddExpenses(id uint, userID string, expenseIDs []uint) (*models.ExpenseReport, error) {
+	if len(expenseIDs) == 0 {
+		return nil, errors.New("expense_ids is required")
+	}
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		report, err := loadDraftReport(tx, id, userID)
+		if err != nil {
+			return err
+		}
+
+		var expenses []models.Expense
+		if err := tx.Where("id IN ?", expenseIDs).Find(&expenses).Error; err != nil {
+			return err
+		}
+		if len(expenses) != len(expenseIDs) {
+			return errors.New("expense not found")
+		}
+		for _, expense := range expenses {
+			switch {
+			case expense.UserID != userID:
+				return fmt.Errorf("expense #%d is not yours", expense.ID)
+			case expense.Status != models.ExpenseStatusDraft:
+				return fmt.Errorf("expense #%d is not a draft", expense.ID)
+			case expense.ExpenseReportID != nil && *expense.ExpenseReportID != report.ID:
+				return fmt.Errorf("expense #%d is already on expense report #%d", expense.ID, *expense.ExpenseReportID)
+			}
+		}
+
+		// Drafts do not touch the ledger, so they can be grouped in any period
+		err = tx.Model(&models.Expense{}).Where("id IN ?", expenseIDs).
+			UpdateColumn("expense_report_id", report.ID).Error
+		if err != nil {
+			return err
+		}
+		return refreshReportTotals(tx, report.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetReport(id)
+}
+
+// RemoveExpense takes a draft expense off one of the user's draft reports.
+func (s *ExpenseReportService) RemoveExpense(id uint, userID string, expenseID uint) (*models.ExpenseReport, error) {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		report, err := loadDraftReport(tx, id, userID)
+		if err != nil {
+			return err
+		}
+		result := tx.Model(&models.Expense{}).Where("id = ? AND expense_report_id = ?", expenseID, report.ID).
+			UpdateColumn("expense_report_id", nil)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return refreshReportTotals(tx, report.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetReport(id)
+}
+
+// SubmitReport submits every line of one of the user's draft reports as a
+// unit: each line goes through the same checks as a single expense, and any
+// failure leaves the whole report in draft. Submitted lines wait for the
+// report's review, and approvers are notified.
+func (s *ExpenseReportService) SubmitReport(id uint, userID string) (*models.ExpenseReport, error) {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		report, err := loadDraftReport(tx, id, userID)
+		if err != nil {
+			return err
+		}
+
+		var lines []models.Expense
+		err = tx.Preload("Splits").Preload("PolicyViolations").Where("expense_report_id = ?", report.ID).
+			Order("expense_date, id").Find(&lines).Error
+		if err != nil {
+			return err
+		}
+		if len(lines) == 0 {
+			return errors.New("expense report has no expenses")
+		}
+
+		for i := range lines {
+			line := &lines[i]
+			line.Justifications = savedJustifications(line)
+			date, err := normalizeBusinessDate(tx, line.ExpenseDate)
+			if err != nil {
+				return fmt.Errorf("expense #%d: %w", line.ID, err)
+			}
+			line.ExpenseDate = date
+			if err := submitExpense(tx, line); err != nil {
+				return fmt.Errorf("expense #%d: %w", line.ID, err)
+			}
+		}
+
+		now := time.Now().UTC()
+		err = tx.Model(report).Updates(map[string]interface{}{
+			"status":       models.ExpenseReportStatusSubmitted,
+			"submitted_at": now,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := refreshReportTotals(tx, report.ID); err != nil {
+			return err
+		}
+		if err := recordAudit(tx, "expense_report.submit", "expense_report", report.ID, userID, report.Title); err != nil {
+			return err
+		}
+		return notify(tx, &models.Notification{
+			Role:       models.RoleAdmin,
+			Type:       "expense_report_submitted",
+			Message:    fmt.Sprintf("Expense report %q with %d expenses was submitted for review", report.Title, len(lines)),
+			EntityType: "expense_report",
+			EntityID:   report.ID,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetReport(id)
+}
+
+// ApproveReport approves a submitted report except for the rejected lines,
+// and tells the claimant. Lines no longer awaiting approval keep their status.
+func (s *ExpenseReportService) ApproveReport(id uint, userID, note string, rejections []LineRejection) (*models.ExpenseReport, error) {
+	return s.reviewReport(id, userID, note, rejections, false)
+}
+
+// RejectReport rejects every line of a submitted report awaiting approval.
+func (s *ExpenseReportService) RejectReport(id uint, userID, note string) (*models.ExpenseReport, error) {
+	return s.reviewReport(id, userID, note, nil, true)
+}
+
+func (s *ExpenseReportService) reviewReport(id uint, userID, note string, rejections []LineRejection, rejectAll bool) (*models.ExpenseReport, error) {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var report models.ExpenseReport
+		if err := tx.Preload("Expenses").First(&report, id).Error; err != nil {
+			return err
+		}
+		if report.Status != models.ExpenseReportStatusSubmitted {
+			return errors.New("expense report is not submitted")
+		}
+
+		reasons := make(map[uint]string, len(rejections))
+		for _, r := range rejections {
+			reasons[r.ExpenseID] = r.Reason
+		}
+		pending := make(map[uint]bool)
+		for _, line := range report.Expenses {
+			if line.Status == models.ExpenseStatusPendingApproval {
+				pending[line.ID] = true
+			}
+		}
+		for expenseID := range reasons {
+			if !pending[expenseID] {
+				return fmt.Errorf("expense #%d is not a line awaiting approval on this report", expenseID)
+			}
+		}
+
+		for i := range report.Expenses {
+			line := &report.Expenses[i]
+			if !pending[line.ID] {
+				continue
+			}
+			status, lineNote := models.ExpenseStatusApproved, note
+			if reason, rejected := reasons[line.ID]; rejected || rejectAll {
+				status = models.ExpenseStatusRejected
+				if reason != "" {
+					lineNote = reason
+				}
+			}
+			if err := decideExpense(tx, line, userID, lineNote, status); err != nil {
+				return err
+			}
+		}
+
+		if err := refreshReportTotals(tx, report.ID); err != nil {
+			return err
+		}
+		if err := tx.First(&report, report.ID).Error; err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		report.Status = reviewedReportStatus(report)
+		report.ReviewedBy = userID
+		report.ReviewedAt = &now
+		report.ReviewNote = note
+		if err := tx.Omit(clause.Associations).Save(&report).Error; err != nil {
+			return err
+		}
+
+		if err := recordAudit(tx, "expense_report.review", "expense_report", report.ID, userID, string(report.Status)); err != nil {
+			return err
+		}
+		return notify(tx, &models.Notification{
+			UserID:     report.UserID,
+			Type:       "expense_report_reviewed",
+			Message:    fmt.Sprintf("Expense report %q was %s: %.2f approved, %.2f rejected", report.Title, strings.ReplaceAll(string(report.Status), "_", " "), report.ApprovedTotal, report.RejectedTotal),
+			EntityType: "expense_report",
+			EntityID:   report.ID,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetReport(id)
+}
+
+// reviewedReportStatus derives a reviewed report's status from its totals.
+func reviewedReportStatus(report models.ExpenseReport) models.ExpenseReportStatus {
+	switch {
+	case report.RejectedTotal == 0:
+		return models.ExpenseReportStatusApproved
+	case report.ApprovedTotal == 0:
+		return models.ExpenseReportStatusRejected
+	default:
+		return models.ExpenseReportStatusPartiallyApproved
+	}
+}
+
+// ExportReport renders a report as CSV: one row per line followed by the
+// report totals in the base currency.
+func (s *ExpenseReportService) ExportReport(id uint) (*ExportFile, error) {
+	report, err := s.GetReport(id)
+	if err != nil {
+		return nil, err
+	}
+
+	base := models.BaseCurrency()
+	var buf bytes.Buffer
+	t, err := newCSVTable(&buf, exportTable{Columns: []exportColumn{
+		{Name: "expense_id", Kind: columnNumber},
+		{Name: "expense_date", Kind: columnDate},
+		{Name: "title"},
+		{Name: "category"},
+		{Name: "amount", Kind: columnAmount},
+		{Name: "currency"},
+		{Name: "base_amount", Kind: columnAmount},
+		{Name: "status"},
+		{Name: "review_note"},
+	}})
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range report.Expenses {
+		err := t.WriteRow(int(line.ID), line.ExpenseDate.UTC(), line.Title, line.Category, line.Amount,
+			line.Currency, line.BaseAmount, string(line.Status), line.ReviewNote)
+		if err != nil {
+			return nil, err
+		}
+	}
+	totals := []struct {
+		label  string
+		amount float64
+	}{{"Total", report.Total}, {"Approved", report.ApprovedTotal}, {"Rejected", report.RejectedTotal}}
+	for _, total := range totals {
+		if err := t.WriteTotal(nil, nil, total.label, nil, nil, base, total.amount, nil, nil); err != nil {
+			return nil, err
+		}
+	}
+	if err := t.Close(); err != nil {
+		return nil, err
+	}
+	return &ExportFile{
+		Filename:    fmt.Sprintf("expense-report-%d.csv", report.ID),
+		ContentType: "text/csv",
+		Content:     buf.Bytes(),
+	}, nil
+}
+
+func loadDraftReport(tx *gorm.DB, id uint, userID string) (*models.ExpenseReport, error) {
+	var report models.ExpenseReport
+	if err := tx.Where("user_id = ?", userID).First(&report, id).Error; err != nil {
+		return nil, err
+	}
+	if report.Status != models.ExpenseReportStatusDraft {
+		return nil, errors.New("expense report is not a draft")
+	}
+	return &report, nil
+}
+
+// refreshReportTotals recomputes a report's line count and base-currency
+// totals from its lines.
+func refreshReportTotals(tx *gorm.DB, id uint) error {
+	var totals struct {
+		LineCount     int
+		Total         float64
+		ApprovedTotal float64
+		RejectedTotal float64
+	}
+	err := tx.Model(&models.Expense{}).
+		Select("count(*) AS line_count, coalesce(sum(base_amount), 0) AS total, "+
+			"coalesce(sum(CASE WHEN status = ? THEN base_amount ELSE 0 END), 0) AS approved_total, "+
+			"coalesce(sum(CASE WHEN status = ? THEN base_amount ELSE 0 END), 0) AS rejected_total",
+			models.ExpenseStatusApproved, models.ExpenseStatusRejected).
+		Where("expense_report_id = ?", id).
+		Scan(&totals).Error
+	if err != nil {
+		return err
+	}
+	return tx.Model(&models.ExpenseReport{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"line_count":     totals.LineCount,
+		"total":          roundAmount(totals.Total),
+		"approved_total": roundAmount(totals.ApprovedTotal),
+		"rejected_total": roundAmount(totals.RejectedTotal),
+	}).Error
+}
+
+// refreshExpenseReport refreshes the totals of the report an expense is on,
+// if any.
+func refreshExpenseReport(tx *gorm.DB, expense *models.Expense) error {
+	if expense.ExpenseReportID == nil {
+		return nil
+	}
+	return refreshReportTotals(tx, *expense.ExpenseReportID)
+}
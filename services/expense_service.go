@@ -1,25 +1,499 @@
 package services
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"io"
 	"ledgerly/db"
 	"ledgerly/models"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ExpenseService struct{}
 
+// ExpenseFilter narrows an expense listing. Zero values match everything.
+type ExpenseFilter struct {
+	Dates          DateRange
+	Status         models.ExpenseStatus
+	WithViolations bool
+}
+
+// CreateExpense records an expense. Expenses with status draft are saved
+// for later submission; all others are submitted straight away.
 func (s *ExpenseService) CreateExpense(expense *models.Expense) error {
-	if expense.Amount <= 0 {
+	if err := prepareExpense(db.DB, expense); err != nil {
+		return err
+	}
+	// Creating never touches a stored expense, and the entry timestamp is
+	// always the server's
+	expense.ID = 0
+	expense.CreatedAt = time.Time{}
+	// Receipt hashes only come from uploaded files
+	expense.ReceiptHash = ""
+	// Expenses are linked to cash advances by liquidating the advance and to
+	// expense reports by adding them to the report
+	expense.CashAdvanceID = nil
+	expense.ExpenseReportID = nil
+	expense.ReviewedBy = ""
+	expense.ReviewedAt = nil
+	expense.ReviewNote = ""
+	// Refunds are only recorded against the stored expense
+	expense.RefundedAmount = 0
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if expense.Status == models.ExpenseStatusDraft {
+			return saveDraft(tx, expense)
+		}
+		return submitExpense(tx, expense)
+	})
+}
+
+// UpdateDraft replaces the details of one of the user's draft expenses.
+func (s *ExpenseService) UpdateDraft(id uint, userID string, changes *models.Expense) (*models.Expense, error) {
+	var expense models.Expense
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := loadDraft(tx, id, userID, &expense); err != nil {
+			return err
+		}
+
+		// A new receipt reference replaces the uploaded file
+		if changes.Receipt != expense.Receipt {
+			expense.ReceiptHash = ""
+		}
+		expense.Title = changes.Title
+		expense.Type = changes.Type
+		expense.Calculation = changes.Calculation
+		expense.Amount = changes.Amount
+		expense.Currency = changes.Currency
+		expense.TaxCodeID = changes.TaxCodeID
+		expense.TaxCode = changes.TaxCode
+		expense.VendorID = changes.VendorID
+		expense.Vendor = changes.Vendor
+		expense.VendorTaxID = changes.VendorTaxID
+		expense.Category = changes.Category
+		expense.CategoryID = changes.CategoryID
+		expense.Tags = changes.Tags
+		expense.Splits = changes.Splits
+		expense.Receipt = changes.Receipt
+		expense.Notes = changes.Notes
+		expense.Attendees = changes.Attendees
+		expense.ExpenseDate = changes.ExpenseDate
+		expense.PettyCashTransactionID = changes.PettyCashTransactionID
+		expense.Justifications = changes.Justifications
+		if err := prepareExpense(tx, &expense); err != nil {
+			return err
+		}
+		if err := saveDraft(tx, &expense); err != nil {
+			return err
+		}
+		return refreshExpenseReport(tx, &expense)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &expense, nil
+}
+
+// SubmitExpense submits one of the user's drafts. Justifications, keyed by
+// policy rule ID, add to those saved with the draft.
+func (s *ExpenseService) SubmitExpense(id uint, userID string, justifications map[string]string) (*models.Expense, error) {
+	var expense models.Expense
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := loadDraft(tx, id, userID, &expense); err != nil {
+			return err
+		}
+		if expense.ExpenseReportID != nil {
+			return errors.New("expense is submitted with its expense report")
+		}
+
+		expense.Justifications = savedJustifications(&expense)
+		for ruleID, justification := range justifications {
+			expense.Justifications[ruleID] = justification
+		}
+
+		date, err := normalizeBusinessDate(tx, expense.ExpenseDate)
+		if err != nil {
+			return err
+		}
+		expense.ExpenseDate = date
+		return submitExpense(tx, &expense)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &expense, nil
+}
+
+// AttachReceipt stores an uploaded receipt file for one of the user's
+// drafts. Files are named by their SHA-256 hash, which duplicate detection
+// compares.
+func (s *ExpenseService) AttachReceipt(id uint, userID, filename string, file io.Reader) (*models.Expense, error) {
+	var expense models.Expense
+	if err := loadDraft(db.DB, id, userID, &expense); err != nil {
+		return nil, err
+	}
+
+	stored, hash, err := storeReceipt(filename, file)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		expense.Receipt = stored
+		expense.ReceiptHash = hash
+		expense.Justifications = savedJustifications(&expense)
+		return saveDraft(tx, &expense)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &expense, nil
+}
+
+// ReceiptPath returns the stored file of an expense's uploaded receipt.
+func (s *ExpenseService) ReceiptPath(id uint) (string, error) {
+	var expense models.Expense
+	if err := db.DB.First(&expense, id).Error; err != nil {
+		return "", err
+	}
+	if expense.ReceiptHash == "" {
+		return "", errors.New("expense has no uploaded receipt")
+	}
+	return filepath.Join(receiptsDir(), expense.Receipt), nil
+}
+
+// receiptsDir returns RECEIPTS_DIR, defaulting to "receipts".
+func receiptsDir() string {
+	if dir := os.Getenv("RECEIPTS_DIR"); dir != "" {
+		return dir
+	}
+	return "receipts"
+}
+
+// storeReceipt writes file to the receipts directory under its hash and
+// returns the stored name and the hash.
+func storeReceipt(filename string, file io.Reader) (string, string, error) {
+	dir := receiptsDir()
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", "", err
+	}
+	tmp, err := os.CreateTemp(dir, "upload-*")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hasher), file); err != nil {
+		tmp.Close()
+		return "", "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", "", err
+	}
+
+	hash := hex.EncodeToString(hasher.Sum(nil))
+	stored := hash + strings.ToLower(filepath.Ext(filename))
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, stored)); err != nil {
+		return "", "", err
+	}
+	return stored, hash, nil
+}
+
+// savedJustifications returns the justifications recorded on an expense's
+// violations, keyed by rule ID.
+func savedJustifications(expense *models.Expense) map[string]string {
+	justifications := make(map[string]string)
+	for _, v := range expense.PolicyViolations {
+		if v.Justification != "" {
+			justifications[strconv.FormatUint(uint64(v.RuleID), 10)] = v.Justification
+		}
+	}
+	return justifications
+}
+
+// prepareExpense validates and normalizes the fields every expense needs.
+func prepareExpense(tx *gorm.DB, expense *models.Expense) error {
+	// Calculated amounts are checked once the rate is applied
+	if expense.Amount <= 0 && !expense.Type.Calculated() {
 		return errors.New("amount must be greater than zero")
 	}
-	if expense.Category == "" {
-		return errors.New("category is mandatory")
+	if expense.Attendees < 1 {
+		expense.Attendees = 1
 	}
-	return db.DB.Create(expense).Error
+	date, err := normalizeBusinessDate(tx, expense.ExpenseDate)
+	if err != nil {
+		return err
+	}
+	expense.ExpenseDate = date
+	expense.PolicyViolations = nil
+	return nil
+}
+
+// applyCurrency defaults an expense's currency to that of the petty cash
+// transaction it was paid with, or else the base currency, and converts it to
+// the base currency at the expense date.
+func applyCurrency(tx *gorm.DB, expense *models.Expense) error {
+	if expense.PettyCashTransactionID != nil {
+		var t models.PettyCashTransaction
+		if err := tx.First(&t, *expense.PettyCashTransactionID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("petty cash transaction not found")
+			}
+			return err
+		}
+		if expense.Currency == "" {
+			expense.Currency = t.Currency
+		} else if !strings.EqualFold(strings.TrimSpace(expense.Currency), t.Currency) {
+			return fmt.Errorf("currency must match the petty cash transaction's (%s)", t.Currency)
+		}
+	}
+
+	currency, err := normalizeCurrency(expense.Currency)
+	if err != nil {
+		return err
+	}
+	expense.Currency = currency
+	expense.ExchangeRate, expense.BaseAmount, err = convertToBase(tx, currency, expense.Amount, expense.ExpenseDate)
+	return err
+}
+
+func loadDraft(tx *gorm.DB, id uint, userID string, expense *models.Expense) error {
+	if err := tx.Preload("Splits").Preload("PolicyViolations").Where("user_id = ?", userID).First(expense, id).Error; err != nil {
+		return err
+	}
+	if expense.Status != models.ExpenseStatusDraft {
+		return errors.New("expense is not a draft")
+	}
+	return nil
 }
 
-func (s *ExpenseService) ListExpenses() ([]models.Expense, error) {
+// saveDraft stores an expense without enforcing category rules, limits,
+// policies or budgets. Policy violations are recorded so the claimant can fix
+// or justify them before submitting.
+func saveDraft(tx *gorm.DB, expense *models.Expense) error {
+	expense.Status = models.ExpenseStatusDraft
+	if err := applyTravelRate(tx, expense); err != nil {
+		return err
+	}
+	if err := applyVendor(tx, expense); err != nil {
+		return err
+	}
+	if err := applyTax(tx, expense); err != nil {
+		return err
+	}
+	if err := applyCurrency(tx, expense); err != nil {
+		return err
+	}
+	if err := applyTags(tx, expense); err != nil {
+		return err
+	}
+	if err := applySplits(tx, expense); err != nil {
+		return err
+	}
+	if _, err := resolveCategory(tx, expense); err != nil {
+		return err
+	}
+
+	violations, err := evaluatePolicies(tx, expense)
+	if err != nil {
+		return err
+	}
+	justifyViolations(violations, expense.Justifications)
+
+	if err := saveExpense(tx, expense); err != nil {
+		return err
+	}
+	if err := storeViolations(tx, expense.ID, violations); err != nil {
+		return err
+	}
+	expense.PolicyViolations = violations
+	return nil
+}
+
+// submitExpense enforces the category's rules and required dimensions, the
+// claimant's spending limits, expense policies, budgets and duplicate
+// detection, then stores the expense. It is approved unless a justified
+// policy violation, a budget or its expense report holds it for approval;
+// approved out-of-pocket expenses accrue a reimbursement.
+func submitExpense(tx *gorm.DB, expense *models.Expense) error {
+	if err := applyTravelRate(tx, expense); err != nil {
+		return err
+	}
+	if err := applyVendor(tx, expense); err != nil {
+		return err
+	}
+	if err := applyTax(tx, expense); err != nil {
+		return err
+	}
+	if err := applyCurrency(tx, expense); err != nil {
+		return err
+	}
+	if err := applyTags(tx, expense); err != nil {
+		return err
+	}
+	if err := applySplits(tx, expense); err != nil {
+		return err
+	}
+	if err := applyCategory(tx, expense); err != nil {
+		return err
+	}
+	paidByDebit, err := paidByOwnDebit(tx, expense)
+	if err != nil {
+		return err
+	}
+	if err := checkSpendingLimits(tx, expense.UserID, expense.BaseAmount, expense.ExpenseDate, !paidByDebit); err != nil {
+		return err
+	}
+
+	expense.Status = models.ExpenseStatusApproved
+	violations, err := enforcePolicies(tx, expense)
+	if err != nil {
+		return err
+	}
+	usages, err := applyBudgets(tx, expense)
+	if err != nil {
+		return err
+	}
+	duplicates, err := checkDuplicates(tx, expense)
+	if err != nil {
+		return err
+	}
+	// Lines of an expense report are approved with the report
+	if expense.ExpenseReportID != nil {
+		expense.Status = models.ExpenseStatusPendingApproval
+	}
+
+	if err := saveExpense(tx, expense); err != nil {
+		return err
+	}
+	if err := storeViolations(tx, expense.ID, violations); err != nil {
+		return err
+	}
+	expense.PolicyViolations = violations
+	if err := recordDuplicateFlags(tx, expense.ID, duplicates); err != nil {
+		return err
+	}
+	if err := accrueReimbursement(tx, expense); err != nil {
+		return err
+	}
+	return recordBudgetAlerts(tx, usages)
+}
+
+// saveExpense writes the expense row and its splits; violations are stored
+// separately. Expenses without an ID are created. Stored expenses are only
+// saved again after being loaded by a path that checked who may change them.
+func saveExpense(tx *gorm.DB, expense *models.Expense) error {
+	var err error
+	if expense.ID == 0 {
+		err = tx.Omit(clause.Associations).Create(expense).Error
+	} else {
+		err = tx.Omit(clause.Associations).Save(expense).Error
+	}
+	if err != nil {
+		return err
+	}
+	return saveSplits(tx, expense)
+}
+
+func (s *ExpenseService) ListExpenses(filter ExpenseFilter) ([]models.Expense, error) {
 	var expenses []models.Expense
-	err := db.DB.Preload("PettyCashTransaction").Find(&expenses).Error
+	err := filter.query(db.DB).Preload("PettyCashTransaction").Preload("Splits").Preload("PolicyViolations").Find(&expenses).Error
 	return expenses, err
 }
+
+// query selects the expenses matching the filter in date order.
+func (f ExpenseFilter) query(tx *gorm.DB) *gorm.DB {
+	query := f.Dates.apply(tx.Model(&models.Expense{}), "expense_date")
+	if f.Status != "" {
+		query = query.Where("status = ?", f.Status)
+	}
+	if f.WithViolations {
+		query = query.Where("EXISTS (SELECT 1 FROM policy_violations WHERE policy_violations.expense_id = expenses.id)")
+	}
+	return query.Order("expense_date, id")
+}
+
+func (s *ExpenseService) ApproveExpense(id uint, userID, note string) (*models.Expense, error) {
+	return s.reviewExpense(id, userID, note, models.ExpenseStatusApproved)
+}
+
+func (s *ExpenseService) RejectExpense(id uint, userID, note string) (*models.Expense, error) {
+	return s.reviewExpense(id, userID, note, models.ExpenseStatusRejected)
+}
+
+// reviewExpense decides an expense held for approval and tells the claimant.
+// The expense is returned with its policy violations for the approver.
+// Expenses on an expense report are decided with the report.
+func (s *ExpenseService) reviewExpense(id uint, userID, note string, status models.ExpenseStatus) (*models.Expense, error) {
+	var expense models.Expense
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Preload("Splits").Preload("PolicyViolations").First(&expense, id).Error; err != nil {
+			return err
+		}
+		if expense.Status != models.ExpenseStatusPendingApproval {
+			return errors.New("expense is not pending approval")
+		}
+		if expense.ExpenseReportID != nil {
+			return errors.New("expense is reviewed with its expense report")
+		}
+
+		if err := decideExpense(tx, &expense, userID, note, status); err != nil {
+			return err
+		}
+		return notify(tx, &models.Notification{
+			UserID:     expense.UserID,
+			Type:       "expense_reviewed",
+			Message:    fmt.Sprintf("Expense %q was %s", expense.Title, status),
+			EntityType: "expense",
+			EntityID:   expense.ID,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Expense reviewed", "expense_id", expense.ID, "status", expense.Status, "user_id", userID)
+	return &expense, nil
+}
+
+// decideExpense approves or rejects an expense held for approval. Review
+// fields are written directly because they do not touch the ledger and may be
+// set after the expense's period has closed.
+func decideExpense(tx *gorm.DB, expense *models.Expense, userID, note string, status models.ExpenseStatus) error {
+	now := time.Now().UTC()
+	err := tx.Model(expense).UpdateColumns(map[string]interface{}{
+		"status":      status,
+		"reviewed_by": userID,
+		"reviewed_at": now,
+		"review_note": note,
+		"updated_at":  now,
+	}).Error
+	if err != nil {
+		return err
+	}
+	expense.Status = status
+	if err := accrueReimbursement(tx, expense); err != nil {
+		return err
+	}
+	if err := refreshExpenseAdvance(tx, expense); err != nil {
+		return err
+	}
+	return recordAudit(tx, "expense."+reviewAction(status), "expense", expense.ID, userID, note)
+}
+
+func reviewAction(status models.ExpenseStatus) string {
+	if status == models.ExpenseStatusRejected {
+		return "reject"
+	}
+	return "approve"
+}
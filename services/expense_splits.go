@@ -0,0 +1,138 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"ledgerly/models"
+
+	"gorm.io/gorm"
+)
+
+// applySplits books each split of an expense to its category, tax code and
+// dimension values, which default to the expense's own. Splits must add up
+// to the expense amount; the last one absorbs the rounding of the base
+// amounts. The expense is then booked to the category of its largest split
+// and its tax is the sum of the splits' tax. Expenses without splits are left
+// alone.
+func applySplits(tx *gorm.DB, expense *models.Expense) error {
+	if len(expense.Splits) == 0 {
+		return nil
+	}
+	if len(expense.Splits) == 1 {
+		return errors.New("a split expense needs at least two splits")
+	}
+
+	var total, baseTotal, taxTotal float64
+	largest := 0
+	sameTaxCode := true
+	for i := range expense.Splits {
+		split := &expense.Splits[i]
+		split.ID = 0
+		split.ExpenseID = expense.ID
+		split.Amount = roundAmount(split.Amount)
+		if split.Amount <= 0 {
+			return fmt.Errorf("split %d: amount must be greater than zero", i+1)
+		}
+
+		line := models.Expense{Category: split.Category, CategoryID: split.CategoryID, TaxCode: split.TaxCode, TaxCodeID: split.TaxCodeID}
+		if line.CategoryID == nil && line.Category == "" {
+			line.Category, line.CategoryID = expense.Category, expense.CategoryID
+		}
+		if line.TaxCodeID == nil && line.TaxCode == "" {
+			line.TaxCode, line.TaxCodeID = expense.TaxCode, expense.TaxCodeID
+		}
+		if _, err := resolveCategory(tx, &line); err != nil {
+			return fmt.Errorf("split %d: %w", i+1, err)
+		}
+		split.Category, split.CategoryID = line.Category, line.CategoryID
+
+		code, err := resolveTaxCode(tx, &line)
+		if err != nil {
+			return fmt.Errorf("split %d: %w", i+1, err)
+		}
+		split.TaxCodeID, split.TaxCode, split.TaxRate = nil, "", 0
+		if code != nil {
+			if code.VendorTaxIDRequired && expense.VendorTaxID == "" {
+				return fmt.Errorf("vendor_tax_id is required for %s expenses", code.Code)
+			}
+			split.TaxCodeID, split.TaxCode, split.TaxRate = &code.ID, code.Code, code.Rate
+		}
+		split.TaxAmount = taxFromGross(split.Amount, split.TaxRate)
+		split.NetAmount = roundAmount(split.Amount - split.TaxAmount)
+
+		tags := make(models.Tags, len(expense.Tags)+len(split.Tags))
+		for code, value := range expense.Tags {
+			tags[code] = value
+		}
+		for code, value := range split.Tags {
+			tags[code] = value
+		}
+		if split.Tags, err = normalizeTags(tx, tags); err != nil {
+			return fmt.Errorf("split %d: %w", i+1, err)
+		}
+
+		split.BaseAmount = roundAmount(split.Amount * expense.ExchangeRate)
+		total += split.Amount
+		baseTotal += split.BaseAmount
+		taxTotal += split.TaxAmount
+		if split.Amount > expense.Splits[largest].Amount {
+			largest = i
+		}
+		if split.TaxCode != expense.Splits[0].TaxCode {
+			sameTaxCode = false
+		}
+	}
+
+	if roundAmount(total) != expense.Amount {
+		return fmt.Errorf("splits add up to %.2f, not the expense amount of %.2f", roundAmount(total), expense.Amount)
+	}
+	last := &expense.Splits[len(expense.Splits)-1]
+	last.BaseAmount = roundAmount(last.BaseAmount + expense.BaseAmount - baseTotal)
+
+	expense.Category = expense.Splits[largest].Category
+	expense.CategoryID = expense.Splits[largest].CategoryID
+	first := expense.Splits[0]
+	expense.TaxCodeID, expense.TaxCode, expense.TaxRate = first.TaxCodeID, first.TaxCode, first.TaxRate
+	if !sameTaxCode {
+		expense.TaxCodeID, expense.TaxCode, expense.TaxRate = nil, "", 0
+	}
+	expense.TaxAmount = roundAmount(taxTotal)
+	expense.NetAmount = roundAmount(expense.Amount - expense.TaxAmount)
+	return nil
+}
+
+// saveSplits replaces the stored splits of an expense.
+func saveSplits(tx *gorm.DB, expense *models.Expense) error {
+	if err := tx.Where("expense_id = ?", expense.ID).Delete(&models.ExpenseSplit{}).Error; err != nil {
+		return err
+	}
+	if len(expense.Splits) == 0 {
+		return nil
+	}
+	for i := range expense.Splits {
+		expense.Splits[i].ID = 0
+		expense.Splits[i].ExpenseID = expense.ID
+	}
+	return tx.Create(&expense.Splits).Error
+}
+
+// chargedLine is the part of an expense charged to one category and set of
+// dimension values: a split, or the whole expense if it is not split.
+type chargedLine struct {
+	Category   string
+	CategoryID *uint
+	BaseAmount float64
+	Tags       models.Tags
+}
+
+// chargedLines returns the lines an expense is charged to.
+func chargedLines(expense *models.Expense) []chargedLine {
+	if len(expense.Splits) == 0 {
+		return []chargedLine{{Category: expense.Category, CategoryID: expense.CategoryID, BaseAmount: expense.BaseAmount, Tags: expense.Tags}}
+	}
+	lines := make([]chargedLine, 0, len(expense.Splits))
+	for _, split := range expense.Splits {
+		lines = append(lines, chargedLine{Category: split.Category, CategoryID: split.CategoryID, BaseAmount: split.BaseAmount, Tags: split.Tags})
+	}
+	return lines
+}
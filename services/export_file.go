@@ -0,0 +1,47 @@
+package services
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+// ExportFile is a rendered download, such as a payout file for the bank or
+// an expense report.
+type ExportFile struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+}
+
+// ExportStream is a download rendered while it is sent, so large exports are
+// never held in memory. Everything that can fail up front has been checked
+// by the time it is returned; WriteTo only fails if the data cannot be read
+// or written.
+type ExportStream struct {
+	Filename    string
+	ContentType string
+	WriteTo     func(w io.Writer) error
+}
+
+// Formats of list and report exports.
+const (
+	ExportFormatCSV  = "csv"
+	ExportFormatXLSX = "xlsx"
+	ExportFormatPDF  = "pdf"
+)
+
+// ExportContentTypes maps each export format to its MIME type.
+var ExportContentTypes = map[string]string{
+	ExportFormatCSV:  "text/csv",
+	ExportFormatXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	ExportFormatPDF:  "application/pdf",
+}
+
+// orgName is the organisation named at the top of PDF exports, from ORG_NAME.
+func orgName() string {
+	if name := strings.TrimSpace(os.Getenv("ORG_NAME")); name != "" {
+		return name
+	}
+	return "Ledgerly"
+}
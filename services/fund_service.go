@@ -0,0 +1,117 @@
+package services
+
+import (
+	"errors"
+	"ledgerly/db"
+	"ledgerly/models"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type FundService struct{}
+
+// FundBalance is a fund with its current balance.
+type FundBalance struct {
+	models.Fund
+	Balance float64 `json:"balance"`
+}
+
+func (s *FundService) CreateFund(fund *models.Fund) error {
+	fund.Name = strings.TrimSpace(fund.Name)
+	if fund.Name == "" {
+		return errors.New("name is mandatory")
+	}
+	currency, err := normalizeCurrency(fund.Currency)
+	if err != nil {
+		return err
+	}
+	fund.Currency = currency
+	fund.Active = true
+	return db.DB.Create(fund).Error
+}
+
+func (s *FundService) GetFund(id uint) (*models.Fund, error) {
+	var fund models.Fund
+	if err := db.DB.First(&fund, id).Error; err != nil {
+		return nil, err
+	}
+	return &fund, nil
+}
+
+func (s *FundService) UpdateFund(id uint, changes *models.Fund) (*models.Fund, error) {
+	var fund models.Fund
+	if err := db.DB.First(&fund, id).Error; err != nil {
+		return nil, err
+	}
+	if name := strings.TrimSpace(changes.Name); name != "" {
+		fund.Name = name
+	}
+	if changes.Currency != "" {
+		currency, err := normalizeCurrency(changes.Currency)
+		if err != nil {
+			return nil, err
+		}
+		if currency != fund.Currency {
+			// The fund's balance and history are in its currency
+			var count int64
+			if err := db.DB.Model(&models.PettyCashTransaction{}).Where("fund_id = ?", fund.ID).Count(&count).Error; err != nil {
+				return nil, err
+			}
+			if count > 0 {
+				return nil, errors.New("the currency of a fund with transactions cannot be changed")
+			}
+			fund.Currency = currency
+		}
+	}
+	fund.CustodianID = changes.CustodianID
+	fund.Active = changes.Active
+	if err := db.DB.Save(&fund).Error; err != nil {
+		return nil, err
+	}
+	return &fund, nil
+}
+
+func (s *FundService) ListFunds() ([]FundBalance, error) {
+	var funds []models.Fund
+	if err := db.DB.Order("id").Find(&funds).Error; err != nil {
+		return nil, err
+	}
+
+	pettyCash := &PettyCashService{}
+	result := make([]FundBalance, 0, len(funds))
+	for _, fund := range funds {
+		balance, err := pettyCash.GetBalance(fund.ID)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, FundBalance{Fund: fund, Balance: balance})
+	}
+	return result, nil
+}
+
+// resolveFund returns the active fund with fundID, or the default fund (the
+// oldest active one) when fundID is 0.
+func resolveFund(tx *gorm.DB, fundID uint) (*models.Fund, error) {
+	var fund models.Fund
+	if fundID == 0 {
+		if err := tx.Where("active = ?", true).Order("id").First(&fund).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, errors.New("no active fund")
+			}
+			return nil, err
+		}
+		return &fund, nil
+	}
+
+	if err := tx.First(&fund, fundID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("fund not found")
+		}
+		return nil, err
+	}
+	if !fund.Active {
+		return nil, errors.New("fund is inactive")
+	}
+	return &fund, nil
+}
@@ -0,0 +1,470 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"ledgerly/db"
+	"ledgerly/models"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ImportService struct{}
+
+// What an import creates.
+const (
+	ImportKindExpenses     = "expenses"
+	ImportKindTransactions = "transactions"
+)
+
+// Import modes. All or nothing imports no row unless every row is valid;
+// skip invalid imports the valid rows and reports the rest.
+const (
+	ImportModeAllOrNothing = "all_or_nothing"
+	ImportModeSkipInvalid  = "skip_invalid"
+)
+
+// Import row outcomes. Valid rows would have been imported but were not,
+// because of a dry run or an invalid row in all or nothing mode.
+const (
+	ImportRowImported  = "imported"
+	ImportRowValid     = "valid"
+	ImportRowInvalid   = "invalid"
+	ImportRowDuplicate = "duplicate"
+)
+
+// importTagPrefix maps a column to a dimension, as in tag:department.
+const importTagPrefix = "tag:"
+
+// importFields are the fields each kind of import reads. Each is read from
+// the column named after it unless the mapping names another.
+var importFields = map[string][]string{
+	ImportKindExpenses:     {"title", "amount", "currency", "category", "expense_date", "vendor", "vendor_tax_id", "tax_code", "notes", "attendees", "status", "user"},
+	ImportKindTransactions: {"type", "amount", "currency", "description", "reference", "fund", "transaction_date", "user"},
+}
+
+// ImportOptions control an import. Mapping maps fields to the spreadsheet
+// column headers they are read from. Rows are recorded for UserID unless the
+// file has a user column of usernames.
+type ImportOptions struct {
+	Kind     string
+	Filename string
+	Mapping  map[string]string
+	Mode     string
+	DryRun   bool
+	UserID   string
+}
+
+// ImportResult reports an import row by row.
+type ImportResult struct {
+	Kind       string      `json:"kind"`
+	Mode       string      `json:"mode"`
+	DryRun     bool        `json:"dry_run"`
+	Committed  bool        `json:"committed"`
+	Rows       int         `json:"rows"`
+	Imported   int         `json:"imported"`
+	Valid      int         `json:"valid"`
+	Invalid    int         `json:"invalid"`
+	Duplicates int         `json:"duplicates"`
+	Lines      []ImportRow `json:"lines"`
+}
+
+// ImportRow is the outcome of one spreadsheet row. Row is its row number in
+// the file, counting the header as row 1.
+type ImportRow struct {
+	Row         int    `json:"row"`
+	Status      string `json:"status"`
+	ID          uint   `json:"id,omitempty"`
+	DuplicateOf uint   `json:"duplicate_of,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// errImportInvalid rolls back an all or nothing import with invalid rows.
+var errImportInvalid = errors.New("import has invalid rows")
+
+// Import reads a CSV or XLSX file with a header row and records each row as
+// an expense or petty cash transaction, with the same validation as entering
+// it through the API. Rows matching an existing record on date, amount and
+// description are skipped as duplicates, as are repeats within the file.
+func (s *ImportService) Import(r io.Reader, opts ImportOptions) (*ImportResult, error) {
+	if _, ok := importFields[opts.Kind]; !ok {
+		return nil, errors.New("kind must be expenses or transactions")
+	}
+	switch opts.Mode {
+	case "":
+		opts.Mode = ImportModeAllOrNothing
+	case ImportModeAllOrNothing, ImportModeSkipInvalid:
+	default:
+		return nil, errors.New("mode must be all_or_nothing or skip_invalid")
+	}
+
+	rows, err := readSpreadsheet(r, opts.Filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("import file is empty")
+	}
+	columns, err := importColumns(importFields[opts.Kind], rows[0], opts.Mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{Kind: opts.Kind, Mode: opts.Mode, DryRun: opts.DryRun}
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		users := make(map[string]string)
+		for n, cells := range rows[1:] {
+			if blankRow(cells) {
+				continue
+			}
+			field := func(name string) string {
+				if col, ok := columns[name]; ok && col < len(cells) {
+					return strings.TrimSpace(cells[col])
+				}
+				return ""
+			}
+
+			line := ImportRow{Row: n + 2, Status: ImportRowValid}
+			// Each row is a savepoint, so an invalid row leaves nothing behind
+			err := tx.Transaction(func(row *gorm.DB) error {
+				userID, err := importUser(row, field("user"), opts.UserID, users)
+				if err != nil {
+					return err
+				}
+				if opts.Kind == ImportKindExpenses {
+					line.ID, line.DuplicateOf, err = importExpense(row, field, columns, userID)
+				} else {
+					line.ID, line.DuplicateOf, err = importTransaction(row, field, columns, userID)
+				}
+				return err
+			})
+			var duplicate *DuplicateError
+			switch {
+			case line.DuplicateOf != 0:
+				line.Status, line.ID = ImportRowDuplicate, 0
+				result.Duplicates++
+			case errors.As(err, &duplicate):
+				line.Status, line.Error = ImportRowDuplicate, err.Error()
+				line.DuplicateOf = duplicate.Matches[0].MatchID
+				result.Duplicates++
+			case err != nil:
+				line.Status, line.Error = ImportRowInvalid, err.Error()
+				result.Invalid++
+			default:
+				result.Valid++
+			}
+			result.Rows++
+			result.Lines = append(result.Lines, line)
+		}
+
+		if opts.DryRun {
+			return errDryRun
+		}
+		if result.Invalid > 0 && opts.Mode == ImportModeAllOrNothing {
+			return errImportInvalid
+		}
+		detail := fmt.Sprintf("%d %s from %s (%d duplicates, %d invalid skipped)", result.Valid, opts.Kind, opts.Filename, result.Duplicates, result.Invalid)
+		return recordAudit(tx, "import."+opts.Kind, "import", 0, opts.UserID, detail)
+	})
+	if err != nil && !errors.Is(err, errDryRun) && !errors.Is(err, errImportInvalid) {
+		return nil, err
+	}
+
+	result.Committed = err == nil
+	for i := range result.Lines {
+		line := &result.Lines[i]
+		if line.Status != ImportRowValid {
+			continue
+		}
+		if result.Committed {
+			line.Status = ImportRowImported
+			result.Imported++
+		} else {
+			line.ID = 0
+		}
+	}
+	if result.Committed {
+		result.Valid = 0
+	}
+	return result, nil
+}
+
+// importExpense records one row as an expense, submitted unless its status
+// is draft. It returns the new expense, or the expense it duplicates.
+func importExpense(tx *gorm.DB, field func(string) string, columns map[string]int, userID string) (uint, uint, error) {
+	amount, err := importAmount(field("amount"))
+	if err != nil {
+		return 0, 0, err
+	}
+	date, err := importDate(field("expense_date"), "expense_date")
+	if err != nil {
+		return 0, 0, err
+	}
+	attendees := 0
+	if value := field("attendees"); value != "" {
+		if attendees, err = strconv.Atoi(value); err != nil {
+			return 0, 0, errors.New("attendees must be a whole number")
+		}
+	}
+
+	expense := &models.Expense{
+		Title:       field("title"),
+		Amount:      amount,
+		Currency:    field("currency"),
+		Category:    field("category"),
+		Vendor:      field("vendor"),
+		VendorTaxID: field("vendor_tax_id"),
+		TaxCode:     field("tax_code"),
+		Notes:       field("notes"),
+		Attendees:   attendees,
+		Tags:        importTags(field, columns),
+		UserID:      userID,
+		ExpenseDate: date,
+	}
+	if expense.Title == "" {
+		return 0, 0, errors.New("title is mandatory")
+	}
+	switch status := strings.ToLower(field("status")); status {
+	case "", "submitted":
+	case string(models.ExpenseStatusDraft):
+		expense.Status = models.ExpenseStatusDraft
+	default:
+		return 0, 0, errors.New("status must be draft or submitted")
+	}
+	if err := prepareExpense(tx, expense); err != nil {
+		return 0, 0, err
+	}
+
+	currency, err := normalizeCurrency(expense.Currency)
+	if err != nil {
+		return 0, 0, err
+	}
+	var existing models.Expense
+	err = tx.Where("user_id = ? AND expense_date >= ? AND expense_date < ? AND amount = ? AND currency = ? AND lower(title) = ?",
+		userID, startOfDay(date), startOfDay(date).AddDate(0, 0, 1), expense.Amount, currency, strings.ToLower(expense.Title)).
+		Order("id").First(&existing).Error
+	if err == nil {
+		return 0, existing.ID, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, 0, err
+	}
+
+	if expense.Status == models.ExpenseStatusDraft {
+		err = saveDraft(tx, expense)
+	} else {
+		err = submitExpense(tx, expense)
+	}
+	return expense.ID, 0, err
+}
+
+// importTransaction posts one row as a petty cash transaction. It returns
+// the new transaction, or the transaction it duplicates.
+func importTransaction(tx *gorm.DB, field func(string) string, columns map[string]int, userID string) (uint, uint, error) {
+	amount, err := importAmount(field("amount"))
+	if err != nil {
+		return 0, 0, err
+	}
+	date, err := importDate(field("transaction_date"), "transaction_date")
+	if err != nil {
+		return 0, 0, err
+	}
+	fundID, err := importFund(tx, field("fund"))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	t := &models.PettyCashTransaction{
+		FundID:          fundID,
+		Type:            models.TransactionType(strings.ToLower(field("type"))),
+		Amount:          amount,
+		Currency:        field("currency"),
+		Description:     field("description"),
+		Reference:       field("reference"),
+		Tags:            importTags(field, columns),
+		UserID:          userID,
+		TransactionDate: date,
+	}
+	if t.Type != models.TransactionTypeCredit && t.Type != models.TransactionTypeDebit {
+		return 0, 0, errors.New("type must be credit or debit")
+	}
+	if err := prepareTransaction(tx, t); err != nil {
+		return 0, 0, err
+	}
+
+	var existing models.PettyCashTransaction
+	err = tx.Where("fund_id = ? AND type = ? AND transaction_date >= ? AND transaction_date < ? AND amount = ? AND lower(description) = ?",
+		t.FundID, t.Type, startOfDay(t.TransactionDate), startOfDay(t.TransactionDate).AddDate(0, 0, 1), t.Amount, strings.ToLower(t.Description)).
+		Order("id").First(&existing).Error
+	if err == nil {
+		return 0, existing.ID, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, 0, err
+	}
+
+	if err := postUserTransaction(tx, t); err != nil {
+		return 0, 0, err
+	}
+	return t.ID, 0, nil
+}
+
+// readSpreadsheet reads the rows of a CSV or XLSX file, told apart by the
+// file name or else by content.
+func readSpreadsheet(r io.Reader, filename string) ([][]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext == ".xlsx" || ext != ".csv" && bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return readXLSX(data)
+	}
+
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV: %w", err)
+	}
+	return rows, nil
+}
+
+// importColumns returns the column each mapped field is read from. Fields
+// default to the column with their own name, ignoring case. Columns named
+// tag:<dimension> tag rows with dimension values.
+func importColumns(fields []string, header []string, mapping map[string]string) (map[string]int, error) {
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := index[name]; !ok && name != "" {
+			index[name] = i
+		}
+	}
+
+	known := make(map[string]bool)
+	for _, field := range fields {
+		known[field] = true
+	}
+	columns := make(map[string]int)
+	for field, column := range mapping {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if !known[field] && !strings.HasPrefix(field, importTagPrefix) {
+			return nil, fmt.Errorf("unknown field %q in mapping", field)
+		}
+		i, ok := index[strings.ToLower(strings.TrimSpace(column))]
+		if !ok {
+			return nil, fmt.Errorf("column %q mapped to %s is not in the file", column, field)
+		}
+		columns[field] = i
+	}
+	for name, i := range index {
+		if _, mapped := columns[name]; !mapped && (known[name] || strings.HasPrefix(name, importTagPrefix)) {
+			columns[name] = i
+		}
+	}
+
+	if _, ok := columns["amount"]; !ok {
+		return nil, errors.New("import file needs an amount column")
+	}
+	return columns, nil
+}
+
+func importTags(field func(string) string, columns map[string]int) models.Tags {
+	var tags models.Tags
+	for name := range columns {
+		code, ok := strings.CutPrefix(name, importTagPrefix)
+		if !ok {
+			continue
+		}
+		if value := field(name); value != "" {
+			if tags == nil {
+				tags = make(models.Tags)
+			}
+			tags[code] = value
+		}
+	}
+	return tags
+}
+
+// importAmount parses an amount, allowing thousands separators.
+func importAmount(value string) (float64, error) {
+	amount, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", ""), 64)
+	if err != nil {
+		return 0, errors.New("amount must be a number")
+	}
+	return amount, nil
+}
+
+// importDate parses a date given as YYYY-MM-DD, RFC 3339 or an Excel serial
+// number. An empty date is today.
+func importDate(value, name string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date, nil
+	}
+	if date, err := time.Parse(time.RFC3339, value); err == nil {
+		return date, nil
+	}
+	if serial, err := strconv.ParseFloat(value, 64); err == nil && serial > 0 {
+		return xlsxDate(serial), nil
+	}
+	return time.Time{}, fmt.Errorf("%s must be YYYY-MM-DD", name)
+}
+
+// importFund resolves a fund given by ID or name. An empty fund is the
+// default fund.
+func importFund(tx *gorm.DB, value string) (uint, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if id, err := strconv.ParseUint(value, 10, 64); err == nil {
+		return uint(id), nil
+	}
+	var fund models.Fund
+	if err := tx.Where("lower(name) = ?", strings.ToLower(value)).First(&fund).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, fmt.Errorf("fund %q not found", value)
+		}
+		return 0, err
+	}
+	return fund.ID, nil
+}
+
+// importUser resolves a username to a user ID, remembering the answers in
+// users. An empty username is the importing user.
+func importUser(tx *gorm.DB, username, importer string, users map[string]string) (string, error) {
+	if username == "" {
+		return importer, nil
+	}
+	if id, ok := users[username]; ok {
+		return id, nil
+	}
+	var user models.User
+	if err := tx.Where("username = ?", username).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", fmt.Errorf("user %q not found", username)
+		}
+		return "", err
+	}
+	users[username] = strconv.FormatUint(uint64(user.ID), 10)
+	return users[username], nil
+}
+
+func blankRow(cells []string) bool {
+	for _, cell := range cells {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
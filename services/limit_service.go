@@ -0,0 +1,325 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"ledgerly/db"
+	"ledgerly/models"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type LimitService struct{}
+
+// Spending limit error codes.
+const (
+	LimitCodePerTransaction = "limit_per_transaction_exceeded"
+	LimitCodeDaily          = "limit_daily_exceeded"
+	LimitCodeMonthly        = "limit_monthly_exceeded"
+)
+
+// LimitError reports an entry that would exceed a spending limit.
+type LimitError struct {
+	Code      string
+	Limit     float64
+	Remaining float64
+}
+
+func (e *LimitError) ErrorCode() string {
+	return e.Code
+}
+
+func (e *LimitError) Error() string {
+	switch e.Code {
+	case LimitCodePerTransaction:
+		return fmt.Sprintf("amount exceeds the per-transaction limit of %.2f", e.Limit)
+	case LimitCodeDaily:
+		return fmt.Sprintf("amount exceeds the daily limit of %.2f (%.2f remaining)", e.Limit, e.Remaining)
+	default:
+		return fmt.Sprintf("amount exceeds the monthly limit of %.2f (%.2f remaining)", e.Limit, e.Remaining)
+	}
+}
+
+// LimitUsage is the spend counted against one periodic limit. Limit and
+// Remaining are nil when there is no limit.
+type LimitUsage struct {
+	Limit     *float64 `json:"limit"`
+	Used      float64  `json:"used"`
+	Remaining *float64 `json:"remaining"`
+}
+
+// SpendingAllowance is a user's effective limits and what is left of them.
+// Available is the largest single amount the user can spend right now, or
+// nil if nothing limits it.
+type SpendingAllowance struct {
+	UserID         string          `json:"user_id"`
+	Role           models.UserRole `json:"role"`
+	PerTransaction *float64        `json:"per_transaction"`
+	Daily          LimitUsage      `json:"daily"`
+	Monthly        LimitUsage      `json:"monthly"`
+	Available      *float64        `json:"available"`
+}
+
+// SetRoleLimit creates or replaces the limits of a role.
+func (s *LimitService) SetRoleLimit(role models.UserRole, limit *models.SpendingLimit, changedBy string) error {
+	if _, ok := models.RolePermissions[role]; !ok {
+		return errors.New("unknown role")
+	}
+	limit.Role = role
+	limit.UserID = ""
+	return saveLimit(limit, changedBy)
+}
+
+// SetUserLimit creates or replaces one user's overrides of their role's
+// limits.
+func (s *LimitService) SetUserLimit(userID uint, limit *models.SpendingLimit, changedBy string) error {
+	var user models.User
+	if err := db.DB.First(&user, userID).Error; err != nil {
+		return err
+	}
+	limit.Role = ""
+	limit.UserID = strconv.FormatUint(uint64(user.ID), 10)
+	return saveLimit(limit, changedBy)
+}
+
+func (s *LimitService) ListLimits() ([]models.SpendingLimit, error) {
+	var limits []models.SpendingLimit
+	err := db.DB.Order("role desc, user_id").Find(&limits).Error
+	return limits, err
+}
+
+func (s *LimitService) DeleteLimit(id uint, changedBy string) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var limit models.SpendingLimit
+		if err := tx.First(&limit, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&limit).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, "limit.delete", "spending_limit", limit.ID, changedBy, limitScope(limit))
+	})
+}
+
+// GetAllowance returns a user's effective limits and remaining allowance on
+// the day of at.
+func (s *LimitService) GetAllowance(userID string, at time.Time) (*SpendingAllowance, error) {
+	var allowance *SpendingAllowance
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		allowance, err = spendingAllowance(tx, userID, at)
+		return err
+	})
+	return allowance, err
+}
+
+func saveLimit(limit *models.SpendingLimit, changedBy string) error {
+	for _, amount := range []*float64{limit.PerTransaction, limit.Daily, limit.Monthly} {
+		if amount != nil && *amount <= 0 {
+			return errors.New("limits must be greater than zero")
+		}
+	}
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		limit.ID = 0
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "role"}, {Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"per_transaction", "daily", "monthly", "updated_at"}),
+		}).Create(limit).Error
+		if err != nil {
+			return err
+		}
+		// The upsert does not report the ID of an updated row
+		if err := tx.Where("role = ? AND user_id = ?", limit.Role, limit.UserID).First(limit).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, "limit.set", "spending_limit", limit.ID, changedBy, limitScope(*limit))
+	})
+}
+
+func limitScope(limit models.SpendingLimit) string {
+	if limit.UserID != "" {
+		return "user " + limit.UserID
+	}
+	return "role " + string(limit.Role)
+}
+
+// effectiveLimits merges a user's overrides over their role's limits.
+func effectiveLimits(tx *gorm.DB, userID string) (models.UserRole, models.SpendingLimit, error) {
+	var effective models.SpendingLimit
+	var user models.User
+	if err := tx.Where("id = ?", userID).Limit(1).Find(&user).Error; err != nil {
+		return "", effective, err
+	}
+
+	var limits []models.SpendingLimit
+	err := tx.Where("(role = ? AND user_id = '') OR (role = '' AND user_id = ?)", user.Role, userID).
+		Order("user_id").
+		Find(&limits).Error
+	if err != nil {
+		return "", effective, err
+	}
+	// The role row sorts first, so user overrides win
+	for _, limit := range limits {
+		if limit.PerTransaction != nil {
+			effective.PerTransaction = limit.PerTransaction
+		}
+		if limit.Daily != nil {
+			effective.Daily = limit.Daily
+		}
+		if limit.Monthly != nil {
+			effective.Monthly = limit.Monthly
+		}
+	}
+	return user.Role, effective, nil
+}
+
+// checkSpendingLimits rejects an entry of amount dated date that would
+// exceed the user's limits. Entries whose spend is already counted elsewhere,
+// like expenses paid by a petty cash debit, only face the per-transaction
+// limit.
+func checkSpendingLimits(tx *gorm.DB, userID string, amount float64, date time.Time, counted bool) error {
+	if userID == "" {
+		return nil
+	}
+	_, limits, err := effectiveLimits(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	if limits.PerTransaction != nil && amount > *limits.PerTransaction {
+		return &LimitError{Code: LimitCodePerTransaction, Limit: *limits.PerTransaction, Remaining: *limits.PerTransaction}
+	}
+	if !counted {
+		return nil
+	}
+
+	dayStart, dayEnd, monthStart, monthEnd := limitWindows(date)
+	checks := []struct {
+		code       string
+		limit      *float64
+		start, end time.Time
+	}{
+		{LimitCodeDaily, limits.Daily, dayStart, dayEnd},
+		{LimitCodeMonthly, limits.Monthly, monthStart, monthEnd},
+	}
+	for _, check := range checks {
+		if check.limit == nil {
+			continue
+		}
+		used, err := spendingUsed(tx, userID, check.start, check.end)
+		if err != nil {
+			return err
+		}
+		if roundAmount(used+amount) > *check.limit {
+			return &LimitError{Code: check.code, Limit: *check.limit, Remaining: roundAmount(*check.limit - used)}
+		}
+	}
+	return nil
+}
+
+func spendingAllowance(tx *gorm.DB, userID string, at time.Time) (*SpendingAllowance, error) {
+	role, limits, err := effectiveLimits(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	allowance := &SpendingAllowance{UserID: userID, Role: role, PerTransaction: limits.PerTransaction, Available: limits.PerTransaction}
+
+	dayStart, dayEnd, monthStart, monthEnd := limitWindows(at)
+	usages := []struct {
+		usage      *LimitUsage
+		limit      *float64
+		start, end time.Time
+	}{
+		{&allowance.Daily, limits.Daily, dayStart, dayEnd},
+		{&allowance.Monthly, limits.Monthly, monthStart, monthEnd},
+	}
+	for _, u := range usages {
+		used, err := spendingUsed(tx, userID, u.start, u.end)
+		if err != nil {
+			return nil, err
+		}
+		u.usage.Used = used
+		if u.limit == nil {
+			continue
+		}
+		remaining := roundAmount(*u.limit - used)
+		if remaining < 0 {
+			remaining = 0
+		}
+		u.usage.Limit = u.limit
+		u.usage.Remaining = &remaining
+		if allowance.Available == nil || remaining < *allowance.Available {
+			allowance.Available = &remaining
+		}
+	}
+	return allowance, nil
+}
+
+// limitWindows returns the UTC calendar day and month containing date.
+func limitWindows(date time.Time) (dayStart, dayEnd, monthStart, monthEnd time.Time) {
+	if date.IsZero() {
+		date = time.Now()
+	}
+	date = date.UTC()
+	dayStart = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart = time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return dayStart, dayStart.AddDate(0, 0, 1), monthStart, monthStart.AddDate(0, 1, 0)
+}
+
+// spendingUsed totals what a user spent in [from, to) in the base currency:
+// their petty cash debits plus submitted out-of-pocket expenses that were not
+// rejected.
+func spendingUsed(tx *gorm.DB, userID string, from, to time.Time) (float64, error) {
+	var debits float64
+	err := tx.Model(&models.PettyCashTransaction{}).
+		Where("user_id = ? AND type = ? AND transaction_date >= ? AND transaction_date < ?", userID, models.TransactionTypeDebit, from, to).
+		Select("coalesce(sum(base_amount), 0)").Scan(&debits).Error
+	if err != nil {
+		return 0, err
+	}
+
+	// Expenses count unless a debit of their own counted them, as in
+	// paidByOwnDebit; of several expenses linked to a debit, the first does
+	var expenses float64
+	err = tx.Model(&models.Expense{}).
+		Where("user_id = ? AND status NOT IN ?", userID, models.UncountedExpenseStatuses).
+		Where("expense_date >= ? AND expense_date < ?", from, to).
+		Where(`petty_cash_transaction_id IS NULL
+			OR NOT EXISTS (SELECT 1 FROM petty_cash_transactions t WHERE t.id = expenses.petty_cash_transaction_id
+				AND t.type = ? AND t.user_id = expenses.user_id AND t.deleted_at IS NULL)
+			OR EXISTS (SELECT 1 FROM expenses e WHERE e.petty_cash_transaction_id = expenses.petty_cash_transaction_id
+				AND e.id < expenses.id AND e.status NOT IN ?)`, models.TransactionTypeDebit, models.UncountedExpenseStatuses).
+		Select("coalesce(sum(base_amount), 0)").Scan(&expenses).Error
+	if err != nil {
+		return 0, err
+	}
+	return roundAmount(debits + expenses), nil
+}
+
+// paidByOwnDebit reports whether an expense is paid by a petty cash debit of
+// its claimant that no other expense is linked to. The limits counted that
+// spend when the debit was made; any other linked expense counts itself.
+func paidByOwnDebit(tx *gorm.DB, expense *models.Expense) (bool, error) {
+	if expense.PettyCashTransactionID == nil {
+		return false, nil
+	}
+	var t models.PettyCashTransaction
+	if err := tx.First(&t, *expense.PettyCashTransactionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if t.Type != models.TransactionTypeDebit || t.UserID != expense.UserID {
+		return false, nil
+	}
+	var others int64
+	err := tx.Model(&models.Expense{}).
+		Where("petty_cash_transaction_id = ? AND id <> ? AND status NOT IN ?", t.ID, expense.ID, models.UncountedExpenseStatuses).
+		Count(&others).Error
+	return others == 0, err
+}
@@ -0,0 +1,8 @@
+package services
+
+import "math"
+
+// roundAmount rounds an amount to cents, halves away from zero.
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"ledgerly/db"
+	"ledgerly/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type NotificationService struct{}
+
+// notify stores n using tx so it is only delivered if the change it reports
+// commits.
+func notify(tx *gorm.DB, n *models.Notification) error {
+	return tx.Create(n).Error
+}
+
+// visibleTo limits a query to notifications addressed to the user directly
+// or to their role.
+func visibleTo(query *gorm.DB, userID string, role models.UserRole) *gorm.DB {
+	return query.Where("user_id = ? OR (user_id = '' AND role = ?)", userID, role)
+}
+
+// ListNotifications returns the notifications a user can see, newest first.
+// Role notifications are shared, so reading one marks it read for the role.
+func (s *NotificationService) ListNotifications(userID string, role models.UserRole, unreadOnly bool) ([]models.Notification, error) {
+	var notifications []models.Notification
+	query := visibleTo(db.DB, userID, role)
+	if unreadOnly {
+		query = query.Where("read_at IS NULL")
+	}
+	err := query.Order("created_at desc").Find(&notifications).Error
+	return notifications, err
+}
+
+func (s *NotificationService) MarkRead(id uint, userID string, role models.UserRole) (*models.Notification, error) {
+	var notification models.Notification
+	if err := visibleTo(db.DB, userID, role).First(&notification, id).Error; err != nil {
+		return nil, err
+	}
+	if notification.ReadAt == nil {
+		now := time.Now().UTC()
+		notification.ReadAt = &now
+		if err := db.DB.Save(&notification).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &notification, nil
+}
@@ -0,0 +1,247 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"ledgerly/db"
+	"ledgerly/models"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Payout file formats.
+const (
+	PayoutFormatSEPA = "sepa"
+	PayoutFormatCSV  = "csv"
+)
+
+// sepaCurrency is the only currency of SEPA credit transfers.
+const sepaCurrency = "EUR"
+
+// payoutLine is one credit transfer: everything a batch pays one employee.
+type payoutLine struct {
+	UserID  string
+	Amount  float64
+	Account models.BankAccount
+}
+
+// ExportBatch renders a batch as a payout file in the given format and
+// records when it was exported. Every payee needs bank details on file.
+func (s *ReimbursementService) ExportBatch(id uint, format string) (*ExportFile, error) {
+	var file *ExportFile
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var batch models.ReimbursementBatch
+		if err := tx.First(&batch, id).Error; err != nil {
+			return err
+		}
+		if batch.Status == models.BatchStatusCancelled {
+			return errors.New("batch is cancelled")
+		}
+		lines, err := payoutLines(tx, batch.ID)
+		if err != nil {
+			return err
+		}
+
+		switch format {
+		case "", PayoutFormatSEPA:
+			content, err := sepaCreditTransfer(batch, lines)
+			if err != nil {
+				return err
+			}
+			file = &ExportFile{Filename: batch.Reference + ".xml", ContentType: "application/xml", Content: content}
+		case PayoutFormatCSV:
+			content, err := bankCSV(batch, lines)
+			if err != nil {
+				return err
+			}
+			file = &ExportFile{Filename: batch.Reference + ".csv", ContentType: "text/csv", Content: content}
+		default:
+			return errors.New("format must be sepa or csv")
+		}
+
+		return tx.Model(&batch).UpdateColumn("exported_at", time.Now().UTC()).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func payoutLines(tx *gorm.DB, batchID uint) ([]payoutLine, error) {
+	payees, err := batchPayees(tx, batchID)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]payoutLine, 0, len(payees))
+	missing := make(map[string]bool)
+	for _, p := range payees {
+		line := payoutLine{UserID: p.UserID, Amount: p.Amount}
+		if err := tx.Where("user_id = ?", p.UserID).Limit(1).Find(&line.Account).Error; err != nil {
+			return nil, err
+		}
+		if line.Account.ID == 0 {
+			missing[p.UserID] = true
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("no bank account on file for users %s", strings.Join(sortedKeys(missing), ", "))
+	}
+	return lines, nil
+}
+
+// sepaDocument is a pain.001.001.03 customer credit transfer initiation.
+type sepaDocument struct {
+	XMLName  xml.Name `xml:"urn:iso:std:iso:20022:tech:xsd:pain.001.001.03 Document"`
+	Initiate struct {
+		GroupHeader struct {
+			MessageID       string    `xml:"MsgId"`
+			CreatedAt       string    `xml:"CreDtTm"`
+			NumberOfTxs     int       `xml:"NbOfTxs"`
+			ControlSum      string    `xml:"CtrlSum"`
+			InitiatingParty sepaParty `xml:"InitgPty"`
+		} `xml:"GrpHdr"`
+		PaymentInfo sepaPaymentInfo `xml:"PmtInf"`
+	} `xml:"CstmrCdtTrfInitn"`
+}
+
+type sepaPaymentInfo struct {
+	PaymentInfoID string           `xml:"PmtInfId"`
+	Method        string           `xml:"PmtMtd"`
+	NumberOfTxs   int              `xml:"NbOfTxs"`
+	ControlSum    string           `xml:"CtrlSum"`
+	ServiceLevel  string           `xml:"PmtTpInf>SvcLvl>Cd"`
+	ExecutionDate string           `xml:"ReqdExctnDt"`
+	Debtor        sepaParty        `xml:"Dbtr"`
+	DebtorIBAN    string           `xml:"DbtrAcct>Id>IBAN"`
+	DebtorBIC     string           `xml:"DbtrAgt>FinInstnId>BIC,omitempty"`
+	DebtorAgentNA *sepaNotProvided `xml:"DbtrAgt>FinInstnId>Othr,omitempty"`
+	ChargeBearer  string           `xml:"ChrgBr"`
+	Transfers     []sepaTransfer   `xml:"CdtTrfTxInf"`
+}
+
+type sepaNotProvided struct {
+	ID string `xml:"Id"`
+}
+
+type sepaParty struct {
+	Name string `xml:"Nm"`
+}
+
+type sepaTransfer struct {
+	EndToEndID string `xml:"PmtId>EndToEndId"`
+	Amount     struct {
+		Currency string `xml:"Ccy,attr"`
+		Value    string `xml:",chardata"`
+	} `xml:"Amt>InstdAmt"`
+	CreditorBIC  string    `xml:"CdtrAgt>FinInstnId>BIC,omitempty"`
+	Creditor     sepaParty `xml:"Cdtr"`
+	CreditorIBAN string    `xml:"CdtrAcct>Id>IBAN"`
+	Remittance   string    `xml:"RmtInf>Ustrd"`
+}
+
+// sepaCreditTransfer renders a batch as one SEPA payment with a credit
+// transfer per employee, debited from the account in SEPA_DEBTOR_NAME,
+// SEPA_DEBTOR_IBAN and SEPA_DEBTOR_BIC. Reimbursements are owed in the base
+// currency, so it must be EUR.
+func sepaCreditTransfer(batch models.ReimbursementBatch, lines []payoutLine) ([]byte, error) {
+	if models.BaseCurrency() != sepaCurrency {
+		return nil, fmt.Errorf("SEPA payouts require the base currency to be %s; export as csv instead", sepaCurrency)
+	}
+	debtorName := os.Getenv("SEPA_DEBTOR_NAME")
+	debtorIBAN := strings.ToUpper(strings.ReplaceAll(os.Getenv("SEPA_DEBTOR_IBAN"), " ", ""))
+	debtorBIC := strings.ToUpper(strings.TrimSpace(os.Getenv("SEPA_DEBTOR_BIC")))
+	if debtorName == "" || !validIBAN(debtorIBAN) {
+		return nil, errors.New("SEPA_DEBTOR_NAME and a valid SEPA_DEBTOR_IBAN must be configured")
+	}
+
+	var total float64
+	for _, line := range lines {
+		total = roundAmount(total + line.Amount)
+	}
+	controlSum := fmt.Sprintf("%.2f", total)
+
+	var doc sepaDocument
+	header := &doc.Initiate.GroupHeader
+	header.MessageID = batch.Reference
+	header.CreatedAt = time.Now().UTC().Format("2006-01-02T15:04:05")
+	header.NumberOfTxs = len(lines)
+	header.ControlSum = controlSum
+	header.InitiatingParty.Name = sepaText(debtorName)
+
+	info := &doc.Initiate.PaymentInfo
+	info.PaymentInfoID = batch.Reference
+	info.Method = "TRF"
+	info.NumberOfTxs = len(lines)
+	info.ControlSum = controlSum
+	info.ServiceLevel = "SEPA"
+	info.ExecutionDate = batch.ExecutionDate.UTC().Format("2006-01-02")
+	info.Debtor.Name = sepaText(debtorName)
+	info.DebtorIBAN = debtorIBAN
+	info.DebtorBIC = debtorBIC
+	if debtorBIC == "" {
+		info.DebtorAgentNA = &sepaNotProvided{ID: "NOTPROVIDED"}
+	}
+	info.ChargeBearer = "SLEV"
+
+	for _, line := range lines {
+		var transfer sepaTransfer
+		transfer.EndToEndID = batch.Reference + "-" + line.UserID
+		transfer.Amount.Currency = sepaCurrency
+		transfer.Amount.Value = fmt.Sprintf("%.2f", line.Amount)
+		transfer.CreditorBIC = line.Account.BIC
+		transfer.Creditor.Name = sepaText(line.Account.AccountHolder)
+		transfer.CreditorIBAN = line.Account.IBAN
+		transfer.Remittance = "Expense reimbursement " + batch.Reference
+		info.Transfers = append(info.Transfers, transfer)
+	}
+
+	content, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(content, '\n')...), nil
+}
+
+// sepaText truncates a name to the 70 characters SEPA allows.
+func sepaText(s string) string {
+	runes := []rune(strings.TrimSpace(s))
+	if len(runes) > 70 {
+		runes = runes[:70]
+	}
+	return string(runes)
+}
+
+// bankCSV renders a batch as a generic bulk-payment CSV for banks that do
+// not accept SEPA XML.
+func bankCSV(batch models.ReimbursementBatch, lines []payoutLine) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write([]string{"beneficiary_name", "iban", "bic", "amount", "currency", "execution_date", "reference"}); err != nil {
+		return nil, err
+	}
+	for _, line := range lines {
+		record := []string{
+			line.Account.AccountHolder,
+			line.Account.IBAN,
+			line.Account.BIC,
+			fmt.Sprintf("%.2f", line.Amount),
+			models.BaseCurrency(),
+			batch.ExecutionDate.UTC().Format("2006-01-02"),
+			batch.Reference + "-" + line.UserID,
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
@@ -0,0 +1,343 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PDF page geometry, in points: A4 landscape with half-inch margins.
+const (
+	pdfPageWidth  = 842
+	pdfPageHeight = 595
+	pdfMargin     = 36
+	pdfFontSize   = 8
+	pdfRowHeight  = 12
+	pdfCellPad    = 3
+)
+
+// Objects every table PDF starts with. Page contents and pages follow from
+// pdfFirstPageObject on, two objects per page.
+const (
+	pdfCatalogObject = iota + 1
+	pdfPagesObject
+	pdfFontObject
+	pdfBoldFontObject
+	pdfInfoObject
+	pdfFirstPageObject
+)
+
+// helveticaWidths and helveticaBoldWidths are the advance widths of the
+// printable ASCII characters, from space to tilde, in thousandths of the
+// font size. Other characters are taken to be as wide as a digit.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBoldWidths = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
+
+// winAnsiExtras maps the characters of WinAnsiEncoding outside Latin-1 to
+// their codes.
+var winAnsiExtras = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '‘': 0x91, '’': 0x92,
+	'“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99,
+}
+
+// pdfTable renders a table export as a PDF set in Helvetica, with the
+// organisation, title and period at the top of every page and the column
+// headings repeated. Each page is written out once it is full, so only one
+// page is ever held in memory; the page tree and cross-reference table go
+// at the end of the file.
+type pdfTable struct {
+	w         *bufio.Writer
+	written   int64
+	offsets   map[int]int64
+	pages     []int
+	table     exportTable
+	generated string
+	lefts     []float64
+	widths    []float64
+	page      bytes.Buffer
+	y         float64
+	totals    bool
+}
+
+func newPDFTable(w io.Writer, table exportTable) (*pdfTable, error) {
+	t := &pdfTable{
+		w:         bufio.NewWriter(w),
+		offsets:   make(map[int]int64),
+		table:     table,
+		generated: time.Now().UTC().Format("2006-01-02 15:04 UTC"),
+	}
+
+	total := 0.0
+	for _, col := range table.Columns {
+		total += col.Width
+	}
+	x := float64(pdfMargin)
+	for _, col := range table.Columns {
+		width := (pdfPageWidth - 2*pdfMargin) * col.Width / total
+		t.lefts = append(t.lefts, x)
+		t.widths = append(t.widths, width)
+		x += width
+	}
+
+	t.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+	t.object(pdfCatalogObject, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pdfPagesObject))
+	t.object(pdfFontObject, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	t.object(pdfBoldFontObject, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	t.object(pdfInfoObject, fmt.Sprintf("<< /Title %s /Producer (Ledgerly) /CreationDate (D:%s) >>",
+		pdfString(orgName()+" - "+table.Title), time.Now().UTC().Format("20060102150405Z")))
+	t.startPage()
+	return t, t.flushErr()
+}
+
+func (t *pdfTable) WriteRow(cells ...interface{}) error {
+	if t.y-pdfRowHeight < pdfMargin+pdfRowHeight {
+		t.finishPage()
+		t.startPage()
+	}
+	t.drawRow(cells, false)
+	return t.flushErr()
+}
+
+// WriteTotal writes a total row in bold, ruling a line above the first.
+func (t *pdfTable) WriteTotal(cells ...interface{}) error {
+	if t.y-pdfRowHeight < pdfMargin+pdfRowHeight {
+		t.finishPage()
+		t.startPage()
+	}
+	if !t.totals {
+		t.rule(t.y - 3)
+		t.totals = true
+	}
+	t.drawRow(cells, true)
+	return t.flushErr()
+}
+
+func (t *pdfTable) Close() error {
+	t.finishPage()
+
+	kids := make([]string, len(t.pages))
+	for i, page := range t.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", page)
+	}
+	t.object(pdfPagesObject, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(t.pages)))
+
+	size := pdfFirstPageObject + 2*len(t.pages)
+	xref := t.written
+	t.printf("xref\n0 %d\n0000000000 65535 f \n", size)
+	for n := 1; n < size; n++ {
+		t.printf("%010d 00000 n \n", t.offsets[n])
+	}
+	t.printf("trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", size, pdfCatalogObject, pdfInfoObject, xref)
+	return t.w.Flush()
+}
+
+// startPage begins a page with the heading and the column headings.
+func (t *pdfTable) startPage() {
+	t.page.Reset()
+	top := float64(pdfPageHeight - pdfMargin)
+	t.text(pdfMargin, top-14, 14, true, orgName())
+	t.text(pdfMargin, top-30, 11, true, t.table.Title)
+	t.text(pdfMargin, top-44, pdfFontSize+1, false, "Period: "+t.table.Period)
+	t.text(pdfPageWidth-pdfMargin-pdfTextWidth(pdfEncode("Generated "+t.generated), false, pdfFontSize), top-44, pdfFontSize, false, "Generated "+t.generated)
+
+	t.y = top - 64
+	names := make([]interface{}, len(t.table.Columns))
+	for i, col := range t.table.Columns {
+		names[i] = col.Name
+	}
+	t.drawRow(names, true)
+	t.rule(t.y - 3)
+}
+
+// finishPage numbers the current page and writes it out.
+func (t *pdfTable) finishPage() {
+	number := fmt.Sprintf("Page %d", len(t.pages)+1)
+	t.text(pdfPageWidth-pdfMargin-pdfTextWidth(pdfEncode(number), false, pdfFontSize), pdfMargin/2, pdfFontSize, false, number)
+
+	contents := pdfFirstPageObject + 2*len(t.pages)
+	page := contents + 1
+	t.offsets[contents] = t.written
+	t.printf("%d 0 obj\n<< /Length %d >>\nstream\n", contents, t.page.Len())
+	t.write(t.page.Bytes())
+	t.printf("\nendstream\nendobj\n")
+	t.object(page, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 %d 0 R /F2 %d 0 R >> >> /Contents %d 0 R >>",
+		pdfPagesObject, pdfPageWidth, pdfPageHeight, pdfFontObject, pdfBoldFontObject, contents))
+	t.pages = append(t.pages, page)
+}
+
+// drawRow sets a row of cells below the previous one. Text that does not
+// fit its column is cut short with an ellipsis; numbers are right-aligned.
+func (t *pdfTable) drawRow(cells []interface{}, bold bool) {
+	t.y -= pdfRowHeight
+	for i, value := range cells {
+		if value == nil || i >= len(t.table.Columns) {
+			continue
+		}
+		kind := t.table.Columns[i].Kind
+		text := formatCell(kind, value)
+		if _, isAmount := value.(float64); isAmount && kind == columnAmount {
+			text = groupThousands(text)
+		}
+
+		space := t.widths[i] - 2*pdfCellPad
+		encoded := pdfFit(pdfEncode(text), bold, space)
+		x := t.lefts[i] + pdfCellPad
+		if kind == columnAmount || kind == columnNumber {
+			x = t.lefts[i] + t.widths[i] - pdfCellPad - pdfTextWidth(encoded, bold, pdfFontSize)
+		}
+		t.drawText(x, t.y, pdfFontSize, bold, encoded)
+	}
+}
+
+// rule draws a horizontal line across the table at y.
+func (t *pdfTable) rule(y float64) {
+	fmt.Fprintf(&t.page, "0.5 w %.2f %.2f m %.2f %.2f l S\n", float64(pdfMargin), y, float64(pdfPageWidth-pdfMargin), y)
+}
+
+func (t *pdfTable) text(x, y, size float64, bold bool, s string) {
+	t.drawText(x, y, size, bold, pdfEncode(s))
+}
+
+func (t *pdfTable) drawText(x, y, size float64, bold bool, encoded []byte) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(&t.page, "BT /%s %g Tf %.2f %.2f Td %s Tj ET\n", font, size, x, y, pdfLiteral(encoded))
+}
+
+// object writes an indirect object, recording where it starts for the
+// cross-reference table.
+func (t *pdfTable) object(n int, body string) {
+	t.offsets[n] = t.written
+	t.printf("%d 0 obj\n%s\nendobj\n", n, body)
+}
+
+func (t *pdfTable) printf(format string, args ...interface{}) {
+	t.write([]byte(fmt.Sprintf(format, args...)))
+}
+
+func (t *pdfTable) write(b []byte) {
+	n, _ := t.w.Write(b)
+	t.written += int64(n)
+}
+
+// flushErr returns the first write error, if any; bufio.Writer keeps it.
+func (t *pdfTable) flushErr() error {
+	_, err := t.w.Write(nil)
+	return err
+}
+
+// pdfEncode converts text to WinAnsiEncoding, replacing characters it lacks
+// with a question mark and control characters with spaces.
+func pdfEncode(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r < ' ':
+			out = append(out, ' ')
+		case r < 0x7f || (r >= 0xa0 && r <= 0xff):
+			out = append(out, byte(r))
+		default:
+			if c, ok := winAnsiExtras[r]; ok {
+				out = append(out, c)
+			} else {
+				out = append(out, '?')
+			}
+		}
+	}
+	return out
+}
+
+// pdfTextWidth returns the width of encoded text in points.
+func pdfTextWidth(encoded []byte, bold bool, size float64) float64 {
+	widths := &helveticaWidths
+	if bold {
+		widths = &helveticaBoldWidths
+	}
+	total := 0
+	for _, c := range encoded {
+		if c >= ' ' && c <= '~' {
+			total += widths[c-' ']
+		} else {
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// pdfFit cuts encoded text short with an ellipsis so it fits width.
+func pdfFit(encoded []byte, bold bool, width float64) []byte {
+	if pdfTextWidth(encoded, bold, pdfFontSize) <= width {
+		return encoded
+	}
+	ellipsis := []byte{0x85}
+	for n := len(encoded) - 1; n > 0; n-- {
+		cut := append(append([]byte{}, encoded[:n]...), ellipsis...)
+		if pdfTextWidth(cut, bold, pdfFontSize) <= width {
+			return cut
+		}
+	}
+	return nil
+}
+
+// pdfLiteral quotes encoded text as a PDF string.
+func pdfLiteral(encoded []byte) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, c := range encoded {
+		if c == '(' || c == ')' || c == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+func pdfString(s string) string {
+	return pdfLiteral(pdfEncode(s))
+}
+
+// groupThousands adds thousands separators to a formatted amount such as
+// -1234567.89.
+func groupThousands(amount string) string {
+	sign := ""
+	if strings.HasPrefix(amount, "-") {
+		sign, amount = "-", amount[1:]
+	}
+	whole, fraction, _ := strings.Cut(amount, ".")
+	if _, err := strconv.Atoi(whole); err != nil {
+		return sign + amount
+	}
+	var b strings.Builder
+	for i, d := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(d)
+	}
+	if fraction != "" {
+		return sign + b.String() + "." + fraction
+	}
+	return sign + b.String()
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"ledgerly/db"
+	"ledgerly/models"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type PeriodService struct{}
+
+// GetFiscalYearStartMonth returns the first month of the fiscal year from
+// FISCAL_YEAR_START_MONTH (1-12), defaulting to January.
+func GetFiscalYearStartMonth() time.Month {
+	month, err := strconv.Atoi(os.Getenv("FISCAL_YEAR_START_MONTH"))
+	if err != nil || month < 1 || month > 12 {
+		return time.January
+	}
+	return time.Month(month)
+}
+
+// CreateFiscalYear defines the twelve monthly periods of a fiscal year. The
+// fiscal year is named after the calendar year in which it starts.
+func (s *PeriodService) CreateFiscalYear(year int) ([]models.AccountingPeriod, error) {
+	if year < 1900 || year > 9999 {
+		return nil, errors.New("invalid fiscal year")
+	}
+
+	start := time.Date(year, GetFiscalYearStartMonth(), 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(1, 0, 0)
+
+	var overlapping int64
+	if err := db.DB.Model(&models.AccountingPeriod{}).Where("start_date < ? AND end_date > ?", end, start).Count(&overlapping).Error; err != nil {
+		return nil, err
+	}
+	if overlapping > 0 {
+		return nil, errors.New("fiscal year overlaps existing periods")
+	}
+
+	periods := make([]models.AccountingPeriod, 0, 12)
+	for i := 0; i < 12; i++ {
+		periodStart := start.AddDate(0, i, 0)
+		periods = append(periods, models.AccountingPeriod{
+			Name:       fmt.Sprintf("FY%d-%02d", year, i+1),
+			FiscalYear: year,
+			Number:     i + 1,
+			StartDate:  periodStart,
+			EndDate:    periodStart.AddDate(0, 1, 0),
+			Status:     models.PeriodStatusOpen,
+		})
+	}
+
+	if err := db.DB.Create(&periods).Error; err != nil {
+		return nil, err
+	}
+	slog.Info("Fiscal year created", "fiscal_year", year, "start", start)
+	return periods, nil
+}
+
+func (s *PeriodService) ListPeriods(fiscalYear int) ([]models.AccountingPeriod, error) {
+	var periods []models.AccountingPeriod
+	query := db.DB.Order("start_date")
+	if fiscalYear != 0 {
+		query = query.Where("fiscal_year = ?", fiscalYear)
+	}
+	err := query.Find(&periods).Error
+	return periods, err
+}
+
+func (s *PeriodService) GetLockDate() (time.Time, error) {
+	return models.LockDate(db.DB)
+}
+
+// ClosePeriod locks a period and snapshots its balances. Periods must be
+// closed in order and only once they have ended.
+func (s *PeriodService) ClosePeriod(id uint, userID string) (*models.AccountingPeriod, error) {
+	var period models.AccountingPeriod
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&period, id).Error; err != nil {
+			return err
+		}
+		if period.Status == models.PeriodStatusClosed {
+			return errors.New("period is already closed")
+		}
+		if period.EndDate.After(time.Now()) {
+			return errors.New("period has not ended yet")
+		}
+
+		var openBefore int64
+		if err := tx.Model(&models.AccountingPeriod{}).Where("status = ? AND start_date < ?", models.PeriodStatusOpen, period.StartDate).Count(&openBefore).Error; err != nil {
+			return err
+		}
+		if openBefore > 0 {
+			return errors.New("earlier periods must be closed first")
+		}
+
+		if err := snapshotPeriod(tx, &period); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		period.Status = models.PeriodStatusClosed
+		period.ClosedAt = &now
+		period.ClosedBy = userID
+		if err := tx.Save(&period).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, "period.close", "accounting_period", period.ID, userID, period.Name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Accounting period closed", "period", period.Name, "user_id", userID)
+	return &period, nil
+}
+
+// ReopenPeriod unlocks the most recently closed period. The reason is kept in
+// the audit log.
+func (s *PeriodService) ReopenPeriod(id uint, userID, reason string) (*models.AccountingPeriod, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, errors.New("reason is mandatory")
+	}
+
+	var period models.AccountingPeriod
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&period, id).Error; err != nil {
+			return err
+		}
+		if period.Status != models.PeriodStatusClosed {
+			return errors.New("period is not closed")
+		}
+
+		var closedAfter int64
+		if err := tx.Model(&models.AccountingPeriod{}).Where("status = ? AND start_date > ?", models.PeriodStatusClosed, period.StartDate).Count(&closedAfter).Error; err != nil {
+			return err
+		}
+		if closedAfter > 0 {
+			return errors.New("later periods must be reopened first")
+		}
+
+		period.Status = models.PeriodStatusOpen
+		period.ClosedAt = nil
+		period.ClosedBy = ""
+		if err := tx.Save(&period).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, "period.reopen", "accounting_period", period.ID, userID, reason)
+	})
+	if err != nil {
+		return nil, err
+	}
+	slog.Warn("Accounting period reopened", "period", period.Name, "user_id", userID, "reason", reason)
+	return &period, nil
+}
+
+// snapshotPeriod fills in the balance fields of period from the ledger.
+func snapshotPeriod(tx *gorm.DB, period *models.AccountingPeriod) error {
+	opening, err := balanceAsOf(tx, 0, period.StartDate)
+	if err != nil {
+		return err
+	}
+	credits, err := sumTransactions(tx, models.TransactionTypeCredit, period.StartDate, period.EndDate)
+	if err != nil {
+		return err
+	}
+	debits, err := sumTransactions(tx, models.TransactionTypeDebit, period.StartDate, period.EndDate)
+	if err != nil {
+		return err
+	}
+
+	var expenses float64
+	if err := tx.Model(&models.Expense{}).
+		Where("expense_date >= ? AND expense_date < ?", period.StartDate, period.EndDate).
+		Where("status NOT IN ?", models.UncountedExpenseStatuses).
+		Select("coalesce(sum(base_amount), 0)").Scan(&expenses).Error; err != nil {
+		return err
+	}
+
+	period.OpeningBalance = opening
+	period.TotalCredits = credits
+	period.TotalDebits = debits
+	period.ClosingBalance = period.OpeningBalance + credits - debits
+	period.TotalExpenses = expenses
+	return nil
+}
+
+// sumTransactions totals transactions of one type dated in [from, to) in the
+// base currency.
+func sumTransactions(tx *gorm.DB, txType models.TransactionType, from, to time.Time) (float64, error) {
+	var total float64
+	err := tx.Model(&models.PettyCashTransaction{}).
+		Where("type = ? AND transaction_date >= ? AND transaction_date < ?", txType, from, to).
+		Select("coalesce(sum(base_amount), 0)").Scan(&total).Error
+	return total, err
+}
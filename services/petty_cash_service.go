@@ -2,42 +2,267 @@ package services
 
 import (
 	"errors"
+	"fmt"
 	"ledgerly/db"
 	"ledgerly/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PettyCashService struct{}
 
-func (s *PettyCashService) CreateTransaction(tx *models.PettyCashTransaction) error {
-	if tx.Type == models.TransactionTypeDebit {
-		balance, err := s.GetBalance()
+// TransactionFilter narrows transaction listings. A zero FundID means all
+// funds.
+type TransactionFilter struct {
+	Dates  DateRange
+	FundID uint
+}
+
+// LedgerEntry is a transaction with the balance after it was applied.
+type LedgerEntry struct {
+	models.PettyCashTransaction
+	RunningBalance float64 `json:"running_balance"`
+}
+
+// Ledger lists transactions in date order between an opening and closing
+// balance.
+type Ledger struct {
+	OpeningBalance float64       `json:"opening_balance"`
+	Entries        []LedgerEntry `json:"entries"`
+	ClosingBalance float64       `json:"closing_balance"`
+}
+
+// CreateTransaction posts a transaction entered by a user. Debits count
+// against the user's spending limits in the base currency and are linked to
+// the vendor their description matches unless a vendor is given.
+func (s *PettyCashService) CreateTransaction(t *models.PettyCashTransaction) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		return postUserTransaction(tx, t)
+	})
+}
+
+// postUserTransaction posts a transaction on behalf of a user within tx, with
+// the checks of CreateTransaction.
+func postUserTransaction(tx *gorm.DB, t *models.PettyCashTransaction) error {
+	// Advance transactions are only posted by the advance service
+	t.CashAdvanceID = nil
+	if err := prepareTransaction(tx, t); err != nil {
+		return err
+	}
+	if t.VendorID != nil || t.Type == models.TransactionTypeDebit {
+		vendor, err := resolveVendor(tx, t.VendorID, t.Description)
+		if err != nil {
+			return err
+		}
+		t.VendorID = nil
+		if vendor != nil {
+			t.VendorID = &vendor.ID
+		}
+	}
+	if t.Type == models.TransactionTypeDebit {
+		if err := checkSpendingLimits(tx, t.UserID, t.BaseAmount, t.TransactionDate, true); err != nil {
+			return err
+		}
+	}
+	return tx.Create(t).Error
+}
+
+// createTransaction validates and posts t within tx, so other services can
+// post transactions atomically with their own changes. A zero FundID posts to
+// the default fund.
+func createTransaction(tx *gorm.DB, t *models.PettyCashTransaction) error {
+	if err := prepareTransaction(tx, t); err != nil {
+		return err
+	}
+	return tx.Create(t).Error
+}
+
+// prepareTransaction validates t and its tags, resolves its fund and converts
+// it to the base currency at its transaction date. Transactions are always in their
+// fund's currency, which is the default.
+func prepareTransaction(tx *gorm.DB, t *models.PettyCashTransaction) error {
+	if t.Amount <= 0 {
+		return errors.New("amount must be greater than zero")
+	}
+	if t.Type != models.TransactionTypeCredit && t.Type != models.TransactionTypeDebit {
+		return errors.New("type must be credit or debit")
+	}
+
+	date, err := normalizeBusinessDate(tx, t.TransactionDate)
+	if err != nil {
+		return err
+	}
+	t.TransactionDate = date
+	// The entry timestamp is always the server's
+	t.CreatedAt = time.Time{}
+
+	fund, err := resolveFund(tx, t.FundID)
+	if err != nil {
+		return err
+	}
+	t.FundID = fund.ID
+
+	if t.Currency == "" {
+		t.Currency = fund.Currency
+	}
+	currency, err := normalizeCurrency(t.Currency)
+	if err != nil {
+		return err
+	}
+	if currency != fund.Currency {
+		return fmt.Errorf("fund %s is locked to %s", fund.Name, fund.Currency)
+	}
+	if t.Tags, err = normalizeTags(tx, t.Tags); err != nil {
+		return err
+	}
+	t.Currency = currency
+	t.ExchangeRate, t.BaseAmount, err = convertToBase(tx, currency, t.Amount, t.TransactionDate)
+	if err != nil {
+		return err
+	}
+
+	if t.Type == models.TransactionTypeDebit {
+		balance, err := balanceAsOf(tx, fund.ID, time.Now().UTC())
 		if err != nil {
 			return err
 		}
-		if balance < tx.Amount {
+		if balance < t.Amount {
 			return errors.New("insufficient funds")
 		}
 	}
-	return db.DB.Create(tx).Error
+	return nil
 }
 
-func (s *PettyCashService) GetBalance() (float64, error) {
-	var credits float64
-	var debits float64
+// GetBalance returns the current balance of a fund, or of all funds when
+// fundID is 0.
+func (s *PettyCashService) GetBalance(fundID uint) (float64, error) {
+	return s.GetBalanceAsOf(fundID, time.Now().UTC())
+}
 
-	if err := db.DB.Model(&models.PettyCashTransaction{}).Where("type = ?", models.TransactionTypeCredit).Select("coalesce(sum(amount), 0)").Scan(&credits).Error; err != nil {
-		return 0, err
+// GetBalanceAsOf returns the balance of every transaction dated before asOf.
+func (s *PettyCashService) GetBalanceAsOf(fundID uint, asOf time.Time) (float64, error) {
+	var balance float64
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		balance, err = balanceAsOf(tx, fundID, asOf)
+		return err
+	})
+	return balance, err
+}
+
+// GetLedger returns the transactions matching filter with a running balance,
+// starting from the balance at filter.Dates.From. Balances are in the fund's
+// currency, or the base currency when listing all funds.
+func (s *PettyCashService) GetLedger(filter TransactionFilter) (*Ledger, error) {
+	ledger := &Ledger{Entries: []LedgerEntry{}}
+	if !filter.Dates.From.IsZero() {
+		opening, err := s.GetBalanceAsOf(filter.FundID, filter.Dates.From)
+		if err != nil {
+			return nil, err
+		}
+		ledger.OpeningBalance = opening
 	}
 
-	if err := db.DB.Model(&models.PettyCashTransaction{}).Where("type = ?", models.TransactionTypeDebit).Select("coalesce(sum(amount), 0)").Scan(&debits).Error; err != nil {
-		return 0, err
+	transactions, err := s.ListTransactions(filter)
+	if err != nil {
+		return nil, err
 	}
 
-	return credits - debits, nil
+	balance := ledger.OpeningBalance
+	for _, t := range transactions {
+		if t.Type == models.TransactionTypeCredit {
+			balance += fundAmount(t, filter.FundID)
+		} else {
+			balance -= fundAmount(t, filter.FundID)
+		}
+		ledger.Entries = append(ledger.Entries, LedgerEntry{PettyCashTransaction: t, RunningBalance: balance})
+	}
+	ledger.ClosingBalance = balance
+	return ledger, nil
 }
 
-func (s *PettyCashService) ListTransactions() ([]models.PettyCashTransaction, error) {
+func (s *PettyCashService) ListTransactions(filter TransactionFilter) ([]models.PettyCashTransaction, error) {
 	var transactions []models.PettyCashTransaction
-	err := db.DB.Find(&transactions).Error
+	err := filter.query(db.DB).Find(&transactions).Error
 	return transactions, err
 }
+
+// query selects the transactions matching the filter in date order.
+func (f TransactionFilter) query(tx *gorm.DB) *gorm.DB {
+	query := f.Dates.apply(tx.Model(&models.PettyCashTransaction{}), "transaction_date")
+	if f.FundID != 0 {
+		query = query.Where("fund_id = ?", f.FundID)
+	}
+	return query.Order("transaction_date, id")
+}
+
+// balanceAsOf starts from the latest checkpoint at or before asOf and records
+// a new checkpoint at the start of asOf's month, so repeated queries over a
+// long history only sum recent transactions.
+func balanceAsOf(tx *gorm.DB, fundID uint, asOf time.Time) (float64, error) {
+	asOf = asOf.UTC()
+
+	var checkpoint models.BalanceCheckpoint
+	if err := tx.Where("fund_id = ? AND date <= ?", fundID, asOf).Order("date desc").Limit(1).Find(&checkpoint).Error; err != nil {
+		return 0, err
+	}
+	balance := checkpoint.Balance
+	from := checkpoint.Date
+
+	monthStart := time.Date(asOf.Year(), asOf.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if monthStart.After(from) {
+		net, err := netMovement(tx, fundID, from, monthStart)
+		if err != nil {
+			return 0, err
+		}
+		balance += net
+		from = monthStart
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.BalanceCheckpoint{FundID: fundID, Date: monthStart, Balance: balance}).Error; err != nil {
+			return 0, err
+		}
+	}
+
+	net, err := netMovement(tx, fundID, from, asOf)
+	if err != nil {
+		return 0, err
+	}
+	return balance + net, nil
+}
+
+// netMovement returns credits minus debits dated in [from, to). A zero from
+// means since the beginning and a zero fundID means all funds. A single fund
+// is totalled in its own currency and all funds in the base currency.
+func netMovement(tx *gorm.DB, fundID uint, from, to time.Time) (float64, error) {
+	var net float64
+	query := tx.Model(&models.PettyCashTransaction{}).Where("transaction_date < ?", to)
+	if !from.IsZero() {
+		query = query.Where("transaction_date >= ?", from)
+	}
+	if fundID != 0 {
+		query = query.Where("fund_id = ?", fundID)
+	}
+	column := fundAmountColumn(fundID)
+	err := query.Select("coalesce(sum(CASE WHEN type = ? THEN "+column+" ELSE -"+column+" END), 0)", models.TransactionTypeCredit).Scan(&net).Error
+	return net, err
+}
+
+// fundAmountColumn is the transaction amount column balances of fundID are
+// summed from: the fund's own currency, or the base currency across all
+// funds.
+func fundAmountColumn(fundID uint) string {
+	if fundID == 0 {
+		return "base_amount"
+	}
+	return "amount"
+}
+
+// fundAmount is the counterpart of fundAmountColumn for a loaded
+// transaction.
+func fundAmount(t models.PettyCashTransaction, fundID uint) float64 {
+	if fundID == 0 {
+		return t.BaseAmount
+	}
+	return t.Amount
+}
@@ -0,0 +1,310 @@
+package services
+
+import (
+	"errors"
+	"ledgerly/db"
+	"ledgerly/models"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+type PolicyService struct{}
+
+// Policy error codes.
+const (
+	PolicyCodeViolation             = "policy_violation"
+	PolicyCodeJustificationRequired = "justification_required"
+)
+
+// PolicyError reports the violations that stop an expense from being
+// submitted: hard violations, or soft ones without a justification.
+type PolicyError struct {
+	Code       string
+	Violations []models.PolicyViolation
+}
+
+func (e *PolicyError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, v.Message)
+	}
+	if e.Code == PolicyCodeJustificationRequired {
+		return "justification required: " + strings.Join(messages, "; ")
+	}
+	return "expense breaks policy: " + strings.Join(messages, "; ")
+}
+
+func (e *PolicyError) ErrorCode() string {
+	return e.Code
+}
+
+func (s *PolicyService) CreateRule(rule *models.PolicyRule) error {
+	if err := validateRule(rule); err != nil {
+		return err
+	}
+	rule.Active = true
+	return db.DB.Create(rule).Error
+}
+
+func (s *PolicyService) GetRule(id uint) (*models.PolicyRule, error) {
+	var rule models.PolicyRule
+	if err := db.DB.First(&rule, id).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// UpdateRule replaces a rule's settings and conditions with those of changes.
+func (s *PolicyService) UpdateRule(id uint, changes *models.PolicyRule) (*models.PolicyRule, error) {
+	var rule models.PolicyRule
+	if err := db.DB.First(&rule, id).Error; err != nil {
+		return nil, err
+	}
+
+	rule.Name = changes.Name
+	rule.Message = changes.Message
+	rule.Severity = changes.Severity
+	rule.Active = changes.Active
+	rule.Categories = changes.Categories
+	rule.Keywords = changes.Keywords
+	rule.AmountAbove = changes.AmountAbove
+	rule.PerPersonAbove = changes.PerPersonAbove
+	rule.WeekendOnly = changes.WeekendOnly
+	rule.ReceiptMissing = changes.ReceiptMissing
+	rule.NotesMissing = changes.NotesMissing
+	if err := validateRule(&rule); err != nil {
+		return nil, err
+	}
+	if err := db.DB.Save(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (s *PolicyService) DeleteRule(id uint) error {
+	result := db.DB.Delete(&models.PolicyRule{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (s *PolicyService) ListRules() ([]models.PolicyRule, error) {
+	var rules []models.PolicyRule
+	err := db.DB.Order("id").Find(&rules).Error
+	return rules, err
+}
+
+func validateRule(rule *models.PolicyRule) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if rule.Name == "" {
+		return errors.New("name is mandatory")
+	}
+	if strings.TrimSpace(rule.Message) == "" {
+		rule.Message = rule.Name
+	}
+	switch rule.Severity {
+	case "":
+		rule.Severity = models.PolicySeveritySoft
+	case models.PolicySeverityHard, models.PolicySeveritySoft:
+	default:
+		return errors.New("severity must be hard or soft")
+	}
+	for _, amount := range []*float64{rule.AmountAbove, rule.PerPersonAbove} {
+		if amount != nil && *amount < 0 {
+			return errors.New("amounts must not be negative")
+		}
+	}
+
+	if len(rule.Categories) == 0 && len(rule.Keywords) == 0 && rule.AmountAbove == nil && rule.PerPersonAbove == nil &&
+		!rule.WeekendOnly && !rule.ReceiptMissing && !rule.NotesMissing {
+		return errors.New("rule needs at least one condition")
+	}
+	return nil
+}
+
+// evaluatePolicies returns the violations of the active rules by expense.
+// The expense's category must already be resolved. Category conditions match
+// a split expense if any split is in the category, and amount conditions are
+// then checked against the total of the matching splits.
+func evaluatePolicies(tx *gorm.DB, expense *models.Expense) ([]models.PolicyViolation, error) {
+	var rules []models.PolicyRule
+	if err := tx.Where("active = ?", true).Order("id").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	var lines []policyLine
+	for _, line := range chargedLines(expense) {
+		names, err := expenseCategoryNames(tx, &models.Expense{Category: line.Category, CategoryID: line.CategoryID})
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, policyLine{Categories: names, BaseAmount: line.BaseAmount})
+	}
+
+	var violations []models.PolicyViolation
+	for _, rule := range rules {
+		if ruleMatches(rule, expense, lines) {
+			violations = append(violations, models.PolicyViolation{
+				RuleID:   rule.ID,
+				RuleName: rule.Name,
+				Severity: rule.Severity,
+				Message:  rule.Message,
+			})
+		}
+	}
+	return violations, nil
+}
+
+// enforcePolicies evaluates an expense being submitted. Hard violations block
+// it. Soft violations must be justified in expense.Justifications, keyed by
+// rule ID, and send the expense for approval.
+func enforcePolicies(tx *gorm.DB, expense *models.Expense) ([]models.PolicyViolation, error) {
+	violations, err := evaluatePolicies(tx, expense)
+	if err != nil {
+		return nil, err
+	}
+	justifyViolations(violations, expense.Justifications)
+
+	var hard, unjustified []models.PolicyViolation
+	for _, v := range violations {
+		switch {
+		case v.Severity == models.PolicySeverityHard:
+			hard = append(hard, v)
+		case v.Justification == "":
+			unjustified = append(unjustified, v)
+		}
+	}
+	if len(hard) > 0 {
+		return nil, &PolicyError{Code: PolicyCodeViolation, Violations: hard}
+	}
+	if len(unjustified) > 0 {
+		return nil, &PolicyError{Code: PolicyCodeJustificationRequired, Violations: unjustified}
+	}
+
+	if len(violations) > 0 {
+		expense.Status = models.ExpenseStatusPendingApproval
+	}
+	return violations, nil
+}
+
+func justifyViolations(violations []models.PolicyViolation, justifications map[string]string) {
+	for i := range violations {
+		if violations[i].Severity == models.PolicySeveritySoft {
+			violations[i].Justification = strings.TrimSpace(justifications[strconv.FormatUint(uint64(violations[i].RuleID), 10)])
+		}
+	}
+}
+
+// storeViolations replaces the recorded violations of an expense.
+func storeViolations(tx *gorm.DB, expenseID uint, violations []models.PolicyViolation) error {
+	if err := tx.Where("expense_id = ?", expenseID).Delete(&models.PolicyViolation{}).Error; err != nil {
+		return err
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	for i := range violations {
+		violations[i].ID = 0
+		violations[i].ExpenseID = expenseID
+	}
+	return tx.Create(&violations).Error
+}
+
+// policyLine is a charged line of an expense with the names of its category
+// and the category's ancestors.
+type policyLine struct {
+	Categories []string
+	BaseAmount float64
+}
+
+func ruleMatches(rule models.PolicyRule, expense *models.Expense, lines []policyLine) bool {
+	conditions := 0
+
+	amount := expense.BaseAmount
+	if len(rule.Categories) > 0 {
+		conditions++
+		matched := false
+		amount = 0
+		for _, line := range lines {
+			if anyEqualFold(line.Categories, rule.Categories) {
+				matched = true
+				amount += line.BaseAmount
+			}
+		}
+		if !matched {
+			return false
+		}
+		amount = roundAmount(amount)
+	}
+	if len(rule.Keywords) > 0 {
+		conditions++
+		if !anyEqualFold(words(expense.Title+" "+expense.Notes), rule.Keywords) {
+			return false
+		}
+	}
+	if rule.AmountAbove != nil {
+		conditions++
+		if amount <= *rule.AmountAbove {
+			return false
+		}
+	}
+	if rule.PerPersonAbove != nil {
+		conditions++
+		attendees := expense.Attendees
+		if attendees < 1 {
+			attendees = 1
+		}
+		if amount/float64(attendees) <= *rule.PerPersonAbove {
+			return false
+		}
+	}
+	if rule.WeekendOnly {
+		conditions++
+		day := expense.ExpenseDate.UTC().Weekday()
+		if day != time.Saturday && day != time.Sunday {
+			return false
+		}
+	}
+	if rule.ReceiptMissing {
+		conditions++
+		if strings.TrimSpace(expense.Receipt) != "" {
+			return false
+		}
+	}
+	if rule.NotesMissing {
+		conditions++
+		if strings.TrimSpace(expense.Notes) != "" {
+			return false
+		}
+	}
+	return conditions > 0
+}
+
+func anyEqualFold(values, candidates []string) bool {
+	for _, v := range values {
+		for _, c := range candidates {
+			if strings.EqualFold(v, strings.TrimSpace(c)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// words splits text into words so keywords only match whole words.
+func words(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
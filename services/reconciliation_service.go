@@ -0,0 +1,168 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"ledgerly/db"
+	"ledgerly/models"
+	"log/slog"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ReconciliationService struct{}
+
+// ReconciliationFilter narrows reconciliation listings. Zero fields match
+// everything.
+type ReconciliationFilter struct {
+	Dates  DateRange
+	FundID uint
+	Status models.ReconciliationStatus
+}
+
+// CreateReconciliation records a cash count. The system balance is taken at
+// the moment of counting and the reconciliation waits for approval.
+func (s *ReconciliationService) CreateReconciliation(rec *models.Reconciliation) error {
+	if len(rec.Lines) == 0 {
+		return errors.New("at least one denomination line is required")
+	}
+
+	counted := 0.0
+	for i := range rec.Lines {
+		line := &rec.Lines[i]
+		if line.Denomination <= 0 {
+			return errors.New("denomination must be greater than zero")
+		}
+		if line.Quantity < 0 {
+			return errors.New("quantity cannot be negative")
+		}
+		line.ID = 0
+		line.Total = roundAmount(line.Denomination * float64(line.Quantity))
+		counted += line.Total
+	}
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		fund, err := resolveFund(tx, rec.FundID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		balance, err := balanceAsOf(tx, fund.ID, now)
+		if err != nil {
+			return err
+		}
+
+		rec.ID = 0
+		rec.FundID = fund.ID
+		rec.CountedAt = now
+		rec.CountedTotal = roundAmount(counted)
+		rec.SystemBalance = roundAmount(balance)
+		rec.Variance = roundAmount(counted - balance)
+		rec.Status = models.ReconciliationStatusPending
+		rec.ReviewedBy = ""
+		rec.ReviewedAt = nil
+		rec.ReviewNote = ""
+		rec.AdjustmentTransactionID = nil
+		return tx.Create(rec).Error
+	})
+}
+
+// ApproveReconciliation accepts a count and posts any variance as a cash
+// over (credit) or cash short (debit) adjustment dated at the count.
+func (s *ReconciliationService) ApproveReconciliation(id uint, userID, note string) (*models.Reconciliation, error) {
+	var rec models.Reconciliation
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Preload("Lines").First(&rec, id).Error; err != nil {
+			return err
+		}
+		if rec.Status != models.ReconciliationStatusPending {
+			return errors.New("reconciliation is not pending")
+		}
+
+		if rec.Variance != 0 {
+			adjustment := &models.PettyCashTransaction{
+				FundID:          rec.FundID,
+				Type:            models.TransactionTypeCredit,
+				Amount:          math.Abs(rec.Variance),
+				Description:     fmt.Sprintf("Cash over (reconciliation #%d)", rec.ID),
+				UserID:          userID,
+				TransactionDate: rec.CountedAt,
+			}
+			if rec.Variance < 0 {
+				adjustment.Type = models.TransactionTypeDebit
+				adjustment.Description = fmt.Sprintf("Cash short (reconciliation #%d)", rec.ID)
+			}
+			if err := createTransaction(tx, adjustment); err != nil {
+				return err
+			}
+			rec.AdjustmentTransactionID = &adjustment.ID
+			rec.AdjustmentTransaction = adjustment
+		}
+
+		now := time.Now().UTC()
+		rec.Status = models.ReconciliationStatusApproved
+		rec.ReviewedBy = userID
+		rec.ReviewedAt = &now
+		rec.ReviewNote = note
+		if err := tx.Omit("Lines", "AdjustmentTransaction").Save(&rec).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, "reconciliation.approve", "reconciliation", rec.ID, userID, fmt.Sprintf("variance %.2f", rec.Variance))
+	})
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Reconciliation approved", "id", rec.ID, "fund_id", rec.FundID, "variance", rec.Variance)
+	return &rec, nil
+}
+
+// RejectReconciliation discards a count without posting anything.
+func (s *ReconciliationService) RejectReconciliation(id uint, userID, note string) (*models.Reconciliation, error) {
+	var rec models.Reconciliation
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Preload("Lines").First(&rec, id).Error; err != nil {
+			return err
+		}
+		if rec.Status != models.ReconciliationStatusPending {
+			return errors.New("reconciliation is not pending")
+		}
+
+		now := time.Now().UTC()
+		rec.Status = models.ReconciliationStatusRejected
+		rec.ReviewedBy = userID
+		rec.ReviewedAt = &now
+		rec.ReviewNote = note
+		if err := tx.Omit("Lines").Save(&rec).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, "reconciliation.reject", "reconciliation", rec.ID, userID, note)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (s *ReconciliationService) GetReconciliation(id uint) (*models.Reconciliation, error) {
+	var rec models.Reconciliation
+	if err := db.DB.Preload("Lines").Preload("AdjustmentTransaction").First(&rec, id).Error; err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (s *ReconciliationService) ListReconciliations(filter ReconciliationFilter) ([]models.Reconciliation, error) {
+	var recs []models.Reconciliation
+	query := filter.Dates.apply(db.DB, "counted_at")
+	if filter.FundID != 0 {
+		query = query.Where("fund_id = ?", filter.FundID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	err := query.Preload("Lines").Order("counted_at desc").Find(&recs).Error
+	return recs, err
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"ledgerly/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed five-field cron expression, evaluated in UTC. Each
+// field is a bitset of the values it matches.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+// parseCron parses "minute hour day-of-month month day-of-week". Fields take
+// "*", values, ranges (1-5), lists (1,15) and steps (*/15, 1-10/2); day of
+// week 0 and 7 are both Sunday.
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, errors.New("cron must have five fields: minute hour day-of-month month day-of-week")
+	}
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	names := [5]string{"minute", "hour", "day of month", "month", "day of week"}
+	var sets [5]uint64
+	for i, field := range fields {
+		set, err := parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("cron %s: %w", names[i], err)
+		}
+		sets[i] = set
+	}
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+	return &cronSchedule{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			part = part[:i]
+		}
+
+		lo, hi := min, max
+		if part != "*" {
+			from, to, isRange := strings.Cut(part, "-")
+			var err error
+			if lo, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(to); err != nil {
+					return 0, fmt.Errorf("invalid range %q", part)
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is outside %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// next returns the first time after t the schedule matches, or the zero time
+// if it does not match within five years.
+func (s *cronSchedule) next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches follows cron: when both day fields are restricted, a day
+// matching either runs.
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// nextOccurrence returns the first scheduled run of template after t, or nil
+// once the schedule has ended. Runs before StartDate are never scheduled.
+func nextOccurrence(template *models.RecurringTemplate, t time.Time) (*time.Time, error) {
+	start := template.StartDate.UTC()
+	if t.Before(start) {
+		t = start.Add(-time.Nanosecond)
+	}
+
+	var next time.Time
+	switch template.Frequency {
+	case models.RecurringFrequencyWeekly:
+		period := time.Duration(template.Interval) * 7 * 24 * time.Hour
+		n := int64(0)
+		if !t.Before(start) {
+			n = int64(t.Sub(start)/period) + 1
+		}
+		next = start.Add(time.Duration(n) * period)
+	case models.RecurringFrequencyMonthly:
+		months := (t.Year()-start.Year())*12 + int(t.Month()) - int(start.Month())
+		n := months/template.Interval - 1
+		if n < 0 {
+			n = 0
+		}
+		next = monthlyOccurrence(start, n*template.Interval)
+		for !next.After(t) {
+			n++
+			next = monthlyOccurrence(start, n*template.Interval)
+		}
+	case models.RecurringFrequencyCron:
+		schedule, err := parseCron(template.Cron)
+		if err != nil {
+			return nil, err
+		}
+		if next = schedule.next(t); next.IsZero() {
+			return nil, nil
+		}
+	default:
+		return nil, errors.New("frequency must be weekly, monthly or cron")
+	}
+
+	if template.EndDate != nil {
+		end := template.EndDate.UTC()
+		// The end date is inclusive
+		endOfDay := time.Date(end.Year(), end.Month(), end.Day()+1, 0, 0, 0, 0, time.UTC)
+		if !next.Before(endOfDay) {
+			return nil, nil
+		}
+	}
+	return &next, nil
+}
+
+// monthlyOccurrence returns start moved months months ahead, keeping its day
+// of month or the last day of shorter months.
+func monthlyOccurrence(start time.Time, months int) time.Time {
+	first := time.Date(start.Year(), start.Month()+time.Month(months), 1, start.Hour(), start.Minute(), start.Second(), 0, time.UTC)
+	day := start.Day()
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
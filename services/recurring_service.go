@@ -0,0 +1,498 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ledgerly/db"
+	"ledgerly/models"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RecurringService struct{}
+
+// RecurringFilter narrows a template listing. Zero values match everything.
+type RecurringFilter struct {
+	UserID string
+	Kind   models.RecurringKind
+}
+
+// maxCatchUpRuns bounds the missed runs of one template caught up on in a
+// single scheduler pass; the rest follow on the next pass.
+const maxCatchUpRuns = 100
+
+// errRunExists reports a run that was already made, by an earlier pass or
+// another server process.
+var errRunExists = errors.New("recurring run already exists")
+
+// RecurringPollInterval returns RECURRING_POLL_INTERVAL, how often the
+// scheduler looks for due runs, defaulting to one minute.
+func RecurringPollInterval() time.Duration {
+	interval, err := time.ParseDuration(os.Getenv("RECURRING_POLL_INTERVAL"))
+	if err != nil || interval < time.Second {
+		return time.Minute
+	}
+	return interval
+}
+
+// StartRecurringScheduler makes the runs that are due straight away, which
+// catches up on runs missed while the server was down, and then again every
+// poll interval until ctx is done.
+func StartRecurringScheduler(ctx context.Context) {
+	service := &RecurringService{}
+	interval := RecurringPollInterval()
+	slog.Info("Starting recurring scheduler", "interval", interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			runs, err := service.RunDue(time.Now().UTC())
+			if err != nil {
+				slog.Error("Recurring scheduler pass failed", "error", err)
+			} else if runs > 0 {
+				slog.Info("Recurring runs made", "runs", runs)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// CreateTemplate stores a recurring template. Its first run is the first
+// scheduled time on or after StartDate, so a start date in the past catches
+// up on the runs since.
+func (s *RecurringService) CreateTemplate(template *models.RecurringTemplate, createdBy string) error {
+	template.ID = 0
+	template.LastRunAt = nil
+	template.CreatedBy = createdBy
+	template.Active = true
+	if err := validateTemplate(db.DB, template); err != nil {
+		return err
+	}
+	if template.NextRunAt == nil {
+		return errors.New("schedule has no runs")
+	}
+	return db.DB.Create(template).Error
+}
+
+// UpdateTemplate replaces a template's schedule and what it creates with
+// those of changes. Runs already made are kept; the next run is rescheduled
+// after the last one.
+func (s *RecurringService) UpdateTemplate(id uint, changes *models.RecurringTemplate) (*models.RecurringTemplate, error) {
+	var template models.RecurringTemplate
+	if err := db.DB.First(&template, id).Error; err != nil {
+		return nil, err
+	}
+
+	template.Name = changes.Name
+	template.Kind = changes.Kind
+	template.Mode = changes.Mode
+	template.Frequency = changes.Frequency
+	template.Interval = changes.Interval
+	template.Cron = changes.Cron
+	template.StartDate = changes.StartDate
+	template.EndDate = changes.EndDate
+	template.Title = changes.Title
+	template.Amount = changes.Amount
+	template.Currency = changes.Currency
+	template.Category = changes.Category
+	template.CategoryID = changes.CategoryID
+	template.TaxCode = changes.TaxCode
+	template.VendorID = changes.VendorID
+	template.Notes = changes.Notes
+	template.Tags = changes.Tags
+	template.FundID = changes.FundID
+	template.Type = changes.Type
+	template.Active = changes.Active
+	if err := validateTemplate(db.DB, &template); err != nil {
+		return nil, err
+	}
+	if err := db.DB.Save(&template).Error; err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// DeleteTemplate stops a template. Its runs and what they created are kept.
+func (s *RecurringService) DeleteTemplate(id uint) error {
+	result := db.DB.Delete(&models.RecurringTemplate{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (s *RecurringService) GetTemplate(id uint) (*models.RecurringTemplate, error) {
+	var template models.RecurringTemplate
+	if err := db.DB.First(&template, id).Error; err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+func (s *RecurringService) ListTemplates(filter RecurringFilter) ([]models.RecurringTemplate, error) {
+	var templates []models.RecurringTemplate
+	query := db.DB.Order("name, id")
+	if filter.UserID != "" {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Kind != "" {
+		query = query.Where("kind = ?", filter.Kind)
+	}
+	err := query.Find(&templates).Error
+	return templates, err
+}
+
+// ListRuns returns a template's runs, latest first.
+func (s *RecurringService) ListRuns(templateID uint) ([]models.RecurringRun, error) {
+	var runs []models.RecurringRun
+	err := db.DB.Where("template_id = ?", templateID).Order("scheduled_for desc").Find(&runs).Error
+	return runs, err
+}
+
+// GetRun returns a run with the template it belongs to, including deleted
+// templates.
+func (s *RecurringService) GetRun(id uint) (*models.RecurringRun, *models.RecurringTemplate, error) {
+	var run models.RecurringRun
+	if err := db.DB.First(&run, id).Error; err != nil {
+		return nil, nil, err
+	}
+	var template models.RecurringTemplate
+	if err := db.DB.Unscoped().First(&template, run.TemplateID).Error; err != nil {
+		return nil, nil, err
+	}
+	return &run, &template, nil
+}
+
+// ConfirmRun posts the transaction of a pending draft run, dated when the
+// run was scheduled.
+func (s *RecurringService) ConfirmRun(id uint, userID string) (*models.RecurringRun, error) {
+	var run models.RecurringRun
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		template, err := pendingRun(tx, id, &run)
+		if err != nil {
+			return err
+		}
+		t := templateTransaction(template, run.ScheduledFor)
+		if err := postUserTransaction(tx, t); err != nil {
+			return err
+		}
+		run.Status = models.RecurringRunCreated
+		run.TransactionID = &t.ID
+		if err := tx.Save(&run).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, "recurring_run.confirm", "recurring_run", run.ID, userID, template.Name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// SkipRun discards a pending draft run without posting it.
+func (s *RecurringService) SkipRun(id uint, userID string) (*models.RecurringRun, error) {
+	var run models.RecurringRun
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		template, err := pendingRun(tx, id, &run)
+		if err != nil {
+			return err
+		}
+		run.Status = models.RecurringRunSkipped
+		if err := tx.Save(&run).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, "recurring_run.skip", "recurring_run", run.ID, userID, template.Name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// RunDue makes every run scheduled up to now, oldest first, and returns how
+// many were made. A run that fails is recorded as failed and its template
+// moves on, so one bad run does not hold up the schedule.
+func (s *RecurringService) RunDue(now time.Time) (int, error) {
+	var templates []models.RecurringTemplate
+	err := db.DB.Where("active = ? AND next_run_at IS NOT NULL AND next_run_at <= ?", true, now).
+		Order("next_run_at, id").Find(&templates).Error
+	if err != nil {
+		return 0, err
+	}
+
+	runs := 0
+	for i := range templates {
+		template := &templates[i]
+		for n := 0; n < maxCatchUpRuns && template.NextRunAt != nil && !template.NextRunAt.After(now); n++ {
+			scheduled := *template.NextRunAt
+			err := runTemplate(template, scheduled)
+			switch {
+			case err == nil:
+				runs++
+			case errors.Is(err, errRunExists):
+			default:
+				slog.Warn("Recurring run failed", "template_id", template.ID, "scheduled_for", scheduled, "error", err)
+				if err := failRun(template, scheduled, err); err != nil {
+					return runs, err
+				}
+			}
+
+			next, err := nextOccurrence(template, scheduled)
+			if err != nil {
+				return runs, err
+			}
+			result := db.DB.Model(&models.RecurringTemplate{}).
+				Where("id = ? AND next_run_at = ?", template.ID, scheduled).
+				UpdateColumns(map[string]interface{}{"next_run_at": next, "last_run_at": scheduled})
+			if result.Error != nil {
+				return runs, result.Error
+			}
+			// The template was changed or advanced elsewhere in the meantime
+			if result.RowsAffected == 0 {
+				break
+			}
+			template.NextRunAt = next
+			template.LastRunAt = &scheduled
+		}
+	}
+	return runs, nil
+}
+
+// runTemplate makes one run of a template. The run is recorded in the same
+// transaction as the expense or transaction it creates, and its unique
+// template and time keep it from being made twice.
+func runTemplate(template *models.RecurringTemplate, scheduled time.Time) error {
+	var expense *models.Expense
+	if template.Kind == models.RecurringKindExpense {
+		expense = templateExpense(template, scheduled)
+		if err := prepareExpense(db.DB, expense); err != nil {
+			return err
+		}
+	}
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		run := models.RecurringRun{TemplateID: template.ID, ScheduledFor: scheduled, Status: models.RecurringRunCreated}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&run)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errRunExists
+		}
+
+		var message string
+		switch {
+		case expense != nil && template.Mode == models.RecurringModeDraft:
+			if err := saveDraft(tx, expense); err != nil {
+				return err
+			}
+			run.ExpenseID = &expense.ID
+			message = fmt.Sprintf("Recurring expense %q for %s is ready to submit", template.Name, scheduled.Format("2006-01-02"))
+		case expense != nil:
+			if err := submitExpense(tx, expense); err != nil {
+				return err
+			}
+			run.ExpenseID = &expense.ID
+		case template.Mode == models.RecurringModeDraft:
+			run.Status = models.RecurringRunPending
+			message = fmt.Sprintf("Recurring transaction %q for %s is waiting to be confirmed", template.Name, scheduled.Format("2006-01-02"))
+		default:
+			t := templateTransaction(template, scheduled)
+			if err := postUserTransaction(tx, t); err != nil {
+				return err
+			}
+			run.TransactionID = &t.ID
+		}
+		if err := tx.Save(&run).Error; err != nil {
+			return err
+		}
+		if message == "" {
+			return nil
+		}
+		return notify(tx, &models.Notification{
+			UserID:     template.UserID,
+			Type:       "recurring_run",
+			Message:    message,
+			EntityType: "recurring_run",
+			EntityID:   run.ID,
+		})
+	})
+}
+
+// failRun records a run that could not be made and tells the template's
+// owner.
+func failRun(template *models.RecurringTemplate, scheduled time.Time, cause error) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		run := models.RecurringRun{TemplateID: template.ID, ScheduledFor: scheduled, Status: models.RecurringRunFailed, Error: cause.Error()}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&run)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return notify(tx, &models.Notification{
+			UserID:     template.UserID,
+			Type:       "recurring_run_failed",
+			Message:    fmt.Sprintf("Recurring %s %q for %s failed: %v", template.Kind, template.Name, scheduled.Format("2006-01-02"), cause),
+			EntityType: "recurring_run",
+			EntityID:   run.ID,
+		})
+	})
+}
+
+// pendingRun loads a run waiting for confirmation and its template.
+func pendingRun(tx *gorm.DB, id uint, run *models.RecurringRun) (*models.RecurringTemplate, error) {
+	if err := tx.First(run, id).Error; err != nil {
+		return nil, err
+	}
+	if run.Status != models.RecurringRunPending {
+		return nil, fmt.Errorf("run is %s, not pending", run.Status)
+	}
+	var template models.RecurringTemplate
+	if err := tx.Unscoped().First(&template, run.TemplateID).Error; err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+func templateExpense(template *models.RecurringTemplate, scheduled time.Time) *models.Expense {
+	expense := &models.Expense{
+		Title:       template.Title,
+		Amount:      template.Amount,
+		Currency:    template.Currency,
+		Category:    template.Category,
+		CategoryID:  template.CategoryID,
+		TaxCode:     template.TaxCode,
+		VendorID:    template.VendorID,
+		Notes:       template.Notes,
+		Tags:        copyTags(template.Tags),
+		UserID:      template.UserID,
+		ExpenseDate: scheduled,
+	}
+	if template.Mode == models.RecurringModeDraft {
+		expense.Status = models.ExpenseStatusDraft
+	}
+	return expense
+}
+
+func templateTransaction(template *models.RecurringTemplate, scheduled time.Time) *models.PettyCashTransaction {
+	return &models.PettyCashTransaction{
+		FundID:          template.FundID,
+		Type:            template.Type,
+		Amount:          template.Amount,
+		Currency:        template.Currency,
+		VendorID:        template.VendorID,
+		Description:     template.Title,
+		Tags:            copyTags(template.Tags),
+		UserID:          template.UserID,
+		TransactionDate: scheduled,
+	}
+}
+
+func copyTags(tags models.Tags) models.Tags {
+	if tags == nil {
+		return nil
+	}
+	copied := make(models.Tags, len(tags))
+	for code, value := range tags {
+		copied[code] = value
+	}
+	return copied
+}
+
+// validateTemplate checks a template and schedules its next run after the
+// last one.
+func validateTemplate(tx *gorm.DB, template *models.RecurringTemplate) error {
+	template.Title = strings.TrimSpace(template.Title)
+	if template.Title == "" {
+		return errors.New("title is mandatory")
+	}
+	if template.Name = strings.TrimSpace(template.Name); template.Name == "" {
+		template.Name = template.Title
+	}
+	if template.Amount <= 0 {
+		return errors.New("amount must be greater than zero")
+	}
+	template.Amount = roundAmount(template.Amount)
+
+	switch template.Mode {
+	case "":
+		template.Mode = models.RecurringModeDraft
+	case models.RecurringModeDraft, models.RecurringModeSubmit:
+	default:
+		return errors.New("mode must be draft or submit")
+	}
+
+	switch template.Kind {
+	case models.RecurringKindExpense:
+		template.FundID = 0
+		template.Type = ""
+		line := models.Expense{Category: template.Category, CategoryID: template.CategoryID}
+		if _, err := resolveCategory(tx, &line); err != nil {
+			return err
+		}
+		template.Category, template.CategoryID = line.Category, line.CategoryID
+	case models.RecurringKindTransaction:
+		template.Category, template.CategoryID, template.TaxCode, template.Notes = "", nil, "", ""
+		if template.Type != models.TransactionTypeCredit && template.Type != models.TransactionTypeDebit {
+			return errors.New("type must be credit or debit")
+		}
+		fund, err := resolveFund(tx, template.FundID)
+		if err != nil {
+			return err
+		}
+		template.FundID = fund.ID
+	default:
+		return errors.New("kind must be expense or transaction")
+	}
+
+	tags, err := normalizeTags(tx, template.Tags)
+	if err != nil {
+		return err
+	}
+	template.Tags = tags
+
+	switch template.Frequency {
+	case models.RecurringFrequencyWeekly, models.RecurringFrequencyMonthly:
+		template.Cron = ""
+		if template.Interval == 0 {
+			template.Interval = 1
+		}
+		if template.Interval < 1 {
+			return errors.New("interval must be at least 1")
+		}
+	case models.RecurringFrequencyCron:
+		template.Interval = 0
+		if _, err := parseCron(template.Cron); err != nil {
+			return err
+		}
+	default:
+		return errors.New("frequency must be weekly, monthly or cron")
+	}
+
+	if template.StartDate.IsZero() {
+		template.StartDate = time.Now()
+	}
+	template.StartDate = template.StartDate.UTC()
+	if template.EndDate != nil && template.EndDate.Before(template.StartDate) {
+		return errors.New("end_date must not be before start_date")
+	}
+
+	after := template.StartDate.Add(-time.Nanosecond)
+	if template.LastRunAt != nil {
+		after = *template.LastRunAt
+	}
+	template.NextRunAt, err = nextOccurrence(template, after)
+	return err
+}
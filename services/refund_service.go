@@ -0,0 +1,134 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"ledgerly/db"
+	"ledgerly/models"
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+type RefundService struct{}
+
+// RecordRefund records money a vendor returned against an expense. The
+// refund is dated RefundDate, today by default, which must be in an open
+// period. If the expense was paid from petty cash the refund is credited back
+// to the same fund; otherwise it comes off the employee's reimbursement, or
+// is owed back by the employee if that was already batched or paid.
+func (s *RefundService) RecordRefund(expenseID uint, refund *models.Refund, userID string) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var expense models.Expense
+		if err := tx.First(&expense, expenseID).Error; err != nil {
+			return err
+		}
+		if slices.Contains(models.UncountedExpenseStatuses, expense.Status) {
+			return fmt.Errorf("a %s expense cannot be refunded", expense.Status)
+		}
+
+		refund.Amount = roundAmount(refund.Amount)
+		if refund.Amount <= 0 {
+			return errors.New("amount must be greater than zero")
+		}
+		if remaining := roundAmount(expense.Amount - expense.RefundedAmount); refund.Amount > remaining {
+			return fmt.Errorf("only %.2f %s of the expense is left to refund", remaining, expense.Currency)
+		}
+		date, err := normalizeBusinessDate(tx, refund.RefundDate)
+		if err != nil {
+			return err
+		}
+		if date.Before(startOfDay(expense.ExpenseDate)) {
+			return errors.New("refund_date cannot be before the expense date")
+		}
+
+		refund.ID = 0
+		refund.ExpenseID = expense.ID
+		refund.RefundDate = date
+		refund.BaseAmount = roundAmount(refund.Amount * expense.ExchangeRate)
+		refund.RecordedBy = userID
+		refund.PettyCashTransactionID = nil
+		refund.PettyCashTransaction = nil
+		// The last refund takes whatever is left of the base amount, so
+		// rounding never leaves a fully refunded expense a cent off
+		if refund.Amount == roundAmount(expense.Amount-expense.RefundedAmount) {
+			refunded, err := refundedBaseAmount(tx, expense.ID)
+			if err != nil {
+				return err
+			}
+			refund.BaseAmount = roundAmount(expense.BaseAmount - refunded)
+		}
+
+		if expense.PettyCashTransactionID != nil {
+			var paid models.PettyCashTransaction
+			if err := tx.First(&paid, *expense.PettyCashTransactionID).Error; err != nil {
+				return err
+			}
+			credit := &models.PettyCashTransaction{
+				FundID:          paid.FundID,
+				Type:            models.TransactionTypeCredit,
+				Amount:          refund.Amount,
+				Currency:        expense.Currency,
+				Description:     fmt.Sprintf("Refund of expense #%d: %s", expense.ID, expense.Title),
+				Tags:            expense.Tags,
+				UserID:          userID,
+				TransactionDate: date,
+			}
+			if err := createTransaction(tx, credit); err != nil {
+				return err
+			}
+			refund.PettyCashTransactionID = &credit.ID
+			refund.PettyCashTransaction = credit
+		}
+		if err := tx.Create(refund).Error; err != nil {
+			return err
+		}
+		if expense.PettyCashTransactionID == nil {
+			if err := reduceReimbursement(tx, refund); err != nil {
+				return err
+			}
+		}
+		// The expense may be dated in a closed period; only the refund is new
+		err = tx.Model(&expense).UpdateColumn("refunded_amount", roundAmount(expense.RefundedAmount+refund.Amount)).Error
+		if err != nil {
+			return err
+		}
+		detail := fmt.Sprintf("%.2f %s: %s", refund.Amount, expense.Currency, refund.Reason)
+		if err := recordAudit(tx, "expense.refund", "expense", expense.ID, userID, detail); err != nil {
+			return err
+		}
+		return notify(tx, &models.Notification{
+			UserID:     expense.UserID,
+			Type:       "expense_refunded",
+			Message:    fmt.Sprintf("A refund of %.2f %s was recorded against your expense %q", refund.Amount, expense.Currency, expense.Title),
+			EntityType: "expense",
+			EntityID:   expense.ID,
+		})
+	})
+}
+
+// ListRefunds returns the refunds of an expense, oldest first. A non-empty
+// userID limits them to that user's expenses.
+func (s *RefundService) ListRefunds(expenseID uint, userID string) ([]models.Refund, error) {
+	var expense models.Expense
+	query := db.DB
+	if userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if err := query.First(&expense, expenseID).Error; err != nil {
+		return nil, err
+	}
+
+	var refunds []models.Refund
+	err := db.DB.Preload("PettyCashTransaction").Where("expense_id = ?", expense.ID).
+		Order("refund_date, id").Find(&refunds).Error
+	return refunds, err
+}
+
+// refundedBaseAmount is the base-currency total refunded against an expense.
+func refundedBaseAmount(tx *gorm.DB, expenseID uint) (float64, error) {
+	var refunded float64
+	err := tx.Model(&models.Refund{}).Where("expense_id = ?", expenseID).
+		Select("coalesce(sum(base_amount), 0)").Scan(&refunded).Error
+	return roundAmount(refunded), err
+}
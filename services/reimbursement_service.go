@@ -0,0 +1,395 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"ledgerly/db"
+	"ledgerly/models"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ReimbursementService struct{}
+
+// ReimbursementFilter narrows a reimbursement listing. Zero values match
+// everything.
+type ReimbursementFilter struct {
+	UserID string
+	Status models.ReimbursementStatus
+}
+
+// Payable is what is owed to one employee: Owed is not in a batch yet,
+// Batched is waiting for an open batch to be paid.
+type Payable struct {
+	UserID  string  `json:"user_id"`
+	Owed    float64 `json:"owed"`
+	Batched float64 `json:"batched"`
+	Count   int     `json:"count"`
+}
+
+var bicPattern = regexp.MustCompile(`^[A-Z]{6}[A-Z0-9]{2}([A-Z0-9]{3})?$`)
+
+func (s *ReimbursementService) ListReimbursements(filter ReimbursementFilter) ([]models.Reimbursement, error) {
+	var reimbursements []models.Reimbursement
+	query := db.DB.Preload("Expense").Order("created_at, id")
+	if filter.UserID != "" {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	err := query.Find(&reimbursements).Error
+	return reimbursements, err
+}
+
+// ListPayables returns the unpaid total per employee.
+func (s *ReimbursementService) ListPayables() ([]Payable, error) {
+	payables := make([]Payable, 0)
+	err := db.DB.Model(&models.Reimbursement{}).
+		Select("user_id, "+
+			"coalesce(sum(CASE WHEN status = ? THEN amount ELSE 0 END), 0) AS owed, "+
+			"coalesce(sum(CASE WHEN status = ? THEN amount ELSE 0 END), 0) AS batched, "+
+			"count(*) AS count",
+			models.ReimbursementStatusOwed, models.ReimbursementStatusBatched).
+		Where("status IN ?", []models.ReimbursementStatus{models.ReimbursementStatusOwed, models.ReimbursementStatusBatched}).
+		Group("user_id").
+		Order("user_id").
+		Scan(&payables).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range payables {
+		payables[i].Owed = roundAmount(payables[i].Owed)
+		payables[i].Batched = roundAmount(payables[i].Batched)
+	}
+	return payables, nil
+}
+
+// SetBankAccount creates or replaces the account a user is reimbursed to.
+func (s *ReimbursementService) SetBankAccount(userID string, account *models.BankAccount) error {
+	var user models.User
+	if err := db.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		return err
+	}
+
+	account.AccountHolder = strings.TrimSpace(account.AccountHolder)
+	account.IBAN = strings.ToUpper(strings.ReplaceAll(account.IBAN, " ", ""))
+	account.BIC = strings.ToUpper(strings.TrimSpace(account.BIC))
+	if account.AccountHolder == "" {
+		return errors.New("account_holder is mandatory")
+	}
+	if !validIBAN(account.IBAN) {
+		return errors.New("invalid IBAN")
+	}
+	if account.BIC != "" && !bicPattern.MatchString(account.BIC) {
+		return errors.New("invalid BIC")
+	}
+
+	account.ID = 0
+	account.UserID = userID
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"account_holder", "iban", "bic", "updated_at"}),
+		}).Create(account).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).First(account).Error
+	})
+}
+
+func (s *ReimbursementService) GetBankAccount(userID string) (*models.BankAccount, error) {
+	var account models.BankAccount
+	if err := db.DB.Where("user_id = ?", userID).First(&account).Error; err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// CreateBatch collects the owed reimbursements of the given users, or of
+// everyone when userIDs is empty, into a new open batch.
+func (s *ReimbursementService) CreateBatch(userIDs []string, executionDate time.Time, createdBy string) (*models.ReimbursementBatch, error) {
+	if executionDate.IsZero() {
+		executionDate = time.Now()
+	}
+	executionDate = time.Date(executionDate.Year(), executionDate.Month(), executionDate.Day(), 0, 0, 0, 0, time.UTC)
+
+	var batch models.ReimbursementBatch
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("status = ?", models.ReimbursementStatusOwed)
+		if len(userIDs) > 0 {
+			query = query.Where("user_id IN ?", userIDs)
+		}
+		var owed []models.Reimbursement
+		if err := query.Order("id").Find(&owed).Error; err != nil {
+			return err
+		}
+		// Employees who owe back more than they are owed wait for their next
+		// expenses, so a batch never pays anyone a negative amount
+		net := make(map[string]float64)
+		for _, r := range owed {
+			net[r.UserID] += r.Amount
+		}
+		payable := owed[:0]
+		for _, r := range owed {
+			if roundAmount(net[r.UserID]) > 0 {
+				payable = append(payable, r)
+			}
+		}
+		owed = payable
+		if len(owed) == 0 {
+			return errors.New("no reimbursements are owed")
+		}
+
+		batch = models.ReimbursementBatch{Status: models.BatchStatusOpen, ExecutionDate: executionDate, CreatedBy: createdBy, Count: len(owed)}
+		ids := make([]uint, 0, len(owed))
+		for _, r := range owed {
+			batch.Total = roundAmount(batch.Total + r.Amount)
+			ids = append(ids, r.ID)
+		}
+		if err := tx.Create(&batch).Error; err != nil {
+			return err
+		}
+		batch.Reference = fmt.Sprintf("RB%06d", batch.ID)
+		if err := tx.Model(&batch).UpdateColumn("reference", batch.Reference).Error; err != nil {
+			return err
+		}
+
+		err := tx.Model(&models.Reimbursement{}).Where("id IN ?", ids).
+			Updates(map[string]interface{}{"status": models.ReimbursementStatusBatched, "batch_id": batch.ID}).Error
+		if err != nil {
+			return err
+		}
+		return recordAudit(tx, "reimbursement_batch.create", "reimbursement_batch", batch.ID, createdBy, fmt.Sprintf("%d reimbursements, %.2f", batch.Count, batch.Total))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetBatch(batch.ID)
+}
+
+func (s *ReimbursementService) GetBatch(id uint) (*models.ReimbursementBatch, error) {
+	var batch models.ReimbursementBatch
+	if err := db.DB.Preload("Reimbursements.Expense").First(&batch, id).Error; err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+func (s *ReimbursementService) ListBatches() ([]models.ReimbursementBatch, error) {
+	var batches []models.ReimbursementBatch
+	err := db.DB.Order("id desc").Find(&batches).Error
+	return batches, err
+}
+
+// MarkBatchPaid records that the bank executed a batch and tells each
+// employee they were paid.
+func (s *ReimbursementService) MarkBatchPaid(id uint, userID string) (*models.ReimbursementBatch, error) {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		batch, err := openBatch(tx, id)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		batch.Status = models.BatchStatusPaid
+		batch.PaidAt = &now
+		batch.PaidBy = userID
+		if err := tx.Omit(clause.Associations).Save(batch).Error; err != nil {
+			return err
+		}
+		err = tx.Model(&models.Reimbursement{}).Where("batch_id = ?", batch.ID).
+			Updates(map[string]interface{}{"status": models.ReimbursementStatusPaid, "paid_at": now}).Error
+		if err != nil {
+			return err
+		}
+
+		payees, err := batchPayees(tx, batch.ID)
+		if err != nil {
+			return err
+		}
+		for _, payee := range payees {
+			err := notify(tx, &models.Notification{
+				UserID:     payee.UserID,
+				Type:       "reimbursement_paid",
+				Message:    fmt.Sprintf("%.2f in expense reimbursements was paid in batch %s", payee.Amount, batch.Reference),
+				EntityType: "reimbursement_batch",
+				EntityID:   batch.ID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return recordAudit(tx, "reimbursement_batch.paid", "reimbursement_batch", batch.ID, userID, batch.Reference)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetBatch(id)
+}
+
+// CancelBatch releases the reimbursements of an unpaid batch so they can be
+// batched again.
+func (s *ReimbursementService) CancelBatch(id uint, userID string) (*models.ReimbursementBatch, error) {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		batch, err := openBatch(tx, id)
+		if err != nil {
+			return err
+		}
+
+		batch.Status = models.BatchStatusCancelled
+		if err := tx.Omit(clause.Associations).Save(batch).Error; err != nil {
+			return err
+		}
+		err = tx.Model(&models.Reimbursement{}).Where("batch_id = ?", batch.ID).
+			Updates(map[string]interface{}{"status": models.ReimbursementStatusOwed, "batch_id": nil}).Error
+		if err != nil {
+			return err
+		}
+		return recordAudit(tx, "reimbursement_batch.cancel", "reimbursement_batch", batch.ID, userID, batch.Reference)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetBatch(id)
+}
+
+func openBatch(tx *gorm.DB, id uint) (*models.ReimbursementBatch, error) {
+	var batch models.ReimbursementBatch
+	if err := tx.First(&batch, id).Error; err != nil {
+		return nil, err
+	}
+	if batch.Status != models.BatchStatusOpen {
+		return nil, errors.New("batch is not open")
+	}
+	return &batch, nil
+}
+
+// accrueReimbursement records what the company owes, in the base currency,
+// for an approved out-of-pocket expense, less what vendors have already
+// refunded. It is a no-op for other expenses, fully refunded ones and
+// expenses that already accrued.
+func accrueReimbursement(tx *gorm.DB, expense *models.Expense) error {
+	if expense.PettyCashTransactionID != nil || expense.Status != models.ExpenseStatusApproved {
+		return nil
+	}
+	refunded, err := refundedBaseAmount(tx, expense.ID)
+	if err != nil {
+		return err
+	}
+	amount := roundAmount(expense.BaseAmount - refunded)
+	if amount <= 0 {
+		return nil
+	}
+	var accrued int64
+	err = tx.Model(&models.Reimbursement{}).Where("expense_id = ? AND refund_id IS NULL", expense.ID).Count(&accrued).Error
+	if err != nil || accrued > 0 {
+		return err
+	}
+	return tx.Create(&models.Reimbursement{
+		ExpenseID: expense.ID,
+		UserID:    expense.UserID,
+		Amount:    amount,
+		Status:    models.ReimbursementStatusOwed,
+	}).Error
+}
+
+// cancelReimbursement withdraws what is owed for an expense that turned out
+// not to be reimbursable. Reimbursements already in a batch must be released
+// by cancelling the batch first.
+func cancelReimbursement(tx *gorm.DB, expenseID uint) error {
+	var reimbursement models.Reimbursement
+	err := tx.Where("expense_id = ? AND refund_id IS NULL", expenseID).Limit(1).Find(&reimbursement).Error
+	if err != nil || reimbursement.ID == 0 {
+		return err
+	}
+	if reimbursement.Status != models.ReimbursementStatusOwed {
+		return fmt.Errorf("expense reimbursement is already %s", reimbursement.Status)
+	}
+	return tx.Delete(&reimbursement).Error
+}
+
+// reduceReimbursement takes a refund off what is owed for an out-of-pocket
+// expense, withdrawing the reimbursement once nothing is left. Expenses that
+// have not accrued yet accrue net of the refund. If the reimbursement is
+// already batched or paid, the employee owes the refund back: it is booked
+// as a negative owed line that nets against their next batch.
+func reduceReimbursement(tx *gorm.DB, refund *models.Refund) error {
+	var reimbursement models.Reimbursement
+	err := tx.Where("expense_id = ? AND refund_id IS NULL", refund.ExpenseID).Limit(1).Find(&reimbursement).Error
+	if err != nil || reimbursement.ID == 0 {
+		return err
+	}
+	if reimbursement.Status != models.ReimbursementStatusOwed {
+		return tx.Create(&models.Reimbursement{
+			ExpenseID: refund.ExpenseID,
+			RefundID:  &refund.ID,
+			UserID:    reimbursement.UserID,
+			Amount:    -refund.BaseAmount,
+			Status:    models.ReimbursementStatusOwed,
+		}).Error
+	}
+	reimbursement.Amount = roundAmount(reimbursement.Amount - refund.BaseAmount)
+	if reimbursement.Amount <= 0 {
+		return tx.Delete(&reimbursement).Error
+	}
+	return tx.Model(&reimbursement).Update("amount", reimbursement.Amount).Error
+}
+
+// payee is the total a batch pays one employee.
+type payee struct {
+	UserID string
+	Amount float64
+}
+
+func batchPayees(tx *gorm.DB, batchID uint) ([]payee, error) {
+	var payees []payee
+	err := tx.Model(&models.Reimbursement{}).
+		Select("user_id, sum(amount) AS amount").
+		Where("batch_id = ?", batchID).
+		Group("user_id").
+		Order("user_id").
+		Scan(&payees).Error
+	for i := range payees {
+		payees[i].Amount = roundAmount(payees[i].Amount)
+	}
+	return payees, err
+}
+
+// validIBAN checks an IBAN's format and mod-97 check digits.
+func validIBAN(iban string) bool {
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+	rearranged := iban[4:] + iban[:4]
+	var digits strings.Builder
+	for _, r := range rearranged {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r >= 'A' && r <= 'Z':
+			fmt.Fprintf(&digits, "%d", r-'A'+10)
+		default:
+			return false
+		}
+	}
+	n, ok := new(big.Int).SetString(digits.String(), 10)
+	return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
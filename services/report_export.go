@@ -0,0 +1,339 @@
+package services
+
+import (
+	"fmt"
+	"ledgerly/db"
+	"ledgerly/models"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// ExportTransactions streams the petty cash transactions matching filter as
+// a CSV, XLSX or PDF table, followed by the credits, debits and net movement
+// in the fund's currency, or the base currency for all funds.
+func (s *PettyCashService) ExportTransactions(filter TransactionFilter, format string) (*ExportStream, error) {
+	title := "Petty cash transactions, all funds"
+	currency := models.BaseCurrency()
+	if filter.FundID != 0 {
+		var fund models.Fund
+		if err := db.DB.First(&fund, filter.FundID).Error; err != nil {
+			return nil, err
+		}
+		title = "Petty cash transactions, " + fund.Name
+		currency = fund.Currency
+	}
+
+	table := exportTable{
+		Title:  title,
+		Period: periodLabel(filter.Dates),
+		Columns: []exportColumn{
+			{Name: "Date", Kind: columnDate, Width: 11},
+			{Name: "ID", Kind: columnNumber, Width: 6},
+			{Name: "Fund", Kind: columnText, Width: 14},
+			{Name: "Type", Kind: columnText, Width: 7},
+			{Name: "Description", Kind: columnText, Width: 36},
+			{Name: "User", Kind: columnText, Width: 12},
+			{Name: "Amount", Kind: columnAmount, Width: 12},
+			{Name: "Currency", Kind: columnText, Width: 8},
+			{Name: "Base amount", Kind: columnAmount, Width: 12},
+		},
+	}
+	return tableStream("transactions", filter.Dates, format, table, func(t tableWriter) error {
+		funds, err := fundNames()
+		if err != nil {
+			return err
+		}
+		users, err := usernames()
+		if err != nil {
+			return err
+		}
+
+		rows, err := filter.query(db.DB).Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var credits, debits float64
+		for rows.Next() {
+			var tx models.PettyCashTransaction
+			if err := db.DB.ScanRows(rows, &tx); err != nil {
+				return err
+			}
+			if tx.Type == models.TransactionTypeCredit {
+				credits += fundAmount(tx, filter.FundID)
+			} else {
+				debits += fundAmount(tx, filter.FundID)
+			}
+			err := t.WriteRow(tx.TransactionDate, int(tx.ID), funds[tx.FundID], string(tx.Type), tx.Description,
+				users(tx.UserID), tx.Amount, tx.Currency, tx.BaseAmount)
+			if err != nil {
+				return err
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// Totals go in the column of the currency they are in
+		total := func(label string, amount float64) error {
+			cells := []interface{}{nil, nil, nil, nil, label, nil, nil, currency, roundAmount(amount)}
+			if filter.FundID != 0 {
+				cells[6], cells[8] = roundAmount(amount), nil
+			}
+			return t.WriteTotal(cells...)
+		}
+		if err := total("Total credits", credits); err != nil {
+			return err
+		}
+		if err := total("Total debits", debits); err != nil {
+			return err
+		}
+		return total("Net movement", credits-debits)
+	})
+}
+
+// ExportExpenses streams the expenses matching filter as a CSV, XLSX or PDF
+// table, followed by their total in the base currency.
+func (s *ExpenseService) ExportExpenses(filter ExpenseFilter, format string) (*ExportStream, error) {
+	title := "Expenses"
+	if filter.Status != "" {
+		title += ", " + string(filter.Status)
+	}
+	if filter.WithViolations {
+		title += ", with policy violations"
+	}
+
+	table := exportTable{
+		Title:  title,
+		Period: periodLabel(filter.Dates),
+		Columns: []exportColumn{
+			{Name: "Date", Kind: columnDate, Width: 11},
+			{Name: "ID", Kind: columnNumber, Width: 6},
+			{Name: "Title", Kind: columnText, Width: 26},
+			{Name: "Category", Kind: columnText, Width: 14},
+			{Name: "User", Kind: columnText, Width: 11},
+			{Name: "Status", Kind: columnText, Width: 13},
+			{Name: "Vendor", Kind: columnText, Width: 14},
+			{Name: "Amount", Kind: columnAmount, Width: 11},
+			{Name: "Currency", Kind: columnText, Width: 8},
+			{Name: "Tax", Kind: columnAmount, Width: 9},
+			{Name: "Refunded", Kind: columnAmount, Width: 10},
+			{Name: "Base amount", Kind: columnAmount, Width: 12},
+		},
+	}
+	return tableStream("expenses", filter.Dates, format, table, func(t tableWriter) error {
+		users, err := usernames()
+		if err != nil {
+			return err
+		}
+
+		rows, err := filter.query(db.DB).Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		count := 0
+		var total float64
+		for rows.Next() {
+			var e models.Expense
+			if err := db.DB.ScanRows(rows, &e); err != nil {
+				return err
+			}
+			count++
+			total += e.BaseAmount
+			err := t.WriteRow(e.ExpenseDate, int(e.ID), e.Title, e.Category, users(e.UserID), string(e.Status), e.Vendor,
+				e.Amount, e.Currency, e.TaxAmount, e.RefundedAmount, e.BaseAmount)
+			if err != nil {
+				return err
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return t.WriteTotal(nil, nil, "Total, "+countLabel(count, "expense"), nil, nil, nil, nil, nil,
+			models.BaseCurrency(), nil, nil, roundAmount(total))
+	})
+}
+
+// ExportExpenseSummary renders an expense summary as a CSV, XLSX or PDF
+// table: the totals by category, user, fund and dimension, then the time
+// series per bucket and group, with the comparison alongside when there is
+// one.
+func (s *ReportingService) ExportExpenseSummary(q ExpenseSummaryQuery, format string) (*ExportStream, error) {
+	if err := checkExportFormat(format); err != nil {
+		return nil, err
+	}
+	summary, err := s.GetExpenseSummary(q)
+	if err != nil {
+		return nil, err
+	}
+	users, err := usernames()
+	if err != nil {
+		return nil, err
+	}
+
+	table := exportTable{
+		Title:  "Expense summary in " + summary.Currency,
+		Period: periodLabel(q.Dates),
+		Columns: []exportColumn{
+			{Name: "Breakdown", Kind: columnText, Width: 14},
+			{Name: "Name", Kind: columnText, Width: 30},
+			{Name: "Total", Kind: columnAmount, Width: 14},
+		},
+	}
+	if summary.Comparison != nil {
+		table.Title += ", compared with the " + map[string]string{
+			ComparePreviousPeriod: "previous period",
+			ComparePreviousYear:   "previous year",
+		}[summary.Comparison.Basis]
+		table.Columns = append(table.Columns,
+			exportColumn{Name: "Previous", Kind: columnAmount, Width: 14},
+			exportColumn{Name: "Change", Kind: columnAmount, Width: 14},
+			exportColumn{Name: "Change %", Kind: columnNumber, Width: 10},
+		)
+	}
+
+	name := func(key string) string { return key }
+	groupName := name
+	if q.GroupBy == GroupByUser {
+		groupName = users
+	}
+
+	return tableStream("expense-summary", q.Dates, format, table, func(t tableWriter) error {
+		// Comparisons also list what was only spent on in the earlier range
+		section := func(label string, totals map[string]float64, changes map[string]Change, name func(string) string) error {
+			keys := slices.Sorted(maps.Keys(totals))
+			if summary.Comparison != nil {
+				keys = slices.Sorted(maps.Keys(changes))
+			}
+			for _, key := range keys {
+				cells := []interface{}{label, name(key), totals[key]}
+				if summary.Comparison != nil {
+					cells = append(cells, changeCells(changes[key])...)
+				}
+				if err := t.WriteRow(cells...); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		var comparison ExpenseComparison
+		if summary.Comparison != nil {
+			comparison = *summary.Comparison
+		}
+		if err := section("Category", summary.ByCategory, comparison.ByCategory, name); err != nil {
+			return err
+		}
+		if err := section("User", summary.ByUser, comparison.ByUser, users); err != nil {
+			return err
+		}
+		if err := section("Fund", summary.ByFund, comparison.ByFund, name); err != nil {
+			return err
+		}
+		if summary.ByDimension != nil {
+			if err := section(summary.Dimension, summary.ByDimension, comparison.ByDimension, name); err != nil {
+				return err
+			}
+		}
+		for _, bucket := range summary.Series {
+			if err := t.WriteRow(bucket.Label, "All", bucket.Total); err != nil {
+				return err
+			}
+			for _, key := range slices.Sorted(maps.Keys(bucket.Groups)) {
+				if err := t.WriteRow(bucket.Label, groupName(key), bucket.Groups[key]); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := t.WriteTotal("Refunds", "Deducted from the totals", summary.TotalRefunds); err != nil {
+			return err
+		}
+		cells := []interface{}{"Total", countLabel(summary.Count, "expense"), summary.TotalExpenses}
+		if summary.Comparison != nil {
+			cells = append(cells, changeCells(summary.Comparison.Total)...)
+		}
+		return t.WriteTotal(cells...)
+	})
+}
+
+// ExportPettyCashSummary renders a petty cash summary as a CSV, XLSX or PDF
+// table.
+func (s *ReportingService) ExportPettyCashSummary(fundID uint, format string) (*ExportStream, error) {
+	if err := checkExportFormat(format); err != nil {
+		return nil, err
+	}
+	summary, err := s.GetPettyCashSummary(fundID)
+	if err != nil {
+		return nil, err
+	}
+	title := "Petty cash summary, all funds"
+	if fundID != 0 {
+		var fund models.Fund
+		if err := db.DB.First(&fund, fundID).Error; err != nil {
+			return nil, err
+		}
+		title = "Petty cash summary, " + fund.Name
+	}
+
+	table := exportTable{
+		Title:  title,
+		Period: "Up to " + time.Now().UTC().Format("2006-01-02"),
+		Columns: []exportColumn{
+			{Name: "Item", Kind: columnText, Width: 30},
+			{Name: "Amount", Kind: columnAmount, Width: 14},
+			{Name: "Currency", Kind: columnText, Width: 8},
+		},
+	}
+	return tableStream("petty-cash-summary", DateRange{}, format, table, func(t tableWriter) error {
+		if err := t.WriteRow("Credits", roundAmount(summary.TotalCredits), summary.Currency); err != nil {
+			return err
+		}
+		if err := t.WriteRow("Debits", roundAmount(summary.TotalDebits), summary.Currency); err != nil {
+			return err
+		}
+		return t.WriteTotal("Balance", roundAmount(summary.Balance), summary.Currency)
+	})
+}
+
+// countLabel counts things, such as "1 expense" or "3 expenses".
+func countLabel(n int, noun string) string {
+	if n != 1 {
+		noun += "s"
+	}
+	return fmt.Sprintf("%d %s", n, noun)
+}
+
+// changeCells are the previous, change and change % cells of a comparison.
+func changeCells(c Change) []interface{} {
+	cells := []interface{}{c.Previous, c.Change, nil}
+	if c.ChangePercent != nil {
+		cells[2] = *c.ChangePercent
+	}
+	return cells
+}
+
+// usernames returns a lookup from user IDs, in the string form the models
+// store them in, to usernames, including deleted users. Unknown IDs are
+// shown as they are.
+func usernames() (func(userID string) string, error) {
+	var users []models.User
+	if err := db.DB.Unscoped().Find(&users).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(users))
+	for _, u := range users {
+		names[strconv.FormatUint(uint64(u.ID), 10)] = u.Username
+	}
+	return func(userID string) string {
+		if name, ok := names[userID]; ok {
+			return name
+		}
+		return userID
+	}, nil
+}
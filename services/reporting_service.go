@@ -1,66 +1,1095 @@
 package services
 
 import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
 	"ledgerly/db"
 	"ledgerly/models"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
 )
 
 type ReportingService struct{}
 
+// Expense summary breakdowns and comparison bases.
+const (
+	GroupByCategory = "category"
+	GroupByUser     = "user"
+	GroupByFund     = "fund"
+
+	ComparePreviousPeriod = "previous_period"
+	ComparePreviousYear   = "previous_year"
+)
+
+// OutOfPocketFund is the fund key for expenses not paid from petty cash.
+const OutOfPocketFund = "out_of_pocket"
+
+// ExpenseSummaryQuery selects and shapes an expense summary. Interval enables
+// the time series, GroupBy picks the breakdown inside each bucket (category
+// by default, or a dimension code) and Location is the timezone buckets are
+// cut in (UTC by default). An empty Currency totals every expense in the base
+// currency; otherwise only expenses in Currency are totalled, in their
+// original amounts. Tags only keeps expenses tagged with every given value.
+type ExpenseSummaryQuery struct {
+	Dates    DateRange
+	Interval string
+	GroupBy  string
+	Location *time.Location
+	Compare  string
+	Currency string
+	Tags     models.Tags
+}
+
+// Validate checks the query options before any data is read.
+func (q ExpenseSummaryQuery) Validate() error {
+	if q.Interval != "" && !ValidInterval(q.Interval) {
+		return errors.New("interval must be day, week, month or quarter")
+	}
+	switch q.GroupBy {
+	case "", GroupByCategory, GroupByUser, GroupByFund:
+	default:
+		if !dimensionCodePattern.MatchString(q.GroupBy) {
+			return errors.New("group_by must be category, user, fund or a dimension code")
+		}
+	}
+	switch q.Compare {
+	case "":
+	case ComparePreviousPeriod, ComparePreviousYear:
+		if q.Dates.From.IsZero() || q.Dates.To.IsZero() {
+			return errors.New("comparison requires both from and to")
+		}
+	default:
+		return errors.New("compare must be previous_period or previous_year")
+	}
+	if q.Currency != "" && !currencyPattern.MatchString(q.Currency) {
+		return errors.New("currency must be a three-letter ISO 4217 code")
+	}
+	return nil
+}
+
+// ExpenseSummary totals expenses net of refunds: refunds dated within the
+// range are taken off the totals and are also reported on their own.
 type ExpenseSummary struct {
+	From          *time.Time         `json:"from,omitempty"`
+	To            *time.Time         `json:"to,omitempty"`
+	Currency      string             `json:"currency"`
 	TotalExpenses float64            `json:"total_expenses"`
+	TotalRefunds  float64            `json:"total_refunds"`
+	Count         int                `json:"count"`
 	ByCategory    map[string]float64 `json:"by_category"`
+	ByUser        map[string]float64 `json:"by_user"`
+	ByFund        map[string]float64 `json:"by_fund"`
+	Dimension     string             `json:"dimension,omitempty"`
+	ByDimension   map[string]float64 `json:"by_dimension,omitempty"`
+	Series        []ExpenseBucket    `json:"series,omitempty"`
+	Comparison    *ExpenseComparison `json:"comparison,omitempty"`
+}
+
+// ExpenseBucket is one interval of the expense time series. End is
+// exclusive.
+type ExpenseBucket struct {
+	Label  string             `json:"label"`
+	Start  time.Time          `json:"start"`
+	End    time.Time          `json:"end"`
+	Total  float64            `json:"total"`
+	Count  int                `json:"count"`
+	Groups map[string]float64 `json:"groups"`
+}
+
+// Change compares an amount with its value in the comparison range.
+// ChangePercent is null when there is nothing to compare against.
+type Change struct {
+	Current       float64  `json:"current"`
+	Previous      float64  `json:"previous"`
+	Change        float64  `json:"change"`
+	ChangePercent *float64 `json:"change_percent"`
+}
+
+type ExpenseComparison struct {
+	Basis       string            `json:"basis"`
+	From        time.Time         `json:"from"`
+	To          time.Time         `json:"to"`
+	Total       Change            `json:"total"`
+	ByCategory  map[string]Change `json:"by_category"`
+	ByUser      map[string]Change `json:"by_user"`
+	ByFund      map[string]Change `json:"by_fund"`
+	ByDimension map[string]Change `json:"by_dimension,omitempty"`
+}
+
+type FundReconciliationSummary struct {
+	FundID        uint       `json:"fund_id"`
+	FundName      string     `json:"fund_name"`
+	Count         int        `json:"count"`
+	TotalOver     float64    `json:"total_over"`
+	TotalShort    float64    `json:"total_short"`
+	NetVariance   float64    `json:"net_variance"`
+	LastCountedAt *time.Time `json:"last_counted_at"`
+}
+
+type ReconciliationReport struct {
+	Count           int                         `json:"count"`
+	Approved        int                         `json:"approved"`
+	Pending         int                         `json:"pending"`
+	Rejected        int                         `json:"rejected"`
+	TotalOver       float64                     `json:"total_over"`
+	TotalShort      float64                     `json:"total_short"`
+	NetVariance     float64                     `json:"net_variance"`
+	ByFund          []FundReconciliationSummary `json:"by_fund"`
+	Reconciliations []models.Reconciliation     `json:"reconciliations"`
+}
+
+// BudgetVsActual compares one budget with its spend in the period containing
+// the report date. Status is ok, warning (80% used) or exceeded (over 100%).
+type BudgetVsActual struct {
+	Budget             models.Budget `json:"budget"`
+	PeriodStart        time.Time     `json:"period_start"`
+	PeriodEnd          time.Time     `json:"period_end"`
+	Budgeted           float64       `json:"budgeted"`
+	Actual             float64       `json:"actual"`
+	Remaining          float64       `json:"remaining"`
+	UtilizationPercent float64       `json:"utilization_percent"`
+	Status             string        `json:"status"`
+}
+
+type BudgetReport struct {
+	Date          time.Time        `json:"date"`
+	TotalBudgeted float64          `json:"total_budgeted"`
+	TotalActual   float64          `json:"total_actual"`
+	Budgets       []BudgetVsActual `json:"budgets"`
+}
+
+// RuleViolationSummary totals the violations of one policy rule.
+type RuleViolationSummary struct {
+	RuleID    uint                  `json:"rule_id"`
+	RuleName  string                `json:"rule_name"`
+	Severity  models.PolicySeverity `json:"severity"`
+	Count     int                   `json:"count"`
+	Amount    float64               `json:"amount"`
+	Justified int                   `json:"justified"`
+}
+
+// PolicyViolationReport summarises the policy violations of submitted
+// expenses. FlaggedAmount counts each flagged expense once.
+type PolicyViolationReport struct {
+	From            *time.Time             `json:"from,omitempty"`
+	To              *time.Time             `json:"to,omitempty"`
+	Violations      int                    `json:"violations"`
+	FlaggedExpenses int                    `json:"flagged_expenses"`
+	FlaggedAmount   float64                `json:"flagged_amount"`
+	ByRule          []RuleViolationSummary `json:"by_rule"`
+	ByUser          map[string]int         `json:"by_user"`
+}
+
+// AgeingBucket totals outstanding advances by how long they are overdue.
+type AgeingBucket struct {
+	Label       string  `json:"label"`
+	Count       int     `json:"count"`
+	Outstanding float64 `json:"outstanding"`
+}
+
+// OutstandingAdvance is an advance with what is left of it and how many days
+// past its due date it is on the report date. BaseOutstanding converts
+// Outstanding at the rate the advance was issued at.
+type OutstandingAdvance struct {
+	models.CashAdvance
+	BaseOutstanding float64 `json:"base_outstanding"`
+	DaysOverdue     int     `json:"days_overdue"`
+	Bucket          string  `json:"bucket"`
+}
+
+// AdvanceAgeingReport lists the advances not yet fully liquidated, aged by
+// days overdue: current, 1-30, 31-60, 61-90 and over 90. Totals are in the
+// base currency.
+type AdvanceAgeingReport struct {
+	Date             time.Time            `json:"date"`
+	TotalOutstanding float64              `json:"total_outstanding"`
+	Buckets          []AgeingBucket       `json:"buckets"`
+	ByUser           map[string]float64   `json:"by_user"`
+	Advances         []OutstandingAdvance `json:"advances"`
 }
 
 type PettyCashSummary struct {
+	Currency     string  `json:"currency"`
 	TotalCredits float64 `json:"total_credits"`
 	TotalDebits  float64 `json:"total_debits"`
 	Balance      float64 `json:"balance"`
 }
 
-func (s *ReportingService) GetExpenseSummary() (*ExpenseSummary, error) {
-	var total float64
-	if err := db.DB.Model(&models.Expense{}).Select("coalesce(sum(amount), 0)").Scan(&total).Error; err != nil {
+// GetExpenseSummary totals expenses whose expense date falls within
+// q.Dates, optionally bucketed over time and compared with an earlier range.
+// Grouping by a dimension also totals the expenses per value of it.
+func (s *ReportingService) GetExpenseSummary(q ExpenseSummaryQuery) (*ExpenseSummary, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	if q.Location == nil {
+		q.Location = time.UTC
+	}
+	if q.GroupBy == "" {
+		q.GroupBy = GroupByCategory
+	}
+	dimensions := make([]string, 0, len(q.Tags)+1)
+	for code := range q.Tags {
+		dimensions = append(dimensions, code)
+	}
+	if q.GroupBy != GroupByCategory && q.GroupBy != GroupByUser && q.GroupBy != GroupByFund {
+		dimensions = append(dimensions, q.GroupBy)
+	}
+	if _, err := normalizeDimensionCodes(db.DB, dimensions); err != nil {
+		return nil, err
+	}
+
+	names, err := fundNames()
+	if err != nil {
 		return nil, err
 	}
 
-	rows, err := db.DB.Model(&models.Expense{}).Select("category, sum(amount)").Group("category").Rows()
+	summary, err := summarizeExpenses(q, names)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	byCategory := make(map[string]float64)
-	for rows.Next() {
-		var category string
-		var amount float64
-		if err := rows.Scan(&category, &amount); err != nil {
+	if q.Compare != "" {
+		previousQuery := q
+		previousQuery.Dates = previousRange(q.Dates, q.Compare, q.Location)
+		previousQuery.Interval = ""
+		previous, err := summarizeExpenses(previousQuery, names)
+		if err != nil {
 			return nil, err
 		}
-		byCategory[category] = amount
+		summary.Comparison = &ExpenseComparison{
+			Basis:      q.Compare,
+			From:       previousQuery.Dates.From,
+			To:         previousQuery.Dates.To,
+			Total:      newChange(summary.TotalExpenses, previous.TotalExpenses),
+			ByCategory: compareTotals(summary.ByCategory, previous.ByCategory),
+			ByUser:     compareTotals(summary.ByUser, previous.ByUser),
+			ByFund:     compareTotals(summary.ByFund, previous.ByFund),
+		}
+		if summary.ByDimension != nil {
+			summary.Comparison.ByDimension = compareTotals(summary.ByDimension, previous.ByDimension)
+		}
 	}
+	return summary, nil
+}
 
-	return &ExpenseSummary{
-		TotalExpenses: total,
-		ByCategory:    byCategory,
-	}, nil
+func summarizeExpenses(q ExpenseSummaryQuery, fundNames map[uint]string) (*ExpenseSummary, error) {
+	summary := &ExpenseSummary{
+		Currency:   q.Currency,
+		ByCategory: make(map[string]float64),
+		ByUser:     make(map[string]float64),
+		ByFund:     make(map[string]float64),
+	}
+	if !q.Dates.From.IsZero() {
+		from := q.Dates.From
+		summary.From = &from
+	}
+	if !q.Dates.To.IsZero() {
+		to := q.Dates.To
+		summary.To = &to
+	}
+	if summary.Currency == "" {
+		summary.Currency = models.BaseCurrency()
+	}
+	if q.GroupBy != GroupByCategory && q.GroupBy != GroupByUser && q.GroupBy != GroupByFund {
+		summary.Dimension = q.GroupBy
+		summary.ByDimension = make(map[string]float64)
+	}
+
+	buckets := make(map[time.Time]*ExpenseBucket)
+	// Splits of one expense are separate lines but count as one expense
+	counted := make(map[uint]bool)
+	err := eachExpenseLine(q.Dates, func(line expenseLine) error {
+		amount := line.Amount
+		if q.Currency != "" {
+			if line.Currency != q.Currency {
+				return nil
+			}
+			amount = line.OriginalAmount
+		}
+		for code, value := range q.Tags {
+			if line.Tags[code] != value {
+				return nil
+			}
+		}
+
+		fund := OutOfPocketFund
+		if line.FundID != nil {
+			fund = fundNames[*line.FundID]
+		}
+		keys := map[string]string{
+			GroupByCategory: line.Category,
+			GroupByUser:     line.UserID,
+			GroupByFund:     fund,
+		}
+		if summary.ByDimension != nil {
+			keys[q.GroupBy] = UntaggedDimension
+			if value := line.Tags[q.GroupBy]; value != "" {
+				keys[q.GroupBy] = value
+			}
+			summary.ByDimension[keys[q.GroupBy]] += amount
+		}
+
+		first := !line.Refund && !counted[line.ExpenseID]
+		if line.Refund {
+			summary.TotalRefunds -= amount
+		} else {
+			counted[line.ExpenseID] = true
+		}
+		summary.TotalExpenses += amount
+		if first {
+			summary.Count++
+		}
+		summary.ByCategory[keys[GroupByCategory]] += amount
+		summary.ByUser[keys[GroupByUser]] += amount
+		summary.ByFund[keys[GroupByFund]] += amount
+
+		if q.Interval != "" {
+			start := bucketStart(line.Date, q.Interval, q.Location)
+			bucket, ok := buckets[start]
+			if !ok {
+				bucket = newExpenseBucket(start, q.Interval)
+				buckets[start] = bucket
+			}
+			bucket.Total += amount
+			if first {
+				bucket.Count++
+			}
+			bucket.Groups[keys[q.GroupBy]] += amount
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	summary.TotalExpenses = roundAmount(summary.TotalExpenses)
+	summary.TotalRefunds = roundAmount(summary.TotalRefunds)
+	roundTotals(summary.ByCategory)
+	roundTotals(summary.ByUser)
+	roundTotals(summary.ByFund)
+	roundTotals(summary.ByDimension)
+	for _, bucket := range buckets {
+		bucket.Total = roundAmount(bucket.Total)
+		roundTotals(bucket.Groups)
+	}
+
+	if q.Interval != "" {
+		// Fill empty buckets so the series has no gaps within the range
+		if !q.Dates.From.IsZero() && !q.Dates.To.IsZero() {
+			for start := bucketStart(q.Dates.From, q.Interval, q.Location); start.Before(q.Dates.To); start = nextBucket(start, q.Interval) {
+				if _, ok := buckets[start]; !ok {
+					buckets[start] = newExpenseBucket(start, q.Interval)
+				}
+			}
+		}
+		summary.Series = make([]ExpenseBucket, 0, len(buckets))
+		for _, bucket := range buckets {
+			summary.Series = append(summary.Series, *bucket)
+		}
+		sort.Slice(summary.Series, func(i, j int) bool {
+			return summary.Series[i].Start.Before(summary.Series[j].Start)
+		})
+	}
+	return summary, nil
+}
+
+func roundTotals(totals map[string]float64) {
+	for key, amount := range totals {
+		totals[key] = roundAmount(amount)
+	}
+}
+
+func newExpenseBucket(start time.Time, interval string) *ExpenseBucket {
+	return &ExpenseBucket{
+		Label:  bucketLabel(start, interval),
+		Start:  start,
+		End:    nextBucket(start, interval),
+		Groups: make(map[string]float64),
+	}
+}
+
+// previousRange returns the range to compare r against. Ranges made of whole
+// months are shifted by calendar months so that, for example, March is
+// compared with February rather than with the 31 days before it.
+func previousRange(r DateRange, basis string, loc *time.Location) DateRange {
+	if basis == ComparePreviousYear {
+		return DateRange{From: r.From.AddDate(-1, 0, 0), To: r.To.AddDate(-1, 0, 0)}
+	}
+
+	from, to := r.From.In(loc), r.To.In(loc)
+	if isMonthStart(from) && isMonthStart(to) {
+		months := (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month())
+		return DateRange{From: from.AddDate(0, -months, 0), To: from}
+	}
+	return DateRange{From: r.From.Add(-r.To.Sub(r.From)), To: r.From}
+}
+
+func isMonthStart(t time.Time) bool {
+	return t.Day() == 1 && t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0
+}
+
+func newChange(current, previous float64) Change {
+	change := Change{
+		Current:  roundAmount(current),
+		Previous: roundAmount(previous),
+		Change:   roundAmount(current - previous),
+	}
+	if previous != 0 {
+		percent := roundAmount((current - previous) / previous * 100)
+		change.ChangePercent = &percent
+	}
+	return change
+}
+
+func compareTotals(current, previous map[string]float64) map[string]Change {
+	changes := make(map[string]Change, len(current))
+	for key, amount := range current {
+		changes[key] = newChange(amount, previous[key])
+	}
+	for key, amount := range previous {
+		if _, ok := current[key]; !ok {
+			changes[key] = newChange(0, amount)
+		}
+	}
+	return changes
+}
+
+// fundNames maps fund IDs to names, including deactivated funds.
+func fundNames() (map[uint]string, error) {
+	var funds []models.Fund
+	if err := db.DB.Unscoped().Find(&funds).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string, len(funds))
+	for _, f := range funds {
+		names[f.ID] = f.Name
+	}
+	return names, nil
 }
 
-func (s *ReportingService) GetPettyCashSummary() (*PettyCashSummary, error) {
+// GetPettyCashSummary totals one fund in its currency, or all funds in the
+// base currency when fundID is 0.
+func (s *ReportingService) GetPettyCashSummary(fundID uint) (*PettyCashSummary, error) {
 	var credits float64
 	var debits float64
 
-	if err := db.DB.Model(&models.PettyCashTransaction{}).Where("type = ?", "credit").Select("coalesce(sum(amount), 0)").Scan(&credits).Error; err != nil {
+	currency := models.BaseCurrency()
+	if fundID != 0 {
+		var fund models.Fund
+		if err := db.DB.First(&fund, fundID).Error; err != nil {
+			return nil, err
+		}
+		currency = fund.Currency
+	}
+	column := fundAmountColumn(fundID)
+
+	query := func() *gorm.DB {
+		q := db.DB.Model(&models.PettyCashTransaction{})
+		if fundID != 0 {
+			q = q.Where("fund_id = ?", fundID)
+		}
+		return q
+	}
+
+	if err := query().Where("type = ?", "credit").Select("coalesce(sum(" + column + "), 0)").Scan(&credits).Error; err != nil {
 		return nil, err
 	}
 
-	if err := db.DB.Model(&models.PettyCashTransaction{}).Where("type = ?", "debit").Select("coalesce(sum(amount), 0)").Scan(&debits).Error; err != nil {
+	if err := query().Where("type = ?", "debit").Select("coalesce(sum(" + column + "), 0)").Scan(&debits).Error; err != nil {
 		return nil, err
 	}
 
 	return &PettyCashSummary{
+		Currency:     currency,
 		TotalCredits: credits,
 		TotalDebits:  debits,
 		Balance:      credits - debits,
 	}, nil
 }
+
+// GetReconciliationReport summarises cash counts matching filter. Over and
+// short totals only include approved counts, since only those are posted.
+func (s *ReportingService) GetReconciliationReport(filter ReconciliationFilter) (*ReconciliationReport, error) {
+	recs, err := (&ReconciliationService{}).ListReconciliations(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := fundNames()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReconciliationReport{ByFund: []FundReconciliationSummary{}, Reconciliations: recs}
+	byFund := make(map[uint]int)
+	for _, rec := range recs {
+		i, ok := byFund[rec.FundID]
+		if !ok {
+			report.ByFund = append(report.ByFund, FundReconciliationSummary{FundID: rec.FundID, FundName: names[rec.FundID]})
+			i = len(report.ByFund) - 1
+			byFund[rec.FundID] = i
+		}
+		summary := &report.ByFund[i]
+		summary.Count++
+		report.Count++
+		if summary.LastCountedAt == nil || rec.CountedAt.After(*summary.LastCountedAt) {
+			countedAt := rec.CountedAt
+			summary.LastCountedAt = &countedAt
+		}
+
+		switch rec.Status {
+		case models.ReconciliationStatusPending:
+			report.Pending++
+		case models.ReconciliationStatusRejected:
+			report.Rejected++
+		case models.ReconciliationStatusApproved:
+			report.Approved++
+			if rec.Variance > 0 {
+				summary.TotalOver = roundAmount(summary.TotalOver + rec.Variance)
+				report.TotalOver = roundAmount(report.TotalOver + rec.Variance)
+			} else {
+				summary.TotalShort = roundAmount(summary.TotalShort - rec.Variance)
+				report.TotalShort = roundAmount(report.TotalShort - rec.Variance)
+			}
+			summary.NetVariance = roundAmount(summary.NetVariance + rec.Variance)
+			report.NetVariance = roundAmount(report.NetVariance + rec.Variance)
+		}
+	}
+	return report, nil
+}
+
+// GetBudgetVsActual reports every budget in force at date against the spend
+// in its period containing date.
+func (s *ReportingService) GetBudgetVsActual(date time.Time) (*BudgetReport, error) {
+	date = date.UTC()
+	var budgets []models.Budget
+	err := db.DB.Where("active = ? AND start_date <= ?", true, date).
+		Where("end_date IS NULL OR end_date > ?", date).
+		Order("category, id").
+		Find(&budgets).Error
+	if err != nil {
+		return nil, err
+	}
+
+	report := &BudgetReport{Date: date, Budgets: make([]BudgetVsActual, 0, len(budgets))}
+	for _, budget := range budgets {
+		start, end := budgetPeriodRange(budget.Period, date)
+		actual, err := budgetActual(db.DB, budget, start, end)
+		if err != nil {
+			return nil, err
+		}
+		actual = roundAmount(actual)
+
+		line := BudgetVsActual{
+			Budget:             budget,
+			PeriodStart:        start,
+			PeriodEnd:          end,
+			Budgeted:           budget.Amount,
+			Actual:             actual,
+			Remaining:          roundAmount(budget.Amount - actual),
+			UtilizationPercent: roundAmount(actual / budget.Amount * 100),
+			Status:             "ok",
+		}
+		switch {
+		case actual > budget.Amount:
+			line.Status = "exceeded"
+		case line.UtilizationPercent >= float64(budgetAlertThresholds[0]):
+			line.Status = "warning"
+		}
+		report.Budgets = append(report.Budgets, line)
+		report.TotalBudgeted = roundAmount(report.TotalBudgeted + budget.Amount)
+		report.TotalActual = roundAmount(report.TotalActual + actual)
+	}
+	return report, nil
+}
+
+// GetPolicyViolationReport summarises the policy violations of submitted
+// expenses dated within dates.
+func (s *ReportingService) GetPolicyViolationReport(dates DateRange) (*PolicyViolationReport, error) {
+	var rows []struct {
+		models.PolicyViolation
+		Amount float64
+		UserID string
+	}
+	query := db.DB.Table("policy_violations").
+		Select("policy_violations.*, expenses.base_amount AS amount, expenses.user_id").
+		Joins("JOIN expenses ON expenses.id = policy_violations.expense_id").
+		Where("expenses.deleted_at IS NULL AND expenses.status <> ?", models.ExpenseStatusDraft).
+		Order("policy_violations.rule_id")
+	if err := dates.apply(query, "expenses.expense_date").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	report := &PolicyViolationReport{ByRule: []RuleViolationSummary{}, ByUser: make(map[string]int)}
+	if !dates.From.IsZero() {
+		report.From = &dates.From
+	}
+	if !dates.To.IsZero() {
+		report.To = &dates.To
+	}
+
+	byRule := make(map[uint]int)
+	flagged := make(map[uint]bool)
+	for _, row := range rows {
+		i, ok := byRule[row.RuleID]
+		if !ok {
+			report.ByRule = append(report.ByRule, RuleViolationSummary{RuleID: row.RuleID, RuleName: row.RuleName, Severity: row.Severity})
+			i = len(report.ByRule) - 1
+			byRule[row.RuleID] = i
+		}
+		summary := &report.ByRule[i]
+		summary.Count++
+		summary.Amount = roundAmount(summary.Amount + row.Amount)
+		if row.Justification != "" {
+			summary.Justified++
+		}
+
+		report.Violations++
+		report.ByUser[row.UserID]++
+		if !flagged[row.ExpenseID] {
+			flagged[row.ExpenseID] = true
+			report.FlaggedExpenses++
+			report.FlaggedAmount = roundAmount(report.FlaggedAmount + row.Amount)
+		}
+	}
+	return report, nil
+}
+
+// GetAdvanceAgeingReport ages the outstanding advances issued by date at
+// that date.
+func (s *ReportingService) GetAdvanceAgeingReport(date time.Time) (*AdvanceAgeingReport, error) {
+	date = date.UTC()
+	var advances []models.CashAdvance
+	err := db.DB.Preload("IssueTransaction").
+		Where("status = ? AND issued_at <= ?", models.CashAdvanceStatusOutstanding, date).
+		Order("due_date, id").
+		Find(&advances).Error
+	if err != nil {
+		return nil, err
+	}
+
+	report := &AdvanceAgeingReport{
+		Date: date,
+		Buckets: []AgeingBucket{
+			{Label: "current"}, {Label: "1-30"}, {Label: "31-60"}, {Label: "61-90"}, {Label: "90+"},
+		},
+		ByUser:   make(map[string]float64),
+		Advances: make([]OutstandingAdvance, 0, len(advances)),
+	}
+	for _, advance := range advances {
+		line := OutstandingAdvance{CashAdvance: advance, BaseOutstanding: advance.Outstanding}
+		if advance.IssueTransaction != nil {
+			line.BaseOutstanding = roundAmount(advance.Outstanding * advance.IssueTransaction.ExchangeRate)
+		}
+		if date.After(advance.DueDate) {
+			line.DaysOverdue = int(date.Sub(advance.DueDate).Hours() / 24)
+		}
+		i := 0
+		switch {
+		case line.DaysOverdue > 90:
+			i = 4
+		case line.DaysOverdue > 60:
+			i = 3
+		case line.DaysOverdue > 30:
+			i = 2
+		case line.DaysOverdue > 0:
+			i = 1
+		}
+		bucket := &report.Buckets[i]
+		line.Bucket = bucket.Label
+		bucket.Count++
+		bucket.Outstanding = roundAmount(bucket.Outstanding + line.BaseOutstanding)
+
+		report.Advances = append(report.Advances, line)
+		report.ByUser[advance.UserID] = roundAmount(report.ByUser[advance.UserID] + line.BaseOutstanding)
+		report.TotalOutstanding = roundAmount(report.TotalOutstanding + line.BaseOutstanding)
+	}
+	return report, nil
+}
+
+// TaxReportQuery selects a tax summary. Interval is month (the default) or
+// quarter.
+type TaxReportQuery struct {
+	Dates    DateRange
+	Interval string
+}
+
+// TaxRateSummary totals the expenses booked with one tax code and rate.
+type TaxRateSummary struct {
+	TaxCode string  `json:"tax_code"`
+	Rate    float64 `json:"rate"`
+	Count   int     `json:"count"`
+	Net     float64 `json:"net"`
+	Tax     float64 `json:"tax"`
+	Gross   float64 `json:"gross"`
+}
+
+// TaxPeriod is one filing period of the tax summary. End is exclusive.
+type TaxPeriod struct {
+	Label string           `json:"label"`
+	Start time.Time        `json:"start"`
+	End   time.Time        `json:"end"`
+	Rates []TaxRateSummary `json:"rates"`
+	Net   float64          `json:"net"`
+	Tax   float64          `json:"tax"`
+	Gross float64          `json:"gross"`
+}
+
+// TaxReport summarises the tax on approved expenses per period and rate, in
+// the base currency. Expenses without a tax code are listed as EXEMPT so the
+// gross totals cover all spend.
+type TaxReport struct {
+	From     *time.Time       `json:"from,omitempty"`
+	To       *time.Time       `json:"to,omitempty"`
+	Currency string           `json:"currency"`
+	Interval string           `json:"interval"`
+	Periods  []TaxPeriod      `json:"periods"`
+	Totals   []TaxRateSummary `json:"totals"`
+	Net      float64          `json:"net"`
+	Tax      float64          `json:"tax"`
+	Gross    float64          `json:"gross"`
+}
+
+// GetTaxReport totals net, tax and gross amounts of approved expenses dated
+// within q.Dates per period and tax rate, per split for split expenses. Tax
+// is converted at each expense's exchange rate and net is the remainder of
+// the base amount. Refunds dated within q.Dates are taken off the period they
+// were received in, shared between the splits and between tax and net in
+// proportion.
+func (s *ReportingService) GetTaxReport(q TaxReportQuery) (*TaxReport, error) {
+	if q.Interval == "" {
+		q.Interval = IntervalMonth
+	}
+	if q.Interval != IntervalMonth && q.Interval != IntervalQuarter {
+		return nil, errors.New("interval must be month or quarter")
+	}
+
+	// Share scales a line: 1 for an expense, minus the refunded part of the
+	// expense for a refund
+	type taxRow struct {
+		Date         time.Time
+		Refund       bool
+		Share        float64
+		TaxCode      string
+		TaxRate      float64
+		TaxAmount    float64
+		ExchangeRate float64
+		BaseAmount   float64
+	}
+	columns := "CASE WHEN expense_splits.id IS NULL THEN expenses.tax_code ELSE expense_splits.tax_code END AS tax_code, " +
+		"coalesce(expense_splits.tax_rate, expenses.tax_rate) AS tax_rate, " +
+		"coalesce(expense_splits.tax_amount, expenses.tax_amount) AS tax_amount, expenses.exchange_rate, " +
+		"coalesce(expense_splits.base_amount, expenses.base_amount) AS base_amount"
+	var rows []taxRow
+	query := db.DB.Model(&models.Expense{}).
+		Select("expenses.expense_date AS date, 0 AS refund, 1 AS share, "+columns).
+		Joins("LEFT JOIN expense_splits ON expense_splits.expense_id = expenses.id").
+		Where("expenses.status = ?", models.ExpenseStatusApproved).
+		Order("expenses.expense_date")
+	if err := q.Dates.apply(query, "expenses.expense_date").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	var refunds []taxRow
+	query = db.DB.Table("refunds").
+		Select("refunds.refund_date AS date, 1 AS refund, coalesce(-refunds.base_amount / nullif(expenses.base_amount, 0), 0) AS share, "+columns).
+		Joins("JOIN expenses ON expenses.id = refunds.expense_id").
+		Joins("LEFT JOIN expense_splits ON expense_splits.expense_id = expenses.id").
+		Where("expenses.deleted_at IS NULL AND expenses.status = ?", models.ExpenseStatusApproved).
+		Order("refunds.refund_date")
+	if err := q.Dates.apply(query, "refunds.refund_date").Scan(&refunds).Error; err != nil {
+		return nil, err
+	}
+
+	report := &TaxReport{
+		Currency: models.BaseCurrency(),
+		Interval: q.Interval,
+		Periods:  []TaxPeriod{},
+		Totals:   []TaxRateSummary{},
+	}
+	if !q.Dates.From.IsZero() {
+		report.From = &q.Dates.From
+	}
+	if !q.Dates.To.IsZero() {
+		report.To = &q.Dates.To
+	}
+
+	periods := make(map[time.Time]int)
+	for _, row := range append(rows, refunds...) {
+		code := row.TaxCode
+		if code == "" {
+			code = TaxCodeExempt
+		}
+		count := 1
+		if row.Refund {
+			count = 0
+		}
+		gross := roundAmount(row.BaseAmount * row.Share)
+		tax := roundAmount(row.TaxAmount * row.ExchangeRate * row.Share)
+		net := roundAmount(gross - tax)
+
+		start := bucketStart(row.Date, q.Interval, time.UTC)
+		i, ok := periods[start]
+		if !ok {
+			report.Periods = append(report.Periods, TaxPeriod{
+				Label: bucketLabel(start, q.Interval),
+				Start: start,
+				End:   nextBucket(start, q.Interval),
+				Rates: []TaxRateSummary{},
+			})
+			i = len(report.Periods) - 1
+			periods[start] = i
+		}
+		period := &report.Periods[i]
+		period.Rates = addTaxLine(period.Rates, code, row.TaxRate, count, net, tax, gross)
+		period.Net = roundAmount(period.Net + net)
+		period.Tax = roundAmount(period.Tax + tax)
+		period.Gross = roundAmount(period.Gross + gross)
+
+		report.Totals = addTaxLine(report.Totals, code, row.TaxRate, count, net, tax, gross)
+		report.Net = roundAmount(report.Net + net)
+		report.Tax = roundAmount(report.Tax + tax)
+		report.Gross = roundAmount(report.Gross + gross)
+	}
+	// Refunds can open periods after those of the expenses
+	sort.Slice(report.Periods, func(i, j int) bool {
+		return report.Periods[i].Start.Before(report.Periods[j].Start)
+	})
+	for i := range report.Periods {
+		sortTaxRates(report.Periods[i].Rates)
+	}
+	sortTaxRates(report.Totals)
+	return report, nil
+}
+
+// ExportTaxReport renders a tax summary as CSV for filing: one row per
+// period and rate, then the totals per rate.
+func (s *ReportingService) ExportTaxReport(q TaxReportQuery) (*ExportFile, error) {
+	report, err := s.GetTaxReport(q)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	rows := [][]string{{"period", "tax_code", "rate", "count", "net", "tax", "gross", "currency"}}
+	line := func(period string, r TaxRateSummary) []string {
+		return []string{
+			period,
+			r.TaxCode,
+			strconv.FormatFloat(r.Rate, 'f', -1, 64),
+			strconv.Itoa(r.Count),
+			fmt.Sprintf("%.2f", r.Net),
+			fmt.Sprintf("%.2f", r.Tax),
+			fmt.Sprintf("%.2f", r.Gross),
+			report.Currency,
+		}
+	}
+	for _, period := range report.Periods {
+		for _, r := range period.Rates {
+			rows = append(rows, line(period.Label, r))
+		}
+	}
+	for _, r := range report.Totals {
+		rows = append(rows, line("Total", r))
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+
+	name := "tax-summary"
+	if report.From != nil {
+		name += "-" + report.From.Format("20060102")
+	}
+	if report.To != nil {
+		name += "-" + report.To.Format("20060102")
+	}
+	return &ExportFile{Filename: name + ".csv", ContentType: "text/csv", Content: buf.Bytes()}, nil
+}
+
+// addTaxLine adds a line's amounts to the summary of its code and rate. count
+// is 0 for refunds, which do not add an expense.
+func addTaxLine(rates []TaxRateSummary, code string, rate float64, count int, net, tax, gross float64) []TaxRateSummary {
+	i := 0
+	for i < len(rates) && (rates[i].TaxCode != code || rates[i].Rate != rate) {
+		i++
+	}
+	if i == len(rates) {
+		rates = append(rates, TaxRateSummary{TaxCode: code, Rate: rate})
+	}
+	r := &rates[i]
+	r.Count += count
+	r.Net = roundAmount(r.Net + net)
+	r.Tax = roundAmount(r.Tax + tax)
+	r.Gross = roundAmount(r.Gross + gross)
+	return rates
+}
+
+// sortTaxRates orders rate summaries by rate, highest first, then code.
+func sortTaxRates(rates []TaxRateSummary) {
+	sort.Slice(rates, func(i, j int) bool {
+		if rates[i].Rate != rates[j].Rate {
+			return rates[i].Rate > rates[j].Rate
+		}
+		return rates[i].TaxCode < rates[j].TaxCode
+	})
+}
+
+// VendorSpend totals the spend at one vendor. VendorID is nil for spend not
+// linked to a vendor.
+type VendorSpend struct {
+	VendorID *uint   `json:"vendor_id"`
+	Vendor   string  `json:"vendor"`
+	Count    int     `json:"count"`
+	Total    float64 `json:"total"`
+}
+
+// VendorSpendReport ranks vendors by spend in the base currency.
+type VendorSpendReport struct {
+	From     *time.Time    `json:"from,omitempty"`
+	To       *time.Time    `json:"to,omitempty"`
+	Currency string        `json:"currency"`
+	Total    float64       `json:"total"`
+	Vendors  []VendorSpend `json:"vendors"`
+}
+
+// GetVendorSpendReport totals spend per vendor within dates: submitted
+// expenses that were not rejected, less refunds of them received within
+// dates, plus petty cash debits booked to a vendor that no expense claims.
+func (s *ReportingService) GetVendorSpendReport(dates DateRange) (*VendorSpendReport, error) {
+	type row struct {
+		VendorID *uint
+		Count    int
+		Total    float64
+	}
+	var expenses []row
+	query := db.DB.Model(&models.Expense{}).
+		Select("vendor_id, count(*) AS count, coalesce(sum(base_amount), 0) AS total").
+		Where("status NOT IN ?", models.UncountedExpenseStatuses).
+		Group("vendor_id")
+	if err := dates.apply(query, "expense_date").Scan(&expenses).Error; err != nil {
+		return nil, err
+	}
+	var refunds []row
+	query = db.DB.Table("refunds").
+		Select("expenses.vendor_id, 0 AS count, -coalesce(sum(refunds.base_amount), 0) AS total").
+		Joins("JOIN expenses ON expenses.id = refunds.expense_id").
+		Where("expenses.deleted_at IS NULL AND expenses.status NOT IN ?", models.UncountedExpenseStatuses).
+		Group("expenses.vendor_id")
+	if err := dates.apply(query, "refunds.refund_date").Scan(&refunds).Error; err != nil {
+		return nil, err
+	}
+	var debits []row
+	query = db.DB.Model(&models.PettyCashTransaction{}).
+		Select("vendor_id, count(*) AS count, coalesce(sum(base_amount), 0) AS total").
+		Where("type = ? AND vendor_id IS NOT NULL", models.TransactionTypeDebit).
+		Where("id NOT IN (SELECT petty_cash_transaction_id FROM expenses WHERE petty_cash_transaction_id IS NOT NULL AND deleted_at IS NULL)").
+		Group("vendor_id")
+	if err := dates.apply(query, "transaction_date").Scan(&debits).Error; err != nil {
+		return nil, err
+	}
+
+	var vendors []models.Vendor
+	if err := db.DB.Unscoped().Find(&vendors).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string, len(vendors))
+	for _, v := range vendors {
+		names[v.ID] = v.Name
+	}
+
+	report := &VendorSpendReport{Currency: models.BaseCurrency(), Vendors: []VendorSpend{}}
+	if !dates.From.IsZero() {
+		report.From = &dates.From
+	}
+	if !dates.To.IsZero() {
+		report.To = &dates.To
+	}
+	byVendor := make(map[uint]int)
+	unassigned := -1
+	for _, r := range append(append(expenses, refunds...), debits...) {
+		var i int
+		var ok bool
+		if r.VendorID == nil {
+			i, ok = unassigned, unassigned >= 0
+		} else {
+			i, ok = byVendor[*r.VendorID]
+		}
+		if !ok {
+			spend := VendorSpend{VendorID: r.VendorID, Vendor: UnassignedVendor}
+			if r.VendorID != nil {
+				spend.Vendor = names[*r.VendorID]
+			}
+			report.Vendors = append(report.Vendors, spend)
+			i = len(report.Vendors) - 1
+			if r.VendorID == nil {
+				unassigned = i
+			} else {
+				byVendor[*r.VendorID] = i
+			}
+		}
+		report.Vendors[i].Count += r.Count
+		report.Vendors[i].Total = roundAmount(report.Vendors[i].Total + r.Total)
+		report.Total = roundAmount(report.Total + r.Total)
+	}
+	sort.SliceStable(report.Vendors, func(i, j int) bool {
+		return report.Vendors[i].Total > report.Vendors[j].Total
+	})
+	return report, nil
+}
+
+// BankReconciliationReport lists what does not reconcile between the bank
+// account and petty cash: withdrawals on imported statements no top-up was
+// matched to, and top-ups no withdrawal was matched to. Totals are per
+// currency.
+type BankReconciliationReport struct {
+	From            *time.Time                    `json:"from,omitempty"`
+	To              *time.Time                    `json:"to,omitempty"`
+	UnmatchedLines  []models.BankStatementLine    `json:"unmatched_lines"`
+	UnmatchedTopUps []models.PettyCashTransaction `json:"unmatched_top_ups"`
+	LinesTotal      map[string]float64            `json:"lines_total"`
+	TopUpsTotal     map[string]float64            `json:"top_ups_total"`
+}
+
+// GetBankReconciliationReport lists the unmatched withdrawals booked and
+// top-ups dated within dates, the top-ups of one fund when fundID is not 0.
+// Ignored lines are left out.
+func (s *ReportingService) GetBankReconciliationReport(dates DateRange, fundID uint) (*BankReconciliationReport, error) {
+	report := &BankReconciliationReport{
+		UnmatchedLines:  []models.BankStatementLine{},
+		UnmatchedTopUps: []models.PettyCashTransaction{},
+		LinesTotal:      make(map[string]float64),
+		TopUpsTotal:     make(map[string]float64),
+	}
+	if !dates.From.IsZero() {
+		report.From = &dates.From
+	}
+	if !dates.To.IsZero() {
+		report.To = &dates.To
+	}
+
+	lines := db.DB.Where("status = ? AND amount < 0", models.BankLineStatusUnmatched).Order("booking_date, id")
+	if err := dates.apply(lines, "booking_date").Find(&report.UnmatchedLines).Error; err != nil {
+		return nil, err
+	}
+	for _, line := range report.UnmatchedLines {
+		report.LinesTotal[line.Currency] = roundAmount(report.LinesTotal[line.Currency] - line.Amount)
+	}
+
+	topUps := unmatchedTopUps(db.DB).Order("transaction_date, id")
+	if fundID != 0 {
+		topUps = topUps.Where("fund_id = ?", fundID)
+	}
+	if err := dates.apply(topUps, "transaction_date").Find(&report.UnmatchedTopUps).Error; err != nil {
+		return nil, err
+	}
+	for _, t := range report.UnmatchedTopUps {
+		report.TopUpsTotal[t.Currency] = roundAmount(report.TopUpsTotal[t.Currency] + t.Amount)
+	}
+	return report, nil
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// columnKind decides how the cells of an export column are formatted and
+// aligned.
+type columnKind int
+
+const (
+	columnText columnKind = iota
+	columnAmount
+	columnNumber
+	columnDate
+)
+
+// exportColumn is one column of a table export. Width is relative: PDF
+// columns share the page width in proportion to it, and XLSX columns are
+// Width characters wide.
+type exportColumn struct {
+	Name  string
+	Kind  columnKind
+	Width float64
+}
+
+// exportTable describes a table export. Title and Period head each page of
+// a PDF; CSV and XLSX exports are just the columns and rows.
+type exportTable struct {
+	Title   string
+	Period  string
+	Columns []exportColumn
+}
+
+// tableWriter writes a table export one row at a time, so rows can come
+// straight from a database cursor. Cells are given in column order as
+// strings, float64 amounts or numbers, ints and time.Time dates; nil is an
+// empty cell. Total rows come last and are set in bold where the format
+// allows.
+type tableWriter interface {
+	WriteRow(cells ...interface{}) error
+	WriteTotal(cells ...interface{}) error
+	Close() error
+}
+
+// checkExportFormat rejects formats tables cannot be exported in.
+func checkExportFormat(format string) error {
+	if _, ok := ExportContentTypes[format]; !ok {
+		return errors.New("format must be csv, xlsx or pdf")
+	}
+	return nil
+}
+
+// newTableWriter starts a table export in format on w, beginning with the
+// column headings.
+func newTableWriter(w io.Writer, format string, table exportTable) (tableWriter, error) {
+	switch format {
+	case ExportFormatCSV:
+		return newCSVTable(w, table)
+	case ExportFormatXLSX:
+		return newXLSXTable(w, table)
+	case ExportFormatPDF:
+		return newPDFTable(w, table)
+	}
+	return nil, checkExportFormat(format)
+}
+
+// tableStream wraps a table export as a download named after name and the
+// date range. write fills in the rows and totals; the table is closed after
+// it.
+func tableStream(name string, dates DateRange, format string, table exportTable, write func(t tableWriter) error) (*ExportStream, error) {
+	if err := checkExportFormat(format); err != nil {
+		return nil, err
+	}
+	if !dates.From.IsZero() {
+		name += "-" + dates.From.Format("20060102")
+	}
+	if !dates.To.IsZero() {
+		name += "-" + dates.To.Format("20060102")
+	}
+	return &ExportStream{
+		Filename:    name + "." + format,
+		ContentType: ExportContentTypes[format],
+		WriteTo: func(w io.Writer) error {
+			t, err := newTableWriter(w, format, table)
+			if err != nil {
+				return err
+			}
+			if err := write(t); err != nil {
+				return err
+			}
+			return t.Close()
+		},
+	}, nil
+}
+
+// periodLabel describes a date range for an export heading. To is
+// exclusive, so a range ending at midnight is shown up to the day before.
+func periodLabel(dates DateRange) string {
+	var from, to string
+	if !dates.From.IsZero() {
+		from = dates.From.Format("2006-01-02")
+	}
+	if !dates.To.IsZero() {
+		end := dates.To
+		if h, m, s := end.Clock(); h == 0 && m == 0 && s == 0 && end.Nanosecond() == 0 {
+			end = end.AddDate(0, 0, -1)
+		}
+		to = end.Format("2006-01-02")
+	}
+	switch {
+	case from != "" && to != "":
+		return from + " to " + to
+	case from != "":
+		return "From " + from
+	case to != "":
+		return "Up to " + to
+	}
+	return "All dates"
+}
+
+// formatCell renders a cell as plain text, the way CSV exports show it.
+func formatCell(kind columnKind, value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		if kind == columnAmount {
+			return fmt.Sprintf("%.2f", v)
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format("2006-01-02")
+	}
+	return fmt.Sprint(value)
+}
+
+// spreadsheetText keeps text that starts like a formula from being run as
+// one when the export is opened in a spreadsheet, by prefixing it with an
+// apostrophe.
+func spreadsheetText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// csvTable writes a table export as CSV: a heading row, then the rows and
+// totals.
+type csvTable struct {
+	w       *csv.Writer
+	columns []exportColumn
+}
+
+func newCSVTable(w io.Writer, table exportTable) (*csvTable, error) {
+	t := &csvTable{w: csv.NewWriter(w), columns: table.Columns}
+	names := make([]string, len(table.Columns))
+	for i, col := range table.Columns {
+		names[i] = col.Name
+	}
+	return t, t.w.Write(names)
+}
+
+func (t *csvTable) WriteRow(cells ...interface{}) error {
+	record := make([]string, len(t.columns))
+	for i, col := range t.columns {
+		if i >= len(cells) {
+			continue
+		}
+		record[i] = formatCell(col.Kind, cells[i])
+		if _, ok := cells[i].(string); ok {
+			record[i] = spreadsheetText(record[i])
+		}
+	}
+	return t.w.Write(record)
+}
+
+func (t *csvTable) WriteTotal(cells ...interface{}) error {
+	return t.WriteRow(cells...)
+}
+
+func (t *csvTable) Close() error {
+	t.w.Flush()
+	return t.w.Error()
+}
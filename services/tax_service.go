@@ -0,0 +1,195 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"ledgerly/db"
+	"ledgerly/models"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type TaxService struct{}
+
+// TaxCodeExempt is the tax code key of expenses booked without a tax code.
+const TaxCodeExempt = "EXEMPT"
+
+var taxIDPattern = regexp.MustCompile(`^[A-Z0-9]{4,20}$`)
+
+func (s *TaxService) CreateTaxCode(code *models.TaxCode) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := validateTaxCode(tx, code); err != nil {
+			return err
+		}
+		code.Active = true
+		return tx.Create(code).Error
+	})
+}
+
+// UpdateTaxCode replaces a tax code's settings. Expenses already booked keep
+// the code and rate they were booked with.
+func (s *TaxService) UpdateTaxCode(id uint, changes *models.TaxCode) (*models.TaxCode, error) {
+	var code models.TaxCode
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&code, id).Error; err != nil {
+			return err
+		}
+		code.Code = changes.Code
+		code.Name = changes.Name
+		code.Rate = changes.Rate
+		code.VendorTaxIDRequired = changes.VendorTaxIDRequired
+		code.Active = changes.Active
+		if err := validateTaxCode(tx, &code); err != nil {
+			return err
+		}
+		return tx.Save(&code).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+// DeleteTaxCode removes an unused tax code. Codes that have been used must be
+// deactivated instead.
+func (s *TaxService) DeleteTaxCode(id uint) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var code models.TaxCode
+		if err := tx.First(&code, id).Error; err != nil {
+			return err
+		}
+		var used, splits int64
+		if err := tx.Model(&models.Expense{}).Where("tax_code_id = ?", id).Count(&used).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.ExpenseSplit{}).Where("tax_code_id = ?", id).Count(&splits).Error; err != nil {
+			return err
+		}
+		if used+splits > 0 {
+			return errors.New("tax code is in use; deactivate it instead")
+		}
+		return tx.Delete(&code).Error
+	})
+}
+
+func (s *TaxService) GetTaxCode(id uint) (*models.TaxCode, error) {
+	var code models.TaxCode
+	if err := db.DB.First(&code, id).Error; err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+func (s *TaxService) ListTaxCodes(activeOnly bool) ([]models.TaxCode, error) {
+	var codes []models.TaxCode
+	query := db.DB.Order("code")
+	if activeOnly {
+		query = query.Where("active = ?", true)
+	}
+	err := query.Find(&codes).Error
+	return codes, err
+}
+
+func validateTaxCode(tx *gorm.DB, code *models.TaxCode) error {
+	code.Code = strings.ToUpper(strings.TrimSpace(code.Code))
+	code.Name = strings.TrimSpace(code.Name)
+	if code.Code == "" {
+		return errors.New("code is mandatory")
+	}
+	if code.Code == TaxCodeExempt {
+		return fmt.Errorf("%s is reserved for expenses without a tax code", TaxCodeExempt)
+	}
+	if code.Rate < 0 || code.Rate > 100 {
+		return errors.New("rate must be between 0 and 100")
+	}
+
+	var duplicates int64
+	if err := tx.Model(&models.TaxCode{}).Where("code = ? AND id <> ?", code.Code, code.ID).Count(&duplicates).Error; err != nil {
+		return err
+	}
+	if duplicates > 0 {
+		return errors.New("a tax code with this code already exists")
+	}
+	return nil
+}
+
+// applyTax books an expense to its tax code, given by ID or code, and splits
+// the gross amount into net and tax. Tax is rounded to cents and net is the
+// remainder, so the two always add up to the gross amount. Expenses without a
+// tax code are exempt.
+func applyTax(tx *gorm.DB, expense *models.Expense) error {
+	expense.Vendor = strings.TrimSpace(expense.Vendor)
+	vendorTaxID, err := normalizeTaxID(expense.VendorTaxID)
+	if err != nil {
+		return err
+	}
+	expense.VendorTaxID = vendorTaxID
+
+	code, err := resolveTaxCode(tx, expense)
+	if err != nil {
+		return err
+	}
+	if code == nil {
+		expense.TaxCodeID = nil
+		expense.TaxCode = ""
+		expense.TaxRate = 0
+	} else {
+		if code.VendorTaxIDRequired && expense.VendorTaxID == "" {
+			return fmt.Errorf("vendor_tax_id is required for %s expenses", code.Code)
+		}
+		expense.TaxCodeID = &code.ID
+		expense.TaxCode = code.Code
+		expense.TaxRate = code.Rate
+	}
+
+	expense.Amount = roundAmount(expense.Amount)
+	expense.TaxAmount = taxFromGross(expense.Amount, expense.TaxRate)
+	expense.NetAmount = roundAmount(expense.Amount - expense.TaxAmount)
+	return nil
+}
+
+// resolveTaxCode returns the active tax code of an expense, or nil if it has
+// none.
+func resolveTaxCode(tx *gorm.DB, expense *models.Expense) (*models.TaxCode, error) {
+	var code models.TaxCode
+	var err error
+	switch value := strings.TrimSpace(expense.TaxCode); {
+	case expense.TaxCodeID != nil:
+		err = tx.First(&code, *expense.TaxCodeID).Error
+	case value != "" && !strings.EqualFold(value, TaxCodeExempt):
+		err = tx.Where("code = ?", strings.ToUpper(value)).First(&code).Error
+	default:
+		return nil, nil
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("unknown tax code")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !code.Active {
+		return nil, fmt.Errorf("tax code %s is inactive", code.Code)
+	}
+	return &code, nil
+}
+
+// taxFromGross returns the tax included in a gross amount at rate percent,
+// rounded to cents.
+func taxFromGross(gross, rate float64) float64 {
+	if rate == 0 {
+		return 0
+	}
+	return roundAmount(gross * rate / (100 + rate))
+}
+
+// normalizeTaxID strips the spacing and punctuation vendors print tax IDs
+// with, e.g. "DE 123.456.789" becomes DE123456789.
+func normalizeTaxID(id string) (string, error) {
+	id = strings.ToUpper(strings.NewReplacer(" ", "", ".", "", "-", "", "/", "").Replace(id))
+	if id != "" && !taxIDPattern.MatchString(id) {
+		return "", errors.New("vendor_tax_id must be 4 to 20 letters and digits")
+	}
+	return id, nil
+}
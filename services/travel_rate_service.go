@@ -0,0 +1,218 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"ledgerly/db"
+	"ledgerly/models"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TravelRateService struct{}
+
+var (
+	vehicleTypePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+	destinationPattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9_.-]{0,31}$`)
+)
+
+// SetMileageRate creates or replaces the rate of a vehicle type from a date.
+func (s *TravelRateService) SetMileageRate(rate *models.MileageRate, userID string) error {
+	vehicleType := strings.ToLower(strings.TrimSpace(rate.VehicleType))
+	if !vehicleTypePattern.MatchString(vehicleType) {
+		return errors.New("vehicle_type must be a lowercase code such as car or motorcycle")
+	}
+	if rate.Rate <= 0 {
+		return errors.New("rate must be greater than zero")
+	}
+	if rate.EffectiveFrom.IsZero() {
+		return errors.New("effective_from is mandatory")
+	}
+	currency, err := normalizeCurrency(rate.Currency)
+	if err != nil {
+		return err
+	}
+
+	rate.ID = 0
+	rate.VehicleType = vehicleType
+	rate.EffectiveFrom = startOfDay(rate.EffectiveFrom)
+	rate.Currency = currency
+	rate.CreatedBy = userID
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "vehicle_type"}, {Name: "effective_from"}},
+			DoUpdates: clause.AssignmentColumns([]string{"rate", "currency", "created_by", "updated_at"}),
+		}).Create(rate).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("vehicle_type = ? AND effective_from = ?", rate.VehicleType, rate.EffectiveFrom).First(rate).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, "mileage_rate.set", "mileage_rate", rate.ID, userID, fmt.Sprintf("%s from %s = %g %s/km", rate.VehicleType, rate.EffectiveFrom.Format("2006-01-02"), rate.Rate, rate.Currency))
+	})
+}
+
+// ListMileageRates returns mileage rates, newest first per vehicle type. An
+// empty vehicleType means all vehicle types.
+func (s *TravelRateService) ListMileageRates(vehicleType string) ([]models.MileageRate, error) {
+	var rates []models.MileageRate
+	query := db.DB.Order("vehicle_type, effective_from desc")
+	if vehicleType != "" {
+		query = query.Where("vehicle_type = ?", strings.ToLower(vehicleType))
+	}
+	err := query.Find(&rates).Error
+	return rates, err
+}
+
+func (s *TravelRateService) DeleteMileageRate(id uint, userID string) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var rate models.MileageRate
+		if err := tx.First(&rate, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&rate).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, "mileage_rate.delete", "mileage_rate", rate.ID, userID, fmt.Sprintf("%s from %s", rate.VehicleType, rate.EffectiveFrom.Format("2006-01-02")))
+	})
+}
+
+// SetPerDiemRate creates or replaces the daily rate of a destination from a
+// date.
+func (s *TravelRateService) SetPerDiemRate(rate *models.PerDiemRate, userID string) error {
+	destination := strings.ToUpper(strings.TrimSpace(rate.Destination))
+	if !destinationPattern.MatchString(destination) {
+		return errors.New("destination must be an uppercase code such as DE or US-NYC")
+	}
+	if rate.DailyRate <= 0 {
+		return errors.New("daily_rate must be greater than zero")
+	}
+	if rate.EffectiveFrom.IsZero() {
+		return errors.New("effective_from is mandatory")
+	}
+	currency, err := normalizeCurrency(rate.Currency)
+	if err != nil {
+		return err
+	}
+
+	rate.ID = 0
+	rate.Destination = destination
+	rate.EffectiveFrom = startOfDay(rate.EffectiveFrom)
+	rate.Currency = currency
+	rate.CreatedBy = userID
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "destination"}, {Name: "effective_from"}},
+			DoUpdates: clause.AssignmentColumns([]string{"daily_rate", "currency", "created_by", "updated_at"}),
+		}).Create(rate).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("destination = ? AND effective_from = ?", rate.Destination, rate.EffectiveFrom).First(rate).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, "per_diem_rate.set", "per_diem_rate", rate.ID, userID, fmt.Sprintf("%s from %s = %g %s/day", rate.Destination, rate.EffectiveFrom.Format("2006-01-02"), rate.DailyRate, rate.Currency))
+	})
+}
+
+// ListPerDiemRates returns per diem rates, newest first per destination. An
+// empty destination means all destinations.
+func (s *TravelRateService) ListPerDiemRates(destination string) ([]models.PerDiemRate, error) {
+	var rates []models.PerDiemRate
+	query := db.DB.Order("destination, effective_from desc")
+	if destination != "" {
+		query = query.Where("destination = ?", strings.ToUpper(destination))
+	}
+	err := query.Find(&rates).Error
+	return rates, err
+}
+
+func (s *TravelRateService) DeletePerDiemRate(id uint, userID string) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var rate models.PerDiemRate
+		if err := tx.First(&rate, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&rate).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, "per_diem_rate.delete", "per_diem_rate", rate.ID, userID, fmt.Sprintf("%s from %s", rate.Destination, rate.EffectiveFrom.Format("2006-01-02")))
+	})
+}
+
+// applyTravelRate calculates the amount of a mileage or per diem expense
+// from the rate in force on its expense date and records the calculation.
+// The expense is claimed in the rate's currency. Receipt expenses are left
+// alone.
+func applyTravelRate(tx *gorm.DB, expense *models.Expense) error {
+	calc := expense.Calculation
+	switch expense.Type {
+	case "", models.ExpenseTypeReceipt:
+		expense.Type = models.ExpenseTypeReceipt
+		expense.Calculation = nil
+		return nil
+
+	case models.ExpenseTypeMileage:
+		if calc == nil || calc.VehicleType == "" || calc.Distance <= 0 {
+			return errors.New("mileage expenses need a vehicle_type and a distance greater than zero")
+		}
+		vehicleType := strings.ToLower(strings.TrimSpace(calc.VehicleType))
+		var rate models.MileageRate
+		err := tx.Where("vehicle_type = ? AND effective_from <= ?", vehicleType, expense.ExpenseDate.UTC()).
+			Order("effective_from desc").First(&rate).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("no %s mileage rate on or before %s", vehicleType, expense.ExpenseDate.Format("2006-01-02"))
+		}
+		if err != nil {
+			return err
+		}
+		*calc = models.ExpenseCalculation{
+			VehicleType:   rate.VehicleType,
+			Distance:      calc.Distance,
+			RateID:        rate.ID,
+			Rate:          rate.Rate,
+			Currency:      rate.Currency,
+			EffectiveFrom: rate.EffectiveFrom,
+			Formula:       fmt.Sprintf("%g km x %g %s", calc.Distance, rate.Rate, rate.Currency),
+		}
+		expense.Amount = roundAmount(calc.Distance * rate.Rate)
+
+	case models.ExpenseTypePerDiem:
+		if calc == nil || calc.Destination == "" || calc.Days <= 0 {
+			return errors.New("per diem expenses need a destination and days greater than zero")
+		}
+		destination := strings.ToUpper(strings.TrimSpace(calc.Destination))
+		var rate models.PerDiemRate
+		err := tx.Where("destination = ? AND effective_from <= ?", destination, expense.ExpenseDate.UTC()).
+			Order("effective_from desc").First(&rate).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("no per diem rate for %s on or before %s", destination, expense.ExpenseDate.Format("2006-01-02"))
+		}
+		if err != nil {
+			return err
+		}
+		*calc = models.ExpenseCalculation{
+			Destination:   rate.Destination,
+			Days:          calc.Days,
+			RateID:        rate.ID,
+			Rate:          rate.DailyRate,
+			Currency:      rate.Currency,
+			EffectiveFrom: rate.EffectiveFrom,
+			Formula:       fmt.Sprintf("%g days x %g %s", calc.Days, rate.DailyRate, rate.Currency),
+		}
+		expense.Amount = roundAmount(calc.Days * rate.DailyRate)
+
+	default:
+		return errors.New("type must be receipt, mileage or per_diem")
+	}
+
+	if expense.Amount <= 0 {
+		return errors.New("amount must be greater than zero")
+	}
+	expense.Currency = calc.Currency
+	return nil
+}
@@ -0,0 +1,373 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"ledgerly/db"
+	"ledgerly/models"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type VendorService struct{}
+
+// UnassignedVendor is the vendor key of spend not linked to a vendor.
+const UnassignedVendor = "unassigned"
+
+func (s *VendorService) CreateVendor(vendor *models.Vendor) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := validateVendor(tx, vendor); err != nil {
+			return err
+		}
+		vendor.Active = true
+		vendor.MergedIntoID = nil
+		return tx.Create(vendor).Error
+	})
+}
+
+// UpdateVendor replaces a vendor's details. Renaming a vendor renames it on
+// its expenses too.
+func (s *VendorService) UpdateVendor(id uint, changes *models.Vendor) (*models.Vendor, error) {
+	var vendor models.Vendor
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&vendor, id).Error; err != nil {
+			return err
+		}
+		oldName := vendor.Name
+
+		if name := strings.TrimSpace(changes.Name); name != "" {
+			vendor.Name = name
+		}
+		vendor.TaxID = changes.TaxID
+		vendor.Aliases = changes.Aliases
+		vendor.DefaultCategoryID = changes.DefaultCategoryID
+		vendor.Active = changes.Active
+		if err := validateVendor(tx, &vendor); err != nil {
+			return err
+		}
+		if err := tx.Save(&vendor).Error; err != nil {
+			return err
+		}
+
+		if vendor.Name == oldName {
+			return nil
+		}
+		// The vendor name is reference data, so it is renamed in closed
+		// periods too
+		return tx.Model(&models.Expense{}).Where("vendor_id = ?", vendor.ID).UpdateColumn("vendor", vendor.Name).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &vendor, nil
+}
+
+// DeleteVendor removes a vendor nothing is linked to. Vendors that have been
+// used must be deactivated or merged instead.
+func (s *VendorService) DeleteVendor(id uint) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var vendor models.Vendor
+		if err := tx.First(&vendor, id).Error; err != nil {
+			return err
+		}
+
+		var expenses, transactions int64
+		if err := tx.Model(&models.Expense{}).Where("vendor_id = ?", id).Count(&expenses).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.PettyCashTransaction{}).Where("vendor_id = ?", id).Count(&transactions).Error; err != nil {
+			return err
+		}
+		if expenses+transactions > 0 {
+			return errors.New("vendor is in use; deactivate or merge it instead")
+		}
+		return tx.Delete(&vendor).Error
+	})
+}
+
+func (s *VendorService) GetVendor(id uint) (*models.Vendor, error) {
+	var vendor models.Vendor
+	if err := db.DB.First(&vendor, id).Error; err != nil {
+		return nil, err
+	}
+	return &vendor, nil
+}
+
+// ListVendors returns vendors by name. A non-empty search matches names and
+// aliases containing it.
+func (s *VendorService) ListVendors(search string, activeOnly bool) ([]models.Vendor, error) {
+	var vendors []models.Vendor
+	query := db.DB.Order("name")
+	if activeOnly {
+		query = query.Where("active = ?", true)
+	}
+	if search = strings.TrimSpace(search); search != "" {
+		pattern := "%" + strings.ToLower(search) + "%"
+		query = query.Where("lower(name) LIKE ? OR lower(aliases) LIKE ?", pattern, pattern)
+	}
+	err := query.Find(&vendors).Error
+	return vendors, err
+}
+
+// MatchVendor returns the active vendor that text, such as an expense title,
+// most likely refers to, or nil if none matches.
+func (s *VendorService) MatchVendor(text string) (*models.Vendor, error) {
+	return matchVendor(db.DB, text)
+}
+
+// MergeVendors folds duplicate vendors into target: their expenses and
+// transactions move to it, their names become its aliases and it takes
+// their tax ID and default category where it has none.
+func (s *VendorService) MergeVendors(targetID uint, sourceIDs []uint, userID string) (*models.Vendor, error) {
+	if len(sourceIDs) == 0 {
+		return nil, errors.New("source_ids is required")
+	}
+
+	var target models.Vendor
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&target, targetID).Error; err != nil {
+			return err
+		}
+		var sources []models.Vendor
+		if err := tx.Where("id IN ?", sourceIDs).Find(&sources).Error; err != nil {
+			return err
+		}
+		if len(sources) != len(sourceIDs) {
+			return errors.New("vendor not found")
+		}
+
+		ids := make([]uint, 0, len(sources))
+		names := make([]string, 0, len(sources))
+		for _, source := range sources {
+			if source.ID == target.ID {
+				return errors.New("a vendor cannot be merged into itself")
+			}
+			ids = append(ids, source.ID)
+			names = append(names, source.Name)
+			target.Aliases = append(target.Aliases, source.Name)
+			target.Aliases = append(target.Aliases, source.Aliases...)
+			if target.TaxID == "" {
+				target.TaxID = source.TaxID
+			}
+			if target.DefaultCategoryID == nil {
+				target.DefaultCategoryID = source.DefaultCategoryID
+			}
+		}
+		target.Aliases = vendorAliases(target.Name, target.Aliases)
+		if err := tx.Save(&target).Error; err != nil {
+			return err
+		}
+
+		// Relinking is reference data, so it is allowed in closed periods
+		err := tx.Model(&models.Expense{}).Where("vendor_id IN ?", ids).
+			UpdateColumns(map[string]interface{}{"vendor_id": target.ID, "vendor": target.Name}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&models.PettyCashTransaction{}).Where("vendor_id IN ?", ids).UpdateColumn("vendor_id", target.ID).Error; err != nil {
+			return err
+		}
+		err = tx.Unscoped().Model(&models.Vendor{}).Where("id IN ? OR merged_into_id IN ?", ids, ids).
+			UpdateColumn("merged_into_id", target.ID).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("id IN ?", ids).Delete(&models.Vendor{}).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, "vendor.merge", "vendor", target.ID, userID, "merged "+strings.Join(names, ", "))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+func validateVendor(tx *gorm.DB, vendor *models.Vendor) error {
+	vendor.Name = strings.TrimSpace(vendor.Name)
+	if vendor.Name == "" {
+		return errors.New("name is mandatory")
+	}
+	taxID, err := normalizeTaxID(vendor.TaxID)
+	if err != nil {
+		return errors.New("tax_id must be 4 to 20 letters and digits")
+	}
+	vendor.TaxID = taxID
+	vendor.Aliases = vendorAliases(vendor.Name, vendor.Aliases)
+
+	var duplicates int64
+	if err := tx.Model(&models.Vendor{}).Where("lower(name) = lower(?) AND id <> ?", vendor.Name, vendor.ID).Count(&duplicates).Error; err != nil {
+		return err
+	}
+	if duplicates > 0 {
+		return errors.New("a vendor with this name already exists")
+	}
+
+	if vendor.DefaultCategoryID != nil {
+		if err := tx.First(&models.Category{}, *vendor.DefaultCategoryID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("default category not found")
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// vendorAliases trims aliases and drops blanks, repeats and the vendor's own
+// name.
+func vendorAliases(name string, aliases []string) []string {
+	seen := map[string]bool{categoryKey(name): true}
+	result := make([]string, 0, len(aliases))
+	for _, alias := range aliases {
+		alias = strings.TrimSpace(alias)
+		key := categoryKey(alias)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, alias)
+	}
+	return result
+}
+
+// applyVendor links an expense to its vendor: the one given by ID, or else
+// the one matching the vendor name or, without a name, the title. A linked
+// expense takes the vendor's name, and its tax ID and default category where
+// the expense has none. Unknown vendor names are kept as free text.
+func applyVendor(tx *gorm.DB, expense *models.Expense) error {
+	text := expense.Vendor
+	if strings.TrimSpace(text) == "" {
+		text = expense.Title
+	}
+	vendor, err := resolveVendor(tx, expense.VendorID, text)
+	if err != nil {
+		return err
+	}
+	expense.Vendor = strings.TrimSpace(expense.Vendor)
+	if vendor == nil {
+		expense.VendorID = nil
+		return nil
+	}
+
+	expense.VendorID = &vendor.ID
+	expense.Vendor = vendor.Name
+	if strings.TrimSpace(expense.VendorTaxID) == "" {
+		expense.VendorTaxID = vendor.TaxID
+	}
+	if expense.CategoryID == nil && strings.TrimSpace(expense.Category) == "" && vendor.DefaultCategoryID != nil {
+		categoryID := *vendor.DefaultCategoryID
+		expense.CategoryID = &categoryID
+	}
+	return nil
+}
+
+// resolveVendor returns the vendor with id, following merges, or else the
+// active vendor matching text. It returns nil if neither finds one.
+func resolveVendor(tx *gorm.DB, id *uint, text string) (*models.Vendor, error) {
+	if id == nil {
+		return matchVendor(tx, text)
+	}
+
+	var vendor models.Vendor
+	if err := tx.Unscoped().First(&vendor, *id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("vendor not found")
+		}
+		return nil, err
+	}
+	if vendor.MergedIntoID != nil {
+		mergedInto := *vendor.MergedIntoID
+		vendor = models.Vendor{}
+		if err := tx.First(&vendor, mergedInto).Error; err != nil {
+			return nil, err
+		}
+	} else if vendor.DeletedAt.Valid {
+		return nil, errors.New("vendor not found")
+	}
+	if !vendor.Active {
+		return nil, fmt.Errorf("vendor %s is inactive", vendor.Name)
+	}
+	return &vendor, nil
+}
+
+// matchVendor picks the active vendor text most likely refers to: one whose
+// name or an alias equals it ignoring case and punctuation, or else the one
+// with the longest name or alias whose words all appear in it, allowing one
+// typo in words of five letters or more.
+func matchVendor(tx *gorm.DB, text string) (*models.Vendor, error) {
+	key := categoryKey(text)
+	if key == "" {
+		return nil, nil
+	}
+	var vendors []models.Vendor
+	if err := tx.Where("active = ?", true).Order("id").Find(&vendors).Error; err != nil {
+		return nil, err
+	}
+
+	textWords := words(strings.ToLower(text))
+	var best *models.Vendor
+	bestLength := 0
+	for i := range vendors {
+		for _, name := range append([]string{vendors[i].Name}, vendors[i].Aliases...) {
+			candidate := categoryKey(name)
+			if candidate == key {
+				return &vendors[i], nil
+			}
+			if len(candidate) > bestLength && containsWords(textWords, words(strings.ToLower(name))) {
+				best, bestLength = &vendors[i], len(candidate)
+			}
+		}
+	}
+	return best, nil
+}
+
+// containsWords reports whether every word of name appears in text.
+func containsWords(text, name []string) bool {
+	if len(name) == 0 {
+		return false
+	}
+	for _, want := range name {
+		found := false
+		for _, have := range text {
+			if have == want || (len(want) >= 5 && len(have) >= 5 && withinOneEdit(have, want)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// withinOneEdit reports whether a and b differ by at most one inserted,
+// deleted or replaced character.
+func withinOneEdit(a, b string) bool {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) < len(rb) {
+		ra, rb = rb, ra
+	}
+	if len(ra)-len(rb) > 1 {
+		return false
+	}
+	i, j, edits := 0, 0, 0
+	for i < len(ra) && j < len(rb) {
+		if ra[i] == rb[j] {
+			i++
+			j++
+			continue
+		}
+		edits++
+		if edits > 1 {
+			return false
+		}
+		if len(ra) == len(rb) {
+			j++
+		}
+		i++
+	}
+	return edits+(len(ra)-i) <= 1
+}
@@ -0,0 +1,394 @@
+package services
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xlsxPackage is the subset of an Office Open XML workbook needed to read
+// its first worksheet as text.
+type xlsxPackage struct {
+	files map[string]*zip.File
+}
+
+// readXLSX returns the cells of the first worksheet of an XLSX workbook, one
+// slice per row. Empty rows are kept so row numbers match the spreadsheet.
+// Numbers are returned as stored, so dates come back as Excel serial numbers.
+func readXLSX(data []byte) ([][]string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.New("file is not a valid XLSX workbook")
+	}
+	pkg := &xlsxPackage{files: make(map[string]*zip.File)}
+	for _, f := range archive.File {
+		pkg.files[f.Name] = f
+	}
+
+	sheet, err := pkg.firstSheet()
+	if err != nil {
+		return nil, err
+	}
+	shared, err := pkg.sharedStrings()
+	if err != nil {
+		return nil, err
+	}
+
+	var doc struct {
+		Rows []struct {
+			Index int `xml:"r,attr"`
+			Cells []struct {
+				Ref    string `xml:"r,attr"`
+				Type   string `xml:"t,attr"`
+				Value  string `xml:"v"`
+				Inline struct {
+					Text string `xml:"t"`
+					Runs []struct {
+						Text string `xml:"t"`
+					} `xml:"r"`
+				} `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := pkg.decode(sheet, &doc); err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	for _, r := range doc.Rows {
+		index := r.Index
+		if index == 0 {
+			index = len(rows) + 1
+		}
+		for len(rows) < index {
+			rows = append(rows, nil)
+		}
+		var row []string
+		for i, c := range r.Cells {
+			col := i
+			if c.Ref != "" {
+				if col, err = xlsxColumn(c.Ref); err != nil {
+					return nil, err
+				}
+			}
+			value := c.Value
+			switch c.Type {
+			case "s":
+				n, err := strconv.Atoi(c.Value)
+				if err != nil || n < 0 || n >= len(shared) {
+					return nil, fmt.Errorf("cell %s refers to a missing shared string", c.Ref)
+				}
+				value = shared[n]
+			case "inlineStr":
+				value = c.Inline.Text
+				for _, run := range c.Inline.Runs {
+					value += run.Text
+				}
+			case "b":
+				value = map[string]string{"1": "TRUE", "0": "FALSE"}[c.Value]
+			}
+			for len(row) <= col {
+				row = append(row, "")
+			}
+			row[col] = value
+		}
+		rows[index-1] = row
+	}
+	return rows, nil
+}
+
+// firstSheet returns the path of the workbook's first worksheet.
+func (p *xlsxPackage) firstSheet() (string, error) {
+	var workbook struct {
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := p.decode("xl/workbook.xml", &workbook); err != nil {
+		return "", err
+	}
+	if len(workbook.Sheets) == 0 {
+		return "", errors.New("workbook has no sheets")
+	}
+
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := p.decode("xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return "", err
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID != workbook.Sheets[0].ID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/"), nil
+		}
+		return path.Join("xl", rel.Target), nil
+	}
+	return "", errors.New("workbook's first sheet is missing")
+}
+
+// sharedStrings returns the workbook's shared string table, if it has one.
+func (p *xlsxPackage) sharedStrings() ([]string, error) {
+	if _, ok := p.files["xl/sharedStrings.xml"]; !ok {
+		return nil, nil
+	}
+	var table struct {
+		Items []struct {
+			Text string `xml:"t"`
+			Runs []struct {
+				Text string `xml:"t"`
+			} `xml:"r"`
+		} `xml:"si"`
+	}
+	if err := p.decode("xl/sharedStrings.xml", &table); err != nil {
+		return nil, err
+	}
+	strs := make([]string, len(table.Items))
+	for i, item := range table.Items {
+		strs[i] = item.Text
+		for _, run := range item.Runs {
+			strs[i] += run.Text
+		}
+	}
+	return strs, nil
+}
+
+func (p *xlsxPackage) decode(name string, v interface{}) error {
+	f, ok := p.files[name]
+	if !ok {
+		return fmt.Errorf("XLSX workbook is missing %s", name)
+	}
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := xml.NewDecoder(io.LimitReader(r, 256<<20)).Decode(v); err != nil {
+		return fmt.Errorf("reading %s: %w", name, err)
+	}
+	return nil
+}
+
+// xlsxColumn returns the zero-based column of a cell reference such as AB12.
+func xlsxColumn(ref string) (int, error) {
+	col := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		col = col*26 + int(r-'A') + 1
+	}
+	if col == 0 {
+		return 0, fmt.Errorf("invalid cell reference %q", ref)
+	}
+	return col - 1, nil
+}
+
+// xlsxEpoch is day zero of Excel's 1900 date system, allowing for its
+// phantom 29 February 1900.
+var xlsxEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// xlsxDate converts an Excel serial date, with the time of day as the
+// fraction, to a time in UTC.
+func xlsxDate(serial float64) time.Time {
+	return xlsxEpoch.Add(time.Duration(serial * 24 * float64(time.Hour))).Round(time.Second)
+}
+
+// xlsxColumnName returns the letters of a zero-based column, the inverse of
+// xlsxColumn.
+func xlsxColumnName(col int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name
+}
+
+// Cell styles of xlsxStyles, by index.
+const (
+	xlsxStyleDefault = iota
+	xlsxStyleBold
+	xlsxStyleAmount
+	xlsxStyleBoldAmount
+	xlsxStyleDate
+)
+
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="5">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="4" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="4" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1" applyNumberFormat="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`</cellXfs></styleSheet>`
+
+// xlsxParts are the parts of a one-sheet workbook other than the sheet
+// itself and its name.
+var xlsxParts = []struct{ name, content string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+		`</Relationships>`},
+	{"xl/styles.xml", xlsxStyles},
+}
+
+// xlsxTable writes a table export as a one-sheet XLSX workbook. The sheet is
+// the last part of the archive, so its rows are compressed and written as
+// they come. Amounts and dates are stored as numbers with a display format,
+// so they stay usable in formulas.
+type xlsxTable struct {
+	archive *zip.Writer
+	sheet   *bufio.Writer
+	columns []exportColumn
+	row     int
+}
+
+func newXLSXTable(w io.Writer, table exportTable) (*xlsxTable, error) {
+	archive := zip.NewWriter(w)
+	for _, part := range xlsxParts {
+		f, err := archive.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	// Sheet names are at most 31 characters and cannot contain []:*?/\
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return -1
+		}
+		return r
+	}, table.Title)
+	if runes := []rune(name); len(runes) > 31 {
+		name = string(runes[:31])
+	}
+	if strings.TrimSpace(name) == "" {
+		name = "Sheet1"
+	}
+	f, err := archive.Create("xl/workbook.xml")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(f, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="`+xlsxEscape(name)+`" sheetId="1" r:id="rId1"/></sheets></workbook>`); err != nil {
+		return nil, err
+	}
+
+	f, err = archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	t := &xlsxTable{archive: archive, sheet: bufio.NewWriter(f), columns: table.Columns}
+	t.sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	// Keep the headings in view while scrolling
+	t.sheet.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews><cols>`)
+	for i, col := range table.Columns {
+		fmt.Fprintf(t.sheet, `<col min="%d" max="%d" width="%g" customWidth="1"/>`, i+1, i+1, col.Width)
+	}
+	t.sheet.WriteString(`</cols><sheetData>`)
+
+	names := make([]interface{}, len(table.Columns))
+	for i, col := range table.Columns {
+		names[i] = col.Name
+	}
+	return t, t.writeRow(names, true)
+}
+
+func (t *xlsxTable) WriteRow(cells ...interface{}) error {
+	return t.writeRow(cells, false)
+}
+
+func (t *xlsxTable) WriteTotal(cells ...interface{}) error {
+	return t.writeRow(cells, true)
+}
+
+func (t *xlsxTable) writeRow(cells []interface{}, bold bool) error {
+	t.row++
+	fmt.Fprintf(t.sheet, `<row r="%d">`, t.row)
+	for i, value := range cells {
+		if value == nil || i >= len(t.columns) {
+			continue
+		}
+		ref := xlsxColumnName(i) + strconv.Itoa(t.row)
+		style := xlsxStyleDefault
+		if bold {
+			style = xlsxStyleBold
+		}
+		switch v := value.(type) {
+		case float64:
+			if t.columns[i].Kind == columnAmount {
+				style = xlsxStyleAmount
+				if bold {
+					style = xlsxStyleBoldAmount
+				}
+			}
+			fmt.Fprintf(t.sheet, `<c r="%s" s="%d"><v>%s</v></c>`, ref, style, strconv.FormatFloat(v, 'f', -1, 64))
+		case int:
+			fmt.Fprintf(t.sheet, `<c r="%s" s="%d"><v>%d</v></c>`, ref, style, v)
+		case time.Time:
+			if v.IsZero() {
+				continue
+			}
+			day := time.Date(v.Year(), v.Month(), v.Day(), 0, 0, 0, 0, time.UTC)
+			fmt.Fprintf(t.sheet, `<c r="%s" s="%d"><v>%d</v></c>`, ref, xlsxStyleDate, int(day.Sub(xlsxEpoch).Hours()/24))
+		case string:
+			fmt.Fprintf(t.sheet, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`,
+				ref, style, xlsxEscape(spreadsheetText(v)))
+		default:
+			fmt.Fprintf(t.sheet, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`,
+				ref, style, xlsxEscape(formatCell(t.columns[i].Kind, value)))
+		}
+	}
+	_, err := t.sheet.WriteString(`</row>`)
+	return err
+}
+
+func (t *xlsxTable) Close() error {
+	t.sheet.WriteString(`</sheetData></worksheet>`)
+	if err := t.sheet.Flush(); err != nil {
+		return err
+	}
+	return t.archive.Close()
+}
+
+func xlsxEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}